@@ -0,0 +1,33 @@
+package litefs
+
+import (
+	"sync/atomic"
+)
+
+var (
+	activeGoroutines atomic.Int64
+	openConnections  atomic.Int64
+)
+
+// ActiveGoroutines returns the number of background goroutines started by
+// this package that haven't exited, e.g. those of subscriptions, monitors and
+// brokers that are still open. It drops back to zero once everything has been
+// closed, which makes leaks visible.
+func ActiveGoroutines() int64 {
+	return activeGoroutines.Load()
+}
+
+// OpenConnections returns the number of event stream connections to LiteFS
+// currently open.
+func OpenConnections() int64 {
+	return openConnections.Load()
+}
+
+// spawn runs fn in a goroutine counted by ActiveGoroutines.
+func spawn(fn func()) {
+	activeGoroutines.Add(1)
+	go func() {
+		defer activeGoroutines.Add(-1)
+		fn()
+	}()
+}
@@ -0,0 +1,363 @@
+package litefs
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AdminRecentEvents is the number of recent events shown by AdminHandler.
+const AdminRecentEvents = 50
+
+// AdminCSRFHeader carries the CSRF token of AdminHandler's actions for clients
+// that don't post forms. Forms send it as the "csrf" field.
+const AdminCSRFHeader = "Litefs-Csrf-Token"
+
+// AdminStatus is the status reported by AdminHandler.
+type AdminStatus struct {
+	IsPrimary   bool              `json:"isPrimary"`
+	Primary     string            `json:"primary"`
+	Error       string            `json:"error,omitempty"`
+	Nodes       []NodeRecord      `json:"nodes,omitempty"`
+	Databases   []AdminDatabase   `json:"databases"`
+	Events      []AdminEvent      `json:"events"`
+	Subscribers []SubscriberStats `json:"subscribers,omitempty"`
+	Latency     *LatencySnapshot  `json:"latency,omitempty"`
+}
+
+// AdminDatabase is the replication status of one database.
+type AdminDatabase struct {
+	Name      string    `json:"name"`
+	Pos       Pos       `json:"pos"`
+	LastTx    time.Time `json:"lastTx,omitempty"`
+	LastTxAge string    `json:"lastTxAge,omitempty"`
+}
+
+// AdminEvent is an event received by AdminHandler.
+type AdminEvent struct {
+	ReceivedAt time.Time `json:"receivedAt"`
+	Event      *Event    `json:"event"`
+}
+
+// AdminHandler is an embeddable http.Handler showing cluster topology,
+// database positions and recent events as HTML at its root and as JSON at
+// "status.json".
+//
+// If Client and Authorize are both set, the node can also be promoted and
+// demoted, and databases exported, by posting to "promote", "demote" and "export" with the database
+// named by the "db" field. The page includes forms for them. Actions must
+// carry the CSRF token embedded in the page, so that other sites can't make
+// them on behalf of a logged in operator.
+type AdminHandler struct {
+	// Dir is the LiteFS mount directory whose databases are reported.
+	Dir string
+
+	// Monitor reports the primary.
+	Monitor *PrimaryMonitor
+
+	// Registry, if set, lists the application nodes.
+	Registry *NodeRegistry
+
+	// Broker, if set, has the statistics of its subscribers reported.
+	Broker *EventBroker
+
+	// Latency, if set, reports replication latency between nodes.
+	Latency *LatencyMap
+
+	// Client, if set, makes the actions through the LiteFS API. Actions are
+	// refused unless Authorize is also set, so that they are never exposed
+	// without access control.
+	Client *Client
+
+	// Authorize, if set, is called for every request. Requests for which it
+	// returns false receive a 403 Forbidden response.
+	Authorize func(r *http.Request) bool
+
+	es EventSource
+	m  sync.Mutex
+
+	csrfOnce  sync.Once
+	csrfToken string
+
+	events []AdminEvent
+	lastTx map[string]time.Time
+}
+
+// NewAdminHandler returns a new *AdminHandler for databases mounted in dir that
+// subscribes to the local LiteFS node's event stream.
+func NewAdminHandler(dir string, monitor *PrimaryMonitor) *AdminHandler {
+	h := &AdminHandler{
+		Dir:     dir,
+		Monitor: monitor,
+		es:      NewEventSource(),
+		lastTx:  make(map[string]time.Time),
+	}
+
+	spawn(h.run)
+
+	return h
+}
+
+// Close unsubscribes to the local LiteFS node's event stream.
+func (h *AdminHandler) Close() {
+	h.es.Close()
+}
+
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Authorize != nil && !h.Authorize(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	switch action := path.Base(r.URL.Path); action {
+	case "promote", "demote", "export":
+		h.serveAction(w, r, action)
+		return
+	}
+
+	status := h.Status(r.Context())
+
+	if strings.HasSuffix(r.URL.Path, "status.json") {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = adminTemplate.Execute(w, adminPage{AdminStatus: status, Actions: h.actions(), CSRFToken: h.csrf()})
+}
+
+// adminPage is the data of the HTML page.
+type adminPage struct {
+	*AdminStatus
+	Actions   bool
+	CSRFToken string
+}
+
+// actions reports whether actions are enabled.
+func (h *AdminHandler) actions() bool {
+	return h.Client != nil && h.Authorize != nil
+}
+
+// serveAction makes a POSTed action, redirecting back to the page once it is
+// done, except for exports, which are downloaded.
+func (h *AdminHandler) serveAction(w http.ResponseWriter, r *http.Request, action string) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	} else if !h.actions() {
+		http.NotFound(w, r)
+		return
+	}
+
+	token := r.Header.Get(AdminCSRFHeader)
+	if token == "" {
+		token = r.PostFormValue("csrf")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(h.csrf())) != 1 {
+		http.Error(w, "invalid CSRF token", http.StatusForbidden)
+		return
+	}
+
+	var err error
+	switch action {
+	case "promote":
+		err = h.Client.Promote(r.Context())
+	case "demote":
+		err = h.Client.Demote(r.Context())
+	case "export":
+		db := r.PostFormValue("db")
+		if !validDatabaseName(db) {
+			http.Error(w, "invalid database name", http.StatusBadRequest)
+			return
+		}
+		h.serveExport(w, r, db)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	http.Redirect(w, r, "./", http.StatusSeeOther)
+}
+
+// serveExport downloads a snapshot of db.
+func (h *AdminHandler) serveExport(w http.ResponseWriter, r *http.Request, db string) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+db+`"`)
+
+	var started bool
+	err := h.Client.Export(r.Context(), db, w, WithProgress(func(n, total int64) { started = true }))
+	if err != nil && !started {
+		w.Header().Del("Content-Disposition")
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
+
+// csrf returns the token actions must carry. It is random for each handler.
+func (h *AdminHandler) csrf() string {
+	h.csrfOnce.Do(func() {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		h.csrfToken = hex.EncodeToString(b)
+	})
+	return h.csrfToken
+}
+
+// Status returns the current cluster status.
+func (h *AdminHandler) Status(ctx context.Context) *AdminStatus {
+	status := &AdminStatus{}
+
+	if h.Monitor != nil {
+		var err error
+		if status.IsPrimary, err = h.Monitor.IsPrimary(); err != nil {
+			status.Error = err.Error()
+		}
+		status.Primary, _ = h.Monitor.Hostname()
+	}
+
+	if h.Registry != nil {
+		nodes, err := h.Registry.Nodes(ctx)
+		if err != nil {
+			status.Error = err.Error()
+		}
+		status.Nodes = nodes
+	}
+
+	if h.Broker != nil {
+		status.Subscribers = h.Broker.Stats()
+	}
+
+	if h.Latency != nil {
+		latency, err := h.Latency.Snapshot(ctx)
+		if err != nil {
+			status.Error = err.Error()
+		}
+		status.Latency = latency
+	}
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	paths, _ := filepath.Glob(filepath.Join(h.Dir, "*"+PosSuffix))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), PosSuffix)
+		db := AdminDatabase{Name: name, LastTx: h.lastTx[name]}
+		if pos, err := ReadPos(filepath.Join(h.Dir, name)); err == nil {
+			db.Pos = pos
+		} else if !os.IsNotExist(err) {
+			status.Error = err.Error()
+		}
+		if !db.LastTx.IsZero() {
+			db.LastTxAge = time.Since(db.LastTx).Round(time.Millisecond).String()
+		}
+		status.Databases = append(status.Databases, db)
+	}
+	sort.Slice(status.Databases, func(i, j int) bool { return status.Databases[i].Name < status.Databases[j].Name })
+
+	status.Events = make([]AdminEvent, len(h.events))
+	for i, e := range h.events {
+		status.Events[len(h.events)-1-i] = e
+	}
+
+	return status
+}
+
+func (h *AdminHandler) run() {
+	for {
+		select {
+		case event, running := <-h.es.C():
+			if !running {
+				return
+			}
+			h.observe(event)
+		case _, running := <-h.es.ErrC():
+			if !running {
+				return
+			}
+		}
+	}
+}
+
+func (h *AdminHandler) observe(event *Event) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	now := time.Now()
+	if event.Type == EventTypeTx {
+		h.lastTx[event.DB] = now
+	}
+
+	h.events = append(h.events, AdminEvent{ReceivedAt: now, Event: event})
+	if len(h.events) > AdminRecentEvents {
+		h.events = h.events[len(h.events)-AdminRecentEvents:]
+	}
+}
+
+var adminTemplate = template.Must(template.New("admin").Parse(`<!DOCTYPE html>
+<html>
+<head><title>LiteFS</title></head>
+<body>
+<h1>LiteFS</h1>
+{{if .Error}}<p><strong>Error:</strong> {{.Error}}</p>{{end}}
+<p>This node is the {{if .IsPrimary}}primary{{else}}replica of <strong>{{.Primary}}</strong>{{end}}.</p>
+{{if .Actions}}
+<form method="post" action="{{if .IsPrimary}}demote{{else}}promote{{end}}">
+<input type="hidden" name="csrf" value="{{.CSRFToken}}">
+<button>{{if .IsPrimary}}Demote{{else}}Promote{{end}}</button>
+</form>
+{{end}}
+
+{{if .Nodes}}
+<h2>Nodes</h2>
+<table>
+<tr><th>ID</th><th>Region</th><th>Role</th><th>Version</th><th>Heartbeat</th></tr>
+{{range .Nodes}}<tr><td>{{.ID}}</td><td>{{.Region}}</td><td>{{.Role}}</td><td>{{.Version}}</td><td>{{.HeartbeatAt.Format "15:04:05"}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Databases</h2>
+<table>
+<tr><th>Name</th><th>Position</th><th>Last tx</th>{{if .Actions}}<th></th>{{end}}</tr>
+{{range .Databases}}<tr><td>{{.Name}}</td><td>{{.Pos}}</td><td>{{.LastTxAge}}</td>
+{{- if $.Actions}}<td><form method="post" action="export"><input type="hidden" name="csrf" value="{{$.CSRFToken}}"><input type="hidden" name="db" value="{{.Name}}"><button>Export</button></form></td>{{end}}</tr>
+{{end}}</table>
+
+{{if .Subscribers}}
+<h2>Subscribers</h2>
+<table>
+<tr><th>Label</th><th>Delivered</th><th>Dropped</th><th>Pending</th><th>Lag</th></tr>
+{{range .Subscribers}}<tr><td>{{.Label}}</td><td>{{.Delivered}}</td><td>{{.Dropped}}</td><td>{{.Pending}}</td><td>{{.Lag}}</td></tr>
+{{end}}</table>
+{{end}}
+
+{{with .Latency}}
+<h2>Replication latency</h2>
+<table>
+<tr><th>From</th><th>To</th><th>Probes</th><th>Mean</th><th>p99</th></tr>
+{{range .Regions}}<tr><td>{{.From}}</td><td>{{.To}}</td><td>{{.Count}}</td><td>{{.Mean}}</td><td>{{.P99}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h2>Recent events</h2>
+<table>
+<tr><th>Received</th><th>Type</th><th>DB</th></tr>
+{{range .Events}}<tr><td>{{.ReceivedAt.Format "15:04:05.000"}}</td><td>{{.Event.Type}}</td><td>{{.Event.DB}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
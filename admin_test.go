@@ -0,0 +1,170 @@
+package litefs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler(t *testing.T) {
+	mockServer(t, initEventJSON, txEventJSON, flush, sleep10)
+	dir := t.TempDir()
+	writePosFile(t, filepath.Join(dir, "db"), "0000000000000027/83b05248774ce767")
+
+	h := NewAdminHandler(dir, nil)
+	t.Cleanup(h.Close)
+	time.Sleep(20 * time.Millisecond)
+
+	t.Run("json", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+
+		var status AdminStatus
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(status.Databases) != 1 || status.Databases[0].Pos.TXID != 0x27 || status.Databases[0].LastTx.IsZero() {
+			t.Fatalf("wrong databases: %#v", status.Databases)
+		}
+		if len(status.Events) < 2 || status.Events[0].Event.Type != EventTypeTx {
+			t.Fatalf("wrong events: %#v", status.Events)
+		}
+	})
+
+	t.Run("html", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if !strings.Contains(w.Body.String(), "0000000000000027/83b05248774ce767") {
+			t.Fatalf("position missing from page:\n%s", w.Body)
+		}
+	})
+
+	t.Run("subscribers", func(t *testing.T) {
+		b := mockServerBroker(t, hold)
+		sub := b.Subscribe(WithLabel("cache"))
+		go b.Publish(initEvent)
+		assertReadEvent(t, sub, initEvent)
+
+		h.Broker = b
+		defer func() { h.Broker = nil }()
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/status.json", nil))
+
+		var status AdminStatus
+		if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(status.Subscribers) != 1 || status.Subscribers[0].Label != "cache" {
+			t.Fatalf("wrong subscribers: %#v", status.Subscribers)
+		}
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		h.Authorize = func(r *http.Request) bool { return false }
+		defer func() { h.Authorize = nil }()
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusForbidden {
+			t.Fatalf("expected 403, got %d", w.Code)
+		}
+	})
+}
+
+func TestAdminHandlerActions(t *testing.T) {
+	mockServer(t, initEventJSON, hold)
+	h := NewAdminHandler(t.TempDir(), nil)
+	t.Cleanup(h.Close)
+
+	// role changes wait for the client's own subscription.
+	src := newFakeSource()
+	useEventSource(t, func(...SubscribeOption) EventSource { return src })
+
+	var promoted bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/promote":
+			promoted = true
+			go func() { src.c <- pChangeNode1Event }()
+		case "/export":
+			if r.URL.Query().Get("name") != "app.db" {
+				http.Error(w, "not found", http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write([]byte("SQLite format 3\x00"))
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(s.Close)
+	h.Client = NewClient("")
+	h.Client.URL = s.URL
+
+	// actions are refused without Authorize.
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/promote", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 without Authorize, got %d", w.Code)
+	}
+	h.Authorize = func(r *http.Request) bool { return true }
+
+	// the token is taken from the page, as a browser would.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	m := regexp.MustCompile(`name="csrf" value="([0-9a-f]+)"`).FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("CSRF token missing from page:\n%s", w.Body)
+	}
+	token := m[1]
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	for _, tt := range []struct {
+		name string
+		path string
+		form url.Values
+		code int
+	}{
+		{"no token", "/promote", nil, http.StatusForbidden},
+		{"wrong token", "/promote", url.Values{"csrf": {"0123"}}, http.StatusForbidden},
+		{"invalid db", "/export", url.Values{"csrf": {token}, "db": {"../app.db"}}, http.StatusBadRequest},
+		{"export failed", "/export", url.Values{"csrf": {token}, "db": {"other.db"}}, http.StatusBadGateway},
+	} {
+		if w := post(tt.path, tt.form); w.Code != tt.code {
+			t.Fatalf("%s: expected %d, got %d", tt.name, tt.code, w.Code)
+		}
+	}
+	if promoted {
+		t.Fatal("expected no promotion without a valid token")
+	}
+
+	if w := post("/promote", url.Values{"csrf": {token}}); w.Code != http.StatusSeeOther || !promoted {
+		t.Fatalf("expected promotion and redirect, got %d", w.Code)
+	}
+
+	w = post("/export", url.Values{"csrf": {token}, "db": {"app.db"}})
+	if w.Code != http.StatusOK || w.Body.String() != "SQLite format 3\x00" || !strings.Contains(w.Header().Get("Content-Disposition"), `"app.db"`) {
+		t.Fatalf("unexpected export: %d %q %v", w.Code, w.Body, w.Header())
+	}
+
+	// actions can't be made with GET requests.
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/demote?csrf="+token, nil))
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != http.MethodPost {
+		t.Fatalf("expected 405, got %d", w.Code)
+	}
+}
@@ -0,0 +1,327 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWriteShed = errors.New("write shed: primary is saturated")
+)
+
+// PriorityHeader is the request header the admission middleware reads to
+// determine the priority of a write. Valid values are "low", "normal" and
+// "high".
+const PriorityHeader = "Litefs-Priority"
+
+// Priority tags a write with how important it is to admit it when the primary
+// is saturated. The zero value is PriorityNormal.
+type Priority int
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+// ParsePriority parses "low", "normal" or "high" into a Priority.
+func ParsePriority(s string) (Priority, bool) {
+	switch strings.ToLower(s) {
+	case "low":
+		return PriorityLow, true
+	case "normal", "":
+		return PriorityNormal, true
+	case "high":
+		return PriorityHigh, true
+	default:
+		return PriorityNormal, false
+	}
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx tagged with the write priority p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the write priority ctx was tagged with, or
+// PriorityNormal if it wasn't tagged.
+func PriorityFromContext(ctx context.Context) Priority {
+	p, _ := ctx.Value(priorityKey{}).(Priority)
+	return p
+}
+
+// Admission is the decision an AdmissionController makes about a write.
+type Admission int
+
+const (
+	AdmissionAccept Admission = iota
+	AdmissionQueue
+	AdmissionShed
+)
+
+func (a Admission) String() string {
+	switch a {
+	case AdmissionAccept:
+		return "accept"
+	case AdmissionQueue:
+		return "queue"
+	case AdmissionShed:
+		return "shed"
+	default:
+		return "Admission(" + strconv.Itoa(int(a)) + ")"
+	}
+}
+
+// admissionRateWindow is the time constant of the decaying tx rate average.
+const admissionRateWindow = time.Second
+
+// admissionLatencyWindow is the time constant over which the latency average
+// decays towards zero while no latencies are observed. Without it, shedding low
+// priority writes could stop the samples that would end the shedding.
+const admissionLatencyWindow = 5 * time.Second
+
+// admissionPollInterval is how often queued writes recheck saturation.
+const admissionPollInterval = 10 * time.Millisecond
+
+// AdmissionController watches tx event throughput and halt latency and decides
+// whether low-priority writes should be admitted, queued or shed while the
+// primary is saturated. Normal and high priority writes are always admitted.
+//
+// The exported fields configure the controller and must be set before it is
+// used.
+type AdmissionController struct {
+	// MaxTxRate is the tx events per second above which the primary is
+	// considered saturated. Zero disables the check.
+	MaxTxRate float64
+
+	// MaxLatency is the halt latency above which the primary is considered
+	// saturated. Zero disables the check.
+	MaxLatency time.Duration
+
+	// QueueTimeout is how long low-priority writes wait for the primary to
+	// recover before being shed. Zero sheds them immediately.
+	QueueTimeout time.Duration
+
+	// Config, if set, supplies MaxTxRate, MaxLatency and QueueTimeout in
+	// place of the fields above so that they can be tuned at runtime.
+	Config *LiveConfig
+
+	es EventSource
+	m  sync.Mutex
+
+	rate      float64
+	rateAt    time.Time
+	latency   time.Duration
+	latencyAt time.Time
+}
+
+// NewAdmissionController returns a new *AdmissionController that subscribes to
+// the local LiteFS node's event stream.
+func NewAdmissionController() *AdmissionController {
+	ac := &AdmissionController{
+		es: NewEventSource(),
+	}
+
+	spawn(ac.run)
+
+	return ac
+}
+
+// Close unsubscribes to the local LiteFS node's event stream.
+func (ac *AdmissionController) Close() {
+	ac.es.Close()
+}
+
+// TxRate returns the recent rate of tx events per second.
+func (ac *AdmissionController) TxRate() float64 {
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	return ac.decayedRate(time.Now())
+}
+
+// Latency returns the moving average of observed halt latencies, decayed
+// towards zero over the time since the last observation.
+func (ac *AdmissionController) Latency() time.Duration {
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	return ac.decayedLatency(time.Now())
+}
+
+// ObserveLatency records the latency of a halt or forwarded write. It is
+// called automatically by AdmissionController.WithHalt; writes made any other
+// way must record their latency themselves.
+func (ac *AdmissionController) ObserveLatency(d time.Duration) {
+	ac.observeLatency(d, time.Now())
+}
+
+func (ac *AdmissionController) observeLatency(d time.Duration, now time.Time) {
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	if ac.latencyAt.IsZero() {
+		ac.latency = d
+	} else {
+		ac.latency = (ac.decayedLatency(now)*7 + d) / 8
+	}
+	ac.latencyAt = now
+}
+
+// Saturated reports whether the primary is currently considered saturated.
+func (ac *AdmissionController) Saturated() bool {
+	maxTxRate, maxLatency, _ := ac.limits()
+	if maxTxRate > 0 && ac.TxRate() > maxTxRate {
+		return true
+	}
+	if maxLatency > 0 && ac.Latency() > maxLatency {
+		return true
+	}
+	return false
+}
+
+// limits returns the thresholds in effect, from Config if it is set.
+func (ac *AdmissionController) limits() (maxTxRate float64, maxLatency, queueTimeout time.Duration) {
+	if ac.Config != nil {
+		c := ac.Config.Load()
+		return c.MaxTxRate, c.MaxLatency, c.QueueTimeout
+	}
+	return ac.MaxTxRate, ac.MaxLatency, ac.QueueTimeout
+}
+
+// Decide returns the admission decision for a write with priority p.
+func (ac *AdmissionController) Decide(p Priority) Admission {
+	if p >= PriorityNormal || !ac.Saturated() {
+		return AdmissionAccept
+	}
+	if _, _, queueTimeout := ac.limits(); queueTimeout > 0 {
+		return AdmissionQueue
+	}
+	return AdmissionShed
+}
+
+// Wait blocks until a write with the priority ctx is tagged with may proceed.
+// ErrWriteShed is returned if the write is shed, either immediately or because
+// the primary didn't recover within QueueTimeout.
+func (ac *AdmissionController) Wait(ctx context.Context) error {
+	switch ac.Decide(PriorityFromContext(ctx)) {
+	case AdmissionAccept:
+		return nil
+	case AdmissionShed:
+		return ErrWriteShed
+	}
+
+	_, _, queueTimeout := ac.limits()
+	timer := time.NewTimer(queueTimeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(admissionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !ac.Saturated() {
+				return nil
+			}
+		case <-timer.C:
+			return ErrWriteShed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// WithHalt is like the package-level WithHalt, but first waits for admission
+// and records how long the HALT lock took to acquire.
+func (ac *AdmissionController) WithHalt(ctx context.Context, databasePath string, fn func() error) error {
+	if err := ac.Wait(ctx); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	return WithHaltContext(ctx, databasePath, func() error {
+		ac.ObserveLatency(time.Since(start))
+		return fn()
+	})
+}
+
+// Middleware returns an http.Handler that applies admission control to write
+// requests before passing them to next. The priority is taken from the request
+// context (see WithPriority) or the PriorityHeader. Shed requests receive a 503
+// response with a Retry-After header.
+func (ac *AdmissionController) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		if h := r.Header.Get(PriorityHeader); h != "" {
+			if p, ok := ParsePriority(h); ok {
+				ctx = WithPriority(ctx, p)
+			}
+		}
+
+		if err := ac.Wait(ctx); err != nil {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (ac *AdmissionController) run() {
+	for {
+		select {
+		case event, running := <-ac.es.C():
+			if !running {
+				return
+			}
+			if event.Type == EventTypeTx {
+				ac.observeTx(time.Now())
+			}
+		case _, running := <-ac.es.ErrC():
+			if !running {
+				return
+			}
+		}
+	}
+}
+
+func (ac *AdmissionController) observeTx(now time.Time) {
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	ac.rate = ac.decayedRate(now) + 1/admissionRateWindow.Seconds()
+	ac.rateAt = now
+}
+
+// decayedRate returns the tx rate decayed to now. ac.m must be held.
+func (ac *AdmissionController) decayedRate(now time.Time) float64 {
+	if ac.rateAt.IsZero() {
+		return 0
+	}
+	dt := now.Sub(ac.rateAt).Seconds()
+	return ac.rate * math.Exp(-dt/admissionRateWindow.Seconds())
+}
+
+// decayedLatency returns the latency average decayed to now. ac.m must be held.
+func (ac *AdmissionController) decayedLatency(now time.Time) time.Duration {
+	if ac.latencyAt.IsZero() {
+		return 0
+	}
+	dt := now.Sub(ac.latencyAt).Seconds()
+	return time.Duration(float64(ac.latency) * math.Exp(-dt/admissionLatencyWindow.Seconds()))
+}
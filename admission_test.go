@@ -0,0 +1,112 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdmissionController(t *testing.T) {
+	t.Run("tx rate", func(t *testing.T) {
+		ac := mockServerAdmission(t,
+			txEventJSON, txEventJSON, txEventJSON, txEventJSON, flush, sleep10,
+		)
+		ac.MaxTxRate = 2
+
+		time.Sleep(20 * time.Millisecond)
+		if rate := ac.TxRate(); rate < 3 {
+			t.Fatalf("expected rate >= 3, got %f", rate)
+		}
+		if !ac.Saturated() {
+			t.Fatal("expected saturated")
+		}
+	})
+
+	t.Run("decide", func(t *testing.T) {
+		ac := mockServerAdmission(t)
+		ac.MaxLatency = 10 * time.Millisecond
+
+		if d := ac.Decide(PriorityLow); d != AdmissionAccept {
+			t.Fatalf("expected accept, got %s", d)
+		}
+
+		ac.ObserveLatency(time.Second)
+		if d := ac.Decide(PriorityLow); d != AdmissionShed {
+			t.Fatalf("expected shed, got %s", d)
+		}
+		if d := ac.Decide(PriorityNormal); d != AdmissionAccept {
+			t.Fatalf("expected accept, got %s", d)
+		}
+
+		ac.QueueTimeout = 10 * time.Millisecond
+		if d := ac.Decide(PriorityLow); d != AdmissionQueue {
+			t.Fatalf("expected queue, got %s", d)
+		}
+
+		ctx := WithPriority(context.Background(), PriorityLow)
+		if err := ac.Wait(ctx); !errors.Is(err, ErrWriteShed) {
+			t.Fatalf("expected ErrWriteShed, got %v", err)
+		}
+	})
+
+	t.Run("latency decay", func(t *testing.T) {
+		ac := mockServerAdmission(t)
+
+		now := time.Now()
+		ac.observeLatency(time.Second, now)
+
+		ac.m.Lock()
+		defer ac.m.Unlock()
+		if d := ac.decayedLatency(now); d != time.Second {
+			t.Fatalf("expected 1s, got %s", d)
+		}
+		if d := ac.decayedLatency(now.Add(admissionLatencyWindow)); d < 367*time.Millisecond || d > 368*time.Millisecond {
+			t.Fatalf("expected ~368ms after one window, got %s", d)
+		}
+		if d := ac.decayedLatency(now.Add(5 * admissionLatencyWindow)); d > 10*time.Millisecond {
+			t.Fatalf("expected latency to decay below 10ms, got %s", d)
+		}
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		ac := mockServerAdmission(t)
+		ac.MaxLatency = 10 * time.Millisecond
+		ac.ObserveLatency(time.Second)
+
+		h := ac.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		for _, tc := range []struct {
+			method   string
+			priority string
+			status   int
+		}{
+			{http.MethodGet, "low", http.StatusOK},
+			{http.MethodPost, "", http.StatusOK},
+			{http.MethodPost, "high", http.StatusOK},
+			{http.MethodPost, "low", http.StatusServiceUnavailable},
+		} {
+			r := httptest.NewRequest(tc.method, "/", nil)
+			if tc.priority != "" {
+				r.Header.Set(PriorityHeader, tc.priority)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tc.status {
+				t.Fatalf("%s %s: expected %d, got %d", tc.method, tc.priority, tc.status, w.Code)
+			}
+		}
+	})
+}
+
+func mockServerAdmission(t *testing.T, resps ...string) *AdmissionController {
+	mockServer(t, resps...)
+
+	ac := NewAdmissionController()
+	t.Cleanup(ac.Close)
+
+	return ac
+}
@@ -0,0 +1,95 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// PosPollInterval is how often the "-pos" file is reread while waiting for a
+// database to reach a position, in case tx events are unavailable.
+var PosPollInterval = 100 * time.Millisecond
+
+// ReadPos returns the current replication position of the database at
+// databasePath by reading its "-pos" file from the LiteFS mount.
+func ReadPos(databasePath string) (Pos, error) {
+	data, err := os.ReadFile(PosPath(databasePath))
+	if err != nil {
+		return Pos{}, err
+	}
+	return ParsePos(string(data))
+}
+
+// AfterWrite runs fn in a new goroutine once the local copy of the database at
+// databasePath has reached at least the TXID of pos. This lets workers on
+// replicas act on data that another node just wrote. The returned channel
+// receives fn's error, or ctx's error if it is done before the position is
+// reached.
+func AfterWrite(ctx context.Context, databasePath string, pos Pos, fn func(context.Context) error) <-chan error {
+	errc := make(chan error, 1)
+
+	spawn(func() {
+		if err := WaitForPos(ctx, databasePath, pos.TXID); err != nil {
+			errc <- err
+			return
+		}
+		errc <- fn(ctx)
+	})
+
+	return errc
+}
+
+// WaitForPos blocks until the local copy of the database at databasePath has
+// replicated at least txid, or ctx is done. Waiting for the TXID of a write
+// forwarded to the primary gives read-your-writes consistency on a replica.
+// The "-pos" file is reread after every event and every PosPollInterval. If
+// the event subscription ends, e.g. because the events endpoint doesn't exist,
+// the error that ended it is returned.
+func WaitForPos(ctx context.Context, databasePath string, txid TXID) error {
+	// only subscribe to events if the database is behind.
+	if reached, err := posReached(databasePath, txid); err != nil || reached {
+		return err
+	}
+
+	es := NewEventSource(WithEventFilter(EventTypeTx), WithDatabase(filepath.Base(databasePath)))
+	defer es.Close()
+
+	ticker := time.NewTicker(PosPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// checked again after subscribing, in case txid was reached before
+		// the subscription started.
+		if reached, err := posReached(databasePath, txid); err != nil || reached {
+			return err
+		}
+
+		select {
+		case _, running := <-es.C():
+			if !running {
+				return ErrSubscriptionClosed
+			}
+		case err, running := <-es.ErrC():
+			if err := sourceError(err, running); err != nil {
+				return err
+			}
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// posReached reports whether the database at databasePath has replicated at
+// least txid. A missing "-pos" file means nothing has been replicated.
+func posReached(databasePath string, txid TXID) (bool, error) {
+	pos, err := ReadPos(databasePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return pos.TXID >= txid, nil
+}
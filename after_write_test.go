@@ -0,0 +1,115 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAfterWrite(t *testing.T) {
+	t.Run("waits for position", func(t *testing.T) {
+		mockServer(t, sleep10, txEventJSON, flush)
+		dbPath := filepath.Join(t.TempDir(), "db")
+		writePosFile(t, dbPath, "0000000000000026/0000000000000000")
+
+		ran := make(chan struct{})
+		errc := AfterWrite(context.Background(), dbPath, Pos{TXID: 0x27}, func(context.Context) error {
+			close(ran)
+			return nil
+		})
+
+		select {
+		case <-ran:
+			t.Fatal("ran before position was reached")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		writePosFile(t, dbPath, "0000000000000027/83b05248774ce767")
+
+		select {
+		case err := <-errc:
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		mockServer(t)
+		dbPath := filepath.Join(t.TempDir(), "db")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		errc := AfterWrite(ctx, dbPath, Pos{TXID: 1}, func(context.Context) error {
+			t.Fatal("unexpected call")
+			return nil
+		})
+		if err := <-errc; !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+	})
+}
+
+func TestWaitForPos(t *testing.T) {
+	mockServer(t, sleep10, txEventJSON, flush, hold)
+	dbPath := filepath.Join(t.TempDir(), "db")
+	writePosFile(t, dbPath, "0000000000000026/0000000000000000")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- WaitForPos(ctx, dbPath, 0x27) }()
+
+	writePosFile(t, dbPath, "0000000000000027/83b05248774ce767")
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pos, err := ReadPos(dbPath); err != nil || pos.TXID != 0x27 {
+		t.Fatalf("unexpected position: %s, %v", pos, err)
+	}
+}
+
+func TestWaitForPosReached(t *testing.T) {
+	useEventSource(t, func(...SubscribeOption) EventSource {
+		t.Fatal("unexpected subscription")
+		return nil
+	})
+	dbPath := filepath.Join(t.TempDir(), "db")
+	writePosFile(t, dbPath, "0000000000000027/83b05248774ce767")
+
+	if err := WaitForPos(context.Background(), dbPath, 0x27); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestWaitForPosTerminalError(t *testing.T) {
+	statusServer(t, http.StatusNotFound)
+	dbPath := filepath.Join(t.TempDir(), "db")
+	writePosFile(t, dbPath, "0000000000000026/0000000000000000")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// the subscription ends rather than the wait spinning on closed channels.
+	err := WaitForPos(ctx, dbPath, 0x27)
+	var statusErr *ErrUnexpectedStatus
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 error, got %v", err)
+	}
+}
+
+func writePosFile(t *testing.T, dbPath, pos string) {
+	t.Helper()
+
+	if err := os.WriteFile(dbPath+"-pos", []byte(pos+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,81 @@
+package litefs
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ttlCache caches the results of lookups by key. Concurrent lookups of a key
+// that isn't cached share a single call.
+type ttlCache[V any] struct {
+	m       sync.Mutex
+	entries map[string]*cacheEntry[V]
+}
+
+type cacheEntry[V any] struct {
+	done    chan struct{}
+	val     V
+	err     error
+	expires time.Time
+}
+
+// get returns the cached result for key, calling fn to look it up if there is
+// none or it has expired. Successful results are kept for ttl and errors for
+// negativeTTL. fn runs in its own goroutine with a context that isn't canceled
+// when ctx is, so a caller giving up doesn't fail the lookup for callers
+// sharing it.
+func (c *ttlCache[V]) get(ctx context.Context, key string, ttl, negativeTTL time.Duration, fn func(context.Context) (V, error)) (V, error) {
+	c.m.Lock()
+	e := c.entries[key]
+	if e != nil {
+		select {
+		case <-e.done:
+			if time.Now().After(e.expires) {
+				e = nil
+			}
+		default:
+		}
+	}
+	if e == nil {
+		e = &cacheEntry[V]{done: make(chan struct{})}
+		if c.entries == nil {
+			c.entries = make(map[string]*cacheEntry[V])
+		}
+		c.entries[key] = e
+
+		lookupCtx := context.WithoutCancel(ctx)
+		spawn(func() {
+			val, err := fn(lookupCtx)
+
+			c.m.Lock()
+			defer c.m.Unlock()
+
+			e.val, e.err = val, err
+			if err == nil {
+				e.expires = time.Now().Add(ttl)
+			} else {
+				e.expires = time.Now().Add(negativeTTL)
+			}
+			close(e.done)
+		})
+	}
+	c.m.Unlock()
+
+	select {
+	case <-e.done:
+		return e.val, e.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+// forget drops the cached result for key so that the next get looks it up
+// again.
+func (c *ttlCache[V]) forget(key string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	delete(c.entries, key)
+}
@@ -0,0 +1,217 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// ChangelogTable is the table the change-capture triggers write to.
+const ChangelogTable = "_litefs_changelog"
+
+// Change operations recorded in the changelog.
+const (
+	ChangeInsert = "insert"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Change is a row-level change recorded by the changelog triggers.
+type Change struct {
+	ID     int64          `json:"id"`
+	Table  string         `json:"table"`
+	Op     string         `json:"op"`
+	Before map[string]any `json:"before,omitempty"`
+	After  map[string]any `json:"after,omitempty"`
+}
+
+// ChangeSet is the set of changes observed after a tx event. If several
+// transactions commit before the changelog is read, their changes are
+// delivered together with the position of the most recent one.
+type ChangeSet struct {
+	DB      string   `json:"db"`
+	Pos     Pos      `json:"pos"`
+	Changes []Change `json:"changes"`
+}
+
+// ChangelogSQL returns the statements that create the changelog table and the
+// triggers recording before/after images of columns in table. They must be
+// executed on the primary.
+func ChangelogSQL(table string, columns ...string) []string {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ` + ChangelogTable + ` (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	tbl TEXT NOT NULL,
+	op TEXT NOT NULL,
+	old TEXT,
+	new TEXT
+)`,
+	}
+
+	image := func(prefix string) string {
+		args := make([]string, len(columns))
+		for i, col := range columns {
+			args[i] = quoteLiteral(col) + ", " + prefix + "." + quoteIdent(col)
+		}
+		return "json_object(" + strings.Join(args, ", ") + ")"
+	}
+
+	for _, t := range []struct{ op, old, new string }{
+		{ChangeInsert, "NULL", image("NEW")},
+		{ChangeUpdate, image("OLD"), image("NEW")},
+		{ChangeDelete, image("OLD"), "NULL"},
+	} {
+		stmts = append(stmts, fmt.Sprintf(
+			"CREATE TRIGGER IF NOT EXISTS %s AFTER %s ON %s BEGIN INSERT INTO %s (tbl, op, old, new) VALUES (%s, %s, %s, %s); END",
+			quoteIdent("_litefs_cdc_"+table+"_"+t.op), strings.ToUpper(t.op), quoteIdent(table),
+			ChangelogTable, quoteLiteral(table), quoteLiteral(t.op), t.old, t.new,
+		))
+	}
+	return stmts
+}
+
+// PruneChangelog deletes the changes with an ID up to and including through
+// and returns how many were deleted. Pass the lowest checkpoint saved by the
+// ChangeCaptures reading the changelog so that no undelivered change is lost.
+// It must be called on the primary.
+func PruneChangelog(ctx context.Context, db *sql.DB, through int64) (int64, error) {
+	result, err := db.ExecContext(ctx, `DELETE FROM `+ChangelogTable+` WHERE id <= ?`, through)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// InstallChangelog executes the statements returned by ChangelogSQL. It must
+// be called on the primary.
+func InstallChangelog(ctx context.Context, db *sql.DB, table string, columns ...string) error {
+	for _, stmt := range ChangelogSQL(table, columns...) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChangeCapture emits row-level changes recorded by the changelog triggers
+// each time a tx event is received for Database. The ID of the last change
+// delivered is saved to Store under Name as the TXID of a Pos. Delivered
+// changes stay in the changelog until they are removed with PruneChangelog.
+type ChangeCapture struct {
+	DB       *sql.DB
+	Database string
+	Store    PosStore
+	Name     string
+
+	// Handler is called with each non-empty ChangeSet. If it returns an error
+	// the changes are redelivered after the next tx event.
+	Handler func(ctx context.Context, cs *ChangeSet) error
+
+	// OnError is called with errors encountered while reading changes. If nil,
+	// Run returns the first such error.
+	OnError func(error)
+
+	// Logger, if set, receives tx events that are skipped because their
+	// position can't be parsed.
+	Logger *slog.Logger
+}
+
+// Run delivers changes until ctx is done.
+func (cc *ChangeCapture) Run(ctx context.Context) error {
+	es := NewEventSource()
+	defer es.Close()
+
+	for {
+		select {
+		case event, running := <-es.C():
+			if !running {
+				return ErrSubscriptionClosed
+			}
+			data, ok := event.Data.(*TxEventData)
+			if !ok || event.DB != cc.Database {
+				continue
+			}
+			pos, err := data.Pos()
+			if err != nil {
+				if cc.Logger != nil {
+					cc.Logger.Warn("litefs: skipping tx event with invalid position", slog.String("db", event.DB), slog.Any("error", err))
+				}
+				continue
+			}
+			if err := cc.Capture(ctx, pos); err != nil {
+				if cc.OnError == nil {
+					return err
+				}
+				cc.OnError(err)
+			}
+		case err, running := <-es.ErrC():
+			if err := sourceError(err, running); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Capture reads the changes recorded since the last checkpoint and passes them
+// to Handler tagged with pos.
+func (cc *ChangeCapture) Capture(ctx context.Context, pos Pos) error {
+	checkpoint, err := cc.Store.LoadPos(ctx, cc.Name)
+	if err != nil {
+		return fmt.Errorf("load checkpoint: %w", err)
+	}
+
+	rows, err := cc.DB.QueryContext(ctx, `SELECT id, tbl, op, old, new FROM `+ChangelogTable+` WHERE id > ? ORDER BY id`, int64(checkpoint.TXID))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cs := &ChangeSet{DB: cc.Database, Pos: pos}
+	for rows.Next() {
+		var c Change
+		var before, after sql.NullString
+		if err := rows.Scan(&c.ID, &c.Table, &c.Op, &before, &after); err != nil {
+			return err
+		}
+		if before.Valid {
+			if err := json.Unmarshal([]byte(before.String), &c.Before); err != nil {
+				return err
+			}
+		}
+		if after.Valid {
+			if err := json.Unmarshal([]byte(after.String), &c.After); err != nil {
+				return err
+			}
+		}
+		cs.Changes = append(cs.Changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(cs.Changes) == 0 {
+		return nil
+	}
+
+	if err := cc.Handler(ctx, cs); err != nil {
+		return err
+	}
+
+	last := cs.Changes[len(cs.Changes)-1].ID
+	if err := cc.Store.SavePos(ctx, cc.Name, Pos{TXID: TXID(last)}); err != nil {
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	return nil
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+func quoteLiteral(s string) string {
+	return `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+}
@@ -0,0 +1,136 @@
+package litefs
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangelogSQL(t *testing.T) {
+	stmts := ChangelogSQL("users", "id", "name")
+	if len(stmts) != 4 {
+		t.Fatalf("expected 4 statements, got %d", len(stmts))
+	}
+
+	update := stmts[2]
+	for _, s := range []string{
+		`AFTER UPDATE ON "users"`,
+		`json_object('id', OLD."id", 'name', OLD."name")`,
+		`json_object('id', NEW."id", 'name', NEW."name")`,
+	} {
+		if !strings.Contains(update, s) {
+			t.Fatalf("expected %q in %s", s, update)
+		}
+	}
+}
+
+func TestChangeCapture(t *testing.T) {
+	ctx := context.Background()
+	var sets []*ChangeSet
+	cc := &ChangeCapture{
+		DB:       openFakeDB(t, []string{"id", "tbl", "op", "old", "new"}, 0, 100),
+		Database: "db",
+		Store:    &FilePosStore{Dir: t.TempDir()},
+		Name:     "cdc",
+		Handler: func(ctx context.Context, cs *ChangeSet) error {
+			sets = append(sets, cs)
+			return nil
+		},
+	}
+
+	fakeRows = [][]driver.Value{
+		{int64(1), "users", ChangeInsert, nil, `{"name":"a"}`},
+		{int64(2), "users", ChangeUpdate, `{"name":"a"}`, `{"name":"b"}`},
+	}
+	if err := cc.Capture(ctx, Pos{TXID: 1}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	fakeRows = append(fakeRows, []driver.Value{int64(3), "users", ChangeDelete, `{"name":"b"}`, nil})
+	if err := cc.Capture(ctx, Pos{TXID: 2}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := cc.Capture(ctx, Pos{TXID: 3}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []*ChangeSet{
+		{DB: "db", Pos: Pos{TXID: 1}, Changes: []Change{
+			{ID: 1, Table: "users", Op: ChangeInsert, After: map[string]any{"name": "a"}},
+			{ID: 2, Table: "users", Op: ChangeUpdate, Before: map[string]any{"name": "a"}, After: map[string]any{"name": "b"}},
+		}},
+		{DB: "db", Pos: Pos{TXID: 2}, Changes: []Change{
+			{ID: 3, Table: "users", Op: ChangeDelete, Before: map[string]any{"name": "b"}},
+		}},
+	}
+	if !reflect.DeepEqual(sets, expected) {
+		t.Fatalf("wrong change sets\nexpected: %#v\nactual: %#v", expected, sets)
+	}
+}
+
+func TestChangeCaptureRun(t *testing.T) {
+	badTxEventJSON := strings.Replace(txEventJSON, "0000000000000027", "zz", 1)
+	mockServer(t, initEventJSON, badTxEventJSON, txEventJSON, flush, hold)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var buf bytes.Buffer
+	var sets []*ChangeSet
+	cc := &ChangeCapture{
+		DB:       openFakeDB(t, []string{"id", "tbl", "op", "old", "new"}, 0, 100),
+		Database: "db",
+		Store:    &FilePosStore{Dir: t.TempDir()},
+		Name:     "cdc",
+		Logger:   slog.New(slog.NewTextHandler(&buf, nil)),
+		Handler: func(ctx context.Context, cs *ChangeSet) error {
+			sets = append(sets, cs)
+			cancel()
+			return nil
+		},
+	}
+	fakeRows = [][]driver.Value{{int64(1), "users", ChangeInsert, nil, `{"name":"a"}`}}
+
+	// the event with an invalid position is skipped rather than delivered
+	// with the zero Pos.
+	if err := cc.Run(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(sets) != 1 || sets[0].Pos.TXID != 0x27 {
+		t.Fatalf("expected one change set at txid 0x27, got %#v", sets)
+	}
+	if !strings.Contains(buf.String(), "invalid position") {
+		t.Fatalf("expected the skipped event to be logged, got %q", buf.String())
+	}
+}
+
+func TestPruneChangelog(t *testing.T) {
+	changes := []int64{1, 2, 3, 4}
+	db := openStubDB(t, func(query string, args []any) (stubResult, error) {
+		if query != `DELETE FROM `+ChangelogTable+` WHERE id <= ?` {
+			t.Fatalf("unexpected query: %s", query)
+		}
+		var kept []int64
+		for _, id := range changes {
+			if id > args[0].(int64) {
+				kept = append(kept, id)
+			}
+		}
+		deleted := int64(len(changes) - len(kept))
+		changes = kept
+		return stubResult{affected: deleted}, nil
+	})
+
+	n, err := PruneChangelog(context.Background(), db, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != 2 || !reflect.DeepEqual(changes, []int64{3, 4}) {
+		t.Fatalf("expected 2 changes deleted leaving [3 4], got %d leaving %v", n, changes)
+	}
+}
@@ -0,0 +1,386 @@
+package litefs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Client is a client for the LiteFS HTTP API.
+//
+// The exported fields configure the client and must be set before it is used.
+type Client struct {
+	// URL is the base URL of the LiteFS API.
+	URL string
+
+	// HTTPClient makes the requests. It defaults to http.DefaultClient.
+	HTTPClient *http.Client
+
+	// Dir, if set, is the LiteFS mount directory, which is read for the
+	// positions of databases after they are changed through the API.
+	Dir string
+
+	opts []Option
+}
+
+// NewClient returns a new *Client for the LiteFS API on its default port,
+// with databases mounted in dir. The options apply to the event subscriptions
+// the client makes.
+func NewClient(dir string, opts ...Option) *Client {
+	return &Client{URL: APIURL(DefaultAPIPort, ""), Dir: dir, opts: opts}
+}
+
+// ImportOption configures Client.Import.
+type ImportOption func(*importOptions)
+
+type importOptions struct {
+	rateLimit int64
+	progress  func(n, total int64)
+}
+
+// WithRateLimit limits imports to bytesPerSecond, so that uploading a large
+// database doesn't starve replication of bandwidth.
+func WithRateLimit(bytesPerSecond int64) ImportOption {
+	return func(o *importOptions) {
+		o.rateLimit = bytesPerSecond
+	}
+}
+
+// WithImportProgress calls fn as an import is uploaded with the number of
+// bytes uploaded so far and the size of the database, or -1 if it isn't
+// known.
+func WithImportProgress(fn func(n, total int64)) ImportOption {
+	return func(o *importOptions) {
+		o.progress = fn
+	}
+}
+
+// Import replaces the database named db with the SQLite database read from r,
+// creating it if it doesn't exist. The body is streamed, using chunked
+// encoding if its length isn't known. LiteFS doesn't report the resulting
+// position, so its TXID is read from the mount if Dir is set and is zero
+// otherwise. Imports must be made on the primary.
+func (c *Client) Import(ctx context.Context, db string, r io.Reader, opts ...ImportOption) (TXID, error) {
+	var o importOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	size := readerSize(r)
+	if o.rateLimit > 0 {
+		r = &throttledReader{ctx: ctx, r: r, rate: o.rateLimit}
+	}
+	if o.progress != nil {
+		r = &progressReader{r: r, total: size, fn: o.progress}
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/import", url.Values{"name": {db}}, r)
+	if err != nil {
+		return 0, err
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+
+	if c.Dir == "" {
+		return 0, nil
+	}
+	pos, err := ReadPos(filepath.Join(c.Dir, db))
+	if err != nil {
+		return 0, err
+	}
+	return pos.TXID, nil
+}
+
+// NodeInfo is the status of a LiteFS node reported by its API.
+type NodeInfo struct {
+	// ID is the node's ID.
+	ID string `json:"id"`
+
+	// ClusterID is the ID of the cluster the node belongs to.
+	ClusterID string `json:"clusterID,omitempty"`
+
+	// Primary is whether the node is the primary.
+	Primary bool `json:"primary"`
+
+	// Candidate is whether the node can become the primary.
+	Candidate bool `json:"candidate"`
+
+	// PrimaryHostname is the hostname of the primary, if one is known.
+	PrimaryHostname string `json:"primaryHostname,omitempty"`
+
+	// Databases are the positions of the node's databases, by name.
+	Databases map[string]Pos `json:"databases,omitempty"`
+}
+
+// Info returns the status of the LiteFS node, e.g. for health checks.
+func (c *Client) Info(ctx context.Context) (*NodeInfo, error) {
+	resp, err := c.do(ctx, http.MethodGet, "/info", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var info NodeInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ExportOption configures Client.Export.
+type ExportOption func(*exportOptions)
+
+type exportOptions struct {
+	gzip     bool
+	progress func(n, total int64)
+}
+
+// WithGzip compresses exported databases with gzip.
+func WithGzip() ExportOption {
+	return func(o *exportOptions) {
+		o.gzip = true
+	}
+}
+
+// WithProgress calls fn as an export is downloaded with the number of bytes
+// downloaded so far and the size of the database, or -1 if LiteFS doesn't
+// report it. Sizes are of the uncompressed database.
+func WithProgress(fn func(n, total int64)) ExportOption {
+	return func(o *exportOptions) {
+		o.progress = fn
+	}
+}
+
+// Export writes a consistent snapshot of the database named db to w, e.g. for
+// backups. The snapshot is streamed, so w receives a partial database if an
+// error is returned.
+func (c *Client) Export(ctx context.Context, db string, w io.Writer, opts ...ExportOption) error {
+	var o exportOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, "/export", url.Values{"name": {db}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var gw *gzip.Writer
+	if o.gzip {
+		gw = gzip.NewWriter(w)
+		w = gw
+	}
+	if o.progress != nil {
+		w = &progressWriter{w: w, total: resp.ContentLength, fn: o.progress}
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return err
+	}
+	if gw != nil {
+		return gw.Close()
+	}
+	return nil
+}
+
+// progressWriter reports the number of bytes written through it.
+type progressWriter struct {
+	w     io.Writer
+	n     int64
+	total int64
+	fn    func(n, total int64)
+}
+
+func (pw *progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.n += int64(n)
+	pw.fn(pw.n, pw.total)
+	return n, err
+}
+
+// progressReader reports the number of bytes read through it.
+type progressReader struct {
+	r     io.Reader
+	n     int64
+	total int64
+	fn    func(n, total int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.n += int64(n)
+		pr.fn(pr.n, pr.total)
+	}
+	return n, err
+}
+
+// throttledReader limits reads through it to rate bytes per second on average.
+type throttledReader struct {
+	ctx   context.Context
+	r     io.Reader
+	rate  int64
+	start time.Time
+	n     int64
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if tr.start.IsZero() {
+		tr.start = time.Now()
+	}
+	if int64(len(p)) > tr.rate {
+		p = p[:tr.rate]
+	}
+
+	n, err := tr.r.Read(p)
+	tr.n += int64(n)
+
+	// wait until the bytes read so far are due at rate.
+	due := tr.start.Add(time.Duration(float64(tr.n) / float64(tr.rate) * float64(time.Second)))
+	if sleepErr := sleepContext(tr.ctx, time.Until(due)); sleepErr != nil && err == nil {
+		err = sleepErr
+	}
+	return n, err
+}
+
+// readerSize returns the number of bytes left in r if it can be known without
+// reading it, as net/http does for request bodies, or -1 otherwise.
+func readerSize(r io.Reader) int64 {
+	switch r := r.(type) {
+	case *bytes.Buffer:
+		return int64(r.Len())
+	case *bytes.Reader:
+		return int64(r.Len())
+	case *strings.Reader:
+		return int64(r.Len())
+	case *os.File:
+		fi, err := r.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return -1
+		}
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		return fi.Size() - offset
+	}
+	return -1
+}
+
+// Promote asks LiteFS to make the local node the primary and waits until the
+// event stream reports that it is. LiteFS must have lease.promote enabled.
+func (c *Client) Promote(ctx context.Context) error {
+	return c.changeRole(ctx, "/promote", RolePrimary)
+}
+
+// Demote asks LiteFS to hand off the primary role of the local node and waits
+// until the event stream reports that it is a replica.
+func (c *Client) Demote(ctx context.Context) error {
+	return c.changeRole(ctx, "/demote", RoleReplica)
+}
+
+// changeRole posts to path and waits for the local node to have role. The
+// event stream is subscribed to first so that the change can't be missed.
+func (c *Client) changeRole(ctx context.Context, path string, role Role) error {
+	opts := subscribeOptions(c.opts,
+		WithURL(strings.TrimSuffix(c.URL, "/")+EventsPath),
+		WithEventFilter(EventTypeInit, EventTypePrimaryChange),
+	)
+	if c.HTTPClient != nil {
+		opts = append(opts, WithHTTPClient(c.HTTPClient))
+	}
+	es := NewEventSource(opts...)
+	defer es.Close()
+
+	resp, err := c.do(ctx, http.MethodPost, path, nil, nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	for {
+		select {
+		case event, running := <-es.C():
+			if !running {
+				return ErrSubscriptionClosed
+			}
+			var isPrimary bool
+			switch data := event.Data.(type) {
+			case *InitEventData:
+				isPrimary = data.IsPrimary
+			case *PrimaryChangeEventData:
+				isPrimary = data.IsPrimary
+			default:
+				continue
+			}
+			if isPrimary == (role == RolePrimary) {
+				return nil
+			}
+		case err, running := <-es.ErrC():
+			if err := sourceError(err, running); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// do makes a request to the API, returning an error for responses other than
+// 200 OK. The caller must close the response body.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	return c.send(req)
+}
+
+// newRequest returns a request to the API at path.
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := strings.TrimSuffix(c.URL, "/") + path
+	if len(query) != 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", DefaultUserAgent)
+	return req, nil
+}
+
+// send sends req, failing with *ErrUnexpectedStatus on responses other than
+// 200 OK.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, &ErrUnexpectedStatus{Code: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
@@ -0,0 +1,192 @@
+package litefs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientImport(t *testing.T) {
+	dir := t.TempDir()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/import" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		if name := r.URL.Query().Get("name"); name != "app.db" {
+			http.Error(w, "wrong name "+name, http.StatusBadRequest)
+			return
+		}
+		if body, _ := io.ReadAll(r.Body); string(body) != "SQLite format 3\x00" {
+			http.Error(w, "wrong body", http.StatusBadRequest)
+			return
+		}
+		writePosFile(t, filepath.Join(dir, "app.db"), "0000000000000005/0000000000000000")
+	}))
+	t.Cleanup(s.Close)
+
+	c := NewClient(dir)
+	c.URL = s.URL
+
+	// a reader of unknown length is sent chunked.
+	r := io.MultiReader(strings.NewReader("SQLite format 3\x00"))
+	txid, err := c.Import(context.Background(), "app.db", r)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if txid != 5 {
+		t.Fatalf("expected TXID 5, got %s", txid)
+	}
+
+	if _, err := c.Import(context.Background(), "other.db", strings.NewReader("")); !errors.As(err, new(*ErrUnexpectedStatus)) || !strings.Contains(err.Error(), "wrong name other.db") {
+		t.Fatalf("expected unexpected status with message, got %v", err)
+	}
+}
+
+func TestClientImportOptions(t *testing.T) {
+	data := strings.Repeat("SQLite format 3\x00", 64)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != int64(len(data)) {
+			http.Error(w, "unknown length", http.StatusLengthRequired)
+			return
+		}
+		if body, _ := io.ReadAll(r.Body); string(body) != data {
+			http.Error(w, "wrong body", http.StatusBadRequest)
+			return
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	c := NewClient("")
+	c.URL = s.URL
+
+	// the body is sent at about 10KB/s, so it takes about 100ms.
+	var n, total int64
+	start := time.Now()
+	if _, err := c.Import(context.Background(), "app.db", strings.NewReader(data),
+		WithRateLimit(10240), WithImportProgress(func(nn, tt int64) { n, total = nn, tt }),
+	); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("expected the import to be throttled, took %s", elapsed)
+	}
+	if n != int64(len(data)) || total != int64(len(data)) {
+		t.Fatalf("expected progress %d/%d, got %d/%d", len(data), len(data), n, total)
+	}
+
+	// throttling stops once the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := c.Import(ctx, "app.db", strings.NewReader(data), WithRateLimit(1024)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestClientExport(t *testing.T) {
+	data := strings.Repeat("SQLite format 3\x00", 1000)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/export" || r.URL.Query().Get("name") != "app.db" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, r, "app.db", time.Time{}, strings.NewReader(data))
+	}))
+	t.Cleanup(s.Close)
+
+	c := NewClient("")
+	c.URL = s.URL
+
+	var buf bytes.Buffer
+	var n, total int64
+	err := c.Export(context.Background(), "app.db", &buf, WithGzip(), WithProgress(func(nn, tt int64) { n, total = nn, tt }))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n != int64(len(data)) || total != int64(len(data)) {
+		t.Fatalf("expected progress %d/%d, got %d/%d", len(data), len(data), n, total)
+	}
+
+	gr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := io.ReadAll(gr); err != nil || string(b) != data {
+		t.Fatalf("expected exported database, got %d bytes, %v", len(b), err)
+	}
+
+	if err := c.Export(context.Background(), "other.db", io.Discard); !errors.As(err, new(*ErrUnexpectedStatus)) {
+		t.Fatalf("expected unexpected status, got %v", err)
+	}
+}
+
+func TestClientInfo(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/info" {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, `{"id":"ABC","clusterID":"LFSC1","primary":false,"candidate":true,"primaryHostname":"node-1",`+
+			`"databases":{"app.db":{"txid":"0000000000000027","postApplyChecksum":"83b05248774ce767"}}}`)
+	}))
+	t.Cleanup(s.Close)
+
+	c := NewClient("")
+	c.URL = s.URL
+
+	info, err := c.Info(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := &NodeInfo{
+		ID:              "ABC",
+		ClusterID:       "LFSC1",
+		Candidate:       true,
+		PrimaryHostname: "node-1",
+		Databases:       map[string]Pos{"app.db": {TXID: 0x27, PostApplyChecksum: 0x83b05248774ce767}},
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, info)
+	}
+}
+
+func TestClientPromote(t *testing.T) {
+	src := newFakeSource()
+	useEventSource(t, func(...SubscribeOption) EventSource { return src })
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || (r.URL.Path != "/promote" && r.URL.Path != "/demote") {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		go func() {
+			src.c <- pChangeNode2Event
+			if r.URL.Path == "/promote" {
+				src.c <- pChangeNode1Event
+			}
+		}()
+	}))
+	t.Cleanup(s.Close)
+
+	c := NewClient("")
+	c.URL = s.URL
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Promote(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	src = newFakeSource()
+	if err := c.Demote(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
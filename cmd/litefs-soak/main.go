@@ -0,0 +1,40 @@
+// Command litefs-soak runs long-lived event subscriptions against a
+// misbehaving event server and fails if goroutines or file descriptors leak.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/superfly/litefs-go/litefstest"
+)
+
+func main() {
+	var config litefstest.SoakConfig
+	flag.DurationVar(&config.Duration, "duration", time.Hour, "how long to run")
+	flag.IntVar(&config.Subscriptions, "subscriptions", 10, "number of each kind of subscriber")
+	flag.DurationVar(&config.Cycle, "cycle", time.Minute, "how often subscribers are reopened and leaks checked")
+	flag.Int64Var(&config.Chaos.Seed, "seed", time.Now().UnixNano(), "random seed")
+	flag.Float64Var(&config.Chaos.StatusErrorRate, "status-error-rate", 0.1, "probability of a 500 response per connection")
+	flag.Float64Var(&config.Chaos.HangupRate, "hangup-rate", 0.01, "probability of a hangup per event")
+	flag.Float64Var(&config.Chaos.GarbageRate, "garbage-rate", 0.01, "probability of invalid JSON per event")
+	flag.DurationVar(&config.Chaos.MaxDelay, "max-delay", 10*time.Millisecond, "longest pause between events")
+	flag.Parse()
+
+	config.Logf = log.Printf
+	log.Printf("seed %d", config.Chaos.Seed)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	report, err := litefstest.Soak(ctx, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("ok: %d cycles, %d events, %d errors, %d connections, peak %s",
+		report.Cycles, report.Events, report.Errors, report.Connections, report.Peak)
+}
@@ -0,0 +1,196 @@
+package litefs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/superfly/litefs-go/internal/miniyaml"
+)
+
+// Config holds tuning that can be changed while subsystems are running. Set a
+// *LiveConfig on a subsystem's Config field and its values are used in place
+// of the subsystem's own fields. Zero MaxWait, MaxLag and Debounce leave the
+// fields in effect.
+type Config struct {
+	// MaxWait bounds how long ConsistencyTracker.Middleware waits for a
+	// token's positions.
+	MaxWait time.Duration
+
+	// MaxLag is the lag beyond which a ReplicationMonitor reports the node
+	// unhealthy.
+	MaxLag time.Duration
+
+	// Debounce is how long after a tx event a View is refreshed.
+	Debounce time.Duration
+
+	// MaxTxRate, MaxLatency and QueueTimeout configure an
+	// AdmissionController.
+	MaxTxRate    float64
+	MaxLatency   time.Duration
+	QueueTimeout time.Duration
+
+	// DefaultRoute and Routes configure a Router.
+	DefaultRoute RoutePolicy
+	Routes       map[string]RoutePolicy
+}
+
+// ParseRoutePolicy parses "forward", "halt" or "local" into a RoutePolicy.
+func ParseRoutePolicy(s string) (RoutePolicy, bool) {
+	for _, p := range []RoutePolicy{RouteForward, RouteHalt, RouteLocal} {
+		if s == p.String() {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// LiveConfig is a Config that can be replaced atomically while it is in use,
+// e.g. from a file reloaded on SIGHUP. Every subsystem sharing it sees a new
+// Config at the same time and never a mix of old and new values.
+type LiveConfig struct {
+	base Config
+	v    atomic.Pointer[Config]
+
+	m        sync.Mutex
+	watchers []func(*Config)
+}
+
+// NewLiveConfig returns a new *LiveConfig holding base. Files loaded with
+// LoadFile override base.
+func NewLiveConfig(base Config) *LiveConfig {
+	lc := &LiveConfig{base: base}
+	lc.v.Store(&base)
+	return lc
+}
+
+// Load returns the current Config. It must not be modified.
+func (lc *LiveConfig) Load() *Config {
+	return lc.v.Load()
+}
+
+// Store replaces the current Config with c and calls watchers with it.
+func (lc *LiveConfig) Store(c Config) {
+	lc.m.Lock()
+	defer lc.m.Unlock()
+
+	lc.v.Store(&c)
+	for _, fn := range lc.watchers {
+		fn(&c)
+	}
+}
+
+// Watch calls fn with every Config stored from now on.
+func (lc *LiveConfig) Watch(fn func(*Config)) {
+	lc.m.Lock()
+	defer lc.m.Unlock()
+
+	lc.watchers = append(lc.watchers, fn)
+}
+
+// LoadFile stores the base Config overridden by the YAML file at path:
+//
+//	max-wait: 5s
+//	max-lag: 30s
+//	debounce: 100ms
+//	admission:
+//	  max-tx-rate: 500
+//	  max-latency: 250ms
+//	  queue-timeout: 2s
+//	routing:
+//	  default: forward
+//	  databases:
+//	    analytics.db: halt
+//
+// The current Config is left in place if the file is invalid.
+func (lc *LiveConfig) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	m, err := miniyaml.Parse(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	c := lc.base
+	if err := parseConfig(m, &c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	lc.Store(c)
+	return nil
+}
+
+// ReloadOnSignal calls LoadFile with path whenever the process receives
+// SIGHUP, until ctx is done. Reload errors are passed to onError, if set, and
+// leave the current Config in place.
+func (lc *LiveConfig) ReloadOnSignal(ctx context.Context, path string, onError func(error)) error {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+	defer signal.Stop(c)
+
+	for {
+		select {
+		case <-c:
+			if err := lc.LoadFile(path); err != nil && onError != nil {
+				onError(err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func parseConfig(m miniyaml.Map, c *Config) (err error) {
+	duration := func(m miniyaml.Map, key string, d *time.Duration) {
+		if s := m.String(key); s != "" && err == nil {
+			if *d, err = time.ParseDuration(s); err != nil {
+				err = fmt.Errorf("%s: %w", key, err)
+			}
+		}
+	}
+
+	duration(m, "max-wait", &c.MaxWait)
+	duration(m, "max-lag", &c.MaxLag)
+	duration(m, "debounce", &c.Debounce)
+
+	if admission := m.Map("admission"); admission != nil {
+		if s := admission.String("max-tx-rate"); s != "" {
+			if c.MaxTxRate, err = strconv.ParseFloat(s, 64); err != nil {
+				return fmt.Errorf("max-tx-rate: %w", err)
+			}
+		}
+		duration(admission, "max-latency", &c.MaxLatency)
+		duration(admission, "queue-timeout", &c.QueueTimeout)
+	}
+	if err != nil {
+		return err
+	}
+
+	if routing := m.Map("routing"); routing != nil {
+		if s := routing.String("default"); s != "" {
+			p, ok := ParseRoutePolicy(s)
+			if !ok {
+				return fmt.Errorf("routing: unknown policy %q", s)
+			}
+			c.DefaultRoute = p
+		}
+		if dbs := routing.Map("databases"); dbs != nil {
+			c.Routes = make(map[string]RoutePolicy, len(dbs))
+			for db := range dbs {
+				p, ok := ParseRoutePolicy(dbs.String(db))
+				if !ok {
+					return fmt.Errorf("routing: %s: unknown policy %q", db, dbs.String(db))
+				}
+				c.Routes[db] = p
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package litefs
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLiveConfig(t *testing.T) {
+	lc := NewLiveConfig(Config{MaxWait: time.Second, MaxTxRate: 100})
+
+	var watched []*Config
+	lc.Watch(func(c *Config) { watched = append(watched, c) })
+
+	path := filepath.Join(t.TempDir(), "tuning.yml")
+	writeFile(t, path, `
+max-wait: 5s
+max-lag: 30s
+debounce: 100ms
+admission:
+  max-latency: 250ms
+routing:
+  default: halt
+  databases:
+    app.db: forward
+`)
+	if err := lc.LoadFile(path); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := &Config{
+		MaxWait:      5 * time.Second,
+		MaxLag:       30 * time.Second,
+		Debounce:     100 * time.Millisecond,
+		MaxTxRate:    100,
+		MaxLatency:   250 * time.Millisecond,
+		DefaultRoute: RouteHalt,
+		Routes:       map[string]RoutePolicy{"app.db": RouteForward},
+	}
+	if c := lc.Load(); !reflect.DeepEqual(c, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, c)
+	}
+	if len(watched) != 1 || watched[0] != lc.Load() {
+		t.Fatalf("expected watcher to be called with the new config, got %v", watched)
+	}
+
+	// subsystems follow the config.
+	rt := &Router{Default: RouteLocal, Config: lc}
+	if rt.Policy("app.db") != RouteForward || rt.Policy("other.db") != RouteHalt {
+		t.Fatal("expected router to use config")
+	}
+	ac := &AdmissionController{QueueTimeout: time.Hour, Config: lc}
+	if ac.Decide(PriorityLow) != AdmissionAccept {
+		t.Fatal("expected unsaturated controller to accept")
+	}
+	if _, _, queueTimeout := ac.limits(); queueTimeout != 0 {
+		t.Fatalf("expected queue timeout from config, got %s", queueTimeout)
+	}
+
+	if rm := (&ReplicationMonitor{MaxLag: time.Second, Config: lc}); rm.maxLag() != 30*time.Second {
+		t.Fatalf("expected max lag from config, got %s", rm.maxLag())
+	}
+	if v := (&View[int]{Debounce: time.Second, Config: lc}); v.debounce() != 100*time.Millisecond {
+		t.Fatalf("expected debounce from config, got %s", v.debounce())
+	}
+
+	// zero durations leave the subsystems' fields in effect.
+	empty := NewLiveConfig(Config{})
+	if ct := (&ConsistencyTracker{MaxWait: time.Second, Config: empty}); ct.maxWait() != time.Second {
+		t.Fatalf("expected max wait from field, got %s", ct.maxWait())
+	}
+	if rm := (&ReplicationMonitor{MaxLag: time.Second, Config: empty}); rm.maxLag() != time.Second {
+		t.Fatalf("expected max lag from field, got %s", rm.maxLag())
+	}
+
+	// invalid files leave the config in place.
+	writeFile(t, path, "routing:\n  default: sideways\n")
+	if err := lc.LoadFile(path); err == nil {
+		t.Fatal("expected error")
+	}
+	if c := lc.Load(); !reflect.DeepEqual(c, expected) {
+		t.Fatalf("expected config to be unchanged, got %+v", c)
+	}
+}
+
+func TestLiveConfigReloadOnSignal(t *testing.T) {
+	lc := NewLiveConfig(Config{})
+	path := filepath.Join(t.TempDir(), "tuning.yml")
+	writeFile(t, path, "max-wait: 3s\n")
+
+	// catch SIGHUP so that it can't kill the test before ReloadOnSignal
+	// installs its handler.
+	catch := make(chan os.Signal, 1)
+	signal.Notify(catch, syscall.SIGHUP)
+	defer signal.Stop(catch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- lc.ReloadOnSignal(ctx, path, nil) }()
+
+	deadline := time.Now().Add(time.Second)
+	for lc.Load().MaxWait != 3*time.Second {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,407 @@
+package litefs
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConsistencyHeader is the header used to propagate consistency tokens between
+// services.
+const ConsistencyHeader = "Litefs-Consistency"
+
+var (
+	errInvalidToken = errors.New("invalid consistency token")
+)
+
+// ConsistencyToken maps database names to the minimum position a reader must
+// have replicated to observe the writes that caused a request.
+type ConsistencyToken map[string]Pos
+
+// ParseConsistencyToken parses a token in the "db=TXID/CHECKSUM,..." format
+// returned by ConsistencyToken.String.
+func ParseConsistencyToken(s string) (ConsistencyToken, error) {
+	t := make(ConsistencyToken)
+	if s == "" {
+		return t, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		db, pos, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || !validDatabaseName(db) {
+			return nil, fmt.Errorf("%w: %q", errInvalidToken, s)
+		}
+		p, err := ParsePos(pos)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", errInvalidToken, err)
+		}
+		t.Observe(db, p)
+	}
+	return t, nil
+}
+
+// validDatabaseName reports whether name is a database file name, rather than
+// a path that could escape the mount directory.
+func validDatabaseName(name string) bool {
+	return name != "" && name != "." && name != ".." && name == filepath.Base(name)
+}
+
+// String encodes t in the "db=TXID/CHECKSUM,..." format.
+func (t ConsistencyToken) String() string {
+	parts := make([]string, 0, len(t))
+	for db, pos := range t {
+		parts = append(parts, db+"="+pos.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// Observe raises the position for db to pos if pos is further ahead.
+func (t ConsistencyToken) Observe(db string, pos Pos) {
+	if cur, ok := t[db]; !ok || pos.TXID > cur.TXID {
+		t[db] = pos
+	}
+}
+
+// ConsistencyTracker tracks the latest position this process knows of for each
+// database, from tx events and from tokens on incoming requests. Its Transport
+// attaches that position to outgoing requests and its Middleware waits for
+// positions attached to incoming requests, so causal consistency flows through
+// service-to-service calls.
+type ConsistencyTracker struct {
+	// Dir is the LiteFS mount directory in which databases named in tokens are
+	// found.
+	Dir string
+
+	// MaxWait bounds how long Middleware waits for a token's positions before
+	// responding with 503 Service Unavailable.
+	MaxWait time.Duration
+
+	// Proxy, if set, enables cooperative mode with the LiteFS proxy. For
+	// requests that arrived through the proxy, positions of the proxy's
+	// database already covered by its TXID cookie aren't waited for again.
+	Proxy *ProxyConfig
+
+	// Config, if set, supplies MaxWait in place of the field above so that it
+	// can be tuned at runtime. The field is used while Config's is zero.
+	Config *LiveConfig
+
+	es EventSource
+	m  sync.Mutex
+
+	token   ConsistencyToken
+	applied map[string]time.Time
+}
+
+// NewConsistencyTracker returns a new *ConsistencyTracker for databases mounted
+// in dir that subscribes to the local LiteFS node's event stream.
+func NewConsistencyTracker(dir string) *ConsistencyTracker {
+	t := &ConsistencyTracker{
+		Dir:     dir,
+		MaxWait: 5 * time.Second,
+		es:      NewEventSource(),
+		token:   make(ConsistencyToken),
+		applied: make(map[string]time.Time),
+	}
+
+	spawn(t.run)
+
+	return t
+}
+
+// Close unsubscribes to the local LiteFS node's event stream.
+func (t *ConsistencyTracker) Close() {
+	t.es.Close()
+}
+
+// Token returns a copy of the latest known positions.
+func (t *ConsistencyTracker) Token() ConsistencyToken {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	token := make(ConsistencyToken, len(t.token))
+	for db, pos := range t.token {
+		token[db] = pos
+	}
+	return token
+}
+
+// Observe records that this process knows of pos for db.
+func (t *ConsistencyTracker) Observe(db string, pos Pos) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.token.Observe(db, pos)
+}
+
+// LastApplied returns when a tx event was last received for db, which is the
+// last time the local copy of db was known to be up to date. The zero time is
+// returned if no tx event has been received.
+func (t *ConsistencyTracker) LastApplied(db string) time.Time {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	return t.applied[db]
+}
+
+// Wait blocks until every database in token has reached its position locally.
+func (t *ConsistencyTracker) Wait(ctx context.Context, token ConsistencyToken) error {
+	for db, pos := range token {
+		if !validDatabaseName(db) {
+			return fmt.Errorf("%w: invalid database name %q", errInvalidToken, db)
+		}
+		if err := WaitForPos(ctx, filepath.Join(t.Dir, db), pos.TXID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Transport returns an http.RoundTripper that sets the ConsistencyHeader on
+// outgoing requests before passing them to base. If base is nil,
+// http.DefaultTransport is used.
+func (t *ConsistencyTracker) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		token := t.Token()
+		if len(token) == 0 {
+			return base.RoundTrip(r)
+		}
+
+		r = r.Clone(r.Context())
+		r.Header.Set(ConsistencyHeader, token.String())
+		return base.RoundTrip(r)
+	})
+}
+
+// maxWait returns MaxWait, from Config if it is set there.
+func (t *ConsistencyTracker) maxWait() time.Duration {
+	if t.Config != nil {
+		if d := t.Config.Load().MaxWait; d > 0 {
+			return d
+		}
+	}
+	return t.MaxWait
+}
+
+// Middleware returns an http.Handler that waits up to MaxWait for the
+// positions in an incoming request's ConsistencyHeader, and in any
+// ReadYourWrites level already in its context, before passing it to next.
+// Those positions are also observed so that they propagate to requests made
+// through Transport, and are added to the request's context so that KV,
+// SessionStore and connections wrapped by Wrap honor them too.
+//
+// In cooperative mode (see Proxy), the proxy's own read-your-writes wait is
+// trusted rather than repeated, but positions beyond it are still waited for.
+func (t *ConsistencyTracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := ParseConsistencyToken(r.Header.Get(ConsistencyHeader))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c := ConsistencyFromContext(r.Context()).Merge(ReadYourWrites(token))
+
+		ctx, cancel := context.WithTimeout(r.Context(), t.maxWait())
+		defer cancel()
+
+		if err := t.Wait(ctx, t.unproxied(r, c.token)); err != nil {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		// only databases that exist are observed, so that requests can't
+		// grow the token without bound.
+		for db, pos := range c.token {
+			if _, err := os.Stat(PosPath(filepath.Join(t.Dir, db))); err == nil {
+				t.Observe(db, pos)
+			}
+		}
+		next.ServeHTTP(w, r.WithContext(WithConsistency(r.Context(), c)))
+	})
+}
+
+// Wrap returns a connector for the database at databasePath whose queries
+// honor the Consistency in their context (see WithConsistency). Use it with
+// sql.OpenDB.
+func (t *ConsistencyTracker) Wrap(c driver.Connector, databasePath string) driver.Connector {
+	return &hookConnector{Connector: c, hooks: &DriverHooks{
+		Query: func(ctx context.Context, query string, fn func() (driver.Rows, error)) (rows driver.Rows, err error) {
+			err = ConsistencyFromContext(ctx).Read(ctx, databasePath, t, func() (err error) {
+				rows, err = fn()
+				return err
+			})
+			return rows, err
+		},
+	}}
+}
+
+// unproxied returns the positions in token the LiteFS proxy hasn't already
+// waited for before passing r on.
+func (t *ConsistencyTracker) unproxied(r *http.Request, token ConsistencyToken) ConsistencyToken {
+	if t.Proxy == nil || t.Proxy.DB == "" || !t.Proxy.Proxied(r) {
+		return token
+	}
+	txid, ok := ProxyTXID(r)
+	if pos, exists := token[t.Proxy.DB]; !ok || !exists || pos.TXID > txid {
+		return token
+	}
+
+	remaining := make(ConsistencyToken, len(token))
+	for db, pos := range token {
+		if db != t.Proxy.DB {
+			remaining[db] = pos
+		}
+	}
+	return remaining
+}
+
+func (t *ConsistencyTracker) run() {
+	for {
+		select {
+		case event, running := <-t.es.C():
+			if !running {
+				return
+			}
+			data, ok := event.Data.(*TxEventData)
+			if !ok {
+				continue
+			}
+			if pos, err := data.Pos(); err == nil {
+				t.observeApplied(event.DB, pos)
+			}
+		case _, running := <-t.es.ErrC():
+			if !running {
+				return
+			}
+		}
+	}
+}
+
+func (t *ConsistencyTracker) observeApplied(db string, pos Pos) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.token.Observe(db, pos)
+	t.applied[db] = time.Now()
+}
+
+// Consistency is the consistency level required of a read.
+type Consistency struct {
+	strong    bool
+	staleness time.Duration
+	token     ConsistencyToken
+}
+
+// Eventual reads whatever the local copy of the database holds.
+func Eventual() Consistency {
+	return Consistency{}
+}
+
+// Strong reads the latest data written on the primary. The read is made after
+// acquiring the HALT lock, which brings the local copy up to date, so it is as
+// slow as forwarding the read to the primary.
+func Strong() Consistency {
+	return Consistency{strong: true}
+}
+
+// BoundedStaleness reads from the local copy of the database if it was known
+// to be up to date within d, otherwise the read is made while holding the HALT
+// lock, which brings the local copy up to date.
+func BoundedStaleness(d time.Duration) Consistency {
+	return Consistency{staleness: d}
+}
+
+// ReadYourWrites waits for the local copy of the database to reach the
+// position in token, typically returned from an earlier write, before reading.
+func ReadYourWrites(token ConsistencyToken) Consistency {
+	return Consistency{token: token}
+}
+
+// Merge returns a level satisfying both c and other.
+func (c Consistency) Merge(other Consistency) Consistency {
+	merged := Consistency{
+		strong:    c.strong || other.strong,
+		staleness: c.staleness,
+	}
+	if merged.staleness == 0 || (other.staleness > 0 && other.staleness < merged.staleness) {
+		merged.staleness = other.staleness
+	}
+	if len(c.token) != 0 || len(other.token) != 0 {
+		merged.token = make(ConsistencyToken, len(c.token)+len(other.token))
+		for db, pos := range c.token {
+			merged.token.Observe(db, pos)
+		}
+		for db, pos := range other.token {
+			merged.token.Observe(db, pos)
+		}
+	}
+	return merged
+}
+
+// String returns a description of c, e.g. "bounded-staleness(5s)".
+func (c Consistency) String() string {
+	var parts []string
+	if c.strong {
+		parts = append(parts, "strong")
+	}
+	if c.staleness > 0 {
+		parts = append(parts, fmt.Sprintf("bounded-staleness(%s)", c.staleness))
+	}
+	if len(c.token) != 0 {
+		parts = append(parts, fmt.Sprintf("read-your-writes(%s)", c.token))
+	}
+	if len(parts) == 0 {
+		return "eventual"
+	}
+	return strings.Join(parts, "+")
+}
+
+// Read calls fn once the local copy of the database at databasePath satisfies
+// c. tracker reports when the database was last known to be up to date for
+// BoundedStaleness reads. If nil, such reads always take the HALT lock.
+func (c Consistency) Read(ctx context.Context, databasePath string, tracker *ConsistencyTracker, fn func() error) error {
+	name := filepath.Base(databasePath)
+	if pos, ok := c.token[name]; ok {
+		if err := WaitForPos(ctx, databasePath, pos.TXID); err != nil {
+			return err
+		}
+	}
+
+	if c.strong || (c.staleness > 0 && (tracker == nil || time.Since(tracker.LastApplied(name)) > c.staleness)) {
+		return WithHaltContext(ctx, databasePath, fn)
+	}
+	return fn()
+}
+
+type consistencyKey struct{}
+
+// WithConsistency returns a copy of ctx carrying the consistency level c for
+// reads made with it.
+func WithConsistency(ctx context.Context, c Consistency) context.Context {
+	return context.WithValue(ctx, consistencyKey{}, c)
+}
+
+// ConsistencyFromContext returns the level stored in ctx by WithConsistency,
+// or Eventual if none is set.
+func ConsistencyFromContext(ctx context.Context) Consistency {
+	c, _ := ctx.Value(consistencyKey{}).(Consistency)
+	return c
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,215 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsistencyToken(t *testing.T) {
+	token, err := ParseConsistencyToken("b=0000000000000002/0000000000000000, a=0000000000000001/0000000000000000")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	token.Observe("a", Pos{TXID: 3})
+	token.Observe("b", Pos{TXID: 1})
+	if s := token.String(); s != "a=0000000000000003/0000000000000000,b=0000000000000002/0000000000000000" {
+		t.Fatalf("wrong token: %s", s)
+	}
+
+	for _, s := range []string{"a", "..=0000000000000001/0000000000000000", "a/b=0000000000000001/0000000000000000"} {
+		if _, err := ParseConsistencyToken(s); err == nil {
+			t.Fatalf("expected error for %q", s)
+		}
+	}
+}
+
+func TestConsistencyTracker(t *testing.T) {
+	t.Run("transport", func(t *testing.T) {
+		mockServer(t, txEventJSON, flush)
+		tracker := NewConsistencyTracker(t.TempDir())
+		t.Cleanup(tracker.Close)
+		time.Sleep(20 * time.Millisecond)
+
+		var header string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header.Get(ConsistencyHeader)
+		}))
+		t.Cleanup(s.Close)
+
+		client := &http.Client{Transport: tracker.Transport(nil)}
+		resp, err := client.Get(s.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		resp.Body.Close()
+
+		if header != "db=0000000000000027/83b05248774ce767" {
+			t.Fatalf("wrong header: %q", header)
+		}
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		mockServer(t)
+		dir := t.TempDir()
+		tracker := NewConsistencyTracker(dir)
+		tracker.MaxWait = 20 * time.Millisecond
+		t.Cleanup(tracker.Close)
+
+		h := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		serve := func() int {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(ConsistencyHeader, "db=0000000000000002/0000000000000000")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w.Code
+		}
+
+		writePosFile(t, filepath.Join(dir, "db"), "0000000000000001/0000000000000000")
+		if code := serve(); code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d", code)
+		}
+
+		writePosFile(t, filepath.Join(dir, "db"), "0000000000000002/0000000000000000")
+		if code := serve(); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+		if pos := tracker.Token()["db"]; pos.TXID != 2 {
+			t.Fatalf("expected observed TXID 2, got %s", pos.TXID)
+		}
+
+		if err := tracker.Wait(context.Background(), ConsistencyToken{"../db": {TXID: 1}}); !errors.Is(err, errInvalidToken) {
+			t.Fatalf("expected errInvalidToken, got %v", err)
+		}
+	})
+
+	t.Run("cooperative", func(t *testing.T) {
+		mockServer(t)
+		dir := t.TempDir()
+		tracker := NewConsistencyTracker(dir)
+		tracker.MaxWait = 20 * time.Millisecond
+		tracker.Proxy = &ProxyConfig{Addr: ":8080", Target: "localhost:8081", DB: "db"}
+		t.Cleanup(tracker.Close)
+		writePosFile(t, filepath.Join(dir, "db"), "0000000000000001/0000000000000000")
+
+		h := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		serve := func(localPort int, cookie string) int {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.TCPAddr{Port: localPort}))
+			r.Header.Set(ConsistencyHeader, "db=0000000000000002/0000000000000000")
+			r.AddCookie(&http.Cookie{Name: ProxyTXIDCookie, Value: cookie})
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w.Code
+		}
+
+		// the proxy already waited for TXID 2.
+		if code := serve(8081, "0000000000000002"); code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", code)
+		}
+		// the proxy only waited for TXID 1.
+		if code := serve(8081, "0000000000000001"); code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d", code)
+		}
+		// the request didn't come through the proxy.
+		if code := serve(9000, "0000000000000002"); code != http.StatusServiceUnavailable {
+			t.Fatalf("expected 503, got %d", code)
+		}
+	})
+}
+
+func TestConsistency(t *testing.T) {
+	t.Run("merge", func(t *testing.T) {
+		a := ReadYourWrites(ConsistencyToken{"a": {TXID: 2}, "b": {TXID: 1}})
+		b := BoundedStaleness(time.Second).Merge(ReadYourWrites(ConsistencyToken{"b": {TXID: 3}}))
+
+		c := a.Merge(b).Merge(BoundedStaleness(time.Minute))
+		if s := c.String(); s != "bounded-staleness(1s)+read-your-writes(a=0000000000000002/0000000000000000,b=0000000000000003/0000000000000000)" {
+			t.Fatalf("wrong consistency: %s", s)
+		}
+		if s := c.Merge(Strong()).String(); !strings.HasPrefix(s, "strong+") {
+			t.Fatalf("wrong consistency: %s", s)
+		}
+		if s := Eventual().String(); s != "eventual" {
+			t.Fatalf("wrong consistency: %s", s)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		if s := ConsistencyFromContext(context.Background()).String(); s != "eventual" {
+			t.Fatalf("wrong default consistency: %s", s)
+		}
+		ctx := WithConsistency(context.Background(), Strong())
+		if s := ConsistencyFromContext(ctx).String(); s != "strong" {
+			t.Fatalf("wrong consistency: %s", s)
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "db")
+		writePosFile(t, path, "0000000000000001/0000000000000000")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		c := ReadYourWrites(ConsistencyToken{"db": {TXID: 2}})
+		if err := c.Read(ctx, path, nil, func() error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+
+		writePosFile(t, path, "0000000000000002/0000000000000000")
+		var called bool
+		if err := c.Read(context.Background(), path, nil, func() error { called = true; return nil }); err != nil || !called {
+			t.Fatalf("unexpected result: %v, %v", called, err)
+		}
+	})
+
+	t.Run("middleware context", func(t *testing.T) {
+		mockServer(t)
+		dir := t.TempDir()
+		tracker := NewConsistencyTracker(dir)
+		t.Cleanup(tracker.Close)
+		writePosFile(t, filepath.Join(dir, "db"), "0000000000000002/0000000000000000")
+
+		var actual Consistency
+		h := tracker.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			actual = ConsistencyFromContext(r.Context())
+		}))
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r = r.WithContext(WithConsistency(r.Context(), Strong()))
+		r.Header.Set(ConsistencyHeader, "db=0000000000000002/0000000000000000")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+
+		if s := actual.String(); s != "strong+read-your-writes(db=0000000000000002/0000000000000000)" {
+			t.Fatalf("wrong consistency: %s", s)
+		}
+	})
+
+	t.Run("wrap", func(t *testing.T) {
+		mockServer(t)
+		dir := t.TempDir()
+		tracker := NewConsistencyTracker(dir)
+		t.Cleanup(tracker.Close)
+		writePosFile(t, filepath.Join(dir, "db"), "0000000000000001/0000000000000000")
+
+		db := sql.OpenDB(tracker.Wrap(&fakeConnector{}, filepath.Join(dir, "db")))
+		t.Cleanup(func() { db.Close() })
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		ctx = WithConsistency(ctx, ReadYourWrites(ConsistencyToken{"db": {TXID: 2}}))
+
+		if _, err := db.QueryContext(ctx, "SELECT 1"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline exceeded, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,35 @@
+package litefs
+
+import (
+	"context"
+)
+
+type brokerKey struct{}
+
+type primaryMonitorKey struct{}
+
+// NewContext returns a copy of ctx carrying b so that handlers and libraries
+// can subscribe to the process's events without it being passed to every
+// constructor. A broker is shared rather than an *EventSubscription because
+// each event on a subscription is only delivered to one reader.
+func NewContext(ctx context.Context, b *EventBroker) context.Context {
+	return context.WithValue(ctx, brokerKey{}, b)
+}
+
+// FromContext returns the *EventBroker stored in ctx by NewContext.
+func FromContext(ctx context.Context) (*EventBroker, bool) {
+	b, ok := ctx.Value(brokerKey{}).(*EventBroker)
+	return b, ok
+}
+
+// NewPrimaryMonitorContext returns a copy of ctx carrying pm.
+func NewPrimaryMonitorContext(ctx context.Context, pm *PrimaryMonitor) context.Context {
+	return context.WithValue(ctx, primaryMonitorKey{}, pm)
+}
+
+// PrimaryMonitorFromContext returns the *PrimaryMonitor stored in ctx by
+// NewPrimaryMonitorContext.
+func PrimaryMonitorFromContext(ctx context.Context) (*PrimaryMonitor, bool) {
+	pm, ok := ctx.Value(primaryMonitorKey{}).(*PrimaryMonitor)
+	return pm, ok
+}
@@ -0,0 +1,26 @@
+package litefs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := FromContext(ctx); ok {
+		t.Fatal("unexpected broker")
+	}
+	if _, ok := PrimaryMonitorFromContext(ctx); ok {
+		t.Fatal("unexpected monitor")
+	}
+
+	b, pm := &EventBroker{}, &PrimaryMonitor{}
+	ctx = NewPrimaryMonitorContext(NewContext(ctx, b), pm)
+
+	if actual, ok := FromContext(ctx); !ok || actual != b {
+		t.Fatal("wrong broker")
+	}
+	if actual, ok := PrimaryMonitorFromContext(ctx); !ok || actual != pm {
+		t.Fatal("wrong monitor")
+	}
+}
@@ -0,0 +1,106 @@
+// Package grpc routes gRPC write calls to the LiteFS primary, as
+// litefs.ReplayWrites and litefs.Router do for HTTP requests.
+//
+// On replicas, calls to methods matching the configured write patterns are
+// rejected, or answered with a Fly-Replay header so that the Fly.io proxy
+// replays them on the primary:
+//
+//	c := grpc.Config{Monitor: pm, WriteMethods: []string{"/notes.Notes/Create*"}, Replay: true}
+//	s := grpclib.NewServer(
+//		grpclib.UnaryInterceptor(c.UnaryServerInterceptor()),
+//		grpclib.StreamInterceptor(c.StreamServerInterceptor()),
+//	)
+package grpc
+
+import (
+	"context"
+	"path"
+
+	"github.com/superfly/litefs-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// PrimaryMetadata is the response header that names the primary on calls
+// rejected by a replica, so that clients can retry there.
+const PrimaryMetadata = "litefs-primary"
+
+// Config configures the interceptors. It must not be modified after the
+// interceptors are created.
+type Config struct {
+	// Monitor reports the node's role. Until it is ready, the node is
+	// treated as a replica.
+	Monitor *litefs.PrimaryMonitor
+
+	// WriteMethods are path.Match patterns of the full names of methods that
+	// write, such as "/notes.Notes/Create" or "/notes.Notes/*". Calls to other
+	// methods are always served.
+	WriteMethods []string
+
+	// Replay, if set, answers write calls on replicas with a Fly-Replay
+	// header naming the primary, so that the Fly.io proxy replays them there.
+	// Otherwise they fail with FailedPrecondition.
+	Replay bool
+}
+
+// UnaryServerInterceptor returns an interceptor that routes unary write calls.
+func (c Config) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := c.route(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that routes streaming write
+// calls. Calls are routed when they start, not per message.
+func (c Config) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := c.route(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// route returns the status to fail a call to method with, or nil if this node
+// should serve it.
+func (c Config) route(ctx context.Context, method string) error {
+	if !c.isWrite(method) {
+		return nil
+	}
+	isPrimary, err := c.Monitor.IsPrimary()
+	if err == nil && isPrimary {
+		return nil
+	}
+
+	hostname, _ := c.Monitor.Hostname()
+	if hostname == "" {
+		return status.Error(codes.Unavailable, litefs.ErrNoPrimary.Error())
+	}
+
+	md := metadata.Pairs(PrimaryMetadata, hostname)
+	if c.Replay {
+		md.Set(litefs.FlyReplayHeader, "instance="+hostname)
+	}
+	if err := grpc.SetHeader(ctx, md); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if c.Replay {
+		return status.Error(codes.Unavailable, "replaying on the primary")
+	}
+	return status.Error(codes.FailedPrecondition, litefs.ErrPrimaryRequired.Error())
+}
+
+// isWrite reports whether method matches one of the write patterns.
+func (c Config) isWrite(method string) bool {
+	for _, pattern := range c.WriteMethods {
+		if ok, _ := path.Match(pattern, method); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package grpc_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs-go"
+	litefsgrpc "github.com/superfly/litefs-go/contrib/grpc"
+	"github.com/superfly/litefs-go/litefstest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// The health service stands in for an application's: Check is a unary write
+// and Watch a streaming one.
+const (
+	checkMethod = "/grpc.health.v1.Health/Check"
+	watchMethod = "/grpc.health.v1.Health/Watch"
+)
+
+func TestInterceptors(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		isPrimary bool
+		hostname  string
+		replay    bool
+		code      codes.Code
+		replayTo  string
+	}{
+		{name: "primary", isPrimary: true, hostname: "node-1", code: codes.OK},
+		{name: "replica", hostname: "node-2", code: codes.FailedPrecondition},
+		{name: "replay", hostname: "node-2", replay: true, code: codes.Unavailable, replayTo: "instance=node-2"},
+		{name: "no primary", code: codes.Unavailable},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := litefstest.NewEventServer()
+			t.Cleanup(s.Close)
+			s.SetInit(tt.isPrimary, tt.hostname)
+
+			client := dial(t, s, litefsgrpc.Config{WriteMethods: []string{checkMethod, watchMethod}, Replay: tt.replay})
+			ctx := context.Background()
+
+			var header, trailer metadata.MD
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Header(&header), grpc.Trailer(&trailer))
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("expected %s, got %v", tt.code, err)
+			}
+			if tt.code == codes.OK {
+				return
+			}
+
+			md := metadata.Join(header, trailer)
+			if primary := md.Get(litefsgrpc.PrimaryMetadata); tt.hostname != "" && (len(primary) != 1 || primary[0] != tt.hostname) {
+				t.Fatalf("expected primary %q, got %v", tt.hostname, primary)
+			}
+			if replay := md.Get(litefs.FlyReplayHeader); tt.replayTo != "" && (len(replay) != 1 || replay[0] != tt.replayTo) {
+				t.Fatalf("expected replay to %q, got %v", tt.replayTo, replay)
+			}
+
+			stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := stream.Recv(); status.Code(err) != tt.code {
+				t.Fatalf("expected %s from stream, got %v", tt.code, err)
+			}
+		})
+	}
+}
+
+func TestInterceptorsReadMethods(t *testing.T) {
+	s := litefstest.NewEventServer()
+	t.Cleanup(s.Close)
+	s.SetInit(false, "node-2")
+
+	// calls to methods that don't match a write pattern are served anywhere.
+	client := dial(t, s, litefsgrpc.Config{WriteMethods: []string{"/notes.Notes/*"}})
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+// dial serves the health service with c's interceptors over an in-memory
+// connection, with c.Monitor following s, and returns a client for it.
+func dial(t *testing.T, s *litefstest.EventServer, c litefsgrpc.Config) healthpb.HealthClient {
+	t.Helper()
+
+	prev := litefs.EventSubscriptionURL
+	litefs.EventSubscriptionURL = s.EventsURL()
+	t.Cleanup(func() { litefs.EventSubscriptionURL = prev })
+
+	c.Monitor = litefs.NewPrimaryMonitor()
+	t.Cleanup(c.Monitor.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Monitor.WaitReady(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(c.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(c.StreamServerInterceptor()),
+	)
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
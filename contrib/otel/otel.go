@@ -0,0 +1,205 @@
+// Package otel traces LiteFS event subscriptions with OpenTelemetry.
+//
+// Each connection to the event stream is a span that ends when the connection
+// does, recording the error that ended it. Events received on the connection
+// are span events. Spans and events carry the hostname of the instance and the
+// name of the database as attributes:
+//
+//	o := otel.NewObserver(otel.Tracer())
+//	b := litefs.NewEventBroker(litefs.WithObserver(o))
+//
+// Connections, disconnections and received events can also be counted with
+// RecordMetrics, for backends that alert on metrics rather than traces.
+package otel
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/superfly/litefs-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the tracer returned by Tracer.
+const ScopeName = "github.com/superfly/litefs-go/contrib/otel"
+
+// Names of the spans, span events and attributes recorded by an Observer.
+const (
+	SpanConnection = "litefs.events.connection"
+	EventReceived  = "litefs.event"
+
+	AttrHostname        = attribute.Key("litefs.hostname")
+	AttrURL             = attribute.Key("litefs.url")
+	AttrEventType       = attribute.Key("litefs.event.type")
+	AttrDB              = attribute.Key("litefs.db")
+	AttrTXID            = attribute.Key("litefs.txid")
+	AttrPrimaryHostname = attribute.Key("litefs.primary_hostname")
+	AttrIsPrimary       = attribute.Key("litefs.is_primary")
+	AttrError           = attribute.Key("litefs.error")
+)
+
+// Names of the counters recorded by an Observer once RecordMetrics is called.
+const (
+	MetricConnections = "litefs.events.connections"
+	MetricDisconnects = "litefs.events.disconnects"
+	MetricReceived    = "litefs.events.received"
+)
+
+// Tracer returns a tracer from the global tracer provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(ScopeName)
+}
+
+// Meter returns a meter from the global meter provider.
+func Meter() metric.Meter {
+	return otel.Meter(ScopeName)
+}
+
+// Observer is a litefs.StreamObserver that records each connection of a
+// subscription as a span. It is safe to share between subscriptions.
+type Observer struct {
+	tracer   trace.Tracer
+	hostname string
+
+	connections metric.Int64Counter
+	disconnects metric.Int64Counter
+	received    metric.Int64Counter
+
+	m     sync.Mutex
+	spans map[*litefs.EventSubscription]trace.Span
+}
+
+var _ litefs.StreamObserver = (*Observer)(nil)
+
+// NewObserver returns a new *Observer that starts spans with tracer. Spans are
+// attributed to the hostname reported by the operating system, which on Fly.io
+// is the ID of the machine.
+func NewObserver(tracer trace.Tracer) *Observer {
+	hostname, _ := os.Hostname()
+	return NewObserverWithHostname(tracer, hostname)
+}
+
+// NewObserverWithHostname returns a new *Observer that starts spans with
+// tracer, attributed to the instance hostname.
+func NewObserverWithHostname(tracer trace.Tracer, hostname string) *Observer {
+	return &Observer{
+		tracer:   tracer,
+		hostname: hostname,
+		spans:    make(map[*litefs.EventSubscription]trace.Span),
+	}
+}
+
+// RecordMetrics makes o count connections, disconnections and received events
+// with counters created from meter, attributed like spans except that
+// disconnections are attributed with whether they were caused by an error. It
+// must be called before o is used.
+func (o *Observer) RecordMetrics(meter metric.Meter) (err error) {
+	if o.connections, err = meter.Int64Counter(MetricConnections,
+		metric.WithDescription("Connections made to the LiteFS event stream."),
+	); err != nil {
+		return err
+	}
+	if o.disconnects, err = meter.Int64Counter(MetricDisconnects,
+		metric.WithDescription("Connections to the LiteFS event stream that ended or failed."),
+	); err != nil {
+		return err
+	}
+	o.received, err = meter.Int64Counter(MetricReceived,
+		metric.WithDescription("Events received from the LiteFS event stream."),
+	)
+	return err
+}
+
+// Connected starts the span of the connection.
+func (o *Observer) Connected(es *litefs.EventSubscription, url string) {
+	if o.connections != nil {
+		o.connections.Add(context.Background(), 1, metric.WithAttributes(AttrHostname.String(o.hostname)))
+	}
+
+	_, span := o.tracer.Start(context.Background(), SpanConnection,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(AttrHostname.String(o.hostname), AttrURL.String(url)),
+	)
+
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if prev := o.spans[es]; prev != nil {
+		prev.End()
+	}
+	o.spans[es] = span
+}
+
+// Disconnected ends the span of the connection, recording err unless the
+// subscription was closed. An attempt to connect that failed is recorded as a
+// span of its own.
+func (o *Observer) Disconnected(es *litefs.EventSubscription, err error) {
+	o.m.Lock()
+	span := o.spans[es]
+	delete(o.spans, es)
+	o.m.Unlock()
+
+	if span == nil {
+		_, span = o.tracer.Start(context.Background(), SpanConnection,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(AttrHostname.String(o.hostname)),
+		)
+	}
+	failed := err != nil && !errors.Is(err, context.Canceled)
+	if failed {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+
+	if o.disconnects != nil {
+		o.disconnects.Add(context.Background(), 1, metric.WithAttributes(AttrHostname.String(o.hostname), AttrError.Bool(failed)))
+	}
+}
+
+// Received adds the event to the span of the connection.
+func (o *Observer) Received(es *litefs.EventSubscription, e *litefs.Event) {
+	if o.received != nil {
+		attrs := []attribute.KeyValue{AttrHostname.String(o.hostname), AttrEventType.String(e.Type)}
+		if e.DB != "" {
+			attrs = append(attrs, AttrDB.String(e.DB))
+		}
+		o.received.Add(context.Background(), 1, metric.WithAttributes(attrs...))
+	}
+
+	o.m.Lock()
+	span := o.spans[es]
+	o.m.Unlock()
+
+	if span == nil {
+		return
+	}
+	span.AddEvent(EventReceived, trace.WithAttributes(o.attributes(e)...))
+}
+
+// attributes returns the attributes of a received event.
+func (o *Observer) attributes(e *litefs.Event) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		AttrHostname.String(o.hostname),
+		AttrEventType.String(e.Type),
+	}
+	if e.DB != "" {
+		attrs = append(attrs, AttrDB.String(e.DB))
+	}
+
+	switch data := e.Data.(type) {
+	case *litefs.TxEventData:
+		attrs = append(attrs, AttrTXID.String(data.TXID))
+	case *litefs.InitEventData:
+		attrs = append(attrs, AttrIsPrimary.Bool(data.IsPrimary), AttrPrimaryHostname.String(data.Hostname))
+	case *litefs.PrimaryChangeEventData:
+		attrs = append(attrs, AttrIsPrimary.Bool(data.IsPrimary), AttrPrimaryHostname.String(data.Hostname))
+	}
+	return attrs
+}
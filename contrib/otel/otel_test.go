@@ -0,0 +1,159 @@
+package otel_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs-go"
+	litefsotel "github.com/superfly/litefs-go/contrib/otel"
+	"github.com/superfly/litefs-go/litefstest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestObserver(t *testing.T) {
+	s := litefstest.NewEventServer()
+	t.Cleanup(s.Close)
+
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	o := litefsotel.NewObserverWithHostname(tp.Tracer(litefsotel.ScopeName), "machine-1")
+	if err := o.RecordMetrics(mp.Meter(litefsotel.ScopeName)); err != nil {
+		t.Fatal(err)
+	}
+
+	es := litefs.SubscribeEvents(
+		litefs.WithURL(s.EventsURL()),
+		litefs.WithObserver(o),
+		litefs.WithReconnect(litefs.Backoff{Min: time.Millisecond}),
+	)
+	readEvent(t, es, litefs.EventTypeInit)
+	waitClients(t, s)
+	s.Tx("db", 3)
+	readEvent(t, es, litefs.EventTypeTx)
+
+	// a hangup ends the first connection with an error; closing the
+	// subscription ends the second without one.
+	s.Hangup()
+	readEvent(t, es, litefs.EventTypeInit)
+	es.Close()
+
+	deadline := time.Now().Add(time.Second)
+	for len(spans.Ended()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for spans, got %d", len(spans.Ended()))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	ended := spans.Ended()
+	first, second := ended[0], ended[1]
+	for _, span := range ended {
+		if span.Name() != litefsotel.SpanConnection || !hasAttr(span.Attributes(), litefsotel.AttrHostname.String("machine-1")) {
+			t.Fatalf("unexpected span: %s %v", span.Name(), span.Attributes())
+		}
+	}
+	if first.Status().Code != codes.Error || second.Status().Code != codes.Unset {
+		t.Fatalf("unexpected statuses: %v, %v", first.Status(), second.Status())
+	}
+
+	// the received events are followed by the recorded disconnect error.
+	events := first.Events()
+	if len(events) != 3 || events[0].Name != litefsotel.EventReceived || events[2].Name != "exception" {
+		t.Fatalf("unexpected span events: %v", events)
+	}
+	if attrs := events[0].Attributes; !hasAttr(attrs, litefsotel.AttrIsPrimary.Bool(true)) || !hasAttr(attrs, litefsotel.AttrPrimaryHostname.String("node-1")) {
+		t.Fatalf("unexpected init attributes: %v", attrs)
+	}
+	if attrs := events[1].Attributes; !hasAttr(attrs, litefsotel.AttrDB.String("db")) || !hasAttr(attrs, litefsotel.AttrTXID.String(litefs.TXID(3).String())) {
+		t.Fatalf("unexpected tx attributes: %v", attrs)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name  string
+		attrs []attribute.KeyValue
+		value int64
+	}{
+		{litefsotel.MetricConnections, nil, 2},
+		{litefsotel.MetricDisconnects, []attribute.KeyValue{litefsotel.AttrError.Bool(true)}, 1},
+		{litefsotel.MetricDisconnects, []attribute.KeyValue{litefsotel.AttrError.Bool(false)}, 1},
+		{litefsotel.MetricReceived, []attribute.KeyValue{litefsotel.AttrEventType.String(litefs.EventTypeInit)}, 2},
+		{litefsotel.MetricReceived, []attribute.KeyValue{litefsotel.AttrDB.String("db")}, 1},
+	} {
+		if value := counterValue(rm, tt.name, tt.attrs...); value != tt.value {
+			t.Fatalf("%s%v: expected %d, got %d", tt.name, tt.attrs, tt.value, value)
+		}
+	}
+}
+
+func readEvent(t *testing.T, es *litefs.EventSubscription, typ string) {
+	t.Helper()
+
+	select {
+	case e := <-es.C():
+		if e.Type != typ {
+			t.Fatalf("expected %s event, got %s", typ, e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for %s event", typ)
+	}
+}
+
+func waitClients(t *testing.T, s *litefstest.EventServer) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.WaitClients(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hasAttr(attrs []attribute.KeyValue, kv attribute.KeyValue) bool {
+	for _, attr := range attrs {
+		if attr == kv {
+			return true
+		}
+	}
+	return false
+}
+
+// counterValue sums the data points of the counter name that have attrs.
+func counterValue(rm metricdata.ResourceMetrics, name string, attrs ...attribute.KeyValue) int64 {
+	var value int64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if m.Name != name || !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				if matches(dp.Attributes, attrs) {
+					value += dp.Value
+				}
+			}
+		}
+	}
+	return value
+}
+
+func matches(set attribute.Set, attrs []attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if v, ok := set.Value(kv.Key); !ok || v != kv.Value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+package litefs
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultDatabaseScanInterval is how often a DatabaseWatcher scans the mount
+// directory by default.
+const DefaultDatabaseScanInterval = 5 * time.Second
+
+// DatabaseChange describes a database appearing in or disappearing from the
+// LiteFS mount.
+type DatabaseChange struct {
+	Name    string
+	Removed bool
+}
+
+// DatabaseWatcher tracks the databases in a LiteFS mount directory so that
+// multi-tenant applications can start and stop per-database work as databases
+// come and go. The directory is scanned every interval, and immediately when
+// a transaction arrives for a database that isn't known yet.
+type DatabaseWatcher struct {
+	dir      string
+	interval time.Duration
+	es       EventSource
+	m        sync.Mutex
+
+	dbs      map[string]struct{}
+	watchers []func(DatabaseChange)
+
+	// notify serializes calls to watchers.
+	notify sync.Mutex
+}
+
+// NewDatabaseWatcher returns a new *DatabaseWatcher for the LiteFS mount
+// directory dir that scans it every interval, or every
+// DefaultDatabaseScanInterval if interval is zero.
+func NewDatabaseWatcher(dir string, interval time.Duration) *DatabaseWatcher {
+	if interval <= 0 {
+		interval = DefaultDatabaseScanInterval
+	}
+
+	w := &DatabaseWatcher{
+		dir:      dir,
+		interval: interval,
+		es:       NewEventSource(WithEventFilter(EventTypeTx)),
+		dbs:      make(map[string]struct{}),
+	}
+	w.scan()
+
+	spawn(w.run)
+
+	return w
+}
+
+// Databases returns the names of the known databases, sorted.
+func (w *DatabaseWatcher) Databases() []string {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return sortedKeys(w.dbs)
+}
+
+// Watch calls fn with an appearance of each known database and then with
+// every change from now on. Calls are made one at a time, so fn should hand
+// off slow work. fn must not call Watch.
+func (w *DatabaseWatcher) Watch(fn func(DatabaseChange)) {
+	w.notify.Lock()
+	defer w.notify.Unlock()
+
+	w.m.Lock()
+	w.watchers = append(w.watchers, fn)
+	names := sortedKeys(w.dbs)
+	w.m.Unlock()
+
+	for _, name := range names {
+		fn(DatabaseChange{Name: name})
+	}
+}
+
+// Close unsubscribes from the local LiteFS node's event stream and stops
+// scanning.
+func (w *DatabaseWatcher) Close() {
+	w.es.Close()
+}
+
+func (w *DatabaseWatcher) run() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.scan()
+		case e, running := <-w.es.C():
+			if !running {
+				return
+			}
+			if e.Type != EventTypeTx {
+				continue
+			}
+			w.m.Lock()
+			_, known := w.dbs[e.DB]
+			w.m.Unlock()
+			if !known {
+				w.scan()
+			}
+		case _, running := <-w.es.ErrC():
+			if !running {
+				return
+			}
+		}
+	}
+}
+
+// scan updates the known databases from the position files in the mount
+// directory and notifies watchers of the differences.
+func (w *DatabaseWatcher) scan() {
+	paths, err := filepath.Glob(filepath.Join(w.dir, "*"+PosSuffix))
+	if err != nil {
+		return
+	}
+	found := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		found[strings.TrimSuffix(filepath.Base(path), PosSuffix)] = struct{}{}
+	}
+
+	w.notify.Lock()
+	defer w.notify.Unlock()
+
+	w.m.Lock()
+	var changes []DatabaseChange
+	for _, name := range sortedKeys(found) {
+		if _, ok := w.dbs[name]; !ok {
+			changes = append(changes, DatabaseChange{Name: name})
+		}
+	}
+	for _, name := range sortedKeys(w.dbs) {
+		if _, ok := found[name]; !ok {
+			changes = append(changes, DatabaseChange{Name: name, Removed: true})
+		}
+	}
+	w.dbs = found
+	watchers := w.watchers
+	w.m.Unlock()
+
+	for _, c := range changes {
+		for _, fn := range watchers {
+			fn(c)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package litefs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDatabaseWatcher(t *testing.T) {
+	t.Run("scan", func(t *testing.T) {
+		mockServer(t, hold)
+		dir := t.TempDir()
+		writePosFile(t, filepath.Join(dir, "a"), "0000000000000001/0000000000000000")
+
+		w := NewDatabaseWatcher(dir, 5*time.Millisecond)
+		t.Cleanup(w.Close)
+
+		changes := make(chan DatabaseChange, 10)
+		w.Watch(func(c DatabaseChange) { changes <- c })
+		assertDatabaseChange(t, changes, DatabaseChange{Name: "a"})
+
+		writePosFile(t, filepath.Join(dir, "b"), "0000000000000001/0000000000000000")
+		assertDatabaseChange(t, changes, DatabaseChange{Name: "b"})
+		if dbs := w.Databases(); !reflect.DeepEqual(dbs, []string{"a", "b"}) {
+			t.Fatalf("wrong databases: %v", dbs)
+		}
+
+		if err := os.Remove(PosPath(filepath.Join(dir, "a"))); err != nil {
+			t.Fatal(err)
+		}
+		assertDatabaseChange(t, changes, DatabaseChange{Name: "a", Removed: true})
+	})
+
+	t.Run("event", func(t *testing.T) {
+		dir := t.TempDir()
+		mockServer(t, sleep10, sleep10, txEventJSON, flush, hold)
+
+		w := NewDatabaseWatcher(dir, time.Hour)
+		t.Cleanup(w.Close)
+
+		changes := make(chan DatabaseChange, 10)
+		w.Watch(func(c DatabaseChange) { changes <- c })
+		writePosFile(t, filepath.Join(dir, "db"), "0000000000000027/83b05248774ce767")
+		assertDatabaseChange(t, changes, DatabaseChange{Name: "db"})
+	})
+}
+
+func assertDatabaseChange(t *testing.T, c <-chan DatabaseChange, expected DatabaseChange) {
+	t.Helper()
+
+	select {
+	case actual := <-c:
+		if actual != expected {
+			t.Fatalf("expected %+v, got %+v", expected, actual)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,139 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// DBStatsSample is a sample of a connection pool's statistics alongside the
+// node's LiteFS role.
+type DBStatsSample struct {
+	sql.DBStats
+
+	// Name is the LiteFS database name the pool was registered under.
+	Name string `json:"name"`
+
+	// Write reports whether the pool was registered as a write pool.
+	Write bool `json:"write"`
+
+	// IsPrimary reports whether the node was the primary when sampled.
+	IsPrimary bool `json:"isPrimary"`
+
+	// SinceLastTx is the time since a tx event was last received for the
+	// database, if a tracker is configured.
+	SinceLastTx time.Duration `json:"sinceLastTx,omitempty"`
+
+	// Misrouted reports whether a write pool had connections in use while the
+	// node was a replica, which suggests writes are bypassing routing.
+	Misrouted bool `json:"misrouted"`
+}
+
+// DBStatsExporter periodically samples the statistics of registered
+// connection pools together with the node's role so that misrouted write
+// traffic can be spotted.
+type DBStatsExporter struct {
+	// Monitor reports the node's role.
+	Monitor *PrimaryMonitor
+
+	// Tracker, if set, is used to report the time since the last tx event.
+	Tracker *ConsistencyTracker
+
+	// Interval is how often Run samples.
+	Interval time.Duration
+
+	// Handler is called by Run with each set of samples.
+	Handler func([]DBStatsSample)
+
+	m         sync.Mutex
+	pools     []registeredPool
+	misrouted int64
+}
+
+type registeredPool struct {
+	name  string
+	db    *sql.DB
+	write bool
+}
+
+// NewDBStatsExporter returns a new *DBStatsExporter that samples every 10
+// seconds.
+func NewDBStatsExporter(monitor *PrimaryMonitor) *DBStatsExporter {
+	return &DBStatsExporter{
+		Monitor:  monitor,
+		Interval: 10 * time.Second,
+	}
+}
+
+// Register adds a connection pool for the LiteFS database name. Pools that
+// are only used for writes should be registered with write set.
+func (e *DBStatsExporter) Register(name string, db *sql.DB, write bool) {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	e.pools = append(e.pools, registeredPool{name: name, db: db, write: write})
+}
+
+// Sample returns the current statistics of every registered pool.
+func (e *DBStatsExporter) Sample() []DBStatsSample {
+	isPrimary, roleErr := e.Monitor.IsPrimary()
+
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	samples := make([]DBStatsSample, len(e.pools))
+	for i, p := range e.pools {
+		s := DBStatsSample{
+			DBStats:   p.db.Stats(),
+			Name:      p.name,
+			Write:     p.write,
+			IsPrimary: isPrimary,
+		}
+		if e.Tracker != nil {
+			if t := e.Tracker.LastApplied(p.name); !t.IsZero() {
+				s.SinceLastTx = time.Since(t)
+			}
+		}
+		if roleErr == nil && p.write && !isPrimary && s.InUse > 0 {
+			s.Misrouted = true
+			e.misrouted++
+		}
+		samples[i] = s
+	}
+	return samples
+}
+
+// MisroutedSamples returns how many samples have been flagged as Misrouted.
+func (e *DBStatsExporter) MisroutedSamples() int64 {
+	e.m.Lock()
+	defer e.m.Unlock()
+
+	return e.misrouted
+}
+
+// Run samples every Interval and passes the samples to Handler until ctx is
+// done.
+func (e *DBStatsExporter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if samples := e.Sample(); e.Handler != nil {
+				e.Handler(samples)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Publish exposes the samples through expvar under name.
+func (e *DBStatsExporter) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return e.Sample()
+	}))
+}
@@ -0,0 +1,42 @@
+package litefs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDBStatsExporter(t *testing.T) {
+	pm, c := mockServerMonitor(t)
+	c <- pChangeNode2EventJSON
+	c <- flush
+	assertReady(t, pm, 5*time.Millisecond)
+
+	readDB := openFakeDB(t, nil, 0, 0)
+	writeDB := openFakeDB(t, nil, 0, 0)
+
+	e := NewDBStatsExporter(pm)
+	e.Register("db", readDB, false)
+	e.Register("db", writeDB, true)
+
+	for _, s := range e.Sample() {
+		if s.Misrouted {
+			t.Fatalf("unexpected misrouted sample: %#v", s)
+		}
+	}
+
+	// hold a write connection open while the node is a replica.
+	conn, err := writeDB.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer conn.Close()
+
+	samples := e.Sample()
+	if samples[0].Misrouted || !samples[1].Misrouted || samples[1].IsPrimary {
+		t.Fatalf("wrong samples: %#v", samples)
+	}
+	if n := e.MisroutedSamples(); n != 1 {
+		t.Fatalf("expected 1 misrouted sample, got %d", n)
+	}
+}
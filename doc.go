@@ -0,0 +1,10 @@
+// Package litefs is a client for LiteFS features that can't be reached
+// through the SQLite API: the HALT lock, replication positions and the event
+// stream, along with the role tracking, consistency and routing built on them.
+//
+// This package has no dependencies outside the standard library, so that
+// programs can use the event client without taking on a dependency tree.
+// Adapters for third-party libraries, such as metrics exporters and tracing,
+// live in separate modules under contrib/ that are only downloaded by programs
+// that import them.
+package litefs
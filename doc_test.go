@@ -0,0 +1,28 @@
+package litefs
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestNoDependencies keeps the core module free of third-party dependencies.
+// Adapters that need them belong in their own modules under contrib/.
+func TestNoDependencies(t *testing.T) {
+	f, err := os.Open("go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, "require") {
+			t.Fatalf("go.mod must not require modules: %s", line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,230 @@
+package litefs
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"sync"
+)
+
+// DriverHooks intercept the statements, transactions and closing of a
+// connection wrapped by HookConn. Each hook must call fn, which performs the
+// operation, and return its result. Nil hooks call fn directly.
+type DriverHooks struct {
+	// Exec intercepts statements executed without returning rows.
+	Exec func(ctx context.Context, query string, fn func() error) error
+
+	// Query intercepts statements returning rows. It may wrap the rows, e.g.
+	// to hold a lock until they are closed.
+	Query func(ctx context.Context, query string, fn func() (driver.Rows, error)) (driver.Rows, error)
+
+	// Begin intercepts transactions begun through database/sql. It may wrap
+	// the transaction, e.g. to release a lock once it ends.
+	Begin func(ctx context.Context, opts driver.TxOptions, fn func() (driver.Tx, error)) (driver.Tx, error)
+
+	// Close intercepts closing the connection.
+	Close func(fn func() error) error
+}
+
+// HookConn wraps c so that its statements, transactions and closing pass
+// through hooks. It lets drivers wrapping SQLite drivers for LiteFS, such as
+// the sqldriver package, share the package's statement handling.
+func HookConn(c driver.Conn, hooks *DriverHooks) driver.Conn {
+	return &hookConn{Conn: c, hooks: hooks}
+}
+
+func (h *DriverHooks) runExec(ctx context.Context, query string, fn func() error) error {
+	if h.Exec == nil {
+		return fn()
+	}
+	return h.Exec(ctx, query, fn)
+}
+
+func (h *DriverHooks) runQuery(ctx context.Context, query string, fn func() (driver.Rows, error)) (driver.Rows, error) {
+	if h.Query == nil {
+		return fn()
+	}
+	return h.Query(ctx, query, fn)
+}
+
+func (h *DriverHooks) runBegin(ctx context.Context, opts driver.TxOptions, fn func() (driver.Tx, error)) (driver.Tx, error) {
+	if h.Begin == nil {
+		return fn()
+	}
+	return h.Begin(ctx, opts, fn)
+}
+
+func (h *DriverHooks) runClose(fn func() error) error {
+	if h.Close == nil {
+		return fn()
+	}
+	return h.Close(fn)
+}
+
+// queryWithHalt runs a query while holding the HALT lock of the database at
+// databasePath, which is released once its rows are closed so that writes made
+// while they are read, e.g. by INSERT ... RETURNING, are covered.
+func queryWithHalt(ctx context.Context, databasePath string, fn func() (driver.Rows, error)) (driver.Rows, error) {
+	f, err := os.OpenFile(LockPath(databasePath), os.O_RDWR, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := HaltContext(ctx, f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	rows, err := fn()
+	if err != nil {
+		// closing the lock file releases the lock even if unlocking fails.
+		_ = Unhalt(f)
+		_ = f.Close()
+		return nil, err
+	}
+	return &haltRows{Rows: rows, f: f}, nil
+}
+
+// haltRows releases the HALT lock held by its lock file once it is closed.
+type haltRows struct {
+	driver.Rows
+	f    *os.File
+	once sync.Once
+}
+
+func (r *haltRows) Close() error {
+	err := r.Rows.Close()
+	r.once.Do(func() {
+		if uerr := Unhalt(r.f); err == nil {
+			err = uerr
+		}
+		_ = r.f.Close()
+	})
+	return err
+}
+
+// hookConnector wraps a driver.Connector so that statements on its
+// connections pass through hooks.
+type hookConnector struct {
+	driver.Connector
+	hooks *DriverHooks
+}
+
+func (c *hookConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return HookConn(conn, c.hooks), nil
+}
+
+type hookConn struct {
+	driver.Conn
+	hooks *DriverHooks
+}
+
+func (c *hookConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	err = c.hooks.runExec(ctx, query, func() (err error) {
+		result, err = execer.ExecContext(ctx, query, args)
+		return err
+	})
+	return result, err
+}
+
+func (c *hookConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return c.hooks.runQuery(ctx, query, func() (driver.Rows, error) {
+		return queryer.QueryContext(ctx, query, args)
+	})
+}
+
+func (c *hookConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hookStmt{Stmt: stmt, hooks: c.hooks, query: query}, nil
+}
+
+func (c *hookConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *hookConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.hooks.runBegin(ctx, opts, func() (driver.Tx, error) {
+		if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+			return beginner.BeginTx(ctx, opts)
+		}
+		return c.Conn.Begin()
+	})
+}
+
+func (c *hookConn) Close() error {
+	return c.hooks.runClose(c.Conn.Close)
+}
+
+func (c *hookConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *hookConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *hookConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type hookStmt struct {
+	driver.Stmt
+	hooks *DriverHooks
+	query string
+}
+
+func (s *hookStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, err error) {
+	err = s.hooks.runExec(ctx, s.query, func() (err error) {
+		if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+			result, err = execer.ExecContext(ctx, args)
+		} else {
+			result, err = s.Stmt.Exec(namedValues(args))
+		}
+		return err
+	})
+	return result, err
+}
+
+func (s *hookStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.hooks.runQuery(ctx, s.query, func() (driver.Rows, error) {
+		if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+			return queryer.QueryContext(ctx, args)
+		}
+		return s.Stmt.Query(namedValues(args))
+	})
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return values
+}
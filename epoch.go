@@ -0,0 +1,117 @@
+package litefs
+
+import (
+	"database/sql"
+	"sync"
+)
+
+// EpochChanged reports that a database was replaced wholesale, e.g. by a
+// restore or an import, rather than changed by a transaction following on
+// from its previous position. Connections and caches holding data read before
+// the change may be stale.
+type EpochChanged struct {
+	// DB is the name of the database.
+	DB string
+
+	// Prev is the last position seen before the change and Pos the first
+	// position after it.
+	Prev Pos
+	Pos  Pos
+}
+
+// EpochWatcher detects databases being replaced from the local LiteFS node's
+// event stream. A database is considered replaced when a tx event reports a
+// TXID lower than the last one seen, or the same TXID with a different
+// checksum. Positions are only known once a tx event has been seen for a
+// database, so replacements before then aren't detected.
+type EpochWatcher struct {
+	es EventSource
+	m  sync.Mutex
+
+	pos      map[string]Pos
+	handlers []func(*EpochChanged)
+}
+
+// NewEpochWatcher returns a new *EpochWatcher.
+func NewEpochWatcher(opts ...Option) *EpochWatcher {
+	w := &EpochWatcher{
+		es:  NewEventSource(subscribeOptions(opts, WithEventFilter(EventTypeTx))...),
+		pos: make(map[string]Pos),
+	}
+
+	spawn(w.run)
+
+	return w
+}
+
+// OnEpochChange calls fn whenever a database is replaced. Handlers are called
+// in the order they were added, one change at a time, and must not block.
+func (w *EpochWatcher) OnEpochChange(fn func(*EpochChanged)) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.handlers = append(w.handlers, fn)
+}
+
+// Close unsubscribes from the local LiteFS node's event stream.
+func (w *EpochWatcher) Close() {
+	w.es.Close()
+}
+
+func (w *EpochWatcher) run() {
+	for {
+		select {
+		case event, running := <-w.es.C():
+			if !running {
+				return
+			}
+			data, ok := event.Data.(*TxEventData)
+			if !ok {
+				continue
+			}
+			pos, err := data.Pos()
+			if err != nil {
+				continue
+			}
+			w.observe(event.DB, pos)
+		case _, running := <-w.es.ErrC():
+			if !running {
+				return
+			}
+		}
+	}
+}
+
+func (w *EpochWatcher) observe(db string, pos Pos) {
+	w.m.Lock()
+	prev, ok := w.pos[db]
+	w.pos[db] = pos
+	handlers := w.handlers
+	w.m.Unlock()
+
+	if !ok || !isEpochChange(prev, pos) {
+		return
+	}
+
+	e := &EpochChanged{DB: db, Prev: prev, Pos: pos}
+	for _, fn := range handlers {
+		fn(e)
+	}
+}
+
+// isEpochChange reports whether a database at prev moving to pos must have
+// been replaced.
+func isEpochChange(prev, pos Pos) bool {
+	return pos.TXID < prev.TXID || (pos.TXID == prev.TXID && pos.PostApplyChecksum != prev.PostApplyChecksum)
+}
+
+// ResetConns returns an epoch change handler that closes db's idle
+// connections, so that connections opened after a database is replaced read
+// it afresh, and then allows maxIdle idle connections again. Connections in
+// use at the time are unaffected.
+func ResetConns(db *sql.DB, maxIdle int) func(*EpochChanged) {
+	return func(*EpochChanged) {
+		db.SetMaxIdleConns(0)
+		db.SetMaxIdleConns(maxIdle)
+	}
+}
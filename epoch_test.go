@@ -0,0 +1,46 @@
+package litefs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEpochWatcher(t *testing.T) {
+	src := newFakeSource()
+	useEventSource(t, func(...SubscribeOption) EventSource { return src })
+
+	w := NewEpochWatcher()
+	t.Cleanup(w.Close)
+
+	changes := make(chan *EpochChanged, 4)
+	w.OnEpochChange(func(e *EpochChanged) { changes <- e })
+
+	tx := func(txid, chksum string) *Event {
+		return &Event{Type: EventTypeTx, DB: "db", Data: &TxEventData{TXID: txid, PostApplyChecksum: chksum}}
+	}
+	src.c <- tx("0000000000000027", "83b05248774ce767")
+	src.c <- tx("0000000000000028", "0000000000000001")
+	src.c <- tx("0000000000000002", "0000000000000002")
+	src.c <- tx("0000000000000003", "0000000000000003")
+	src.c <- tx("0000000000000003", "0000000000000004")
+
+	for _, expected := range []*EpochChanged{
+		{DB: "db", Prev: Pos{TXID: 0x28, PostApplyChecksum: 1}, Pos: Pos{TXID: 2, PostApplyChecksum: 2}},
+		{DB: "db", Prev: Pos{TXID: 3, PostApplyChecksum: 3}, Pos: Pos{TXID: 3, PostApplyChecksum: 4}},
+	} {
+		select {
+		case e := <-changes:
+			if !reflect.DeepEqual(e, expected) {
+				t.Fatalf("expected %+v, got %+v", expected, e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	select {
+	case e := <-changes:
+		t.Fatalf("unexpected change: %+v", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
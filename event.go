@@ -1,7 +1,15 @@
 package litefs
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -31,6 +39,12 @@ func (e *Event) UnmarshalJSON(data []byte) error {
 	e.Type = v.Type
 	e.DB = v.DB
 
+	// modified: tolerate events without data.
+	if len(v.Data) == 0 {
+		e.Data = nil
+		return nil
+	}
+
 	switch v.Type {
 	case EventTypeInit:
 		e.Data = &InitEventData{}
@@ -39,7 +53,13 @@ func (e *Event) UnmarshalJSON(data []byte) error {
 	case EventTypePrimaryChange:
 		e.Data = &PrimaryChangeEventData{}
 	default:
-		e.Data = nil
+		// modified: pass other types through (see RegisterEventDecoder).
+		data, err := decodeOtherEventData(v.Type, v.Data)
+		if err != nil {
+			return err
+		}
+		e.Data = data
+		return nil
 	}
 	if err := json.Unmarshal(v.Data, &e.Data); err != nil {
 		return err
@@ -64,9 +84,226 @@ type TxEventData struct {
 	PageSize          uint32    `json:"pageSize"`
 	Commit            uint32    `json:"commit"`
 	Timestamp         time.Time `json:"timestamp"`
+
+	// not in litefs. only populated by servers that report which tables and
+	// pages a transaction changed.
+	Tables []string `json:"tables,omitempty"`
+	Pages  []uint32 `json:"pages,omitempty"`
+}
+
+// MayTouch reports whether the transaction may have changed any of tables. It
+// returns true if the server didn't report which tables were changed or if no
+// tables are given. (not in litefs)
+func (e *TxEventData) MayTouch(tables ...string) bool {
+	if len(e.Tables) == 0 || len(tables) == 0 {
+		return true
+	}
+	for _, t := range tables {
+		for _, changed := range e.Tables {
+			if strings.EqualFold(t, changed) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 type PrimaryChangeEventData struct {
 	IsPrimary bool   `json:"isPrimary"`
 	Hostname  string `json:"hostname,omitempty"`
 }
+
+////
+// not in litefs.
+
+// EventTypeUnknown stands for the types of events that are neither built in
+// nor registered with RegisterEventDecoder, such as those of newer LiteFS
+// versions, in WithEventFilter. Such events keep their own type and carry
+// their data as RawEventData.
+const EventTypeUnknown = "unknown"
+
+// RawEventData is the data of an event of a type without a decoder, as sent by
+// LiteFS.
+type RawEventData json.RawMessage
+
+// MarshalJSON returns the data as it was received.
+func (d RawEventData) MarshalJSON() ([]byte, error) {
+	if d == nil {
+		return []byte("null"), nil
+	}
+	return d, nil
+}
+
+var (
+	eventDecodersMu sync.RWMutex
+	eventDecoders   = make(map[string]func(json.RawMessage) (any, error))
+)
+
+// RegisterEventDecoder registers decode to decode the data of events of type
+// typ, e.g. one added by a newer LiteFS, in place of passing it through as
+// RawEventData. Errors returned by decode fail the event's decoding. It panics
+// if typ is built in or already registered, and must be called before events
+// are received, typically from an init function.
+func RegisterEventDecoder(typ string, decode func(data json.RawMessage) (any, error)) {
+	eventDecodersMu.Lock()
+	defer eventDecodersMu.Unlock()
+
+	switch typ {
+	case EventTypeInit, EventTypeTx, EventTypePrimaryChange, EventTypeUnknown:
+		panic("litefs: RegisterEventDecoder of built-in event type " + typ)
+	}
+	if _, ok := eventDecoders[typ]; ok {
+		panic("litefs: RegisterEventDecoder called twice for event type " + typ)
+	}
+	eventDecoders[typ] = decode
+}
+
+// isKnownEventType reports whether events of type typ are built in or have a
+// registered decoder.
+func isKnownEventType(typ string) bool {
+	switch typ {
+	case EventTypeInit, EventTypeTx, EventTypePrimaryChange:
+		return true
+	}
+
+	eventDecodersMu.RLock()
+	defer eventDecodersMu.RUnlock()
+
+	_, ok := eventDecoders[typ]
+	return ok
+}
+
+// decodeOtherEventData decodes the data of an event of a type that isn't built
+// in with its registered decoder, or returns it as RawEventData if there is
+// none.
+func decodeOtherEventData(typ string, data json.RawMessage) (any, error) {
+	eventDecodersMu.RLock()
+	decode := eventDecoders[typ]
+	eventDecodersMu.RUnlock()
+
+	if decode == nil {
+		return RawEventData(data), nil
+	}
+	return decode(data)
+}
+
+// MaxEventSize is the largest encoded event accepted from an event stream.
+// Larger events end the connection rather than being buffered.
+var MaxEventSize = 1 << 20
+
+// ErrDecode is wrapped by errors decoding events, e.g. from an event stream
+// that isn't LiteFS's or a newer LiteFS whose events have changed shape.
+var ErrDecode = errors.New("invalid event")
+
+var (
+	errEventTooLarge    = fmt.Errorf("%w: event too large", ErrDecode)
+	errMissingEventType = fmt.Errorf("%w: missing event type", ErrDecode)
+	errMissingEventData = fmt.Errorf("%w: missing event data", ErrDecode)
+)
+
+// DecodeEvent decodes a single JSON-encoded event. Events of known types must
+// carry data of the expected shape; events of other types are returned with
+// their data decoded generically.
+func DecodeEvent(data []byte) (*Event, error) {
+	if len(data) > MaxEventSize {
+		return nil, fmt.Errorf("%w: %d bytes", errEventTooLarge, len(data))
+	}
+
+	var e Event
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	if e.Type == "" {
+		return nil, errMissingEventType
+	}
+
+	switch e.Type {
+	case EventTypeInit, EventTypeTx, EventTypePrimaryChange:
+		if e.Data == nil {
+			return nil, fmt.Errorf("%w: %s", errMissingEventData, e.Type)
+		}
+	}
+	return &e, nil
+}
+
+// readEventLine reads the next non-blank line of an NDJSON event stream
+// without its newline. Lines longer than MaxEventSize are rejected, and a
+// final line without a newline is reported as io.ErrUnexpectedEOF.
+func readEventLine(r *bufio.Reader) ([]byte, error) {
+	for {
+		var line []byte
+		for {
+			chunk, err := r.ReadSlice('\n')
+			if len(line)+len(chunk) > MaxEventSize+1 {
+				return nil, errEventTooLarge
+			}
+			line = append(line, chunk...)
+
+			if err == bufio.ErrBufferFull {
+				continue
+			} else if err == io.EOF && len(bytes.TrimSpace(line)) != 0 {
+				return nil, io.ErrUnexpectedEOF
+			} else if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		if line = bytes.TrimSpace(line); len(line) != 0 {
+			return line, nil
+		}
+	}
+}
+
+// String returns a compact description of e for logging.
+func (e *Event) String() string {
+	s := e.Type
+	if e.DB != "" {
+		s += " db=" + e.DB
+	}
+	if stringer, ok := e.Data.(fmt.Stringer); ok {
+		if data := stringer.String(); data != "" {
+			s += " " + data
+		}
+	}
+	return s
+}
+
+// LogValue implements slog.LogValuer.
+func (e *Event) LogValue() slog.Value {
+	attrs := []slog.Attr{slog.String("type", e.Type)}
+	if e.DB != "" {
+		attrs = append(attrs, slog.String("db", e.DB))
+	}
+	if valuer, ok := e.Data.(slog.LogValuer); ok {
+		attrs = append(attrs, valuer.LogValue().Group()...)
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (e *InitEventData) String() string {
+	return fmt.Sprintf("isPrimary=%t hostname=%s", e.IsPrimary, e.Hostname)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *InitEventData) LogValue() slog.Value {
+	return slog.GroupValue(slog.Bool("isPrimary", e.IsPrimary), slog.String("hostname", e.Hostname))
+}
+
+func (e *TxEventData) String() string {
+	return "txid=" + e.TXID
+}
+
+// LogValue implements slog.LogValuer.
+func (e *TxEventData) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("txid", e.TXID))
+}
+
+func (e *PrimaryChangeEventData) String() string {
+	return fmt.Sprintf("isPrimary=%t hostname=%s", e.IsPrimary, e.Hostname)
+}
+
+// LogValue implements slog.LogValuer.
+func (e *PrimaryChangeEventData) LogValue() slog.Value {
+	return slog.GroupValue(slog.Bool("isPrimary", e.IsPrimary), slog.String("hostname", e.Hostname))
+}
@@ -0,0 +1,706 @@
+package litefs
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBrokerBufferSize is the number of events buffered for each broker
+// subscriber before events are dropped.
+const DefaultBrokerBufferSize = 64
+
+// Defaults for reporting slow broker subscribers.
+const (
+	DefaultSlowThreshold    = time.Second
+	DefaultSlowWarnInterval = time.Minute
+)
+
+// EventBroker maintains a single subscription to the local LiteFS node's event
+// stream and fans its events out to any number of in-process subscribers.
+// Events from other sources can be injected with Publish.
+//
+// The broker remembers the node's role and the latest tx event of each
+// database so that new subscribers first receive events describing the
+// current state instead of waiting for the next real event.
+//
+// Each subscriber is delivered to by its own goroutine from a buffer, so a
+// slow or stuck subscriber drops its own events (see Dropped) rather than
+// stalling the others.
+//
+// If the upstream subscription stops, e.g. with a *TerminalError, every
+// subscription is closed once it has delivered its buffered events and the
+// error. Later subscriptions deliver the backfill and the error, and close.
+type EventBroker struct {
+	// OnPanic, if set, is called when a handler registered with Handle
+	// panics. The handler continues to receive later events.
+	OnPanic func(sub *BrokerSubscription, err *PanicError)
+
+	// Logger, if set, receives a warning when a subscriber's buffer has
+	// stayed full for SlowThreshold, at most once every SlowWarnInterval per
+	// subscriber, so that dropped events can be traced to a consumer. Zero
+	// durations use DefaultSlowThreshold and DefaultSlowWarnInterval.
+	Logger           *slog.Logger
+	SlowThreshold    time.Duration
+	SlowWarnInterval time.Duration
+
+	// ReplaySize is the number of recent tx events kept for SubscribeFrom.
+	// Zero uses DefaultReplaySize. It must be set before events are received.
+	ReplaySize int
+
+	es       *EventSubscription
+	settings settings
+	m        sync.Mutex
+
+	done chan struct{} // closed when the upstream subscription stops
+	err  error         // the upstream's terminal error, set before done is closed
+
+	subs map[*BrokerSubscription]struct{}
+	init *InitEventData
+	txs  map[string]*Event
+	ring eventRing
+}
+
+// NewEventBroker returns a new *EventBroker that subscribes to the local
+// LiteFS node's event stream. The options apply to the upstream subscription
+// and are the defaults of the broker's subscriptions; a logger set with
+// WithLogger is used if Logger isn't set.
+func NewEventBroker(opts ...Option) *EventBroker {
+	b := &EventBroker{
+		es:       SubscribeEvents(subscribeOptions(opts)...),
+		settings: newSettings(opts),
+		done:     make(chan struct{}),
+		subs:     make(map[*BrokerSubscription]struct{}),
+		txs:      make(map[string]*Event),
+	}
+
+	spawn(b.run)
+
+	return b
+}
+
+// BrokerSubscribeOption configures a BrokerSubscription. Every Option is also
+// a BrokerSubscribeOption.
+type BrokerSubscribeOption interface {
+	applyBroker(*BrokerSubscription)
+}
+
+type brokerOptionFunc func(*BrokerSubscription)
+
+func (f brokerOptionFunc) applyBroker(sub *BrokerSubscription) { f(sub) }
+
+// WithTxSampling delivers at most one tx event per database every interval.
+// Tx events arriving sooner are coalesced, and the latest of them, carrying
+// the newest position, is delivered once the interval has passed. It suits
+// consumers on busy clusters that only need to know how fresh a database is.
+func WithTxSampling(interval time.Duration) BrokerSubscribeOption {
+	return brokerOptionFunc(func(sub *BrokerSubscription) {
+		sub.sampler = &txSampler{
+			interval: interval,
+			last:     make(map[string]time.Time),
+			pending:  make(map[string]*Event),
+			timers:   make(map[string]*time.Timer),
+		}
+	})
+}
+
+// WithBufferSize sets the number of events buffered for a subscriber before
+// events are dropped. It defaults to DefaultBrokerBufferSize.
+func WithBufferSize(n int) BrokerSubscribeOption {
+	return brokerOptionFunc(func(sub *BrokerSubscription) {
+		sub.bufferSize = n
+	})
+}
+
+// WithLabel names the subscriber in warnings and statistics.
+func WithLabel(label string) BrokerSubscribeOption {
+	return brokerOptionFunc(func(sub *BrokerSubscription) {
+		sub.label = label
+	})
+}
+
+// WithoutBackfill only delivers events received after subscribing, skipping
+// the events describing the current state.
+func WithoutBackfill() BrokerSubscribeOption {
+	return brokerOptionFunc(func(sub *BrokerSubscription) {
+		sub.noBackfill = true
+	})
+}
+
+// Subscribe returns a new subscription to the broker's events. If the broker
+// has received events, the subscription first delivers an init event with the
+// node's current role and the latest tx event of each database.
+func (b *EventBroker) Subscribe(opts ...BrokerSubscribeOption) *BrokerSubscription {
+	sub := &BrokerSubscription{
+		c:    make(chan *Event),
+		errc: make(chan error),
+	}
+	b.subscribe(sub, opts, func(item brokerItem) bool {
+		if item.err != nil {
+			select {
+			case sub.errc <- item.err:
+			case <-sub.done:
+				return false
+			}
+			return true
+		}
+
+		select {
+		case sub.c <- item.event:
+		case <-sub.done:
+			return false
+		}
+		return true
+	})
+	return sub
+}
+
+// NewEventSource returns a subscription to the broker's events as an
+// EventSource. Of opts, only the filters set by WithEventFilter and
+// WithDatabase apply; the rest configure upstream connections. Assign it to the package's NewEventSource so
+// that components such as PrimaryMonitor and ConsistencyTracker share the
+// broker's upstream connection rather than each opening their own:
+//
+//	b := litefs.NewEventBroker()
+//	litefs.NewEventSource = b.NewEventSource
+func (b *EventBroker) NewEventSource(opts ...SubscribeOption) EventSource {
+	es := &EventSubscription{}
+	for _, opt := range opts {
+		opt.applySubscription(es)
+	}
+	if es.types == nil && es.db == "" {
+		return b.Subscribe()
+	}
+	return b.Subscribe(brokerOptionFunc(func(sub *BrokerSubscription) {
+		sub.match = es.match
+	}))
+}
+
+// Handle calls fn with each of the broker's events, including the backfill
+// (see Subscribe), from a goroutine of its own until the returned
+// subscription is closed. Panics in fn are recovered and passed to OnPanic.
+// The subscription's C and ErrC are unused.
+func (b *EventBroker) Handle(fn func(*Event), opts ...BrokerSubscribeOption) *BrokerSubscription {
+	sub := &BrokerSubscription{}
+	b.subscribe(sub, opts, func(item brokerItem) bool {
+		if item.event != nil {
+			b.call(sub, fn, item.event)
+		}
+		return true
+	})
+	return sub
+}
+
+// OnEvent is an alias of Handle.
+func (b *EventBroker) OnEvent(fn func(*Event), opts ...BrokerSubscribeOption) *BrokerSubscription {
+	return b.Handle(fn, opts...)
+}
+
+// OnPrimaryChange calls fn whenever the primary changes, and with the node's
+// current role first if it is known, like Handle. Init events are passed to
+// fn as primary changes since they carry the same information.
+func (b *EventBroker) OnPrimaryChange(fn func(*PrimaryChangeEventData), opts ...BrokerSubscribeOption) *BrokerSubscription {
+	return b.Handle(func(e *Event) {
+		switch data := e.Data.(type) {
+		case *InitEventData:
+			fn(&PrimaryChangeEventData{IsPrimary: data.IsPrimary, Hostname: data.Hostname})
+		case *PrimaryChangeEventData:
+			fn(data)
+		}
+	}, opts...)
+}
+
+// OnTx calls fn with the name of the database and the data of each tx event,
+// like Handle.
+func (b *EventBroker) OnTx(fn func(db string, data *TxEventData), opts ...BrokerSubscribeOption) *BrokerSubscription {
+	return b.Handle(func(e *Event) {
+		if data, ok := e.Data.(*TxEventData); ok {
+			fn(e.DB, data)
+		}
+	}, opts...)
+}
+
+func (b *EventBroker) call(sub *BrokerSubscription, fn func(*Event), e *Event) {
+	defer func() {
+		if v := recover(); v != nil {
+			sub.panics.Add(1)
+			if b.OnPanic != nil {
+				b.OnPanic(sub, &PanicError{Value: v, Stack: debug.Stack()})
+			}
+		}
+	}()
+
+	fn(e)
+}
+
+// subscribe registers sub and starts its delivery goroutine, which passes
+// items to deliver until it returns false or sub is closed.
+func (b *EventBroker) subscribe(sub *BrokerSubscription, opts []BrokerSubscribeOption, deliver func(brokerItem) bool) {
+	sub.b = b
+	sub.done = make(chan struct{})
+	sub.bufferSize = DefaultBrokerBufferSize
+	sub.settings = b.settings
+	for _, opt := range opts {
+		opt.applyBroker(sub)
+	}
+	sub.queue = make(chan brokerItem, sub.bufferSize)
+
+	b.m.Lock()
+	b.subs[sub] = struct{}{}
+	var backfill []brokerItem
+	switch {
+	case sub.from != nil:
+		backfill = b.replay(*sub.from)
+	case !sub.noBackfill:
+		for _, e := range b.backfill() {
+			backfill = append(backfill, brokerItem{event: e})
+		}
+	}
+	b.m.Unlock()
+
+	if sub.match != nil {
+		filtered := backfill[:0]
+		for _, item := range backfill {
+			if item.event == nil || sub.match(item.event) {
+				filtered = append(filtered, item)
+			}
+		}
+		backfill = filtered
+	}
+
+	spawn(func() {
+		sub.run(backfill, deliver)
+
+		// only run sends on C and ErrC, so they can be closed once it returns.
+		if sub.c != nil {
+			close(sub.c)
+			close(sub.errc)
+		}
+	})
+}
+
+// backfill returns events describing the current state. b.m must be held.
+func (b *EventBroker) backfill() []*Event {
+	var events []*Event
+	if b.init != nil {
+		data := *b.init
+		events = append(events, &Event{Type: EventTypeInit, Data: &data})
+	}
+
+	dbs := make([]string, 0, len(b.txs))
+	for db := range b.txs {
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+	for _, db := range dbs {
+		events = append(events, b.txs[db])
+	}
+	return events
+}
+
+// Publish delivers e to every subscriber as if it were received from the
+// upstream event stream. The broker's state is updated and e is queued for
+// subscribers under one lock so that a new subscriber receives e either in
+// its backfill or live, but not both.
+func (b *EventBroker) Publish(e *Event) {
+	b.publish(e, true)
+}
+
+// publish delivers e to every subscriber. The role described by init and
+// primaryChange events is only remembered if local is set, so that events
+// from other sources can't override what the local node reported.
+func (b *EventBroker) publish(e *Event, local bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	switch data := e.Data.(type) {
+	case *InitEventData:
+		if local {
+			b.init = &InitEventData{IsPrimary: data.IsPrimary, Hostname: data.Hostname}
+		}
+	case *PrimaryChangeEventData:
+		if local {
+			b.init = &InitEventData{IsPrimary: data.IsPrimary, Hostname: data.Hostname}
+		}
+	case *TxEventData:
+		b.txs[e.DB] = e
+		b.ring.push(e, b.ReplaySize)
+	}
+
+	for sub := range b.subs {
+		if sub.match != nil && !sub.match(e) {
+			continue
+		}
+		if sub.sampler != nil && e.Type == EventTypeTx && !sub.sampler.admit(sub, e) {
+			continue
+		}
+		sub.enqueue(brokerItem{event: e})
+	}
+}
+
+// Close unsubscribes from the upstream event stream and closes every
+// subscription.
+func (b *EventBroker) Close() {
+	b.es.Close()
+
+	for _, sub := range b.subscribers() {
+		sub.Close()
+	}
+}
+
+// Stats returns the delivery statistics of every open subscription, ordered
+// by label.
+func (b *EventBroker) Stats() []SubscriberStats {
+	subs := b.subscribers()
+	stats := make([]SubscriberStats, 0, len(subs))
+	for _, sub := range subs {
+		stats = append(stats, sub.Stats())
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Label < stats[j].Label })
+	return stats
+}
+
+func (b *EventBroker) run() {
+	for {
+		select {
+		case event, running := <-b.es.C():
+			if !running {
+				b.stop(nil)
+				return
+			}
+			b.Publish(event)
+		case err, running := <-b.es.ErrC():
+			if !running {
+				b.stop(nil)
+				return
+			} else if IsTerminal(err) {
+				// the upstream closes its channels once err is received.
+				b.stop(err)
+				return
+			}
+			b.publishError(err)
+		}
+	}
+}
+
+// stop records that the upstream subscription stopped with err, which ends
+// every subscription's delivery.
+func (b *EventBroker) stop(err error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.err = err
+	close(b.done)
+}
+
+func (b *EventBroker) publishError(err error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	for sub := range b.subs {
+		sub.enqueue(brokerItem{err: err})
+	}
+}
+
+func (b *EventBroker) subscribers() []*BrokerSubscription {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	subs := make([]*BrokerSubscription, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+func (b *EventBroker) unsubscribe(sub *BrokerSubscription) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	delete(b.subs, sub)
+}
+
+// BrokerSubscription is a subscriber's view of an EventBroker.
+type BrokerSubscription struct {
+	b     *EventBroker
+	c     chan *Event
+	errc  chan error
+	queue chan brokerItem
+	done  chan struct{}
+	once  sync.Once
+
+	label      string
+	bufferSize int
+	noBackfill bool
+	from       *TXID
+	sampler    *txSampler
+	match      func(*Event) bool // nil delivers every event
+	settings   settings
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	panics    atomic.Uint64
+	lag       atomic.Int64
+
+	m         sync.Mutex
+	fullSince time.Time // zero while the buffer has room
+	warnedAt  time.Time
+}
+
+// brokerItem is an event or an upstream error queued for a subscriber.
+type brokerItem struct {
+	event *Event
+	err   error
+	at    time.Time // when it was queued
+}
+
+// enqueue queues item for delivery, dropping it if the buffer is full.
+func (sub *BrokerSubscription) enqueue(item brokerItem) {
+	item.at = sub.settings.now()
+	select {
+	case sub.queue <- item:
+		sub.m.Lock()
+		sub.fullSince = time.Time{}
+		sub.m.Unlock()
+	default:
+		sub.dropped.Add(1)
+		sub.settings.add(MetricEventsDropped, 1, "subscriber", sub.label)
+		sub.warnSlow(sub.settings.now())
+	}
+}
+
+// warnSlow logs a warning if the subscriber's buffer has been full for too
+// long and it hasn't been warned about recently.
+func (sub *BrokerSubscription) warnSlow(now time.Time) {
+	b := sub.b
+	logger := b.Logger
+	if logger == nil {
+		logger = sub.settings.logger
+	}
+	if logger == nil {
+		return
+	}
+	threshold, interval := b.SlowThreshold, b.SlowWarnInterval
+	if threshold <= 0 {
+		threshold = DefaultSlowThreshold
+	}
+	if interval <= 0 {
+		interval = DefaultSlowWarnInterval
+	}
+
+	sub.m.Lock()
+	if sub.fullSince.IsZero() {
+		sub.fullSince = now
+	}
+	fullFor := now.Sub(sub.fullSince)
+	if fullFor < threshold || (!sub.warnedAt.IsZero() && now.Sub(sub.warnedAt) < interval) {
+		sub.m.Unlock()
+		return
+	}
+	sub.warnedAt = now
+	sub.m.Unlock()
+
+	logger.Warn("slow event subscriber is dropping events",
+		slog.String("subscriber", sub.label),
+		slog.Duration("fullFor", fullFor),
+		slog.Int("bufferSize", sub.bufferSize),
+		slog.Uint64("dropped", sub.dropped.Load()),
+	)
+}
+
+func (sub *BrokerSubscription) run(backfill []brokerItem, deliver func(brokerItem) bool) {
+	for _, item := range backfill {
+		if !deliver(item) {
+			return
+		}
+		if item.event != nil {
+			sub.delivered.Add(1)
+		}
+	}
+
+	for {
+		select {
+		case item := <-sub.queue:
+			if !sub.deliverQueued(item, deliver) {
+				return
+			}
+		case <-sub.b.done:
+			sub.drain(deliver)
+			return
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+func (sub *BrokerSubscription) deliverQueued(item brokerItem, deliver func(brokerItem) bool) bool {
+	if !deliver(item) {
+		return false
+	}
+	if item.event != nil {
+		sub.delivered.Add(1)
+	}
+	sub.lag.Store(int64(sub.settings.now().Sub(item.at)))
+	return true
+}
+
+// drain delivers the items left in the buffer and the broker's terminal
+// error, if any, once the upstream subscription has stopped, and then closes
+// the subscription.
+func (sub *BrokerSubscription) drain(deliver func(brokerItem) bool) {
+	defer sub.Close()
+
+	for {
+		select {
+		case item := <-sub.queue:
+			if !sub.deliverQueued(item, deliver) {
+				return
+			}
+		default:
+			if err := sub.b.err; err != nil {
+				deliver(brokerItem{err: err})
+			}
+			return
+		}
+	}
+}
+
+// SubscriberStats describes the delivery of a broker subscriber's events.
+type SubscriberStats struct {
+	Label     string `json:"label,omitempty"`
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+	Panics    uint64 `json:"panics,omitempty"`
+
+	// Pending is the number of events and errors waiting in the buffer.
+	Pending int `json:"pending"`
+
+	// Lag is how long after being queued the most recently delivered item
+	// was received by the subscriber or handled.
+	Lag time.Duration `json:"lag"`
+}
+
+// Stats returns the subscriber's delivery statistics.
+func (sub *BrokerSubscription) Stats() SubscriberStats {
+	return SubscriberStats{
+		Label:     sub.label,
+		Delivered: sub.delivered.Load(),
+		Dropped:   sub.dropped.Load(),
+		Panics:    sub.panics.Load(),
+		Pending:   len(sub.queue),
+		Lag:       time.Duration(sub.lag.Load()),
+	}
+}
+
+// Label returns the subscriber's name set with WithLabel.
+func (sub *BrokerSubscription) Label() string {
+	return sub.label
+}
+
+// Dropped returns the number of events and errors dropped because the
+// subscriber's buffer was full.
+func (sub *BrokerSubscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Panics returns the number of times the subscription's handler panicked.
+func (sub *BrokerSubscription) Panics() uint64 {
+	return sub.panics.Load()
+}
+
+// C returns a chan of events from the broker. It is closed once the
+// subscription is closed, including when the broker's upstream subscription
+// stops.
+func (sub *BrokerSubscription) C() <-chan *Event {
+	return sub.c
+}
+
+// ErrC returns a chan of errors encountered by the broker's upstream event
+// subscription.
+func (sub *BrokerSubscription) ErrC() <-chan error {
+	return sub.errc
+}
+
+// Done returns a chan that is closed when the subscription is closed.
+func (sub *BrokerSubscription) Done() <-chan struct{} {
+	return sub.done
+}
+
+// Close removes the subscription from the broker.
+func (sub *BrokerSubscription) Close() {
+	sub.once.Do(func() {
+		sub.b.unsubscribe(sub)
+		close(sub.done)
+		if sub.sampler != nil {
+			sub.sampler.stop()
+		}
+	})
+}
+
+// txSampler coalesces a subscription's tx events per database.
+type txSampler struct {
+	interval time.Duration
+	m        sync.Mutex
+
+	last    map[string]time.Time
+	pending map[string]*Event
+	timers  map[string]*time.Timer
+}
+
+// admit reports whether e should be delivered now. Otherwise e replaces any
+// pending event for its database, which is delivered to sub when the interval
+// since the last delivery has passed.
+func (s *txSampler) admit(sub *BrokerSubscription, e *Event) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := time.Now()
+	since := now.Sub(s.last[e.DB])
+	if since >= s.interval && s.timers[e.DB] == nil {
+		s.last[e.DB] = now
+		return true
+	}
+
+	s.pending[e.DB] = e
+	if s.timers[e.DB] == nil {
+		s.timers[e.DB] = time.AfterFunc(s.interval-since, func() { s.flush(sub, e.DB) })
+	}
+	return false
+}
+
+func (s *txSampler) flush(sub *BrokerSubscription, db string) {
+	s.m.Lock()
+	e := s.pending[db]
+	delete(s.pending, db)
+	delete(s.timers, db)
+	s.last[db] = time.Now()
+	s.m.Unlock()
+
+	if e != nil {
+		sub.enqueue(brokerItem{event: e})
+	}
+}
+
+func (s *txSampler) stop() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for db, t := range s.timers {
+		t.Stop()
+		delete(s.timers, db)
+	}
+}
+
+// PanicError is a panic recovered from a broker handler.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
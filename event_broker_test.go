@@ -0,0 +1,378 @@
+package litefs
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEventBroker(t *testing.T) {
+	t.Run("fan out", func(t *testing.T) {
+		b := mockServerBroker(t, sleep10, initEventJSON, flush, sleep10, txEventJSON, flush, sleep10)
+
+		var wg sync.WaitGroup
+		received := make([][]*Event, 2)
+		for i := range received {
+			sub := b.Subscribe()
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for len(received[i]) < 2 {
+					select {
+					case event := <-sub.C():
+						received[i] = append(received[i], event)
+					case <-time.After(100 * time.Millisecond):
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		for _, events := range received {
+			if !reflect.DeepEqual(events, []*Event{initEvent, txEvent}) {
+				t.Fatalf("wrong events: %#v", events)
+			}
+		}
+	})
+
+	t.Run("publish", func(t *testing.T) {
+		b := mockServerBroker(t)
+		sub := b.Subscribe()
+
+		go b.Publish(pChangeNode2Event)
+		assertReadEvent(t, sub, pChangeNode2Event)
+	})
+
+	t.Run("closed subscriber", func(t *testing.T) {
+		b := mockServerBroker(t)
+		sub1 := b.Subscribe()
+		sub2 := b.Subscribe()
+		sub1.Close()
+
+		go b.Publish(pChangeNode2Event)
+		assertReadEvent(t, sub2, pChangeNode2Event)
+
+		select {
+		case e, ok := <-sub1.C():
+			if ok {
+				t.Fatalf("closed subscriber received event: %v", e)
+			}
+		case <-time.After(10 * time.Millisecond):
+		}
+	})
+
+	t.Run("tx sampling", func(t *testing.T) {
+		b := mockServerBroker(t, hold)
+		sub := b.Subscribe(WithTxSampling(30 * time.Millisecond))
+
+		tx := func(db string, txid int) *Event {
+			return &Event{Type: EventTypeTx, DB: db, Data: &TxEventData{TXID: TXID(txid).String()}}
+		}
+		go func() {
+			b.Publish(tx("a", 1))
+			b.Publish(tx("a", 2))
+			b.Publish(tx("b", 1))
+			b.Publish(tx("a", 3))
+			b.Publish(pChangeNode2Event)
+		}()
+
+		read := func(timeout time.Duration) *Event {
+			select {
+			case e := <-sub.C():
+				return e
+			case <-time.After(timeout):
+				return nil
+			}
+		}
+		for _, expected := range []*Event{tx("a", 1), tx("b", 1), pChangeNode2Event} {
+			if e := read(100 * time.Millisecond); !reflect.DeepEqual(e, expected) {
+				t.Fatalf("wrong event\nexpected: %s\nactual: %s", expected, e)
+			}
+		}
+
+		// the latest coalesced event is delivered after the interval.
+		if e := read(15 * time.Millisecond); e != nil {
+			t.Fatalf("unexpected event before interval: %s", e)
+		}
+		if e := read(100 * time.Millisecond); !reflect.DeepEqual(e, tx("a", 3)) {
+			t.Fatalf("wrong coalesced event: %s", e)
+		}
+	})
+
+	t.Run("backfill", func(t *testing.T) {
+		b := mockServerBroker(t, hold)
+		sub1 := b.Subscribe()
+		go func() {
+			b.Publish(initEvent)
+			b.Publish(txEvent)
+			b.Publish(pChangeNode1Event)
+		}()
+		assertReadEvent(t, sub1, initEvent)
+		assertReadEvent(t, sub1, txEvent)
+		assertReadEvent(t, sub1, pChangeNode1Event)
+
+		sub2 := b.Subscribe()
+		data := pChangeNode1Event.Data.(*PrimaryChangeEventData)
+		assertReadEvent(t, sub2, &Event{Type: EventTypeInit, Data: &InitEventData{IsPrimary: data.IsPrimary, Hostname: data.Hostname}})
+		assertReadEvent(t, sub2, txEvent)
+
+		// live events follow the backfill.
+		go b.Publish(pChangeNode2Event)
+		assertReadEvent(t, sub1, pChangeNode2Event)
+		assertReadEvent(t, sub2, pChangeNode2Event)
+	})
+
+	t.Run("slow subscriber", func(t *testing.T) {
+		b := mockServerBroker(t, hold)
+		slow := b.Subscribe(WithBufferSize(1))
+		fast := b.Subscribe()
+
+		go func() {
+			b.Publish(pChangeNode1Event)
+			b.Publish(pChangeNode2Event)
+			b.Publish(pChangeNode1Event)
+		}()
+
+		// the slow subscriber never reads but doesn't block the fast one.
+		assertReadEvent(t, fast, pChangeNode1Event)
+		assertReadEvent(t, fast, pChangeNode2Event)
+		assertReadEvent(t, fast, pChangeNode1Event)
+
+		// events beyond the buffer and the one held by the delivery goroutine
+		// are dropped.
+		if n := slow.Dropped(); n == 0 || n > 2 {
+			t.Fatalf("expected 1 or 2 dropped events, got %d", n)
+		}
+		assertReadEvent(t, slow, pChangeNode1Event)
+	})
+
+	t.Run("slow subscriber warning", func(t *testing.T) {
+		b := mockServerBroker(t, hold)
+		var buf syncBuffer
+		b.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+		b.SlowThreshold = 10 * time.Millisecond
+		b.Subscribe(WithBufferSize(1), WithLabel("cache"))
+
+		// the delivery goroutine holds the first event and the buffer the
+		// second, so the buffer is full from the third.
+		b.Publish(pChangeNode1Event)
+		time.Sleep(5 * time.Millisecond)
+		b.Publish(pChangeNode1Event)
+		b.Publish(pChangeNode1Event)
+		if s := buf.String(); s != "" {
+			t.Fatalf("unexpected warning before threshold: %s", s)
+		}
+
+		time.Sleep(15 * time.Millisecond)
+		b.Publish(pChangeNode1Event)
+		b.Publish(pChangeNode1Event)
+
+		s := buf.String()
+		if strings.Count(s, "slow event subscriber") != 1 {
+			t.Fatalf("expected a single warning, got %q", s)
+		}
+		if !strings.Contains(s, "subscriber=cache") || !strings.Contains(s, "dropped=") {
+			t.Fatalf("expected label and drop count in warning, got %q", s)
+		}
+	})
+
+	t.Run("stats", func(t *testing.T) {
+		b := mockServerBroker(t, hold)
+		fast := b.Subscribe(WithLabel("fast"))
+		slow := b.Subscribe(WithLabel("slow"), WithBufferSize(1))
+
+		go func() {
+			b.Publish(pChangeNode1Event)
+			b.Publish(pChangeNode2Event)
+		}()
+		assertReadEvent(t, fast, pChangeNode1Event)
+		assertReadEvent(t, fast, pChangeNode2Event)
+		time.Sleep(10 * time.Millisecond)
+		assertReadEvent(t, slow, pChangeNode1Event)
+		time.Sleep(10 * time.Millisecond)
+
+		stats := b.Stats()
+		if len(stats) != 2 || stats[0].Label != "fast" || stats[1].Label != "slow" {
+			t.Fatalf("wrong stats: %+v", stats)
+		}
+		if s := stats[0]; s.Delivered != 2 || s.Pending != 0 {
+			t.Fatalf("wrong fast stats: %+v", s)
+		}
+		if s := stats[1]; s.Delivered != 1 || s.Pending != 0 || s.Lag < 10*time.Millisecond {
+			t.Fatalf("wrong slow stats: %+v", s)
+		}
+	})
+
+	t.Run("handler panic", func(t *testing.T) {
+		b := mockServerBroker(t, hold)
+
+		panics := make(chan *PanicError, 1)
+		b.OnPanic = func(sub *BrokerSubscription, err *PanicError) { panics <- err }
+
+		received := make(chan *Event, 2)
+		sub := b.Handle(func(e *Event) {
+			if e == pChangeNode1Event {
+				panic("boom")
+			}
+			received <- e
+		})
+		defer sub.Close()
+
+		b.Publish(pChangeNode1Event)
+		b.Publish(pChangeNode2Event)
+
+		select {
+		case err := <-panics:
+			if err.Error() != "panic: boom" || len(err.Stack) == 0 {
+				t.Fatalf("wrong panic error: %s", err)
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("timeout")
+		}
+		select {
+		case e := <-received:
+			if e != pChangeNode2Event {
+				t.Fatalf("wrong event: %s", e)
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("timeout")
+		}
+		if n := sub.Panics(); n != 1 {
+			t.Fatalf("expected 1 panic, got %d", n)
+		}
+	})
+
+	t.Run("typed handlers", func(t *testing.T) {
+		b := mockServerBroker(t, hold)
+		b.Publish(initEvent)
+
+		changes := make(chan *PrimaryChangeEventData, 2)
+		txs := make(chan string, 1)
+		t.Cleanup(b.OnPrimaryChange(func(data *PrimaryChangeEventData) { changes <- data }).Close)
+		t.Cleanup(b.OnTx(func(db string, data *TxEventData) { txs <- db + "@" + data.TXID }).Close)
+
+		go func() {
+			b.Publish(txEvent)
+			b.Publish(pChangeNode2Event)
+		}()
+
+		for _, expected := range []*PrimaryChangeEventData{
+			{IsPrimary: true, Hostname: "node-1"},
+			pChangeNode2Event.Data.(*PrimaryChangeEventData),
+		} {
+			select {
+			case data := <-changes:
+				if !reflect.DeepEqual(data, expected) {
+					t.Fatalf("expected %#v, got %#v", expected, data)
+				}
+			case <-time.After(100 * time.Millisecond):
+				t.Fatal("timeout")
+			}
+		}
+		select {
+		case tx := <-txs:
+			if tx != "db@0000000000000027" {
+				t.Fatalf("wrong tx: %s", tx)
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("timeout")
+		}
+	})
+}
+
+func TestEventBrokerUpstreamStopped(t *testing.T) {
+	// the first connection delivers an init event and ends; the node then
+	// refuses the reconnection, which stops the upstream subscription.
+	var connected bool
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if connected {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		connected = true
+		fmt.Fprintln(w, initEventJSON)
+	}))
+	t.Cleanup(s.Close)
+	prev := EventSubscriptionURL
+	EventSubscriptionURL = s.URL
+	t.Cleanup(func() { EventSubscriptionURL = prev })
+
+	b := NewEventBroker()
+	t.Cleanup(b.Close)
+	sub := b.Subscribe()
+	assertReadEvent(t, sub, initEvent)
+
+	// assertStopped reads errors up to the terminal one and the closed channel.
+	assertStopped := func(sub *BrokerSubscription) {
+		t.Helper()
+
+		for terminal := false; !terminal; {
+			select {
+			case err := <-sub.ErrC():
+				// the disconnection is reported before the refusal.
+				if terminal = IsTerminal(err); terminal && !errors.As(err, new(*ErrUnexpectedStatus)) {
+					t.Fatalf("expected status error, got %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timeout")
+			}
+		}
+		select {
+		case e, ok := <-sub.C():
+			if ok {
+				t.Fatalf("expected closed subscription, got %v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	assertStopped(sub)
+
+	// later subscribers receive the backfill before the error.
+	late := b.Subscribe()
+	assertReadEvent(t, late, initEvent)
+	assertStopped(late)
+}
+
+func mockServerBroker(t *testing.T, resps ...string) *EventBroker {
+	mockServer(t, resps...)
+
+	b := NewEventBroker()
+	t.Cleanup(b.Close)
+
+	return b
+}
+
+func TestEventBrokerNewEventSource(t *testing.T) {
+	b := mockServerBroker(t, initEventJSON, pChangeNode2EventJSON, hold)
+	useEventSource(t, b.NewEventSource)
+
+	// both monitors are fed by the broker's single upstream connection.
+	for i := 0; i < 2; i++ {
+		pm := NewPrimaryMonitor()
+		t.Cleanup(pm.Close)
+		assertReady(t, pm, time.Second)
+		assertPrimary(t, pm, false, "node-2")
+	}
+}
+
+func TestEventBrokerNewEventSourceFilter(t *testing.T) {
+	b := mockServerBroker(t, initEventJSON, txEventJSON, flush, hold)
+
+	// the backfill and live events are both filtered.
+	es := b.NewEventSource(WithEventFilter(EventTypeTx))
+	t.Cleanup(es.Close)
+	assertReadEvent(t, es, txEvent)
+
+	b.Publish(pChangeNode2Event)
+	b.Publish(txEvent)
+	assertReadEvent(t, es, txEvent)
+}
@@ -0,0 +1,101 @@
+package litefs
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultReplaySize is the number of recent tx events an EventBroker keeps for
+// SubscribeFrom by default.
+const DefaultReplaySize = 1024
+
+// ErrReplayTruncated is delivered by a subscription from SubscribeFrom when tx
+// events after the TXID it resumes from have been evicted from the broker's
+// replay buffer. Caches keyed on TXIDs of the database must be invalidated.
+var ErrReplayTruncated = errors.New("events to resume from were evicted")
+
+// SubscribeFrom returns a new subscription like Subscribe that, after an init
+// event with the node's current role, first delivers the retained tx events
+// with TXIDs after lastSeen, in the order they were received, rather than only
+// the latest tx event of each database. It lets a consumer that reconnects
+// catch up on the transactions it missed, so that caches keyed on TXIDs don't
+// skip invalidations.
+//
+// TXIDs are per database, so every database's tx events after lastSeen are
+// delivered. If some of them were evicted from the broker's replay buffer, an
+// error wrapping ErrReplayTruncated naming the database is delivered on ErrC
+// before the replayed events.
+func (b *EventBroker) SubscribeFrom(lastSeen TXID, opts ...BrokerSubscribeOption) *BrokerSubscription {
+	return b.Subscribe(append(opts, brokerOptionFunc(func(sub *BrokerSubscription) {
+		sub.from = &lastSeen
+	}))...)
+}
+
+// replay returns the items a subscription resuming from lastSeen starts with.
+// b.m must be held.
+func (b *EventBroker) replay(lastSeen TXID) []brokerItem {
+	var items []brokerItem
+	if b.init != nil {
+		data := *b.init
+		items = append(items, brokerItem{event: &Event{Type: EventTypeInit, Data: &data}})
+	}
+	for _, db := range sortedKeys(b.ring.evicted) {
+		if b.ring.evicted[db] > lastSeen {
+			items = append(items, brokerItem{err: fmt.Errorf("%w: %s", ErrReplayTruncated, db)})
+		}
+	}
+	for _, e := range b.ring.events() {
+		if txid, _ := eventTXID(e); txid > lastSeen {
+			items = append(items, brokerItem{event: e})
+		}
+	}
+	return items
+}
+
+// eventRing is a bounded buffer of the most recent tx events.
+type eventRing struct {
+	buf   []*Event
+	start int // index of the oldest event once buf is full
+
+	// evicted is the highest TXID of each database evicted from buf.
+	evicted map[string]TXID
+}
+
+// push adds e, evicting the oldest event if the ring holds size events. A
+// size of zero means DefaultReplaySize.
+func (r *eventRing) push(e *Event, size int) {
+	if size <= 0 {
+		size = DefaultReplaySize
+	}
+	if len(r.buf) < size {
+		r.buf = append(r.buf, e)
+		return
+	}
+
+	old := r.buf[r.start]
+	if txid, ok := eventTXID(old); ok {
+		if r.evicted == nil {
+			r.evicted = make(map[string]TXID)
+		}
+		r.evicted[old.DB] = max(r.evicted[old.DB], txid)
+	}
+	r.buf[r.start] = e
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+// events returns the retained events from oldest to newest.
+func (r *eventRing) events() []*Event {
+	events := make([]*Event, 0, len(r.buf))
+	events = append(events, r.buf[r.start:]...)
+	return append(events, r.buf[:r.start]...)
+}
+
+// eventTXID returns the TXID of a tx event.
+func eventTXID(e *Event) (TXID, bool) {
+	data, ok := e.Data.(*TxEventData)
+	if !ok {
+		return 0, false
+	}
+	txid, err := ParseTXID(data.TXID)
+	return txid, err == nil
+}
@@ -0,0 +1,45 @@
+package litefs
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEventBrokerSubscribeFrom(t *testing.T) {
+	b := mockServerBroker(t, hold)
+	b.ReplaySize = 3
+
+	tx := func(txid TXID) *Event {
+		return &Event{Type: EventTypeTx, DB: "db", Data: &TxEventData{TXID: txid.String()}}
+	}
+	b.Publish(initEvent)
+	for txid := TXID(1); txid <= 4; txid++ {
+		b.Publish(tx(txid))
+	}
+
+	t.Run("retained", func(t *testing.T) {
+		sub := b.SubscribeFrom(1)
+		t.Cleanup(sub.Close)
+
+		assertReadEvent(t, sub, initEvent)
+		for txid := TXID(2); txid <= 4; txid++ {
+			assertReadEvent(t, sub, tx(txid))
+		}
+
+		b.Publish(tx(5))
+		assertReadEvent(t, sub, tx(5))
+	})
+
+	t.Run("evicted", func(t *testing.T) {
+		sub := b.SubscribeFrom(1)
+		t.Cleanup(sub.Close)
+
+		assertReadEvent(t, sub, initEvent)
+		if err := readError(t, sub); !errors.Is(err, ErrReplayTruncated) {
+			t.Fatalf("expected ErrReplayTruncated, got %v", err)
+		}
+		for txid := TXID(3); txid <= 5; txid++ {
+			assertReadEvent(t, sub, tx(txid))
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package litefs
+
+import "errors"
+
+// ErrSubscriptionClosed is returned by components reading events when their
+// event source stops, e.g. because it or the component was closed. Errors
+// that ended the subscription are returned instead when they are known.
+var ErrSubscriptionClosed = errors.New("event subscription closed")
+
+// EventSource is a stream of events from a LiteFS node. It is implemented by
+// *EventSubscription, *BrokerSubscription and *PrimaryFileWatcher, and can be
+// implemented by fakes in tests.
+//
+// C and ErrC must be closed once the source has stopped, e.g. after Close.
+type EventSource interface {
+	C() <-chan *Event
+	ErrC() <-chan error
+	Close()
+}
+
+// NewEventSource opens the event sources that the package's components, such
+// as PrimaryMonitor and ConsistencyTracker, read from. It defaults to
+// SubscribeEvents; replace it to feed components from a shared EventBroker,
+// with EventBroker.NewEventSource, or from a fake. The options are hints:
+// components ignore events that don't match them, so they may be dropped by
+// sources that aren't subscriptions.
+var NewEventSource = func(opts ...SubscribeOption) EventSource {
+	return SubscribeEvents(opts...)
+}
+
+// sourceError returns the error a component should stop reading from an event
+// source with, given err and running received from its ErrC: err if it ended
+// the subscription, ErrSubscriptionClosed if ErrC is closed, or nil to keep
+// reading. Components must stop once a source's channels are closed, which
+// are otherwise always ready.
+func sourceError(err error, running bool) error {
+	if !running {
+		return ErrSubscriptionClosed
+	}
+	if IsTerminal(err) {
+		return err
+	}
+	return nil
+}
+
+var (
+	_ EventSource = (*EventSubscription)(nil)
+	_ EventSource = (*BrokerSubscription)(nil)
+	_ EventSource = (*PrimaryFileWatcher)(nil)
+)
@@ -0,0 +1,83 @@
+package litefs
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewEventSource(t *testing.T) {
+	t.Run("fake", func(t *testing.T) {
+		src := newFakeSource()
+		useEventSource(t, func(...SubscribeOption) EventSource { return src })
+
+		pm := NewPrimaryMonitor()
+		t.Cleanup(pm.Close)
+
+		src.c <- pChangeNode2Event
+		assertReady(t, pm, time.Second)
+		assertPrimary(t, pm, false, "node-2")
+
+		pm.Close()
+		select {
+		case <-src.done:
+		case <-time.After(time.Second):
+			t.Fatal("expected source to be closed")
+		}
+	})
+
+	t.Run("broker", func(t *testing.T) {
+		b := mockServerBroker(t, hold)
+		useEventSource(t, func(...SubscribeOption) EventSource { return b.Subscribe() })
+
+		pt := NewPrimaryTracker()
+		t.Cleanup(pt.Close)
+
+		b.Publish(initEvent)
+		assertChanged(t, pt, true)
+
+		pt.Close()
+		select {
+		case _, ok := <-pt.Changed():
+			if ok {
+				t.Fatal("expected tracker to stop")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	})
+}
+
+// useEventSource replaces NewEventSource with fn for the duration of the test.
+func useEventSource(t *testing.T, fn func(...SubscribeOption) EventSource) {
+	prev := NewEventSource
+	NewEventSource = fn
+	t.Cleanup(func() { NewEventSource = prev })
+}
+
+// fakeSource is an EventSource whose events are sent by the test.
+type fakeSource struct {
+	c    chan *Event
+	errc chan error
+	done chan struct{}
+	once sync.Once
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		c:    make(chan *Event),
+		errc: make(chan error),
+		done: make(chan struct{}),
+	}
+}
+
+func (s *fakeSource) C() <-chan *Event   { return s.c }
+func (s *fakeSource) ErrC() <-chan error { return s.errc }
+
+func (s *fakeSource) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		close(s.c)
+		close(s.errc)
+	})
+}
@@ -0,0 +1,268 @@
+package litefs
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEventsTable is the table SQLEventStore uses if none is set.
+const DefaultEventsTable = "_litefs_events"
+
+// StoredEvent is an event persisted by an EventStore.
+type StoredEvent struct {
+	ReceivedAt time.Time `json:"receivedAt"`
+	Event      *Event    `json:"event"`
+}
+
+// TXID returns the TXID of a tx event.
+func (e *StoredEvent) TXID() (TXID, bool) {
+	data, ok := e.Event.Data.(*TxEventData)
+	if !ok {
+		return 0, false
+	}
+	txid, err := ParseTXID(data.TXID)
+	return txid, err == nil
+}
+
+// EventQuery selects stored events. Zero fields don't restrict the results.
+type EventQuery struct {
+	// DB selects events for a database.
+	DB string
+
+	// Since and Until select events received within [Since, Until).
+	Since time.Time
+	Until time.Time
+
+	// MinTXID and MaxTXID select tx events within [MinTXID, MaxTXID]. Other
+	// events are excluded if either is set.
+	MinTXID TXID
+	MaxTXID TXID
+
+	// Limit caps the number of events returned.
+	Limit int
+}
+
+// Match reports whether e is selected by q, ignoring Limit.
+func (q *EventQuery) Match(e *StoredEvent) bool {
+	if q.DB != "" && e.Event.DB != q.DB {
+		return false
+	}
+	if !q.Since.IsZero() && e.ReceivedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !e.ReceivedAt.Before(q.Until) {
+		return false
+	}
+	if q.MinTXID != 0 || q.MaxTXID != 0 {
+		txid, ok := e.TXID()
+		if !ok || txid < q.MinTXID || (q.MaxTXID != 0 && txid > q.MaxTXID) {
+			return false
+		}
+	}
+	return true
+}
+
+// EventStore durably records events so that they can be analyzed after an
+// incident or replayed to consumers that fall behind.
+type EventStore interface {
+	// Append records e.
+	Append(ctx context.Context, e StoredEvent) error
+
+	// Query returns the events selected by q in the order they were appended.
+	Query(ctx context.Context, q EventQuery) ([]StoredEvent, error)
+}
+
+// Persist appends every event received by the broker to store until the
+// returned subscription is closed. Errors are passed to onError, if set.
+func (b *EventBroker) Persist(store EventStore, onError func(error)) *BrokerSubscription {
+	return b.Handle(func(e *Event) {
+		if err := store.Append(context.Background(), StoredEvent{ReceivedAt: time.Now(), Event: e}); err != nil && onError != nil {
+			onError(err)
+		}
+	}, WithoutBackfill())
+}
+
+// FileEventStore is an EventStore that appends events to a file as NDJSON.
+// Queries scan the whole file, so it suits modest histories. The file should
+// not be inside the LiteFS mount.
+type FileEventStore struct {
+	path string
+	m    sync.Mutex
+	f    *os.File
+}
+
+// OpenFileEventStore opens or creates the event store file at path.
+func OpenFileEventStore(path string) (*FileEventStore, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &FileEventStore{path: path, f: f}, nil
+}
+
+// Close closes the file.
+func (s *FileEventStore) Close() error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.f.Close()
+}
+
+// Append writes e to the end of the file.
+func (s *FileEventStore) Append(ctx context.Context, e StoredEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+// Query scans the file for the events selected by q.
+func (s *FileEventStore) Query(ctx context.Context, q EventQuery) ([]StoredEvent, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []StoredEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var e StoredEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		if e.Event == nil || !q.Match(&e) {
+			continue
+		}
+		if events = append(events, e); q.Limit > 0 && len(events) >= q.Limit {
+			break
+		}
+	}
+	return events, scanner.Err()
+}
+
+// SQLEventStore is an EventStore backed by a table in a SQL database. The
+// database should be a local SQLite file rather than one replicated by LiteFS
+// so that every node keeps its own history.
+type SQLEventStore struct {
+	DB *sql.DB
+
+	// Table is the name of the table events are stored in. It defaults to
+	// DefaultEventsTable.
+	Table string
+}
+
+// Init creates the events table if it doesn't exist.
+func (s *SQLEventStore) Init(ctx context.Context) error {
+	if _, err := s.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+s.table()+` (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	received_at INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	db TEXT NOT NULL,
+	txid INTEGER,
+	event BLOB NOT NULL
+)`); err != nil {
+		return err
+	}
+	_, err := s.DB.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS `+quoteIdent(s.name()+"_received_at")+` ON `+s.table()+` (received_at)`)
+	return err
+}
+
+// Append inserts e into the table.
+func (s *SQLEventStore) Append(ctx context.Context, e StoredEvent) error {
+	data, err := json.Marshal(e.Event)
+	if err != nil {
+		return err
+	}
+
+	var txid sql.NullInt64
+	if id, ok := e.TXID(); ok {
+		txid = sql.NullInt64{Int64: int64(id), Valid: true}
+	}
+
+	_, err = s.DB.ExecContext(ctx, `INSERT INTO `+s.table()+` (received_at, type, db, txid, event) VALUES (?, ?, ?, ?, ?)`,
+		e.ReceivedAt.UnixNano(), e.Event.Type, e.Event.DB, txid, data,
+	)
+	return err
+}
+
+// Query selects the events matching q from the table.
+func (s *SQLEventStore) Query(ctx context.Context, q EventQuery) ([]StoredEvent, error) {
+	var where []string
+	var args []any
+	if q.DB != "" {
+		where, args = append(where, "db = ?"), append(args, q.DB)
+	}
+	if !q.Since.IsZero() {
+		where, args = append(where, "received_at >= ?"), append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		where, args = append(where, "received_at < ?"), append(args, q.Until.UnixNano())
+	}
+	if q.MinTXID != 0 || q.MaxTXID != 0 {
+		where, args = append(where, "txid >= ?"), append(args, int64(q.MinTXID))
+	}
+	if q.MaxTXID != 0 {
+		where, args = append(where, "txid <= ?"), append(args, int64(q.MaxTXID))
+	}
+
+	query := `SELECT received_at, event FROM ` + s.table()
+	if len(where) != 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []StoredEvent
+	for rows.Next() {
+		var receivedAt int64
+		var data []byte
+		if err := rows.Scan(&receivedAt, &data); err != nil {
+			return nil, err
+		}
+
+		e := StoredEvent{ReceivedAt: time.Unix(0, receivedAt)}
+		if err := json.Unmarshal(data, &e.Event); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *SQLEventStore) table() string {
+	return quoteIdent(s.name())
+}
+
+func (s *SQLEventStore) name() string {
+	if s.Table != "" {
+		return s.Table
+	}
+	return DefaultEventsTable
+}
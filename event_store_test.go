@@ -0,0 +1,96 @@
+package litefs
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileEventStore(t *testing.T) {
+	s, err := OpenFileEventStore(filepath.Join(t.TempDir(), "events"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tx := func(db string, txid TXID) *Event {
+		return &Event{Type: EventTypeTx, DB: db, Data: &TxEventData{TXID: txid.String(), PostApplyChecksum: Checksum(0).String()}}
+	}
+
+	events := []StoredEvent{
+		{ReceivedAt: t0, Event: initEvent},
+		{ReceivedAt: t0.Add(1 * time.Second), Event: tx("a", 1)},
+		{ReceivedAt: t0.Add(2 * time.Second), Event: tx("b", 1)},
+		{ReceivedAt: t0.Add(3 * time.Second), Event: tx("a", 2)},
+		{ReceivedAt: t0.Add(4 * time.Second), Event: pChangeNode2Event},
+	}
+	for _, e := range events {
+		if err := s.Append(ctx, e); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name     string
+		query    EventQuery
+		expected []StoredEvent
+	}{
+		{"all", EventQuery{}, events},
+		{"db", EventQuery{DB: "a"}, []StoredEvent{events[1], events[3]}},
+		{"time", EventQuery{Since: t0.Add(time.Second), Until: t0.Add(3 * time.Second)}, events[1:3]},
+		{"txid", EventQuery{DB: "a", MinTXID: 2}, events[3:4]},
+		{"max txid", EventQuery{MaxTXID: 1}, events[1:3]},
+		{"limit", EventQuery{Limit: 2}, events[:2]},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := s.Query(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if len(actual) != len(tt.expected) {
+				t.Fatalf("expected %d events, got %d", len(tt.expected), len(actual))
+			}
+			for i := range actual {
+				if !actual[i].ReceivedAt.Equal(tt.expected[i].ReceivedAt) || !reflect.DeepEqual(actual[i].Event, tt.expected[i].Event) {
+					t.Fatalf("wrong event %d: %s", i, actual[i].Event)
+				}
+			}
+		})
+	}
+}
+
+func TestEventBrokerPersist(t *testing.T) {
+	b := mockServerBroker(t, hold)
+	b.Publish(initEvent)
+
+	s, err := OpenFileEventStore(filepath.Join(t.TempDir(), "events"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer s.Close()
+
+	sub := b.Persist(s, func(err error) { t.Errorf("unexpected error: %s", err) })
+	defer sub.Close()
+
+	b.Publish(txEvent)
+
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for {
+		events, err := s.Query(context.Background(), EventQuery{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		// the backfilled init event isn't persisted again.
+		if len(events) == 1 && reflect.DeepEqual(events[0].Event, txEvent) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("wrong events: %#v", events)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
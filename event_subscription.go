@@ -1,31 +1,264 @@
 package litefs
 
 import (
+	"bufio"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand"
 	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
 )
 
 var (
 	EventSubscriptionClient = http.DefaultClient
-	EventSubscriptionURL    = "http://localhost:20202/events"
-)
 
-var (
-	errUnexpectedStatus = errors.New("unexpected status")
+	// EventSubscriptionURL, if set, is the URL of the event stream that
+	// subscriptions connect to. Otherwise it is found with
+	// DiscoverEventsURL each time a subscription connects.
+	EventSubscriptionURL = ""
 )
 
+// ErrDisconnected is wrapped by errors reading an event stream after it
+// connected, such as LiteFS closing it on shutdown. Reconnecting usually
+// fixes them.
+var ErrDisconnected = errors.New("disconnected from event stream")
+
+// ErrUnexpectedStatus is the error returned when LiteFS, or another server this
+// package makes requests to, responds with a status other than 200 OK.
+type ErrUnexpectedStatus struct {
+	Code int
+
+	// Message is the start of the response body, if it was read.
+	Message string
+}
+
+func (e *ErrUnexpectedStatus) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status: %d", e.Code)
+	}
+	return fmt.Sprintf("unexpected status: %d: %s", e.Code, e.Message)
+}
+
+// Permanent reports whether retrying the request is pointless, e.g. because
+// the endpoint doesn't exist or the request isn't authorized.
+func (e *ErrUnexpectedStatus) Permanent() bool {
+	return isPermanentStatus(e.Code)
+}
+
+// ErrStreamStale is delivered when a subscription's event stream is silent for
+// longer than its heartbeat timeout (see WithHeartbeatTimeout).
+var ErrStreamStale = errors.New("event stream stale")
+
+var errRetriesExhausted = errors.New("retries exhausted")
+
+// DefaultUserAgent is the User-Agent sent with requests to LiteFS.
+const DefaultUserAgent = "litefs-go"
+
 // EventSubscription tracks events published by a LiteFS node.
 type EventSubscription struct {
 	c     chan *Event
 	errc  chan error
 	ctx   context.Context
 	close func()
+
+	settings settings
+
+	client        *http.Client
+	errorInterval time.Duration
+	backoff       *Backoff
+	attempts      int
+	tee           io.Writer
+	types         map[string]bool
+	db            string
+	userAgent     string
+	url           string
+	header        http.Header
+	query         url.Values
+	heartbeat     time.Duration
+	overflow      OverflowPolicy
+	dropped       atomic.Uint64
+	lastErr       error
+	lastErrAt     time.Time
+	repeats       int
+}
+
+// SubscribeOption configures an EventSubscription. Every Option is also a
+// SubscribeOption.
+type SubscribeOption interface {
+	applySubscription(*EventSubscription)
+}
+
+type subscribeOptionFunc func(*EventSubscription)
+
+func (f subscribeOptionFunc) applySubscription(es *EventSubscription) { f(es) }
+
+// WithHTTPClient makes subscription requests with c rather than
+// EventSubscriptionClient, e.g. to set timeouts or a transport that dials
+// LiteFS over a Unix socket. c must not time out whole requests since the
+// event stream is long-lived.
+func WithHTTPClient(c *http.Client) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		es.client = c
+	})
+}
+
+// WithErrorInterval coalesces identical consecutive errors. After an error is
+// delivered on ErrC, repeats of it are counted rather than delivered until d
+// has elapsed, at which point a *RepeatedError carrying the count is
+// delivered instead.
+func WithErrorInterval(d time.Duration) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		es.errorInterval = d
+	})
+}
+
+// WithReconnect waits between reconnection attempts according to b, rather
+// than reconnecting immediately. Errors are delivered on ErrC only if a
+// receiver is ready, so a subscriber that only reads C keeps receiving events
+// across LiteFS restarts. If b.MaxRetries consecutive attempts fail, a
+// *TerminalError is delivered and the subscription stops.
+func WithReconnect(b Backoff) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		es.backoff = &b
+	})
+}
+
+// WithEventFilter only delivers events of the given types, e.g. EventTypeTx.
+// EventTypeUnknown delivers events of types without a decoder.
+func WithEventFilter(types ...string) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		if es.types == nil {
+			es.types = make(map[string]bool)
+		}
+		for _, typ := range types {
+			es.types[typ] = true
+		}
+	})
+}
+
+// WithDatabase only delivers events for the database named name, along with
+// events such as init and primaryChange that aren't about any database.
+func WithDatabase(name string) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		es.db = name
+	})
+}
+
+// WithTee copies the raw NDJSON event stream to w as it is read, e.g. to
+// capture it for debugging. Errors writing to w are ignored so that capture
+// never interrupts the subscription.
+func WithTee(w io.Writer) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		es.tee = w
+	})
+}
+
+// WithUserAgent sets the User-Agent of subscription requests so that LiteFS
+// logs and proxies can attribute connections to an application.
+func WithUserAgent(ua string) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		es.userAgent = ua
+	})
+}
+
+// WithURL subscribes to the events endpoint at u rather than
+// EventSubscriptionURL or the discovered one. Deployments that only expose the
+// LiteFS proxy port can route a path on it to LiteFS's /events endpoint and
+// subscribe to that path, passing any credentials the route requires with
+// WithHeader. To route the subscriptions of every type in this package that
+// way, set EventSubscriptionURL or LITEFS_EVENTS_URL instead and add
+// credentials with a transport on EventSubscriptionClient.
+func WithURL(u string) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		es.url = u
+	})
+}
+
+// WithHeader adds a header to subscription requests, e.g. an Authorization
+// header for an events endpoint reached through a proxy.
+func WithHeader(key, value string) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		if es.header == nil {
+			es.header = make(http.Header)
+		}
+		es.header.Add(key, value)
+	})
+}
+
+// WithQuery adds a query parameter to subscription requests, e.g. an
+// application name or instance ID.
+func WithQuery(key, value string) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		if es.query == nil {
+			es.query = make(url.Values)
+		}
+		es.query.Add(key, value)
+	})
 }
 
-func SubscribeEvents() *EventSubscription {
+// WithHeartbeatTimeout treats an event stream that is silent for d, with
+// neither events nor the blank keepalive lines between them, as failed, so
+// that a connection lost without being closed is noticed. The connection is
+// dropped, ErrStreamStale is delivered on ErrC and the subscription
+// reconnects. Time spent waiting for the subscriber to receive an event isn't
+// counted. d must be longer than the interval LiteFS sends keepalives at.
+func WithHeartbeatTimeout(d time.Duration) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		es.heartbeat = d
+	})
+}
+
+// OverflowPolicy is what a subscription does with an event when its buffer is
+// full (see WithEventBuffer).
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops reading the event stream until the subscriber
+	// receives an event. LiteFS may disconnect a subscriber that blocks for
+	// too long.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest drops the oldest buffered event to make room.
+	OverflowDropOldest
+
+	// OverflowDropNewest drops the new event.
+	OverflowDropNewest
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowDropNewest:
+		return "drop-newest"
+	default:
+		return "unknown"
+	}
+}
+
+// WithEventBuffer buffers up to n events for the subscriber, so that the
+// event stream keeps being read while the subscriber is busy, and handles
+// events arriving when the buffer is full according to policy. Dropped events
+// are counted by Dropped.
+func WithEventBuffer(n int, policy OverflowPolicy) SubscribeOption {
+	return subscribeOptionFunc(func(es *EventSubscription) {
+		es.c = make(chan *Event, n)
+		es.overflow = policy
+	})
+}
+
+// SubscribeEvents subscribes to the local LiteFS node's event stream. The
+// subscription reconnects after errors until it is closed or a *TerminalError
+// is delivered on ErrC, after which both channels are closed.
+func SubscribeEvents(opts ...SubscribeOption) *EventSubscription {
 	ctx, close := context.WithCancel(context.Background())
 
 	es := &EventSubscription{
@@ -33,9 +266,15 @@ func SubscribeEvents() *EventSubscription {
 		errc:  make(chan error),
 		ctx:   ctx,
 		close: close,
+
+		client:    EventSubscriptionClient,
+		userAgent: DefaultUserAgent,
+	}
+	for _, opt := range opts {
+		opt.applySubscription(es)
 	}
 
-	go es.run()
+	spawn(es.run)
 
 	return es
 }
@@ -46,40 +285,302 @@ func (es *EventSubscription) run() {
 
 	for {
 		err := es.doRequest()
+		if o := es.settings.observer; o != nil {
+			o.Disconnected(es, err)
+		}
 		if es.ctx.Err() != nil {
 			return
 		}
 
-		es.errc <- err
+		var terr *TerminalError
+		if errors.As(err, &terr) {
+			es.settings.log(slog.LevelError, "event subscription stopped", slog.Any("error", err))
+			es.sendError(err)
+			return
+		}
+		if es.backoff == nil {
+			es.settings.log(slog.LevelWarn, "event stream disconnected, reconnecting", slog.Any("error", err))
+			es.reportError(err)
+			es.settings.add(MetricReconnects, 1)
+			continue
+		}
+
+		es.attempts++
+		if es.backoff.MaxRetries > 0 && es.attempts > es.backoff.MaxRetries {
+			err := &TerminalError{Err: fmt.Errorf("%w after %d attempts: %w", errRetriesExhausted, es.attempts, err)}
+			es.settings.log(slog.LevelError, "event subscription stopped", slog.Any("error", err))
+			es.sendError(err)
+			return
+		}
+		es.reportError(err)
+
+		delay := es.backoff.Delay(es.attempts)
+		es.settings.log(slog.LevelWarn, "event stream disconnected, retrying",
+			slog.Any("error", err),
+			slog.Int("attempt", es.attempts),
+			slog.Duration("delay", delay),
+		)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-es.ctx.Done():
+			timer.Stop()
+			return
+		}
+		es.settings.add(MetricReconnects, 1)
+	}
+}
+
+// reportError delivers err, coalescing repeats if an error interval is set.
+func (es *EventSubscription) reportError(err error) {
+	if es.errorInterval <= 0 {
+		es.sendError(err)
+		return
+	}
+
+	now := es.settings.now()
+	if es.lastErr != nil && err.Error() == es.lastErr.Error() {
+		es.repeats++
+		if now.Sub(es.lastErrAt) < es.errorInterval {
+			return
+		}
+		err = &RepeatedError{Err: err, Count: es.repeats}
+	} else {
+		es.lastErr = err
+	}
+
+	es.lastErrAt = now
+	es.repeats = 0
+	es.sendError(err)
+}
+
+func (es *EventSubscription) sendError(err error) {
+	// in reconnect mode only terminal errors must be received.
+	if es.backoff != nil && !IsTerminal(err) {
+		select {
+		case es.errc <- err:
+		default:
+		}
+		return
+	}
+
+	select {
+	case es.errc <- err:
+	case <-es.ctx.Done():
 	}
 }
 
 func (es *EventSubscription) doRequest() error {
-	req, err := http.NewRequestWithContext(es.ctx, http.MethodGet, EventSubscriptionURL, nil)
+	u := es.url
+	if u == "" {
+		var err error
+		if u, err = eventsURL(); err != nil {
+			return &TerminalError{Err: err}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(es.ctx)
+	defer cancel()
+
+	var hb *heartbeat
+	if es.heartbeat > 0 {
+		hb = newHeartbeat(es.heartbeat, cancel)
+		defer hb.stop()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		return err
+		return &TerminalError{Err: err}
+	}
+	for k, vs := range es.header {
+		req.Header[k] = append(req.Header[k], vs...)
+	}
+	req.Header.Set("User-Agent", es.userAgent)
+	if len(es.query) != 0 {
+		q := req.URL.Query()
+		for k, vs := range es.query {
+			q[k] = append(q[k], vs...)
+		}
+		req.URL.RawQuery = q.Encode()
 	}
 
-	resp, err := EventSubscriptionClient.Do(req)
+	resp, err := es.client.Do(req)
 	if err != nil {
-		return err
+		return hb.check(err)
 	}
 
+	openConnections.Add(1)
+	defer openConnections.Add(-1)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("%w: %d", errUnexpectedStatus, resp.StatusCode)
+		err := &ErrUnexpectedStatus{Code: resp.StatusCode}
+		if err.Permanent() {
+			return &TerminalError{Err: err}
+		}
+		return err
+	}
+	es.settings.log(slog.LevelInfo, "connected to event stream", slog.String("url", req.URL.String()))
+	if o := es.settings.observer; o != nil {
+		o.Connected(es, req.URL.String())
+	}
+
+	var body io.Reader = resp.Body
+	if hb != nil {
+		body = &heartbeatReader{r: body, hb: hb}
+	}
+	if es.tee != nil {
+		body = io.TeeReader(body, ignoreErrorsWriter{es.tee})
 	}
 
-	d := json.NewDecoder(resp.Body)
+	r := bufio.NewReader(body)
 	for {
-		var e Event
-		if err := d.Decode(&e); err != nil {
+		line, err := readEventLine(r)
+		if errors.Is(err, ErrDecode) {
+			return err
+		} else if err != nil {
+			return hb.check(fmt.Errorf("%w: %w", ErrDisconnected, err))
+		}
+		e, err := DecodeEvent(line)
+		if err != nil {
+			es.settings.log(slog.LevelWarn, "couldn't decode event", slog.Any("error", err))
+			es.settings.add(MetricDecodeErrors, 1)
+			return err
+		}
+		es.settings.add(MetricEventsReceived, 1, "type", e.Type)
+		if e.Type == EventTypePrimaryChange {
+			es.settings.log(slog.LevelInfo, "primary changed", slog.Any("event", e))
+		}
+		if o := es.settings.observer; o != nil {
+			o.Received(es, e)
+		}
+
+		// a decoded event resets error coalescing and backoff.
+		es.lastErr = nil
+		es.attempts = 0
+
+		if !es.match(e) {
+			continue
+		}
+
+		hb.stop()
+		if err := es.send(e); err != nil {
 			return err
 		}
+		hb.reset()
+	}
+}
+
+// send delivers e according to the subscription's overflow policy.
+func (es *EventSubscription) send(e *Event) error {
+	switch es.overflow {
+	case OverflowDropNewest:
+		select {
+		case es.c <- e:
+		default:
+			es.drop()
+		}
+		return nil
+	case OverflowDropOldest:
+		for {
+			select {
+			case es.c <- e:
+				return nil
+			default:
+			}
+			// drop e itself if the subscriber emptied the buffer, or it
+			// has none.
+			es.drop()
+			select {
+			case <-es.c:
+			default:
+				return nil
+			}
+		}
+	default:
+		select {
+		case es.c <- e:
+			return nil
+		case <-es.ctx.Done():
+			return es.ctx.Err()
+		}
+	}
+}
+
+// heartbeat cancels a request when it isn't reset within its timeout.
+type heartbeat struct {
+	d     time.Duration
+	timer *time.Timer
+	stale atomic.Bool
+}
+
+func newHeartbeat(d time.Duration, cancel func()) *heartbeat {
+	hb := &heartbeat{d: d}
+	hb.timer = time.AfterFunc(d, func() {
+		hb.stale.Store(true)
+		cancel()
+	})
+	return hb
+}
+
+// reset restarts the timeout. It is a no-op on a nil heartbeat, as are stop
+// and check.
+func (hb *heartbeat) reset() {
+	if hb != nil {
+		hb.timer.Reset(hb.d)
+	}
+}
+
+func (hb *heartbeat) stop() {
+	if hb != nil {
+		hb.timer.Stop()
+	}
+}
+
+// check returns ErrStreamStale in place of err if the timeout expired.
+func (hb *heartbeat) check(err error) error {
+	if hb != nil && hb.stale.Load() {
+		return fmt.Errorf("%w: no data for %s", ErrStreamStale, hb.d)
+	}
+	return err
+}
 
-		es.c <- &e
+// heartbeatReader resets hb whenever data is read from r.
+type heartbeatReader struct {
+	r  io.Reader
+	hb *heartbeat
+}
+
+func (r *heartbeatReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.hb.reset()
+	}
+	return n, err
+}
+
+// match reports whether e passes the subscription's filters.
+func (es *EventSubscription) match(e *Event) bool {
+	if es.types != nil && !es.types[e.Type] && !(es.types[EventTypeUnknown] && !isKnownEventType(e.Type)) {
+		return false
 	}
+	return es.db == "" || e.DB == "" || e.DB == es.db
+}
+
+// ignoreErrorsWriter reports every write to w as successful.
+type ignoreErrorsWriter struct {
+	w io.Writer
+}
+
+func (w ignoreErrorsWriter) Write(p []byte) (int, error) {
+	_, _ = w.w.Write(p)
+	return len(p), nil
+}
+
+// isPermanentStatus reports whether retrying a request that received the
+// status code is pointless, e.g. because the events endpoint doesn't exist.
+func isPermanentStatus(code int) bool {
+	return code >= 400 && code < 500 && code != http.StatusRequestTimeout && code != http.StatusTooManyRequests
 }
 
 // C returns a chan of events from the local LiteFS node.
@@ -88,12 +589,108 @@ func (es *EventSubscription) C() <-chan *Event {
 }
 
 // ErrC returns a chan of errors encountered while fetching events from the
-// local LiteFS node.
+// local LiteFS node. Both channels are closed after a *TerminalError is
+// delivered.
 func (es *EventSubscription) ErrC() <-chan error {
 	return es.errc
 }
 
+func (es *EventSubscription) drop() {
+	es.dropped.Add(1)
+	es.settings.add(MetricEventsDropped, 1)
+}
+
+// Dropped returns the number of events dropped because the subscription's
+// buffer was full (see WithEventBuffer).
+func (es *EventSubscription) Dropped() uint64 {
+	return es.dropped.Load()
+}
+
 // Close shuts down the EventSubscription.
 func (es *EventSubscription) Close() {
 	es.close()
 }
+
+// RepeatedError is delivered in place of an error that occurred Count more
+// times since it was last delivered (see WithErrorInterval).
+type RepeatedError struct {
+	Err   error
+	Count int
+}
+
+func (e *RepeatedError) Error() string {
+	return fmt.Sprintf("%s (repeated %d times)", e.Err, e.Count)
+}
+
+func (e *RepeatedError) Unwrap() error {
+	return e.Err
+}
+
+// TerminalError is delivered when the subscription encounters an error that
+// reconnecting can't fix, such as the events endpoint not existing. The
+// subscription stops after delivering it.
+type TerminalError struct {
+	Err error
+}
+
+func (e *TerminalError) Error() string {
+	return "terminal: " + e.Err.Error()
+}
+
+func (e *TerminalError) Unwrap() error {
+	return e.Err
+}
+
+// IsTerminal reports whether err ended its subscription.
+func IsTerminal(err error) bool {
+	var terr *TerminalError
+	return errors.As(err, &terr)
+}
+
+// DefaultBackoff is a Backoff suitable for reconnecting to the local LiteFS
+// node.
+var DefaultBackoff = Backoff{
+	Min:        100 * time.Millisecond,
+	Max:        10 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Backoff configures exponential backoff between retries.
+type Backoff struct {
+	// Min is the delay before the first retry.
+	Min time.Duration
+
+	// Max caps the delay. Zero leaves it uncapped.
+	Max time.Duration
+
+	// Multiplier is the factor the delay grows by after each failed attempt.
+	// Values below 1 are treated as 1.
+	Multiplier float64
+
+	// Jitter randomizes each delay by up to this fraction of it, in either
+	// direction, so that many clients don't retry in lockstep.
+	Jitter float64
+
+	// MaxRetries is the number of consecutive failed attempts after which to
+	// give up. Zero retries forever.
+	MaxRetries int
+}
+
+// Delay returns the delay before the given retry, starting from 1.
+func (b Backoff) Delay(attempt int) time.Duration {
+	limit := float64(b.Max)
+	if b.Max <= 0 {
+		limit = math.MaxInt64 / 2
+	}
+
+	d := float64(b.Min)
+	for i := 1; i < attempt && d < limit; i++ {
+		d *= math.Max(b.Multiplier, 1)
+	}
+	d = math.Min(d, limit)
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
@@ -1,12 +1,17 @@
 package litefs
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -42,7 +47,7 @@ func ExampleSubscribeEvents() {
 
 	// Output: init: isPrimary=true hostname=node-1
 	// primary change: isPrimary=false hostname=node-2
-	// EOF
+	// disconnected from event stream: EOF
 }
 
 func TestEventStream(t *testing.T) {
@@ -68,8 +73,8 @@ func TestEventStream(t *testing.T) {
 		case <-es.C():
 			t.Fatal("expected error")
 		case err := <-es.ErrC():
-			if !errors.Is(err, errUnexpectedStatus) {
-				t.Fatalf("expected errUnexpectedStatus, got %s", err)
+			if !errors.As(err, new(*ErrUnexpectedStatus)) {
+				t.Fatalf("expected ErrUnexpectedStatus, got %s", err)
 			}
 		case <-time.After(100 * time.Millisecond):
 			t.Fatal("timeout")
@@ -91,8 +96,8 @@ func TestEventStream(t *testing.T) {
 		case <-es.C():
 			t.Fatal("expected error")
 		case err := <-es.ErrC():
-			if err.Error() != "unexpected EOF" {
-				t.Fatalf("expected errUnexpectedStatus, got %s", err)
+			if !errors.Is(err, ErrDisconnected) || !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("expected ErrDisconnected, got %s", err)
 			}
 		case <-time.After(100 * time.Millisecond):
 			t.Fatal("timeout")
@@ -112,7 +117,7 @@ func TestEventStream(t *testing.T) {
 			t.Fatal("expected error")
 		case err := <-es.ErrC():
 			jerr := new(json.SyntaxError)
-			if !errors.As(err, &jerr) {
+			if !errors.Is(err, ErrDecode) || !errors.As(err, &jerr) {
 				t.Fatalf("expected json.SyntaxError, got %s", err)
 			}
 		case <-time.After(100 * time.Millisecond):
@@ -123,11 +128,273 @@ func TestEventStream(t *testing.T) {
 	})
 }
 
+func TestEventStreamErrors(t *testing.T) {
+	t.Run("coalesced", func(t *testing.T) {
+		statusServer(t, http.StatusInternalServerError)
+		es := SubscribeEvents(WithErrorInterval(20 * time.Millisecond))
+		t.Cleanup(es.Close)
+
+		if err := readError(t, es); !errors.As(err, new(*ErrUnexpectedStatus)) {
+			t.Fatalf("expected ErrUnexpectedStatus, got %v", err)
+		}
+
+		err := readError(t, es)
+		rerr := new(RepeatedError)
+		if !errors.As(err, &rerr) {
+			t.Fatalf("expected RepeatedError, got %v", err)
+		}
+		if rerr.Count < 2 || !errors.As(err, new(*ErrUnexpectedStatus)) {
+			t.Fatalf("wrong RepeatedError: %v", err)
+		}
+	})
+
+	t.Run("terminal", func(t *testing.T) {
+		statusServer(t, http.StatusNotFound)
+		es := SubscribeEvents()
+		t.Cleanup(es.Close)
+
+		if err := readError(t, es); !IsTerminal(err) || !errors.As(err, new(*ErrUnexpectedStatus)) {
+			t.Fatalf("expected terminal ErrUnexpectedStatus, got %v", err)
+		}
+
+		select {
+		case _, ok := <-es.ErrC():
+			if ok {
+				t.Fatal("expected ErrC to be closed")
+			}
+		case <-time.After(100 * time.Millisecond):
+			t.Fatal("timeout")
+		}
+	})
+}
+
+func TestEventStreamReconnect(t *testing.T) {
+	t.Run("backoff", func(t *testing.T) {
+		mockServer(t, status500, hangup, initEventJSON, hold)
+
+		es := SubscribeEvents(WithReconnect(Backoff{Min: time.Millisecond, Max: 5 * time.Millisecond, Multiplier: 2}))
+		t.Cleanup(es.Close)
+
+		// errors aren't read, yet events still arrive.
+		select {
+		case event := <-es.C():
+			if !reflect.DeepEqual(event, initEvent) {
+				t.Fatalf("wrong event: %#v", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout")
+		}
+	})
+
+	t.Run("max retries", func(t *testing.T) {
+		mockServer(t, status500, status500, status500, initEventJSON, hold)
+
+		es := SubscribeEvents(WithReconnect(Backoff{Min: time.Millisecond, MaxRetries: 1}))
+		t.Cleanup(es.Close)
+
+		var err error
+		for err == nil || !IsTerminal(err) {
+			select {
+			case err = <-es.ErrC():
+			case event := <-es.C():
+				t.Fatalf("unexpected event: %#v", event)
+			case <-time.After(time.Second):
+				t.Fatal("timeout")
+			}
+		}
+		if !errors.Is(err, errRetriesExhausted) || !errors.As(err, new(*ErrUnexpectedStatus)) {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
+
+func TestEventStreamHeartbeatTimeout(t *testing.T) {
+	mockServer(t, initEventJSON, flush, hold, pChangeNode2EventJSON, hold)
+
+	es := SubscribeEvents(WithHeartbeatTimeout(50 * time.Millisecond))
+	t.Cleanup(es.Close)
+
+	// waiting for the subscriber doesn't make the stream stale.
+	time.Sleep(100 * time.Millisecond)
+	assertReadEvent(t, es, initEvent)
+
+	if err := readError(t, es); !errors.Is(err, ErrStreamStale) {
+		t.Fatalf("expected ErrStreamStale, got %v", err)
+	}
+	assertReadEvent(t, es, pChangeNode2Event)
+}
+
+func TestEventStreamBuffer(t *testing.T) {
+	for _, tt := range []struct {
+		policy   OverflowPolicy
+		dropped  uint64
+		expected []*Event
+	}{
+		{OverflowBlock, 0, []*Event{initEvent, txEvent, pChangeNode2Event, pChangeNode1Event}},
+		{OverflowDropOldest, 2, []*Event{pChangeNode2Event, pChangeNode1Event}},
+		{OverflowDropNewest, 2, []*Event{initEvent, txEvent}},
+	} {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			mockServer(t, initEventJSON, txEventJSON, pChangeNode2EventJSON, pChangeNode1EventJSON, hold)
+
+			es := SubscribeEvents(WithEventBuffer(2, tt.policy))
+			t.Cleanup(es.Close)
+
+			// let the stream be read before receiving.
+			time.Sleep(50 * time.Millisecond)
+			if n := es.Dropped(); n != tt.dropped {
+				t.Fatalf("expected %d dropped, got %d", tt.dropped, n)
+			}
+			for _, e := range tt.expected {
+				assertReadEvent(t, es, e)
+			}
+		})
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Min: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+	for attempt, expected := range map[int]time.Duration{
+		1:  100 * time.Millisecond,
+		2:  200 * time.Millisecond,
+		4:  800 * time.Millisecond,
+		5:  time.Second,
+		99: time.Second,
+	} {
+		if actual := b.Delay(attempt); actual != expected {
+			t.Errorf("attempt %d: expected %s, got %s", attempt, expected, actual)
+		}
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := b.Delay(1); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("jittered delay out of range: %s", d)
+		}
+	}
+}
+
+func TestEventStreamHTTPClient(t *testing.T) {
+	mockServer(t, initEventJSON, hold)
+
+	var requests atomic.Int64
+	client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		requests.Add(1)
+		return http.DefaultTransport.RoundTrip(r)
+	})}
+
+	es := SubscribeEvents(WithHTTPClient(client))
+	t.Cleanup(es.Close)
+
+	assertReadEvent(t, es, initEvent)
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("expected 1 request through the client, got %d", n)
+	}
+}
+
+func TestEventStreamFilter(t *testing.T) {
+	otherTxEventJSON := strings.Replace(txEventJSON, `"db":"db"`, `"db":"other"`, 1)
+
+	t.Run("type", func(t *testing.T) {
+		mockServer(t, initEventJSON, txEventJSON, pChangeNode2EventJSON, txEventJSON, hold)
+
+		es := SubscribeEvents(WithEventFilter(EventTypePrimaryChange, EventTypeInit))
+		t.Cleanup(es.Close)
+
+		assertReadEvent(t, es, initEvent)
+		assertReadEvent(t, es, pChangeNode2Event)
+		assertNoEvent(t, es)
+	})
+
+	t.Run("database", func(t *testing.T) {
+		mockServer(t, initEventJSON, otherTxEventJSON, txEventJSON, hold)
+
+		es := SubscribeEvents(WithDatabase("db"))
+		t.Cleanup(es.Close)
+
+		assertReadEvent(t, es, initEvent)
+		assertReadEvent(t, es, txEvent)
+		assertNoEvent(t, es)
+	})
+}
+
+func TestEventStreamTee(t *testing.T) {
+	mockServer(t, initEventJSON, txEventJSON, flush, sleep10)
+
+	var buf syncBuffer
+	es := SubscribeEvents(WithTee(&buf))
+	t.Cleanup(es.Close)
+
+	assertReadEvent(t, es, initEvent)
+	assertReadEvent(t, es, txEvent)
+
+	if s := buf.String(); s != initEventJSON+"\n"+txEventJSON+"\n" {
+		t.Fatalf("wrong tee output: %q", s)
+	}
+}
+
+func TestEventStreamRequestMetadata(t *testing.T) {
+	reqs := make(chan *http.Request, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case reqs <- r:
+		default:
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(s.Close)
+	EventSubscriptionURL = s.URL + "?v=1"
+
+	es := SubscribeEvents(WithUserAgent("my-app/1.0"), WithQuery("instance", "abc"))
+	t.Cleanup(es.Close)
+
+	select {
+	case r := <-reqs:
+		if ua := r.Header.Get("User-Agent"); ua != "my-app/1.0" {
+			t.Fatalf("wrong User-Agent: %s", ua)
+		}
+		if q := r.URL.RawQuery; q != "instance=abc&v=1" {
+			t.Fatalf("wrong query: %s", q)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout")
+	}
+}
+
+func TestEventStreamURL(t *testing.T) {
+	reqs := make(chan *http.Request, 1)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case reqs <- r:
+		default:
+		}
+		<-r.Context().Done()
+	}))
+	t.Cleanup(s.Close)
+	EventSubscriptionURL = "http://localhost:0/events"
+
+	es := SubscribeEvents(WithURL(s.URL+"/litefs/events"), WithHeader("Authorization", "Bearer secret"))
+	t.Cleanup(es.Close)
+
+	select {
+	case r := <-reqs:
+		if r.URL.Path != "/litefs/events" {
+			t.Fatalf("wrong path: %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Fatalf("wrong Authorization: %s", auth)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout")
+	}
+}
+
 const (
 	status500             = "status500"
 	hangup                = "hangup"
 	sleep10               = "sleep10"
 	flush                 = "flush"
+	hold                  = "hold"
 	initEventJSON         = `{"type":"init","data":{"isPrimary":true,"hostname":"node-1"}}`
 	txEventJSON           = `{"type":"tx","db":"db","data":{"txID":"0000000000000027","postApplyChecksum":"83b05248774ce767","pageSize":4096,"commit":2,"timestamp":"0001-01-01T00:00:00Z"}}`
 	pChangeNode2EventJSON = `{"type":"primaryChange","data":{"isPrimary":false,"hostname":"node-2"}}`
@@ -142,6 +409,15 @@ var (
 )
 
 func mockServerSubscription(t *testing.T, resps ...string) *EventSubscription {
+	mockServer(t, resps...)
+
+	es := SubscribeEvents()
+	t.Cleanup(es.Close)
+
+	return es
+}
+
+func mockServer(t *testing.T, resps ...string) {
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		for len(resps) != 0 {
 			if r.Context().Err() != nil {
@@ -163,6 +439,10 @@ func mockServerSubscription(t *testing.T, resps ...string) *EventSubscription {
 				time.Sleep(10 * time.Millisecond)
 			case flush:
 				w.(http.Flusher).Flush()
+			case hold:
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+				return
 			default:
 				fmt.Fprintln(w, resp)
 			}
@@ -170,14 +450,67 @@ func mockServerSubscription(t *testing.T, resps ...string) *EventSubscription {
 	}))
 	t.Cleanup(s.Close)
 	EventSubscriptionURL = s.URL
+}
 
-	es := SubscribeEvents()
-	t.Cleanup(es.Close)
+// syncBuffer is a bytes.Buffer that is safe for concurrent use.
+type syncBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
 
-	return es
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.String()
+}
+
+func statusServer(t *testing.T, code int) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(s.Close)
+	EventSubscriptionURL = s.URL
+}
+
+func readError(t *testing.T, es eventSource) error {
+	t.Helper()
+
+	select {
+	case event := <-es.C():
+		t.Fatalf("unexpected event: %#v", event)
+	case err := <-es.ErrC():
+		return err
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout")
+	}
+	return nil
+}
+
+// eventSource is implemented by EventSubscription and BrokerSubscription.
+type eventSource interface {
+	C() <-chan *Event
+	ErrC() <-chan error
+}
+
+func assertNoEvent(t *testing.T, es eventSource) {
+	t.Helper()
+
+	select {
+	case event := <-es.C():
+		t.Fatalf("unexpected event: %#v", event)
+	case err := <-es.ErrC():
+		t.Fatalf("unexpected error: %s", err)
+	case <-time.After(20 * time.Millisecond):
+	}
 }
 
-func assertReadEvent(t *testing.T, es *EventSubscription, expected *Event) {
+func assertReadEvent(t *testing.T, es eventSource, expected *Event) {
 	t.Helper()
 
 	select {
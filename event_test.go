@@ -0,0 +1,241 @@
+package litefs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTxEventDataTables(t *testing.T) {
+	var e Event
+	if err := json.Unmarshal([]byte(`{"type":"tx","db":"db","data":{"txID":"0000000000000001","tables":["users"],"pages":[2,3]}}`), &e); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	data := e.Data.(*TxEventData)
+	if !reflect.DeepEqual(data.Tables, []string{"users"}) || !reflect.DeepEqual(data.Pages, []uint32{2, 3}) {
+		t.Fatalf("wrong hints: %#v", data)
+	}
+
+	for _, tc := range []struct {
+		tables   []string
+		expected bool
+	}{
+		{nil, true},
+		{[]string{"users"}, true},
+		{[]string{"posts", "USERS"}, true},
+		{[]string{"posts"}, false},
+	} {
+		if actual := data.MayTouch(tc.tables...); actual != tc.expected {
+			t.Fatalf("MayTouch(%v): expected %t, got %t", tc.tables, tc.expected, actual)
+		}
+	}
+
+	if !(&TxEventData{}).MayTouch("posts") {
+		t.Fatal("expected MayTouch without hints")
+	}
+}
+
+func TestEventString(t *testing.T) {
+	for _, tc := range []struct {
+		event    *Event
+		expected string
+	}{
+		{initEvent, "init isPrimary=true hostname=node-1"},
+		{txEvent, "tx db=db txid=0000000000000027"},
+		{pChangeNode2Event, "primaryChange isPrimary=false hostname=node-2"},
+		{&Event{Type: "unknown"}, "unknown"},
+	} {
+		if s := tc.event.String(); s != tc.expected {
+			t.Fatalf("expected %q, got %q", tc.expected, s)
+		}
+	}
+}
+
+func TestEventLogValue(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	logger.Info("received", "event", txEvent)
+
+	if s := buf.String(); s != "level=INFO msg=received event.type=tx event.db=db event.txid=0000000000000027\n" {
+		t.Fatalf("wrong log output: %q", s)
+	}
+}
+
+func TestDecodeEvent(t *testing.T) {
+	e, err := DecodeEvent([]byte(txEventJSON))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(e, txEvent) {
+		t.Fatalf("wrong event: %#v", e)
+	}
+
+	for _, tt := range []struct {
+		data     string
+		expected error
+	}{
+		{`{"data":{}}`, errMissingEventType},
+		{`{"type":"tx"}`, errMissingEventData},
+		{`{"type":"init","data":null}`, errMissingEventData},
+		{`{"type":"x","data":"` + strings.Repeat("a", MaxEventSize) + `"}`, errEventTooLarge},
+	} {
+		if _, err := DecodeEvent([]byte(tt.data)); !errors.Is(err, tt.expected) {
+			t.Errorf("expected %v for %.40s, got %v", tt.expected, tt.data, err)
+		}
+	}
+
+	// events of unknown types are passed through.
+	if e, err := DecodeEvent([]byte(`{"type":"x"}`)); err != nil || e.Type != "x" {
+		t.Fatalf("unexpected result: %v, %v", e, err)
+	}
+	e, err = DecodeEvent([]byte(`{"type":"x","data":{"a": 1}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if data, ok := e.Data.(RawEventData); !ok || string(data) != `{"a": 1}` {
+		t.Fatalf("expected raw data, got %#v", e.Data)
+	}
+	if b, err := json.Marshal(e); err != nil || string(b) != `{"type":"x","data":{"a":1}}` {
+		t.Fatalf("expected data to be re-encoded, got %s, %v", b, err)
+	}
+}
+
+func TestRegisterEventDecoder(t *testing.T) {
+	type leaseEventData struct {
+		Holder string `json:"holder"`
+	}
+	RegisterEventDecoder("test.lease", func(data json.RawMessage) (any, error) {
+		var v leaseEventData
+		err := json.Unmarshal(data, &v)
+		return &v, err
+	})
+	t.Cleanup(func() {
+		eventDecodersMu.Lock()
+		defer eventDecodersMu.Unlock()
+		delete(eventDecoders, "test.lease")
+	})
+
+	e, err := DecodeEvent([]byte(`{"type":"test.lease","data":{"holder":"node-1"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if data, ok := e.Data.(*leaseEventData); !ok || data.Holder != "node-1" {
+		t.Fatalf("expected decoded data, got %#v", e.Data)
+	}
+	if _, err := DecodeEvent([]byte(`{"type":"test.lease","data":[]}`)); err == nil {
+		t.Fatal("expected decoder error")
+	}
+
+	// the filter for unknown types only matches types without decoders.
+	es := &EventSubscription{}
+	WithEventFilter(EventTypeUnknown).applySubscription(es)
+	if es.match(e) || !es.match(&Event{Type: "x"}) || es.match(txEvent) {
+		t.Fatal("unexpected match")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic")
+		}
+	}()
+	RegisterEventDecoder(EventTypeTx, nil)
+}
+
+func TestReadEventLine(t *testing.T) {
+	r := bufio.NewReaderSize(strings.NewReader("a\n\n  \nb\nc"), 16)
+	for _, expected := range []string{"a", "b"} {
+		if line, err := readEventLine(r); err != nil || string(line) != expected {
+			t.Fatalf("expected %q, got %q, %v", expected, line, err)
+		}
+	}
+	if _, err := readEventLine(r); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected unexpected EOF, got %v", err)
+	}
+
+	r = bufio.NewReaderSize(strings.NewReader(strings.Repeat("a", MaxEventSize+1)+"\n"), 16)
+	if _, err := readEventLine(r); err != errEventTooLarge {
+		t.Fatalf("expected errEventTooLarge, got %v", err)
+	}
+}
+
+func FuzzDecodeEvent(f *testing.F) {
+	for _, seed := range []string{
+		initEventJSON,
+		txEventJSON,
+		pChangeNode2EventJSON,
+		`{"type":"tx","db":"db","data":{"txID":1,"pageSize":-1}}`,
+		`{"type":"init","data":[]}`,
+		`{"type":"primaryChange","data":"node-1"}`,
+		`{"type":"x","data":{"a":[1,{"b":null}]}}`,
+		`{"type":"tx","data":{"txID":"00000000000000`,
+		`{"type":"tx","data":{"tables":["` + strings.Repeat("t", 4096) + `"]}}`,
+		`null`,
+		`[]`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		e, err := DecodeEvent(data)
+		if err != nil {
+			return
+		}
+
+		switch e.Type {
+		case EventTypeInit:
+			if _, ok := e.Data.(*InitEventData); !ok {
+				t.Fatalf("wrong init data: %#v", e.Data)
+			}
+		case EventTypeTx:
+			if _, ok := e.Data.(*TxEventData); !ok {
+				t.Fatalf("wrong tx data: %#v", e.Data)
+			}
+		case EventTypePrimaryChange:
+			if _, ok := e.Data.(*PrimaryChangeEventData); !ok {
+				t.Fatalf("wrong primaryChange data: %#v", e.Data)
+			}
+		}
+
+		// decoded events must be safe to log and re-encode.
+		_ = e.String()
+		slog.New(slog.NewTextHandler(io.Discard, nil)).Info("event", slog.Any("event", e))
+		if _, err := json.Marshal(e); err != nil {
+			t.Fatalf("cannot re-encode event: %s", err)
+		}
+	})
+}
+
+func FuzzReadEventLine(f *testing.F) {
+	f.Add([]byte(initEventJSON + "\n" + txEventJSON + "\n"))
+	f.Add([]byte("\n\n{\"type\":\"tx\""))
+	f.Add([]byte(strings.Repeat("x", 5000)))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bufio.NewReaderSize(bytes.NewReader(data), 16)
+		for {
+			line, err := readEventLine(r)
+			if err != nil {
+				return
+			}
+			if len(line) == 0 || len(line) > MaxEventSize {
+				t.Fatalf("invalid line of %d bytes", len(line))
+			}
+			_, _ = DecodeEvent(line)
+		}
+	})
+}
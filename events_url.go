@@ -0,0 +1,45 @@
+package litefs
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/superfly/litefs-go/litefsconfig"
+)
+
+// EventsURLEnv is the environment variable DiscoverEventsURL reads the URL of
+// the event stream from first.
+const EventsURLEnv = "LITEFS_EVENTS_URL"
+
+// DiscoverEventsURL returns the URL of the local LiteFS node's event stream,
+// which subscriptions connect to unless EventSubscriptionURL is set. It is
+// found, in order, in the LITEFS_EVENTS_URL environment variable, from the
+// HTTP address in the first of litefsconfig.Paths that exists, or on
+// DefaultAPIPort.
+func DiscoverEventsURL() (string, error) {
+	if u := os.Getenv(EventsURLEnv); u != "" {
+		if _, err := url.Parse(u); err != nil {
+			return "", fmt.Errorf("parse %s: %w", EventsURLEnv, err)
+		}
+		return u, nil
+	}
+
+	c, err := litefsconfig.Load("")
+	if errors.Is(err, litefsconfig.ErrNotFound) {
+		return APIURL(DefaultAPIPort, EventsPath), nil
+	} else if err != nil {
+		return "", err
+	}
+	return c.APIURL(EventsPath)
+}
+
+// eventsURL returns EventSubscriptionURL if it is set, or the discovered URL
+// of the event stream otherwise.
+func eventsURL() (string, error) {
+	if EventSubscriptionURL != "" {
+		return EventSubscriptionURL, nil
+	}
+	return DiscoverEventsURL()
+}
@@ -0,0 +1,37 @@
+package litefs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/superfly/litefs-go/litefsconfig"
+)
+
+func TestDiscoverEventsURL(t *testing.T) {
+	paths := litefsconfig.Paths
+	litefsconfig.Paths = []string{filepath.Join(t.TempDir(), "litefs.yml")}
+	t.Cleanup(func() { litefsconfig.Paths = paths })
+
+	assertURL := func(expected string) {
+		t.Helper()
+		u, err := DiscoverEventsURL()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if u != expected {
+			t.Fatalf("expected %s, got %s", expected, u)
+		}
+	}
+
+	t.Setenv(EventsURLEnv, "")
+	assertURL("http://localhost:20202/events")
+
+	if err := os.WriteFile(litefsconfig.Paths[0], []byte("http:\n  addr: \":20203\"\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	assertURL("http://localhost:20203/events")
+
+	t.Setenv(EventsURLEnv, "http://litefs.internal:8080/litefs/events")
+	assertURL("http://litefs.internal:8080/litefs/events")
+}
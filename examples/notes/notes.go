@@ -0,0 +1,189 @@
+// Package notes is a small reference application built on litefs-go. It
+// serves a list of notes from a LiteFS-replicated database and shows how the
+// pieces of the package fit together on a replica:
+//
+//   - writes take the HALT lock with litefs.WithHalt, so any node can accept
+//     them, and respond with a consistency token for the position they
+//     reached;
+//   - reads go through ConsistencyTracker.Middleware, so a client that sends
+//     that token back reads its own writes, even on another replica;
+//   - a PrimaryMonitor lets the app refuse writes with 503 Service
+//     Unavailable while the cluster is failing over rather than letting them
+//     hang.
+//
+// Its tests run the app against a litefstest.Cluster, which makes them
+// integration tests for the package as a whole.
+package notes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"github.com/superfly/litefs-go"
+)
+
+// Store persists notes in the database. In production it is backed by
+// database/sql and a SQLite driver.
+type Store interface {
+	Add(ctx context.Context, text string) error
+	List(ctx context.Context) ([]string, error)
+}
+
+// App serves notes over HTTP.
+type App struct {
+	// DB is the path of the database in the LiteFS mount.
+	DB string
+
+	Store   Store
+	Tracker *litefs.ConsistencyTracker
+	Monitor *litefs.PrimaryMonitor
+}
+
+// New returns an App for the database at db, subscribed to the local LiteFS
+// node's event stream. It must be closed by the caller.
+func New(db string, store Store) *App {
+	return &App{
+		DB:      db,
+		Store:   store,
+		Tracker: litefs.NewConsistencyTracker(filepath.Dir(db)),
+		Monitor: litefs.NewPrimaryMonitor(),
+	}
+}
+
+// Close unsubscribes from the local LiteFS node's event stream.
+func (a *App) Close() {
+	a.Tracker.Close()
+	a.Monitor.Close()
+}
+
+// Handler returns the app's routes:
+//
+//	GET  /notes    lists notes
+//	POST /notes    adds the request body as a note
+//	GET  /primary  reports the current primary
+func (a *App) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/notes", a.Tracker.Middleware(http.HandlerFunc(a.serveNotes)))
+	mux.HandleFunc("/primary", a.servePrimary)
+	return mux
+}
+
+func (a *App) serveNotes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		a.list(w, r)
+	case http.MethodPost:
+		a.add(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *App) list(w http.ResponseWriter, r *http.Request) {
+	var notes []string
+	err := litefs.ConsistencyFromContext(r.Context()).Read(r.Context(), a.DB, a.Tracker, func() (err error) {
+		notes, err = a.Store.List(r.Context())
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(notes)
+}
+
+func (a *App) add(w http.ResponseWriter, r *http.Request) {
+	text, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := a.waitPrimary(r.Context()); err != nil {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	if err := litefs.WithHaltContext(r.Context(), a.DB, func() error {
+		return a.Store.Add(r.Context(), string(text))
+	}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pos, err := litefs.ReadPos(a.DB)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	token := litefs.ConsistencyToken{filepath.Base(a.DB): pos}
+	a.Tracker.Observe(filepath.Base(a.DB), pos)
+
+	w.Header().Set(litefs.ConsistencyHeader, token.String())
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *App) servePrimary(w http.ResponseWriter, r *http.Request) {
+	if err := a.Monitor.WaitReady(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	isPrimary, _ := a.Monitor.IsPrimary()
+	hostname, _ := a.Monitor.Hostname()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(struct {
+		IsPrimary bool   `json:"isPrimary"`
+		Hostname  string `json:"hostname"`
+	}{isPrimary, hostname})
+}
+
+// waitPrimary returns an error if the cluster has no primary to accept
+// writes.
+func (a *App) waitPrimary(ctx context.Context) error {
+	if err := a.Monitor.WaitReady(ctx); err != nil {
+		return err
+	}
+	hostname, err := a.Monitor.Hostname()
+	if err != nil {
+		return err
+	} else if hostname == "" {
+		return litefs.ErrNoPrimary
+	}
+	return nil
+}
+
+// MemoryStore is a Store that keeps notes in memory, for tests.
+type MemoryStore struct {
+	// AfterAdd, if set, is called after every note is added, e.g. to commit
+	// a transaction to a simulated cluster.
+	AfterAdd func() error
+
+	m     sync.Mutex
+	notes []string
+}
+
+func (s *MemoryStore) Add(ctx context.Context, text string) error {
+	s.m.Lock()
+	s.notes = append(s.notes, text)
+	s.m.Unlock()
+
+	if s.AfterAdd != nil {
+		return s.AfterAdd()
+	}
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]string, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return append([]string(nil), s.notes...), nil
+}
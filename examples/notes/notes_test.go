@@ -0,0 +1,159 @@
+package notes_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs-go"
+	"github.com/superfly/litefs-go/examples/notes"
+	"github.com/superfly/litefs-go/litefstest"
+)
+
+func TestReadYourWrites(t *testing.T) {
+	c, srv := newApp(t, "node-1", "node-2")
+
+	token := addNote(t, srv, "hello")
+	if token != "notes.db="+(litefs.Pos{TXID: 1, PostApplyChecksum: 1}).String() {
+		t.Fatalf("wrong token: %s", token)
+	}
+	if notes := listNotes(t, srv, token); len(notes) != 1 || notes[0] != "hello" {
+		t.Fatalf("wrong notes: %v", notes)
+	}
+
+	// a token from a write this replica hasn't seen yet holds the read back
+	// until the write is replicated.
+	ahead := "notes.db=" + (litefs.Pos{TXID: 2, PostApplyChecksum: 2}).String()
+	done := make(chan []string)
+	go func() { done <- listNotes(t, srv, ahead) }()
+
+	select {
+	case <-done:
+		t.Fatal("expected read to wait for replication")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := c.Tx("notes.db"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected read once replicated")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	c, srv := newApp(t, "node-1", "node-2", "node-3")
+	assertPrimary(t, srv, "node-1")
+	addNote(t, srv, "before")
+
+	c.Node("node-1").Kill()
+	c.Advance(c.LeaseTTL)
+	assertPrimary(t, srv, "node-2")
+
+	token := addNote(t, srv, "after")
+	if notes := listNotes(t, srv, token); len(notes) != 2 || notes[1] != "after" {
+		t.Fatalf("wrong notes: %v", notes)
+	}
+}
+
+// newApp starts a cluster with the app running on its last node, and returns
+// the cluster and the app's server.
+func newApp(t *testing.T, hostnames ...string) (*litefstest.Cluster, *httptest.Server) {
+	t.Helper()
+	litefstest.AssertNoLeaks(t)
+
+	c := litefstest.NewCluster(t, hostnames...)
+	c.Dir = t.TempDir()
+
+	db := filepath.Join(c.Dir, "notes.db")
+	if err := os.WriteFile(db+"-lock", nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	prevURL := litefs.EventSubscriptionURL
+	litefs.EventSubscriptionURL = c.Nodes()[len(hostnames)-1].EventsURL()
+	t.Cleanup(func() { litefs.EventSubscriptionURL = prevURL })
+
+	store := &notes.MemoryStore{AfterAdd: func() error {
+		_, err := c.Tx("notes.db")
+		return err
+	}}
+	app := notes.New(db, store)
+	t.Cleanup(app.Close)
+
+	srv := httptest.NewServer(app.Handler())
+	t.Cleanup(srv.Close)
+	return c, srv
+}
+
+// addNote adds a note and returns the consistency token of the write.
+func addNote(t *testing.T, srv *httptest.Server, text string) string {
+	t.Helper()
+
+	resp, err := http.Post(srv.URL+"/notes", "text/plain", strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	return resp.Header.Get(litefs.ConsistencyHeader)
+}
+
+func listNotes(t *testing.T, srv *httptest.Server, token string) []string {
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/notes", nil)
+	if err != nil {
+		t.Error(err)
+		return nil
+	}
+	req.Header.Set(litefs.ConsistencyHeader, token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+		return nil
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", resp.StatusCode)
+		return nil
+	}
+	var notes []string
+	if err := json.NewDecoder(resp.Body).Decode(&notes); err != nil {
+		t.Errorf("unexpected error: %s", err)
+	}
+	return notes
+}
+
+func assertPrimary(t *testing.T, srv *httptest.Server, hostname string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		var status struct{ Hostname string }
+		resp, err := http.Get(srv.URL + "/primary")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&status)
+		resp.Body.Close()
+
+		if err == nil && status.Hostname == hostname {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected primary %q, got %q (err=%v)", hostname, status.Hostname, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,319 @@
+package litefs
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRecoveryTimeout is how long a FailoverReporter waits by default for
+// databases to catch up with a new primary before reporting without them.
+const DefaultRecoveryTimeout = time.Minute
+
+// Kinds of FailoverStep.
+const (
+	FailoverStepDemoted  = "demoted"  // this node stopped being the primary
+	FailoverStepLost     = "lost"     // the cluster reported no primary
+	FailoverStepElected  = "elected"  // a new primary was reported
+	FailoverStepCaughtUp = "caughtUp" // a database received a transaction from the new primary
+)
+
+// FailoverStep is a single observation in a FailoverTimeline.
+type FailoverStep struct {
+	At       time.Time `json:"at"`
+	Kind     string    `json:"kind"`
+	Hostname string    `json:"hostname,omitempty"`
+	DB       string    `json:"db,omitempty"`
+}
+
+// FailoverTimeline is everything this node observed during a single failover,
+// from losing the previous primary until every database it replicates had
+// caught up with the new one.
+type FailoverTimeline struct {
+	Failover
+
+	// Steps are the observations that make up the failover, in order.
+	Steps []FailoverStep `json:"steps"`
+
+	// Recovery is how long each database took after the new primary was
+	// reported to receive its first transaction.
+	Recovery map[string]time.Duration `json:"recovery,omitempty"`
+
+	// Pending are the databases that hadn't caught up when the timeline was
+	// reported.
+	Pending []string `json:"pending,omitempty"`
+}
+
+// String returns a human-readable, multi-line rendering of tl with step times
+// relative to the first step.
+func (tl *FailoverTimeline) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "failover %s -> %s", hostnameOrNone(tl.Previous), tl.Primary)
+	if tl.Election > 0 {
+		fmt.Fprintf(&b, " (no primary for %s)", tl.Election)
+	}
+
+	for _, step := range tl.Steps {
+		fmt.Fprintf(&b, "\n  +%-10s %s", step.At.Sub(tl.Steps[0].At), step.Kind)
+		if step.Hostname != "" {
+			b.WriteString(" " + step.Hostname)
+		}
+		if step.DB != "" {
+			b.WriteString(" " + step.DB)
+		}
+	}
+	if len(tl.Pending) != 0 {
+		b.WriteString("\n  pending: " + strings.Join(tl.Pending, ", "))
+	}
+	return b.String()
+}
+
+// LogValue implements slog.LogValuer.
+func (tl *FailoverTimeline) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("previous", tl.Previous),
+		slog.String("primary", tl.Primary),
+		slog.Duration("election", tl.Election),
+	}
+	if len(tl.Steps) != 0 {
+		attrs = append(attrs, slog.Duration("duration", tl.Steps[len(tl.Steps)-1].At.Sub(tl.Steps[0].At)))
+	}
+
+	recovery := make([]slog.Attr, 0, len(tl.Recovery))
+	for _, db := range sortedKeys(tl.Recovery) {
+		recovery = append(recovery, slog.Duration(db, tl.Recovery[db]))
+	}
+	attrs = append(attrs, slog.Attr{Key: "recovery", Value: slog.GroupValue(recovery...)})
+
+	if len(tl.Pending) != 0 {
+		attrs = append(attrs, slog.Any("pending", tl.Pending))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// FailoverReporter watches the local LiteFS node's event stream and reports a
+// FailoverTimeline for each failover once every database that had seen
+// transactions has received one from the new primary, or RecoveryTimeout has
+// elapsed.
+//
+// The exported fields configure the reporter and must be set before it is
+// used.
+type FailoverReporter struct {
+	// Logger, if set, receives each timeline as a single record.
+	Logger *slog.Logger
+
+	// OnTimeline, if set, is called with each timeline.
+	OnTimeline func(*FailoverTimeline)
+
+	// RecoveryTimeout bounds how long after a new primary is reported the
+	// timeline waits for databases to catch up.
+	RecoveryTimeout time.Duration
+
+	es EventSource
+	m  sync.Mutex
+
+	last *FailoverTimeline
+}
+
+// NewFailoverReporter returns a new *FailoverReporter that subscribes to the
+// local LiteFS node's event stream.
+func NewFailoverReporter() *FailoverReporter {
+	r := &FailoverReporter{
+		RecoveryTimeout: DefaultRecoveryTimeout,
+		es:              NewEventSource(),
+	}
+
+	spawn(r.run)
+
+	return r
+}
+
+// Close unsubscribes to the local LiteFS node's event stream.
+func (r *FailoverReporter) Close() {
+	r.es.Close()
+}
+
+// Last returns the most recently reported timeline, or nil if there has been
+// no failover.
+func (r *FailoverReporter) Last() *FailoverTimeline {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.last
+}
+
+func (r *FailoverReporter) run() {
+	var ft failoverTracker
+	var timeout <-chan time.Time
+
+	for {
+		var tl *FailoverTimeline
+		select {
+		case e, ok := <-r.es.C():
+			if !ok {
+				return
+			}
+			tl = ft.observe(e, time.Now())
+		case _, ok := <-r.es.ErrC():
+			if !ok {
+				return
+			}
+			continue
+		case <-timeout:
+			tl = ft.finish()
+		}
+
+		if tl != nil {
+			timeout = nil
+			r.report(tl)
+		}
+		if timeout == nil && ft.recovering() {
+			timeout = time.After(r.RecoveryTimeout)
+		}
+	}
+}
+
+func (r *FailoverReporter) report(tl *FailoverTimeline) {
+	r.m.Lock()
+	r.last = tl
+	r.m.Unlock()
+
+	if r.Logger != nil {
+		r.Logger.Info("litefs: failover", slog.Any("timeline", tl))
+	}
+	if r.OnTimeline != nil {
+		r.OnTimeline(tl)
+	}
+}
+
+// failoverTracker assembles FailoverTimelines from events.
+type failoverTracker struct {
+	initialized bool
+	isPrimary   bool
+	primary     string
+	lostAt      time.Time
+
+	// dbs are the databases that have received transactions.
+	dbs map[string]struct{}
+
+	cur     *FailoverTimeline
+	pending map[string]struct{}
+}
+
+// observe updates the tracker with e, received at now, and returns the
+// current timeline if e completed it.
+func (ft *failoverTracker) observe(e *Event, now time.Time) *FailoverTimeline {
+	switch data := e.Data.(type) {
+	case *InitEventData:
+		if !ft.initialized {
+			ft.initialized = true
+			ft.isPrimary, ft.primary = data.IsPrimary, data.Hostname
+			return nil
+		}
+		return ft.primaryChange(data.IsPrimary, data.Hostname, now)
+	case *PrimaryChangeEventData:
+		return ft.primaryChange(data.IsPrimary, data.Hostname, now)
+	case *TxEventData:
+		if ft.dbs == nil {
+			ft.dbs = make(map[string]struct{})
+		}
+		ft.dbs[e.DB] = struct{}{}
+
+		if !ft.recovering() {
+			return nil
+		}
+		if _, ok := ft.pending[e.DB]; !ok {
+			return nil
+		}
+		delete(ft.pending, e.DB)
+		ft.cur.Steps = append(ft.cur.Steps, FailoverStep{At: now, Kind: FailoverStepCaughtUp, DB: e.DB})
+		ft.cur.Recovery[e.DB] = now.Sub(ft.cur.At)
+		if len(ft.pending) == 0 {
+			return ft.finish()
+		}
+	}
+	return nil
+}
+
+func (ft *failoverTracker) primaryChange(isPrimary bool, hostname string, now time.Time) *FailoverTimeline {
+	if isPrimary == ft.isPrimary && hostname == ft.primary {
+		return nil
+	}
+
+	// a change during recovery starts a new failover.
+	var tl *FailoverTimeline
+	if ft.recovering() {
+		tl = ft.finish()
+	}
+	if ft.cur == nil {
+		ft.cur = &FailoverTimeline{
+			Failover: Failover{Previous: ft.primary},
+			Recovery: make(map[string]time.Duration),
+		}
+	}
+
+	if ft.isPrimary && !isPrimary {
+		ft.cur.Steps = append(ft.cur.Steps, FailoverStep{At: now, Kind: FailoverStepDemoted})
+	}
+	if hostname == "" {
+		ft.lostAt = now
+		ft.cur.Steps = append(ft.cur.Steps, FailoverStep{At: now, Kind: FailoverStepLost})
+	} else {
+		ft.cur.Steps = append(ft.cur.Steps, FailoverStep{At: now, Kind: FailoverStepElected, Hostname: hostname})
+		ft.cur.At, ft.cur.Primary = now, hostname
+		if !ft.lostAt.IsZero() {
+			ft.cur.Election = now.Sub(ft.lostAt)
+		}
+		ft.pending = make(map[string]struct{}, len(ft.dbs))
+		for db := range ft.dbs {
+			ft.pending[db] = struct{}{}
+		}
+	}
+	ft.isPrimary, ft.primary = isPrimary, hostname
+
+	if ft.recovering() && len(ft.pending) == 0 && tl == nil {
+		return ft.finish()
+	}
+	return tl
+}
+
+// recovering reports whether a new primary has been elected and the tracker
+// is waiting for databases to catch up.
+func (ft *failoverTracker) recovering() bool {
+	return ft.cur != nil && ft.cur.Primary != ""
+}
+
+// finish returns the current timeline, with any databases that haven't caught
+// up listed as pending, and resets the tracker for the next failover.
+func (ft *failoverTracker) finish() *FailoverTimeline {
+	tl := ft.cur
+	if tl == nil {
+		return nil
+	}
+	for db := range ft.pending {
+		tl.Pending = append(tl.Pending, db)
+	}
+	sort.Strings(tl.Pending)
+
+	ft.cur, ft.pending, ft.lostAt = nil, nil, time.Time{}
+	return tl
+}
+
+func hostnameOrNone(hostname string) string {
+	if hostname == "" {
+		return "(none)"
+	}
+	return hostname
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
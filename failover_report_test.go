@@ -0,0 +1,115 @@
+package litefs
+
+import (
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailoverTracker(t *testing.T) {
+	t0 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return t0.Add(d) }
+	tx := func(db string) *Event { return &Event{Type: EventTypeTx, DB: db, Data: &TxEventData{}} }
+	change := func(isPrimary bool, hostname string) *Event {
+		return &Event{Type: EventTypePrimaryChange, Data: &PrimaryChangeEventData{IsPrimary: isPrimary, Hostname: hostname}}
+	}
+
+	t.Run("failover", func(t *testing.T) {
+		var ft failoverTracker
+		steps := []struct {
+			e  *Event
+			at time.Duration
+		}{
+			{initEvent, 0},
+			{tx("a"), 0},
+			{tx("b"), 0},
+			{change(false, ""), time.Second},
+			{change(false, "node-2"), 4 * time.Second},
+			{tx("a"), 5 * time.Second},
+		}
+		for _, step := range steps {
+			if tl := ft.observe(step.e, at(step.at)); tl != nil {
+				t.Fatalf("unexpected timeline after %s: %s", step.e, tl)
+			}
+		}
+
+		tl := ft.observe(tx("b"), at(7*time.Second))
+		if tl == nil {
+			t.Fatal("expected timeline")
+		}
+		expected := &FailoverTimeline{
+			Failover: Failover{At: at(4 * time.Second), Primary: "node-2", Previous: "node-1", Election: 3 * time.Second},
+			Steps: []FailoverStep{
+				{At: at(time.Second), Kind: FailoverStepDemoted},
+				{At: at(time.Second), Kind: FailoverStepLost},
+				{At: at(4 * time.Second), Kind: FailoverStepElected, Hostname: "node-2"},
+				{At: at(5 * time.Second), Kind: FailoverStepCaughtUp, DB: "a"},
+				{At: at(7 * time.Second), Kind: FailoverStepCaughtUp, DB: "b"},
+			},
+			Recovery: map[string]time.Duration{"a": time.Second, "b": 3 * time.Second},
+		}
+		if !reflect.DeepEqual(tl, expected) {
+			t.Fatalf("expected %#v, got %#v", expected, tl)
+		}
+		if ft.recovering() {
+			t.Fatal("expected tracker to be reset")
+		}
+	})
+
+	t.Run("direct handover without databases", func(t *testing.T) {
+		var ft failoverTracker
+		ft.observe(initEvent, at(0))
+
+		tl := ft.observe(change(false, "node-2"), at(time.Second))
+		if tl == nil || tl.Primary != "node-2" || tl.Election != 0 || len(tl.Steps) != 2 {
+			t.Fatalf("unexpected timeline: %#v", tl)
+		}
+	})
+
+	t.Run("pending", func(t *testing.T) {
+		var ft failoverTracker
+		ft.observe(initEvent, at(0))
+		ft.observe(tx("a"), at(0))
+		ft.observe(change(false, "node-2"), at(time.Second))
+
+		tl := ft.finish()
+		if tl == nil || !reflect.DeepEqual(tl.Pending, []string{"a"}) {
+			t.Fatalf("unexpected timeline: %#v", tl)
+		}
+	})
+}
+
+func TestFailoverReporter(t *testing.T) {
+	mockServer(t, initEventJSON, txEventJSON, `{"type":"primaryChange","data":{"isPrimary":false}}`, pChangeNode2EventJSON, hold)
+
+	var buf syncBuffer
+	timelines := make(chan *FailoverTimeline, 1)
+
+	r := NewFailoverReporter()
+	r.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+	r.RecoveryTimeout = 20 * time.Millisecond
+	r.OnTimeline = func(tl *FailoverTimeline) { timelines <- tl }
+	t.Cleanup(r.Close)
+
+	var tl *FailoverTimeline
+	select {
+	case tl = <-timelines:
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	if tl.Previous != "node-1" || tl.Primary != "node-2" || !reflect.DeepEqual(tl.Pending, []string{"db"}) {
+		t.Fatalf("unexpected timeline: %#v", tl)
+	}
+	if r.Last() != tl {
+		t.Fatal("expected last timeline")
+	}
+	if s := tl.String(); !strings.HasPrefix(s, "failover node-1 -> node-2") || !strings.Contains(s, "pending: db") {
+		t.Fatalf("unexpected string: %s", s)
+	}
+	if log := buf.String(); !strings.Contains(log, "timeline.primary=node-2") || !strings.Contains(log, "timeline.pending=[db]") {
+		t.Fatalf("unexpected log: %s", log)
+	}
+}
@@ -0,0 +1,126 @@
+package litefs
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// Flags is an in-memory cache of feature flags stored in a KV. The cache is
+// reloaded whenever a tx event shows the KV's table may have changed, so flag
+// changes propagate to every node in the cluster within moments.
+type Flags struct {
+	kv *KV
+	es EventSource
+	m  sync.RWMutex
+
+	values map[string][]byte
+	err    error
+}
+
+// NewFlags returns a new *Flags that loads its values from kv and subscribes to
+// the local LiteFS node's event stream.
+func NewFlags(kv *KV) *Flags {
+	f := &Flags{
+		kv: kv,
+		es: NewEventSource(),
+	}
+
+	f.setValues(kv.All(context.Background()))
+	spawn(f.run)
+
+	return f
+}
+
+// Close unsubscribes to the local LiteFS node's event stream.
+func (f *Flags) Close() {
+	f.es.Close()
+}
+
+// Err returns the error encountered during the most recent reload, if any. The
+// previously loaded values continue to be served when a reload fails.
+func (f *Flags) Err() error {
+	f.m.RLock()
+	defer f.m.RUnlock()
+
+	return f.err
+}
+
+// Reload reloads all flag values from the local copy of the database.
+func (f *Flags) Reload(ctx context.Context) error {
+	values, err := f.kv.All(ctx)
+	f.setValues(values, err)
+	return err
+}
+
+// Value returns the raw value of the flag name.
+func (f *Flags) Value(name string) ([]byte, bool) {
+	f.m.RLock()
+	defer f.m.RUnlock()
+
+	v, ok := f.values[name]
+	return v, ok
+}
+
+// String returns the value of the flag name, or def if it isn't set.
+func (f *Flags) String(name, def string) string {
+	if v, ok := f.Value(name); ok {
+		return string(v)
+	}
+	return def
+}
+
+// Bool returns the value of the flag name parsed with strconv.ParseBool, or
+// def if it isn't set or can't be parsed.
+func (f *Flags) Bool(name string, def bool) bool {
+	if v, ok := f.Value(name); ok {
+		if b, err := strconv.ParseBool(string(v)); err == nil {
+			return b
+		}
+	}
+	return def
+}
+
+// Set stores value for the flag name and reloads the cache so that the change
+// is visible locally immediately.
+func (f *Flags) Set(ctx context.Context, name string, value []byte) error {
+	if _, err := f.kv.Put(ctx, name, value); err != nil {
+		return err
+	}
+	return f.Reload(ctx)
+}
+
+func (f *Flags) run() {
+	table := f.kv.Table
+	if table == "" {
+		table = DefaultKVTable
+	}
+
+	for {
+		select {
+		case event, running := <-f.es.C():
+			if !running {
+				return
+			}
+			data, ok := event.Data.(*TxEventData)
+			if !ok || event.DB != f.kv.name() || !data.MayTouch(table) {
+				continue
+			}
+			_ = f.Reload(context.Background())
+		case _, running := <-f.es.ErrC():
+			if !running {
+				return
+			}
+		}
+	}
+}
+
+func (f *Flags) setValues(values map[string][]byte, err error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if err == nil {
+		f.values = values
+	}
+	f.err = err
+}
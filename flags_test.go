@@ -0,0 +1,64 @@
+package litefs
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFlags(t *testing.T) {
+	src := newFakeSource()
+	useEventSource(t, func(...SubscribeOption) EventSource { return src })
+
+	path := lockedDB(t, false)
+	writePosFile(t, path, "0000000000000001/0000000000000000")
+	kv := &KV{DB: openKVDB(t), DatabasePath: path}
+	ctx := context.Background()
+	if _, err := kv.Put(ctx, "beta", []byte("true")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Put(ctx, "broken", []byte("maybe")); err != nil {
+		t.Fatal(err)
+	}
+
+	f := NewFlags(kv)
+	t.Cleanup(f.Close)
+	if err := f.Err(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if !f.Bool("beta", false) || !f.Bool("missing", true) || f.Bool("broken", false) {
+		t.Fatal("wrong bool flags")
+	}
+	if s := f.String("missing", "red"); s != "red" {
+		t.Fatalf("expected default, got %q", s)
+	}
+
+	if err := f.Set(ctx, "color", []byte("blue")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s := f.String("color", "red"); s != "blue" {
+		t.Fatalf("expected blue, got %q", s)
+	}
+
+	// writes from other nodes are picked up from tx events touching the
+	// table. Events are handled in order, so the other database's event has
+	// been handled once the next is received.
+	if _, err := kv.Put(ctx, "color", []byte("green")); err != nil {
+		t.Fatal(err)
+	}
+	src.c <- &Event{Type: EventTypeTx, DB: "db", Data: &TxEventData{Tables: []string{"other"}}}
+	src.c <- &Event{Type: EventTypeTx, DB: "other", Data: &TxEventData{}}
+	if s := f.String("color", "red"); s != "blue" {
+		t.Fatalf("reloaded on an unrelated event: %q", s)
+	}
+
+	src.c <- &Event{Type: EventTypeTx, DB: "db", Data: &TxEventData{Tables: []string{DefaultKVTable}}}
+	deadline := time.Now().Add(time.Second)
+	for f.String("color", "red") != "green" {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for reload")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
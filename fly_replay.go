@@ -0,0 +1,125 @@
+package litefs
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ReplayWriteState is the state ReplayToPrimary attaches to the replay of a
+// non-idempotent request, which the Fly.io proxy passes to the primary in the
+// Fly-Replay-Src header.
+const ReplayWriteState = "litefs-write"
+
+// ReplayWrites returns a function that wraps handlers so that, on replicas,
+// write requests are answered with a Fly-Replay header asking the Fly.io proxy
+// to replay them on the primary rather than being passed to next. Requests
+// with safe methods, and all requests on the primary, are passed to next.
+//
+// The primary is named by its LiteFS hostname, so LiteFS must be configured
+// with the Fly machine ID as its hostname, as Fly.io's LiteFS templates do.
+// Write requests receive a 503 response with a Retry-After header while there
+// is no known primary. Non-idempotent requests are guarded against replay
+// loops as by ReplayToPrimary.
+func ReplayWrites(pm *PrimaryMonitor) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			isPrimary, err := pm.IsPrimary()
+			if err == nil && isPrimary {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			hostname, _ := pm.Hostname()
+			if hostname == "" {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, ErrNoPrimary.Error(), http.StatusServiceUnavailable)
+				return
+			}
+
+			replayToPrimary(w, r, hostname)
+		})
+	}
+}
+
+// ReplayToInstance responds to a request by asking the Fly.io proxy to replay
+// it on the machine with the ID instance. Nothing may have been written to w.
+func ReplayToInstance(w http.ResponseWriter, instance string) {
+	replay(w, "instance="+instance)
+}
+
+// ReplayToPrimary responds to r by asking the Fly.io proxy to replay it on the
+// primary, found with DefaultRoleCache, and reports whether it did. It
+// reports false on the primary, where the caller should serve r itself.
+//
+// Non-idempotent requests are replayed with ReplayWriteState. If one arrives
+// with that state on a node that still isn't the primary, the primary moved
+// while it was replayed; it is answered with 503 Service Unavailable and a
+// Retry-After header rather than replayed again, so that it can't bounce
+// between nodes. So are requests while there is no known primary.
+func ReplayToPrimary(w http.ResponseWriter, r *http.Request) bool {
+	hostname, err := DefaultRoleCache.PrimaryHostname(r.Context())
+	if err == nil && hostname == "" {
+		return false
+	}
+	if err != nil {
+		if !errors.Is(err, ErrNoPrimary) {
+			err = ErrNoPrimary
+		}
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return true
+	}
+
+	replayToPrimary(w, r, hostname)
+	return true
+}
+
+// replayToPrimary responds to r by asking the Fly.io proxy to replay it on the
+// primary with hostname, refusing to replay non-idempotent requests twice.
+func replayToPrimary(w http.ResponseWriter, r *http.Request, hostname string) {
+	if isIdempotent(r.Method) {
+		ReplayToInstance(w, hostname)
+		return
+	}
+	if ReplayState(r) == ReplayWriteState {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "primary moved during replay", http.StatusServiceUnavailable)
+		return
+	}
+	replay(w, "instance="+hostname+";state="+ReplayWriteState)
+}
+
+// ReplayState returns the state a request was replayed with, from its
+// Fly-Replay-Src header, or an empty string if it wasn't replayed with one.
+func ReplayState(r *http.Request) string {
+	for _, field := range strings.Split(r.Header.Get(FlyReplaySrcHeader), ";") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(field), "="); ok && k == "state" {
+			return v
+		}
+	}
+	return ""
+}
+
+// replay answers a request with a Fly-Replay header of value. The Fly.io proxy
+// replays the request rather than passing on the response.
+func replay(w http.ResponseWriter, value string) {
+	w.Header().Set(FlyReplayHeader, value)
+	w.WriteHeader(http.StatusConflict)
+}
+
+// isIdempotent reports whether requests with method may be repeated without
+// changing their effect.
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
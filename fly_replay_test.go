@@ -0,0 +1,104 @@
+package litefs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReplayWrites(t *testing.T) {
+	pm, c := mockServerMonitor(t)
+	h := ReplayWrites(pm)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, "/", nil))
+		return w
+	}
+
+	// no primary is known yet.
+	if w := serve(http.MethodPost); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d", w.Code)
+	}
+
+	c <- initEventJSON
+	c <- flush
+	assertReady(t, pm, time.Second)
+	if w := serve(http.MethodPost); w.Code != http.StatusNoContent {
+		t.Fatalf("expected write to be served on the primary, got %d", w.Code)
+	}
+
+	c <- pChangeNode2EventJSON
+	c <- flush
+	assertPrimary(t, pm, false, "node-2")
+	if w := serve(http.MethodGet); w.Code != http.StatusNoContent {
+		t.Fatalf("expected read to be served on a replica, got %d", w.Code)
+	}
+	w := serve(http.MethodDelete)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d", w.Code)
+	}
+	if s := w.Header().Get(FlyReplayHeader); s != "instance=node-2" {
+		t.Fatalf("wrong %s header: %s", FlyReplayHeader, s)
+	}
+
+	// non-idempotent writes are replayed with state and not replayed again.
+	w = serve(http.MethodPost)
+	if s := w.Header().Get(FlyReplayHeader); w.Code != http.StatusConflict || s != "instance=node-2;state="+ReplayWriteState {
+		t.Fatalf("unexpected replay: %d %s", w.Code, s)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(FlyReplaySrcHeader, "instance=node-3;region=ord;state="+ReplayWriteState)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get(FlyReplayHeader) != "" {
+		t.Fatalf("expected 503 without a replay, got %d", w.Code)
+	}
+}
+
+func TestReplayToPrimary(t *testing.T) {
+	dir := t.TempDir()
+	rc := DefaultRoleCache
+	DefaultRoleCache = NewRoleCache(dir)
+	DefaultRoleCache.TTL = 0
+	t.Cleanup(func() { DefaultRoleCache = rc })
+
+	replay := func(method, src string) (*httptest.ResponseRecorder, bool) {
+		r := httptest.NewRequest(method, "/", nil)
+		if src != "" {
+			r.Header.Set(FlyReplaySrcHeader, src)
+		}
+		w := httptest.NewRecorder()
+		return w, ReplayToPrimary(w, r)
+	}
+
+	if _, replayed := replay(http.MethodPost, ""); replayed {
+		t.Fatal("expected request to be served on the primary")
+	}
+
+	if err := os.WriteFile(PrimaryPath(dir), []byte("node-2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for method, expected := range map[string]string{
+		http.MethodPut:  "instance=node-2",
+		http.MethodPost: "instance=node-2;state=" + ReplayWriteState,
+	} {
+		w, replayed := replay(method, "")
+		if !replayed || w.Code != http.StatusConflict {
+			t.Fatalf("expected %s to be replayed, got %d", method, w.Code)
+		}
+		if s := w.Header().Get(FlyReplayHeader); s != expected {
+			t.Fatalf("wrong %s header for %s: %s", FlyReplayHeader, method, s)
+		}
+	}
+
+	// a write replayed here by a node that thought this was the primary.
+	w, replayed := replay(http.MethodPost, "instance=node-1;region=ord;t=1;state="+ReplayWriteState)
+	if !replayed || w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d", w.Code)
+	}
+}
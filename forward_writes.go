@@ -0,0 +1,72 @@
+package litefs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+)
+
+// ForwardWrites returns a handler that reverse-proxies requests to the current
+// primary over HTTP, for deployments without the Fly.io proxy to replay them.
+// Use it as a Router's Forward handler, or wrap it so that it only receives
+// write requests.
+//
+// primaryResolver returns the address of the primary's HTTP server, either as
+// a base URL or as a host and port to reach over plain HTTP. Request and
+// response bodies are streamed and headers are passed on, with
+// X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto set. Requests
+// receive a 503 response with a Retry-After header while primaryResolver
+// returns an empty string, and when they were already forwarded once, which
+// means the primary moved while they were in flight.
+func ForwardWrites(primaryResolver func() string) http.Handler {
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(pr.In.Context().Value(forwardTargetKey{}).(*url.URL))
+			pr.SetXForwarded()
+			pr.Out.Host = pr.In.Host
+			pr.Out.Header.Set(ForwardedHeader, "1")
+		},
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, "forwarding to primary: "+err.Error(), http.StatusBadGateway)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ForwardedHeader) != "" {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "primary moved while forwarding", http.StatusServiceUnavailable)
+			return
+		}
+
+		target, err := primaryURL(primaryResolver())
+		if err != nil {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), forwardTargetKey{}, target)))
+	})
+}
+
+// forwardTargetKey is the context key of the primary a request is forwarded
+// to.
+type forwardTargetKey struct{}
+
+// primaryURL parses the address of the primary returned by a resolver.
+func primaryURL(addr string) (*url.URL, error) {
+	if addr == "" {
+		return nil, ErrNoPrimary
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid primary address: %w", err)
+	}
+	return u, nil
+}
@@ -0,0 +1,51 @@
+package litefs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestForwardWrites(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Primary", "1")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, r.Method+" "+r.URL.RequestURI()+" "+r.Header.Get("X-Token")+" "+r.Host+" "+string(body))
+	}))
+	t.Cleanup(primary.Close)
+
+	var addr atomic.Value
+	addr.Store(strings.TrimPrefix(primary.URL, "http://"))
+	h := ForwardWrites(func() string { return addr.Load().(string) })
+
+	r := httptest.NewRequest(http.MethodPost, "http://app.example/notes?x=1", strings.NewReader("hello"))
+	r.Header.Set("X-Token", "secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated || w.Header().Get("X-Primary") != "1" {
+		t.Fatalf("expected response from primary, got %d", w.Code)
+	}
+	if s := w.Body.String(); s != "POST /notes?x=1 secret app.example hello" {
+		t.Fatalf("wrong request forwarded: %s", s)
+	}
+
+	// requests already forwarded aren't forwarded again.
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(ForwardedHeader, "1")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d", w.Code)
+	}
+
+	addr.Store("")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d", w.Code)
+	}
+}
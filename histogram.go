@@ -0,0 +1,119 @@
+package litefs
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are the bucket upper bounds of a LatencyHistogram
+// created without any.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// LatencyHistogram counts observed latencies in fixed buckets. It is safe for
+// concurrent use.
+type LatencyHistogram struct {
+	buckets []time.Duration
+
+	m      sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    time.Duration
+}
+
+// NewLatencyHistogram returns a new *LatencyHistogram with the given bucket
+// upper bounds, or DefaultLatencyBuckets if none are given.
+func NewLatencyHistogram(buckets ...time.Duration) *LatencyHistogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+
+	return &LatencyHistogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)+1),
+	}
+}
+
+// Observe records a latency of d.
+func (h *LatencyHistogram) Observe(d time.Duration) {
+	i := sort.Search(len(h.buckets), func(i int) bool { return d <= h.buckets[i] })
+
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.counts[i]++
+	h.count++
+	h.sum += d
+}
+
+// Snapshot returns the current state of the histogram.
+func (h *LatencyHistogram) Snapshot() HistogramSnapshot {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	return HistogramSnapshot{
+		Buckets: h.buckets,
+		Counts:  append([]uint64(nil), h.counts...),
+		Count:   h.count,
+		Sum:     h.sum,
+	}
+}
+
+// HistogramSnapshot is the state of a LatencyHistogram at a point in time.
+type HistogramSnapshot struct {
+	// Buckets are the upper bounds of the buckets.
+	Buckets []time.Duration `json:"buckets"`
+
+	// Counts are the number of observations in each bucket, i.e. greater
+	// than the previous bound and at most the bucket's own. It has an extra
+	// final element counting observations above every bound.
+	Counts []uint64 `json:"counts"`
+
+	Count uint64        `json:"count"`
+	Sum   time.Duration `json:"sum"`
+}
+
+// Mean returns the mean observed latency.
+func (s HistogramSnapshot) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / time.Duration(s.Count)
+}
+
+// Quantile returns the upper bound of the bucket containing the q-quantile,
+// for q between 0 and 1. Observations above every bound are reported as the
+// largest bound.
+func (s HistogramSnapshot) Quantile(q float64) time.Duration {
+	if s.Count == 0 || len(s.Buckets) == 0 {
+		return 0
+	}
+
+	rank := uint64(q * float64(s.Count))
+	if rank >= s.Count {
+		rank = s.Count - 1
+	}
+	var seen uint64
+	for i, bound := range s.Buckets {
+		if seen += s.Counts[i]; seen > rank {
+			return bound
+		}
+	}
+	return s.Buckets[len(s.Buckets)-1]
+}
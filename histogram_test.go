@@ -0,0 +1,46 @@
+package litefs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	h := NewLatencyHistogram(100*time.Millisecond, 10*time.Millisecond, time.Second)
+
+	for _, d := range []time.Duration{
+		5 * time.Millisecond,
+		10 * time.Millisecond,
+		50 * time.Millisecond,
+		50 * time.Millisecond,
+		2 * time.Second,
+	} {
+		h.Observe(d)
+	}
+
+	s := h.Snapshot()
+	if expected := []time.Duration{10 * time.Millisecond, 100 * time.Millisecond, time.Second}; !reflect.DeepEqual(s.Buckets, expected) {
+		t.Fatalf("expected buckets %v, got %v", expected, s.Buckets)
+	}
+	if expected := []uint64{2, 2, 0, 1}; !reflect.DeepEqual(s.Counts, expected) {
+		t.Fatalf("expected counts %v, got %v", expected, s.Counts)
+	}
+	if s.Count != 5 || s.Mean() != 423*time.Millisecond {
+		t.Fatalf("unexpected count %d or mean %s", s.Count, s.Mean())
+	}
+
+	for q, expected := range map[float64]time.Duration{
+		0:   10 * time.Millisecond,
+		0.5: 100 * time.Millisecond,
+		1:   time.Second,
+	} {
+		if actual := s.Quantile(q); actual != expected {
+			t.Errorf("expected quantile %v to be %s, got %s", q, expected, actual)
+		}
+	}
+
+	if s := NewLatencyHistogram().Snapshot(); s.Quantile(0.5) != 0 || s.Mean() != 0 || len(s.Buckets) != len(DefaultLatencyBuckets) {
+		t.Fatalf("unexpected empty snapshot: %+v", s)
+	}
+}
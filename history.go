@@ -0,0 +1,110 @@
+package litefs
+
+import (
+	"context"
+	"time"
+)
+
+// HistoryFilter selects events from an EventHistory.
+type HistoryFilter struct {
+	EventQuery
+
+	// Types selects events of the given types, e.g. EventTypePrimaryChange.
+	Types []string
+}
+
+// Failover is a change of primary reconstructed from stored events.
+type Failover struct {
+	// At is when the new primary was reported.
+	At time.Time `json:"at"`
+
+	// Primary is the hostname of the new primary.
+	Primary string `json:"primary"`
+
+	// Previous is the hostname of the previous primary, if known.
+	Previous string `json:"previous,omitempty"`
+
+	// Election is how long the cluster had no primary before Primary was
+	// reported. It is zero if the primary changed hands directly.
+	Election time.Duration `json:"election,omitempty"`
+}
+
+// EventHistory answers questions about the events recorded in Store, e.g. by
+// EventBroker.Persist.
+type EventHistory struct {
+	Store EventStore
+}
+
+// History returns the stored events matching filter in the order they were
+// received.
+func (h *EventHistory) History(ctx context.Context, filter HistoryFilter) ([]StoredEvent, error) {
+	if len(filter.Types) == 0 {
+		return h.Store.Query(ctx, filter.EventQuery)
+	}
+
+	// types are filtered here, so the limit must be too.
+	q := filter.EventQuery
+	q.Limit = 0
+	events, err := h.Store.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	matched := events[:0]
+	for _, e := range events {
+		if !hasType(filter.Types, e.Event.Type) {
+			continue
+		}
+		if matched = append(matched, e); filter.Limit > 0 && len(matched) >= filter.Limit {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// Failovers returns the changes of primary received within [since, until).
+// Zero times don't restrict the range.
+func (h *EventHistory) Failovers(ctx context.Context, since, until time.Time) ([]Failover, error) {
+	events, err := h.History(ctx, HistoryFilter{
+		EventQuery: EventQuery{Since: since, Until: until},
+		Types:      []string{EventTypeInit, EventTypePrimaryChange},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var failovers []Failover
+	var primary string
+	var lostAt time.Time
+	for _, e := range events {
+		switch data := e.Event.Data.(type) {
+		case *InitEventData:
+			// a restart of the process; it says nothing about elections.
+			primary, lostAt = data.Hostname, time.Time{}
+		case *PrimaryChangeEventData:
+			switch {
+			case data.Hostname == "":
+				if lostAt.IsZero() {
+					lostAt = e.ReceivedAt
+				}
+			case data.Hostname != primary || !lostAt.IsZero():
+				f := Failover{At: e.ReceivedAt, Primary: data.Hostname, Previous: primary}
+				if !lostAt.IsZero() {
+					f.Election = e.ReceivedAt.Sub(lostAt)
+				}
+				failovers = append(failovers, f)
+				primary, lostAt = data.Hostname, time.Time{}
+			}
+		}
+	}
+	return failovers, nil
+}
+
+func hasType(types []string, typ string) bool {
+	for _, t := range types {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package litefs
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEventHistory(t *testing.T) {
+	s, err := OpenFileEventStore(filepath.Join(t.TempDir(), "events"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer s.Close()
+
+	ctx := context.Background()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	primaryChange := func(hostname string) *Event {
+		return &Event{Type: EventTypePrimaryChange, Data: &PrimaryChangeEventData{Hostname: hostname}}
+	}
+	for i, e := range []*Event{
+		initEvent, // node-1
+		txEvent,
+		primaryChange("node-2"),
+		primaryChange(""),
+		txEvent,
+		primaryChange("node-1"),
+	} {
+		if err := s.Append(ctx, StoredEvent{ReceivedAt: t0.Add(time.Duration(i) * time.Second), Event: e}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	h := &EventHistory{Store: s}
+
+	t.Run("history", func(t *testing.T) {
+		events, err := h.History(ctx, HistoryFilter{Types: []string{EventTypeTx}, EventQuery: EventQuery{Limit: 1}})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(events) != 1 || !events[0].ReceivedAt.Equal(t0.Add(time.Second)) {
+			t.Fatalf("wrong events: %#v", events)
+		}
+	})
+
+	t.Run("failovers", func(t *testing.T) {
+		failovers, err := h.Failovers(ctx, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		expected := []Failover{
+			{At: t0.Add(2 * time.Second), Primary: "node-2", Previous: "node-1"},
+			{At: t0.Add(5 * time.Second), Primary: "node-1", Previous: "node-2", Election: 2 * time.Second},
+		}
+		for i := range failovers {
+			failovers[i].At = failovers[i].At.UTC()
+		}
+		if !reflect.DeepEqual(failovers, expected) {
+			t.Fatalf("wrong failovers: %#v", failovers)
+		}
+	})
+}
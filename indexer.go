@@ -0,0 +1,253 @@
+package litefs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	errIndexerColumns    = errors.New("indexer query must return at least an ID and a watermark column")
+	errElasticsearchBulk = errors.New("elasticsearch bulk request reported errors")
+)
+
+// Document is a record pushed to an IndexSink.
+type Document struct {
+	ID     string
+	Fields map[string]any
+}
+
+// IndexSink receives documents from an Indexer. Implementations adapt search
+// engines such as Bleve or Elasticsearch.
+type IndexSink interface {
+	Index(ctx context.Context, docs []Document) error
+}
+
+// Indexer keeps an external index in sync with a LiteFS database. Each time a
+// tx event is received for Database, Query is run to fetch the rows that
+// changed since the last checkpoint and they are pushed to Sink.
+//
+// The first column Query returns is the document ID and the second is the
+// row's watermark, typically a row version or a TXID the application records
+// on each row. The remaining columns become the document's fields. Rows must
+// be ordered by watermark and then ID. Query is run with the watermark and the
+// ID of the last row indexed as its arguments, and must return the rows after
+// them; the ID is NULL when every row at the watermark has been indexed. If
+// Query limits the number of rows it returns, it is run repeatedly until no
+// rows are returned, so rows sharing a watermark may span several pages:
+//
+//	SELECT id, version, title FROM docs
+//	WHERE version > ?1 OR (version = ?1 AND id > ?2)
+//	ORDER BY version, id LIMIT 100
+//
+// After each batch is indexed, the highest watermark whose rows have all been
+// indexed is saved to Store under Name as the TXID of a Pos.
+type Indexer struct {
+	DB       *sql.DB
+	Database string
+	Query    string
+	Sink     IndexSink
+	Store    PosStore
+	Name     string
+
+	// Tables optionally lists the tables Query reads. Tx events reporting
+	// that none of them changed are skipped.
+	Tables []string
+
+	// OnError is called with errors encountered while indexing. If nil, Run
+	// returns the first such error.
+	OnError func(error)
+}
+
+// Run performs an initial Sync and then syncs again after each tx event for
+// Database until ctx is done.
+func (idx *Indexer) Run(ctx context.Context) error {
+	es := NewEventSource()
+	defer es.Close()
+
+	if err := idx.handle(idx.Sync(ctx)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, running := <-es.C():
+			if !running {
+				return ErrSubscriptionClosed
+			}
+			data, ok := event.Data.(*TxEventData)
+			if !ok || (idx.Database != "" && event.DB != idx.Database) || !data.MayTouch(idx.Tables...) {
+				continue
+			}
+			if err := idx.handle(idx.Sync(ctx)); err != nil {
+				return err
+			}
+		case err, running := <-es.ErrC():
+			if err := sourceError(err, running); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (idx *Indexer) handle(err error) error {
+	if err == nil || idx.OnError == nil {
+		return err
+	}
+	idx.OnError(err)
+	return nil
+}
+
+// Sync indexes all rows changed since the last checkpoint.
+func (idx *Indexer) Sync(ctx context.Context) error {
+	pos, err := idx.Store.LoadPos(ctx, idx.Name)
+	if err != nil {
+		return fmt.Errorf("load checkpoint: %w", err)
+	}
+	watermark, saved := int64(pos.TXID), int64(pos.TXID)
+	var id sql.NullString
+
+	save := func(w int64) error {
+		if w <= saved {
+			return nil
+		}
+		if err := idx.Store.SavePos(ctx, idx.Name, Pos{TXID: TXID(w)}); err != nil {
+			return fmt.Errorf("save checkpoint: %w", err)
+		}
+		saved = w
+		return nil
+	}
+
+	for {
+		docs, last, lastID, err := idx.query(ctx, watermark, id)
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return save(watermark)
+		}
+		if last < watermark || (id.Valid && last == watermark && lastID == id.String) {
+			return nil // Query didn't advance past the previous page.
+		}
+
+		if err := idx.Sink.Index(ctx, docs); err != nil {
+			return fmt.Errorf("index: %w", err)
+		}
+
+		// The next page may hold more rows at the last watermark, so only
+		// the ones before it are known to be complete.
+		if err := save(last - 1); err != nil {
+			return err
+		}
+		watermark, id = last, sql.NullString{String: lastID, Valid: true}
+	}
+}
+
+// query runs Query after the row with the given watermark and ID, and returns
+// the documents and the watermark and ID of the last row.
+func (idx *Indexer) query(ctx context.Context, watermark int64, afterID sql.NullString) (docs []Document, last int64, lastID string, err error) {
+	rows, err := idx.DB.QueryContext(ctx, idx.Query, watermark, afterID)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, 0, "", err
+	}
+	if len(cols) < 2 {
+		return nil, 0, "", errIndexerColumns
+	}
+
+	for rows.Next() {
+		var id string
+		var rowWatermark int64
+		fields := make([]any, len(cols)-2)
+		dest := []any{&id, &rowWatermark}
+		for i := range fields {
+			dest = append(dest, &fields[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, "", err
+		}
+
+		doc := Document{ID: id, Fields: make(map[string]any, len(fields))}
+		for i, v := range fields {
+			if b, ok := v.([]byte); ok {
+				v = string(b)
+			}
+			doc.Fields[cols[i+2]] = v
+		}
+		docs = append(docs, doc)
+		last, lastID = rowWatermark, id
+	}
+	return docs, last, lastID, rows.Err()
+}
+
+// ElasticsearchSink is an IndexSink that writes documents to an Elasticsearch
+// index using the bulk API.
+type ElasticsearchSink struct {
+	// URL is the base URL of the Elasticsearch cluster.
+	URL string
+
+	// IndexName is the name of the index documents are written to.
+	IndexName string
+
+	// Client is used to make requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+var _ IndexSink = (*ElasticsearchSink)(nil)
+
+func (s *ElasticsearchSink) Index(ctx context.Context, docs []Document) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, doc := range docs {
+		action := map[string]any{"index": map[string]string{"_index": s.IndexName, "_id": doc.ID}}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(doc.Fields); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.URL, "/")+"/_bulk", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &ErrUnexpectedStatus{Code: resp.StatusCode}
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if result.Errors {
+		return errElasticsearchBulk
+	}
+	return nil
+}
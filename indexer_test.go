@@ -0,0 +1,171 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestIndexer(t *testing.T) {
+	ctx := context.Background()
+	sink := &memorySink{}
+	idx := &Indexer{
+		DB:    openFakeDB(t, []string{"id", "version", "title"}, 1, 2),
+		Query: "SELECT id, version, title FROM docs WHERE version > ?1 OR (version = ?1 AND id > ?2) ORDER BY version, id LIMIT 2",
+		Sink:  sink,
+		Store: &FilePosStore{Dir: t.TempDir()},
+		Name:  "docs",
+	}
+
+	fakeRows = [][]driver.Value{
+		{"a", int64(1), "one"},
+		{"b", int64(2), "two"},
+		{"c", int64(3), "three"},
+	}
+	if err := idx.Sync(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertIndexed(t, sink, "a", "b", "c")
+
+	fakeRows = append(fakeRows, []driver.Value{"a", int64(4), "uno"})
+	if err := idx.Sync(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertIndexed(t, sink, "a", "b", "c", "a")
+	if title := sink.docs[3].Fields["title"]; title != "uno" {
+		t.Fatalf("expected uno, got %v", title)
+	}
+
+	pos, err := idx.Store.LoadPos(ctx, "docs")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pos.TXID != 4 {
+		t.Fatalf("expected watermark 4, got %d", pos.TXID)
+	}
+}
+
+func TestIndexerSharedWatermark(t *testing.T) {
+	ctx := context.Background()
+	sink := &memorySink{}
+	idx := &Indexer{
+		DB:    openFakeDB(t, []string{"id", "version"}, 1, 2),
+		Query: "SELECT id, version FROM docs WHERE version > ?1 OR (version = ?1 AND id > ?2) ORDER BY version, id LIMIT 2",
+		Sink:  sink,
+		Store: &FilePosStore{Dir: t.TempDir()},
+		Name:  "docs",
+	}
+
+	// the rows at watermark 1 span two pages.
+	fakeRows = [][]driver.Value{
+		{"a", int64(1)},
+		{"b", int64(1)},
+		{"c", int64(1)},
+		{"d", int64(2)},
+	}
+	if err := idx.Sync(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertIndexed(t, sink, "a", "b", "c", "d")
+
+	if pos, err := idx.Store.LoadPos(ctx, "docs"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if pos.TXID != 2 {
+		t.Fatalf("expected watermark 2, got %d", pos.TXID)
+	}
+}
+
+func assertIndexed(t *testing.T, sink *memorySink, ids ...string) {
+	t.Helper()
+
+	var actual []string
+	for _, doc := range sink.docs {
+		actual = append(actual, doc.ID)
+	}
+	if !reflect.DeepEqual(actual, ids) {
+		t.Fatalf("expected %v, got %v", ids, actual)
+	}
+}
+
+type memorySink struct {
+	docs []Document
+}
+
+func (s *memorySink) Index(ctx context.Context, docs []Document) error {
+	s.docs = append(s.docs, docs...)
+	return nil
+}
+
+// fakeRows holds the rows served by the fake driver.
+var fakeRows [][]driver.Value
+
+// openFakeDB returns a database whose queries return the fakeRows after the
+// watermark in the query's first argument and, if it is given, the ID in the
+// first column in its second.
+func openFakeDB(t *testing.T, cols []string, watermark, limit int) *sql.DB {
+	db := sql.OpenDB(&fakeConnector{cols: cols, watermark: watermark, limit: limit})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type fakeConnector struct {
+	cols      []string
+	watermark int
+	limit     int
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{c}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ c *fakeConnector }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return &fakeStmt{c.c}, nil }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+type fakeStmt struct{ c *fakeConnector }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if len(args) == 0 {
+		return &fakeDriverRows{cols: s.c.cols}, nil
+	}
+	var rows [][]driver.Value
+	for _, row := range fakeRows {
+		if len(rows) < s.c.limit && fakeRowAfter(row, s.c.watermark, args) {
+			rows = append(rows, row)
+		}
+	}
+	return &fakeDriverRows{cols: s.c.cols, rows: rows}, nil
+}
+
+func fakeRowAfter(row []driver.Value, watermark int, args []driver.Value) bool {
+	w, after := row[watermark].(int64), args[0].(int64)
+	if w != after || len(args) < 2 || args[1] == nil {
+		return w > after
+	}
+	return row[0].(string) > args[1].(string)
+}
+
+type fakeDriverRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *fakeDriverRows) Columns() []string { return r.cols }
+func (r *fakeDriverRows) Close() error      { return nil }
+func (r *fakeDriverRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,323 @@
+// Package miniyaml parses the subset of YAML used by LiteFS configuration
+// files: block mappings and sequences, flow sequences of scalars, quoted and
+// plain scalars, block scalars and comments. Scalars are returned as strings.
+//
+// It exists so that reading litefs.yml doesn't add a third-party dependency.
+package miniyaml
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Map is a decoded mapping. Values are string, []any, Map or nil.
+type Map map[string]any
+
+// String returns the scalar at key, or "" if it is missing or not a scalar.
+func (m Map) String(key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+// Map returns the mapping at key, or nil if it is missing or not a mapping.
+func (m Map) Map(key string) Map {
+	v, _ := m[key].(Map)
+	return v
+}
+
+// Strings returns the scalars of the sequence at key. A scalar is returned as
+// a sequence of one.
+func (m Map) Strings(key string) []string {
+	switch v := m[key].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		a := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				a = append(a, s)
+			}
+		}
+		return a
+	}
+	return nil
+}
+
+type line struct {
+	num     int
+	indent  int
+	content string
+	raw     string
+}
+
+// Parse decodes a document whose top level is a mapping.
+func Parse(data []byte) (Map, error) {
+	p := &parser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		content := strings.TrimSpace(stripComment(raw))
+		if content == "" || content == "---" {
+			p.lines = append(p.lines, line{num: i + 1, indent: -1, raw: raw})
+			continue
+		}
+		if strings.HasPrefix(strings.TrimLeft(raw, " "), "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, line{
+			num:     i + 1,
+			indent:  len(raw) - len(strings.TrimLeft(raw, " ")),
+			content: content,
+			raw:     raw,
+		})
+	}
+
+	p.skipBlank()
+	if p.eof() {
+		return Map{}, nil
+	}
+	if isSeqItem(p.peek().content) {
+		return nil, fmt.Errorf("line %d: document is not a mapping", p.peek().num)
+	}
+	m, err := p.parseMap(p.peek().indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.skipBlank(); !p.eof() {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.peek().num)
+	}
+	return m, nil
+}
+
+type parser struct {
+	lines []line
+	i     int
+}
+
+func (p *parser) eof() bool  { return p.i >= len(p.lines) }
+func (p *parser) peek() line { return p.lines[p.i] }
+
+func (p *parser) skipBlank() {
+	for !p.eof() && p.lines[p.i].indent < 0 {
+		p.i++
+	}
+}
+
+func (p *parser) parseMap(indent int) (Map, error) {
+	m := make(Map)
+	for p.skipBlank(); !p.eof(); p.skipBlank() {
+		l := p.peek()
+		if l.indent < indent {
+			break
+		} else if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.num)
+		} else if isSeqItem(l.content) {
+			break
+		}
+
+		key, rest, ok := splitKey(l.content)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key", l.num)
+		}
+		p.i++
+
+		v, err := p.parseValue(indent, rest, true)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.num, err)
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func (p *parser) parseSeq(indent int) ([]any, error) {
+	var a []any
+	for p.skipBlank(); !p.eof(); p.skipBlank() {
+		l := p.peek()
+		if l.indent != indent || !isSeqItem(l.content) {
+			if l.indent > indent {
+				return nil, fmt.Errorf("line %d: unexpected indentation", l.num)
+			}
+			break
+		}
+
+		rest := strings.TrimSpace(strings.TrimPrefix(l.content, "-"))
+		if _, _, ok := splitKey(rest); ok {
+			// a mapping starting on the item's line continues at the
+			// indentation of its first key.
+			p.lines[p.i].indent = indent + strings.Index(l.content, rest)
+			p.lines[p.i].content = rest
+			m, err := p.parseMap(p.lines[p.i].indent)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, m)
+			continue
+		}
+
+		p.i++
+		v, err := p.parseValue(indent, rest, false)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.num, err)
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+// parseValue parses the value following a key or sequence marker at indent.
+// Sequences may be nested at the same indentation as a mapping key.
+func (p *parser) parseValue(indent int, rest string, inMap bool) (any, error) {
+	switch rest {
+	case "|", "|-", ">", ">-":
+		return p.parseBlockScalar(indent, rest), nil
+	case "":
+	default:
+		return parseScalar(rest)
+	}
+
+	if p.skipBlank(); p.eof() {
+		return nil, nil
+	}
+	next := p.peek()
+	switch {
+	case next.indent > indent && isSeqItem(next.content):
+		return p.parseSeq(next.indent)
+	case next.indent > indent:
+		return p.parseMap(next.indent)
+	case inMap && next.indent == indent && isSeqItem(next.content):
+		return p.parseSeq(next.indent)
+	}
+	return nil, nil
+}
+
+func (p *parser) parseBlockScalar(indent int, style string) string {
+	var a []string
+	blockIndent := -1
+	for ; !p.eof(); p.i++ {
+		l := p.peek()
+		if l.indent >= 0 && l.indent <= indent {
+			break
+		}
+		if l.indent < 0 {
+			a = append(a, "")
+			continue
+		}
+		if blockIndent < 0 {
+			blockIndent = l.indent
+		}
+		a = append(a, l.raw[min(blockIndent, l.indent):])
+	}
+	for len(a) != 0 && a[len(a)-1] == "" {
+		a = a[:len(a)-1]
+	}
+
+	sep := "\n"
+	if style[0] == '>' {
+		sep = " "
+	}
+	s := strings.Join(a, sep)
+	if !strings.HasSuffix(style, "-") && s != "" {
+		s += "\n"
+	}
+	return s
+}
+
+func isSeqItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// splitKey splits "key: value" into its key and value.
+func splitKey(content string) (key, rest string, ok bool) {
+	if content == "" || content[0] == '"' || content[0] == '\'' || content[0] == '[' {
+		return "", "", false
+	}
+	if strings.HasSuffix(content, ":") {
+		return strings.TrimSpace(content[:len(content)-1]), "", true
+	}
+	if i := strings.Index(content, ": "); i > 0 {
+		return strings.TrimSpace(content[:i]), strings.TrimSpace(content[i+2:]), true
+	}
+	return "", "", false
+}
+
+func parseScalar(s string) (any, error) {
+	switch {
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("unterminated flow sequence: %s", s)
+		}
+		a := []any{}
+		inner := strings.TrimSpace(s[1 : len(s)-1])
+		if inner == "" {
+			return a, nil
+		}
+		for _, item := range splitFlow(inner) {
+			v, err := parseScalar(strings.TrimSpace(item))
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string: %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("invalid quoted string: %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case s == "~" || s == "null":
+		return nil, nil
+	}
+	return s, nil
+}
+
+// splitFlow splits the items of a flow sequence on commas outside quotes.
+func splitFlow(s string) []string {
+	var a []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			a = append(a, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(a, s[start:])
+}
+
+// stripComment removes a trailing comment outside quotes.
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '[' || s[i-1] == ',' || s[i-1] == '-' {
+				quote = c
+			}
+		case c == '#':
+			if i == 0 || s[i-1] == ' ' || s[i-1] == '\t' {
+				return s[:i]
+			}
+		}
+	}
+	return s
+}
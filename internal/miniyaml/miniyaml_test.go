@@ -0,0 +1,83 @@
+package miniyaml
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const doc = `
+# LiteFS config
+fuse:
+  dir: "/litefs" # mount
+data:
+  dir: '/var/lib/litefs'
+
+exec:
+  - cmd: "app -addr :8081"
+    if-candidate: true
+  - cmd: >
+      run migrations
+
+proxy:
+  addr: ":8080"
+  target: localhost:8081
+  passthrough: ["*.ico", '*.png']
+  always-forward:
+  - /admin
+  - "/jobs # not a comment"
+lease:
+  type: "consul"
+  candidate: ${FLY_REGION}
+  consul:
+`
+
+	m, err := Parse([]byte(doc))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := Map{
+		"fuse": Map{"dir": "/litefs"},
+		"data": Map{"dir": "/var/lib/litefs"},
+		"exec": []any{
+			Map{"cmd": "app -addr :8081", "if-candidate": "true"},
+			Map{"cmd": "run migrations\n"},
+		},
+		"proxy": Map{
+			"addr":           ":8080",
+			"target":         "localhost:8081",
+			"passthrough":    []any{"*.ico", "*.png"},
+			"always-forward": []any{"/admin", "/jobs # not a comment"},
+		},
+		"lease": Map{
+			"type":      "consul",
+			"candidate": "${FLY_REGION}",
+			"consul":    nil,
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("wrong result:\n%#v", m)
+	}
+
+	if s := m.Map("proxy").Strings("passthrough"); !reflect.DeepEqual(s, []string{"*.ico", "*.png"}) {
+		t.Fatalf("wrong strings: %v", s)
+	}
+	if s := m.Map("missing").String("addr"); s != "" {
+		t.Fatalf("unexpected value: %q", s)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, doc := range []string{
+		"- a\n- b\n",
+		"a: b\n    c: d\n",
+		"a:\n\tb: c\n",
+		"a: [b, c\n",
+		"a: \"b\n",
+	} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("expected error for %q", doc)
+		}
+	}
+}
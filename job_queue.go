@@ -0,0 +1,235 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+// JobsTable is the table JobQueue stores its jobs in.
+const JobsTable = "_litefs_jobs"
+
+// DefaultJobPollInterval is how often Work checks for jobs in the absence of
+// tx events if PollInterval isn't set.
+const DefaultJobPollInterval = time.Second
+
+// ErrJobClaimLost is returned when completing or failing a job whose claim
+// expired and was taken by another worker.
+var ErrJobClaimLost = errors.New("job claim lost")
+
+// Job is a unit of work stored in a JobQueue.
+type Job struct {
+	ID       int64
+	Queue    string
+	Payload  []byte
+	Attempts int
+
+	// claim is the locked_until the job was dequeued with, which identifies
+	// the worker's claim.
+	claim int64
+}
+
+// JobQueue is a durable job queue stored in a LiteFS database. Jobs can be
+// enqueued from any node since writes are made while holding the HALT lock.
+// Workers, usually running on the primary or on designated nodes, dequeue jobs
+// with a visibility timeout; jobs that aren't completed in time are handed to
+// another worker and failed jobs are retried with exponential backoff.
+type JobQueue struct {
+	DB *sql.DB
+
+	// DatabasePath is the path of DB's file in the LiteFS mount. It is used
+	// to acquire the HALT lock and to match tx events while waiting for jobs.
+	DatabasePath string
+
+	// Visibility is how long a dequeued job is hidden from other workers.
+	Visibility time.Duration
+
+	// MaxAttempts is how many times a job is attempted before it is left in
+	// the table as dead.
+	MaxAttempts int
+
+	// RetryDelay is the delay before the first retry of a failed job. It
+	// doubles with every attempt, up to MaxRetryDelay if it is set.
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+
+	// PollInterval is how often Work checks for jobs in the absence of tx
+	// events, e.g. for retries becoming due. It defaults to
+	// DefaultJobPollInterval.
+	PollInterval time.Duration
+}
+
+// NewJobQueue returns a new *JobQueue with default settings.
+func NewJobQueue(db *sql.DB, databasePath string) *JobQueue {
+	return &JobQueue{
+		DB:            db,
+		DatabasePath:  databasePath,
+		Visibility:    time.Minute,
+		MaxAttempts:   5,
+		RetryDelay:    time.Second,
+		MaxRetryDelay: time.Hour,
+		PollInterval:  DefaultJobPollInterval,
+	}
+}
+
+// Init creates the jobs table if it doesn't exist.
+func (q *JobQueue) Init(ctx context.Context) error {
+	return WithHaltContext(ctx, q.DatabasePath, func() error {
+		_, err := q.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+JobsTable+` (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue TEXT NOT NULL,
+	payload BLOB,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	run_at INTEGER NOT NULL,
+	locked_until INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT
+)`)
+		return err
+	})
+}
+
+// Enqueue adds a job with payload to queue and returns its ID.
+func (q *JobQueue) Enqueue(ctx context.Context, queue string, payload []byte) (id int64, err error) {
+	err = WithHaltContext(ctx, q.DatabasePath, func() error {
+		result, err := q.DB.ExecContext(ctx, `INSERT INTO `+JobsTable+` (queue, payload, run_at) VALUES (?, ?, ?)`,
+			queue, payload, time.Now().UnixNano(),
+		)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	return id, err
+}
+
+// Dequeue claims the oldest runnable job in queue for the visibility timeout.
+// A nil job is returned if none are runnable.
+func (q *JobQueue) Dequeue(ctx context.Context, queue string) (job *Job, err error) {
+	err = WithHaltContext(ctx, q.DatabasePath, func() error {
+		tx, err := q.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		now := time.Now()
+		j := Job{Queue: queue}
+		if err := tx.QueryRowContext(ctx, `SELECT id, payload, attempts FROM `+JobsTable+`
+WHERE queue = ? AND run_at <= ? AND locked_until <= ? AND attempts < ?
+ORDER BY id LIMIT 1`,
+			queue, now.UnixNano(), now.UnixNano(), q.MaxAttempts,
+		).Scan(&j.ID, &j.Payload, &j.Attempts); errors.Is(err, sql.ErrNoRows) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		j.Attempts++
+		j.claim = now.Add(q.Visibility).UnixNano()
+		if _, err := tx.ExecContext(ctx, `UPDATE `+JobsTable+` SET attempts = ?, locked_until = ? WHERE id = ?`,
+			j.Attempts, j.claim, j.ID,
+		); err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		job = &j
+		return nil
+	})
+	return job, err
+}
+
+// Complete removes a finished job from the queue. ErrJobClaimLost is returned
+// if another worker has claimed the job since it was dequeued.
+func (q *JobQueue) Complete(ctx context.Context, job *Job) error {
+	return q.update(ctx, `DELETE FROM `+JobsTable+` WHERE id = ? AND locked_until = ?`, job.ID, job.claim)
+}
+
+// Fail records jobErr against a job and schedules it to be retried. Jobs that
+// have reached MaxAttempts are not retried. ErrJobClaimLost is returned if
+// another worker has claimed the job since it was dequeued.
+func (q *JobQueue) Fail(ctx context.Context, job *Job, jobErr error) error {
+	delay := Backoff{Min: q.RetryDelay, Max: q.MaxRetryDelay, Multiplier: 2}.Delay(job.Attempts)
+	runAt := time.Now().Add(delay)
+	return q.update(ctx, `UPDATE `+JobsTable+` SET last_error = ?, run_at = ?, locked_until = 0 WHERE id = ? AND locked_until = ?`,
+		jobErr.Error(), runAt.UnixNano(), job.ID, job.claim,
+	)
+}
+
+// update executes query on a claimed job under the HALT lock, returning
+// ErrJobClaimLost if it affects no rows.
+func (q *JobQueue) update(ctx context.Context, query string, args ...any) error {
+	return WithHaltContext(ctx, q.DatabasePath, func() error {
+		result, err := q.DB.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrJobClaimLost
+		}
+		return nil
+	})
+}
+
+// Work runs fn for each job in queue until ctx is done. Completed jobs are
+// removed and jobs for which fn returns an error are failed. Jobs whose claim
+// was lost to another worker are left to it. When the queue is
+// empty, Work waits for a tx event on the database or PollInterval to elapse.
+func (q *JobQueue) Work(ctx context.Context, queue string, fn func(context.Context, *Job) error) error {
+	es := NewEventSource()
+	defer es.Close()
+
+	db := filepath.Base(q.DatabasePath)
+	interval := q.PollInterval
+	if interval <= 0 {
+		interval = DefaultJobPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		job, err := q.Dequeue(ctx, queue)
+		if err != nil {
+			return err
+		}
+
+		if job != nil {
+			if err := fn(ctx, job); err != nil {
+				err = q.Fail(ctx, job, err)
+			} else {
+				err = q.Complete(ctx, job)
+			}
+			if err != nil && !errors.Is(err, ErrJobClaimLost) {
+				return err
+			}
+			continue
+		}
+
+	wait:
+		for {
+			select {
+			case event, running := <-es.C():
+				if !running {
+					return ErrSubscriptionClosed
+				}
+				if event.Type == EventTypeTx && event.DB == db {
+					break wait
+				}
+			case err, running := <-es.ErrC():
+				if err := sourceError(err, running); err != nil {
+					return err
+				}
+			case <-ticker.C:
+				break wait
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobQueue(t *testing.T) {
+	db, jobs := openJobsDB(t)
+	q := NewJobQueue(db, lockedDB(t, false))
+	q.RetryDelay = 20 * time.Millisecond
+	ctx := context.Background()
+
+	if err := q.Init(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	id, err := q.Enqueue(ctx, "emails", []byte("hello"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	job, err := q.Dequeue(ctx, "emails")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if job == nil || job.ID != id || string(job.Payload) != "hello" || job.Attempts != 1 {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	// the job is hidden from other workers until it is failed or completed.
+	if job, err := q.Dequeue(ctx, "emails"); err != nil || job != nil {
+		t.Fatalf("unexpected result: %+v, %v", job, err)
+	}
+
+	if err := q.Fail(ctx, job, errors.New("boom")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if job, err := q.Dequeue(ctx, "emails"); err != nil || job != nil {
+		t.Fatalf("expected retry to be delayed, got %+v, %v", job, err)
+	}
+	time.Sleep(q.RetryDelay)
+	if job, err = q.Dequeue(ctx, "emails"); err != nil || job == nil || job.Attempts != 2 {
+		t.Fatalf("unexpected result: %+v, %v", job, err)
+	}
+
+	if err := q.Complete(ctx, job); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("expected no jobs, got %v", jobs)
+	}
+}
+
+func TestJobQueueClaimLost(t *testing.T) {
+	db, jobs := openJobsDB(t)
+	q := NewJobQueue(db, lockedDB(t, false))
+	q.Visibility = 10 * time.Millisecond
+	ctx := context.Background()
+
+	if _, err := q.Enqueue(ctx, "emails", nil); err != nil {
+		t.Fatal(err)
+	}
+	slow, err := q.Dequeue(ctx, "emails")
+	if err != nil || slow == nil {
+		t.Fatalf("unexpected result: %+v, %v", slow, err)
+	}
+
+	// a worker running past the visibility timeout loses the job to another.
+	time.Sleep(q.Visibility)
+	job, err := q.Dequeue(ctx, "emails")
+	if err != nil || job == nil || job.ID != slow.ID {
+		t.Fatalf("unexpected result: %+v, %v", job, err)
+	}
+	if err := q.Complete(ctx, slow); !errors.Is(err, ErrJobClaimLost) {
+		t.Fatalf("expected ErrJobClaimLost, got %v", err)
+	}
+	if err := q.Fail(ctx, slow, errors.New("boom")); !errors.Is(err, ErrJobClaimLost) {
+		t.Fatalf("expected ErrJobClaimLost, got %v", err)
+	}
+
+	if err := q.Complete(ctx, job); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(jobs) != 0 {
+		t.Fatalf("expected no jobs, got %v", jobs)
+	}
+}
+
+func TestJobQueueFailDelay(t *testing.T) {
+	db, jobs := openJobsDB(t)
+	q := NewJobQueue(db, lockedDB(t, false))
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{0, q.RetryDelay},
+		{1, q.RetryDelay},
+		{3, 4 * q.RetryDelay},
+		{100, q.MaxRetryDelay},
+	} {
+		id, err := q.Enqueue(ctx, "emails", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		if err := q.Fail(ctx, &Job{ID: id, Attempts: tt.attempts}, errors.New("boom")); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if delay := time.Unix(0, jobs[id].runAt).Sub(start); delay < tt.delay || delay > tt.delay+time.Second {
+			t.Fatalf("attempt %d: expected a delay of %s, got %s", tt.attempts, tt.delay, delay)
+		}
+	}
+}
+
+func TestJobQueueWork(t *testing.T) {
+	src := newFakeSource()
+	useEventSource(t, func(...SubscribeOption) EventSource { return src })
+
+	db, _ := openJobsDB(t)
+	q := NewJobQueue(db, lockedDB(t, false))
+	q.PollInterval = 0 // uses DefaultJobPollInterval.
+	ctx := context.Background()
+
+	if _, err := q.Enqueue(ctx, "emails", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	worked := make(chan *Job, 2)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- q.Work(ctx, "emails", func(ctx context.Context, job *Job) error {
+			worked <- job
+			return nil
+		})
+	}()
+	if job := <-worked; string(job.Payload) != "hello" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	// jobs enqueued elsewhere are picked up on their tx event.
+	if _, err := q.Enqueue(ctx, "emails", []byte("again")); err != nil {
+		t.Fatal(err)
+	}
+	src.c <- &Event{Type: EventTypeTx, DB: "db"}
+	if job := <-worked; string(job.Payload) != "again" {
+		t.Fatalf("unexpected job: %+v", job)
+	}
+
+	src.Close()
+	if err := <-errc; !errors.Is(err, ErrSubscriptionClosed) {
+		t.Fatalf("expected ErrSubscriptionClosed, got %v", err)
+	}
+}
+
+type stubJob struct {
+	queue       string
+	payload     []byte
+	attempts    int64
+	runAt       int64
+	lockedUntil int64
+}
+
+// openJobsDB returns a stub database holding a JobsTable, and its jobs by ID.
+func openJobsDB(t *testing.T) (*sql.DB, map[int64]*stubJob) {
+	jobs := make(map[int64]*stubJob)
+	var nextID int64
+
+	db := openStubDB(t, func(query string, args []any) (stubResult, error) {
+		switch {
+		case strings.HasPrefix(query, "INSERT"):
+			nextID++
+			payload, _ := args[1].([]byte)
+			jobs[nextID] = &stubJob{queue: args[0].(string), payload: payload, runAt: args[2].(int64)}
+			return stubResult{affected: 1, lastID: nextID}, nil
+		case strings.HasPrefix(query, "SELECT"):
+			result := stubResult{cols: []string{"id", "payload", "attempts"}}
+			var id int64
+			for jobID, job := range jobs {
+				if job.queue == args[0].(string) && job.runAt <= args[1].(int64) && job.lockedUntil <= args[2].(int64) &&
+					job.attempts < args[3].(int64) && (id == 0 || jobID < id) {
+					id = jobID
+				}
+			}
+			if job := jobs[id]; job != nil {
+				result.rows = [][]driver.Value{{id, job.payload, job.attempts}}
+			}
+			return result, nil
+		case strings.Contains(query, "SET attempts"):
+			job := jobs[args[2].(int64)]
+			job.attempts, job.lockedUntil = args[0].(int64), args[1].(int64)
+		case strings.Contains(query, "SET last_error"):
+			job := jobs[args[2].(int64)]
+			if job == nil || job.lockedUntil != args[3].(int64) {
+				return stubResult{}, nil
+			}
+			job.runAt, job.lockedUntil = args[1].(int64), 0
+		case strings.HasPrefix(query, "DELETE"):
+			if job := jobs[args[0].(int64)]; job == nil || job.lockedUntil != args[1].(int64) {
+				return stubResult{}, nil
+			}
+			delete(jobs, args[0].(int64))
+		}
+		return stubResult{affected: 1}, nil
+	})
+	return db, jobs
+}
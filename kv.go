@@ -0,0 +1,127 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+// DefaultKVTable is the table KV uses if none is set.
+const DefaultKVTable = "_litefs_kv"
+
+var (
+	ErrNotFound = errors.New("not found")
+)
+
+// KV is a key-value store on top of a table in a LiteFS database. Writes are
+// made while holding the HALT lock so they can be issued from any node, and
+// reads honor a Consistency level. It is suited to small, shared data such as
+// feature flags and application config.
+type KV struct {
+	DB *sql.DB
+
+	// DatabasePath is the path of DB's file in the LiteFS mount.
+	DatabasePath string
+
+	// Table is the name of the table values are stored in. It defaults to
+	// DefaultKVTable.
+	Table string
+
+	// Tracker reports when the database was last known to be up to date for
+	// BoundedStaleness reads. If nil, such reads always take the HALT lock.
+	Tracker *ConsistencyTracker
+}
+
+// Init creates the KV table if it doesn't exist.
+func (kv *KV) Init(ctx context.Context) error {
+	return WithHaltContext(ctx, kv.DatabasePath, func() error {
+		_, err := kv.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+kv.table()+` (
+	key TEXT PRIMARY KEY,
+	value BLOB NOT NULL,
+	updated_at INTEGER NOT NULL
+)`)
+		return err
+	})
+}
+
+// Get returns the value stored under key with the consistency level c merged
+// with any level in ctx (see WithConsistency). ErrNotFound is returned if the
+// key doesn't exist.
+func (kv *KV) Get(ctx context.Context, key string, c Consistency) (value []byte, err error) {
+	read := func() error {
+		err := kv.DB.QueryRowContext(ctx, `SELECT value FROM `+kv.table()+` WHERE key = ?`, key).Scan(&value)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return value, ConsistencyFromContext(ctx).Merge(c).Read(ctx, kv.DatabasePath, kv.Tracker, read)
+}
+
+// All returns every key and value from the local copy of the database.
+func (kv *KV) All(ctx context.Context) (map[string][]byte, error) {
+	rows, err := kv.DB.QueryContext(ctx, `SELECT key, value FROM `+kv.table())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	m := make(map[string][]byte)
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, rows.Err()
+}
+
+// Put stores value under key. The returned token can be passed to
+// ReadYourWrites so that later reads observe the write.
+func (kv *KV) Put(ctx context.Context, key string, value []byte) (ConsistencyToken, error) {
+	return kv.write(ctx, `INSERT INTO `+kv.table()+` (key, value, updated_at) VALUES (?, ?, ?)
+ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at`,
+		key, value, time.Now().UnixNano(),
+	)
+}
+
+// Delete removes key. The returned token can be passed to ReadYourWrites so
+// that later reads observe the delete.
+func (kv *KV) Delete(ctx context.Context, key string) (ConsistencyToken, error) {
+	return kv.write(ctx, `DELETE FROM `+kv.table()+` WHERE key = ?`, key)
+}
+
+func (kv *KV) write(ctx context.Context, query string, args ...any) (token ConsistencyToken, err error) {
+	err = WithHaltContext(ctx, kv.DatabasePath, func() error {
+		if _, err := kv.DB.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+
+		pos, err := ReadPos(kv.DatabasePath)
+		if err != nil {
+			return err
+		}
+		token = ConsistencyToken{kv.name(): pos}
+		if kv.Tracker != nil {
+			kv.Tracker.Observe(kv.name(), pos)
+		}
+		return nil
+	})
+	return token, err
+}
+
+func (kv *KV) table() string {
+	if kv.Table != "" {
+		return quoteIdent(kv.Table)
+	}
+	return DefaultKVTable
+}
+
+func (kv *KV) name() string {
+	return filepath.Base(kv.DatabasePath)
+}
@@ -0,0 +1,133 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKV(t *testing.T) {
+	useEventSource(t, func(...SubscribeOption) EventSource { return newFakeSource() })
+
+	path := lockedDB(t, false)
+	writePosFile(t, path, "0000000000000002/0000000000000000")
+	kv := &KV{DB: openKVDB(t), DatabasePath: path}
+	ctx := context.Background()
+
+	if err := kv.Init(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	token, err := kv.Put(ctx, "greeting", []byte("hello"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if token["db"].TXID != 2 {
+		t.Fatalf("unexpected token: %s", token)
+	}
+
+	for _, c := range []Consistency{Eventual(), Strong(), BoundedStaleness(time.Second), ReadYourWrites(token)} {
+		if value, err := kv.Get(ctx, "greeting", c); err != nil || string(value) != "hello" {
+			t.Fatalf("%s: unexpected result: %q, %v", c, value, err)
+		}
+	}
+
+	if all, err := kv.All(ctx); err != nil || len(all) != 1 || string(all["greeting"]) != "hello" {
+		t.Fatalf("unexpected result: %q, %v", all, err)
+	}
+
+	if _, err := kv.Delete(ctx, "greeting"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := kv.Get(ctx, "greeting", Eventual()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestKVConsistency(t *testing.T) {
+	useEventSource(t, func(...SubscribeOption) EventSource { return newFakeSource() })
+
+	path := lockedDB(t, false)
+	writePosFile(t, path, "0000000000000002/0000000000000000")
+	kv := &KV{DB: openKVDB(t), DatabasePath: path}
+	if _, err := kv.Put(context.Background(), "greeting", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	// another node holds the HALT lock, so reads that need it can't be made.
+	holder, err := os.OpenFile(LockPath(path), os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer holder.Close()
+	if err := Halt(holder); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(ctx context.Context, c Consistency) error {
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		_, err := kv.Get(ctx, "greeting", c)
+		return err
+	}
+
+	for _, tt := range []struct {
+		c       Consistency
+		blocked bool
+	}{
+		{Eventual(), false},
+		{Strong(), true},
+		{BoundedStaleness(time.Second), true}, // without a tracker, staleness is unknown.
+		{ReadYourWrites(ConsistencyToken{"db": {TXID: 2}}), false},
+		{ReadYourWrites(ConsistencyToken{"db": {TXID: 3}}), true},
+		{ReadYourWrites(ConsistencyToken{"other": {TXID: 3}}), false},
+	} {
+		if err := get(context.Background(), tt.c); tt.blocked != errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("%s: expected blocked=%v, got %v", tt.c, tt.blocked, err)
+		}
+	}
+
+	// a tracker that has just seen a tx event for the database avoids the
+	// HALT lock for bounded staleness reads.
+	kv.Tracker = NewConsistencyTracker(t.TempDir())
+	t.Cleanup(kv.Tracker.Close)
+	kv.Tracker.observeApplied("db", Pos{TXID: 2})
+	if err := get(context.Background(), BoundedStaleness(time.Second)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the level in the context is merged with the one given.
+	if err := get(WithConsistency(context.Background(), Strong()), Eventual()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+}
+
+// openKVDB returns a stub database holding the DefaultKVTable.
+func openKVDB(t *testing.T) *sql.DB {
+	values := make(map[string][]byte)
+
+	return openStubDB(t, func(query string, args []any) (stubResult, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT key, value"):
+			result := stubResult{cols: []string{"key", "value"}}
+			for _, key := range sortedKeys(values) {
+				result.rows = append(result.rows, []driver.Value{key, values[key]})
+			}
+			return result, nil
+		case strings.HasPrefix(query, "SELECT value"):
+			result := stubResult{cols: []string{"value"}}
+			if value, ok := values[args[0].(string)]; ok {
+				result.rows = [][]driver.Value{{value}}
+			}
+			return result, nil
+		case strings.HasPrefix(query, "INSERT"):
+			values[args[0].(string)] = args[1].([]byte)
+		case strings.HasPrefix(query, "DELETE"):
+			delete(values, args[0].(string))
+		}
+		return stubResult{affected: 1}, nil
+	})
+}
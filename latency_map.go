@@ -0,0 +1,268 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+)
+
+// LatencyTable is the table LatencyMap publishes measurements to.
+const LatencyTable = "_litefs_latency"
+
+// LatencyMap shares the replication latencies measured by each node's Prober
+// across the cluster, so that any node can report who lags whom and by how
+// much. Each node periodically publishes the latency of probes from every
+// writer to a replicated table. Run it alongside a Prober on every node.
+//
+// Measurements are cumulative since each node's Prober started. With Prober's
+// default settings only the primary writes probes, so the map shows the lag of
+// each replica behind the current primary; set Prober.Forward to measure every
+// pair of nodes.
+//
+// The exported fields configure the map and must be set before it is used.
+type LatencyMap struct {
+	DB *sql.DB
+
+	// DatabasePath is the path of DB's file in the LiteFS mount.
+	DatabasePath string
+
+	// Hostname identifies this node's measurements. It should match the
+	// Prober hostnames of the other nodes.
+	Hostname string
+
+	// Region is the region of this node.
+	Region string
+
+	// Prober supplies this node's measurements.
+	Prober *Prober
+
+	// Registry, if set, supplies the regions of nodes that don't publish
+	// measurements, such as a primary that doesn't read any probes.
+	Registry *NodeRegistry
+
+	// Interval is how often Run publishes measurements.
+	Interval time.Duration
+
+	// TTL is how long after they were published measurements are reported.
+	TTL time.Duration
+
+	// OnError, if set, is called with errors publishing measurements.
+	// Publishing continues after an error.
+	OnError func(error)
+}
+
+// NewLatencyMap returns a new *LatencyMap that publishes the measurements of
+// prober every 30 seconds and reports them for 2 minutes.
+func NewLatencyMap(db *sql.DB, databasePath, hostname, region string, prober *Prober) *LatencyMap {
+	return &LatencyMap{
+		DB:           db,
+		DatabasePath: databasePath,
+		Hostname:     hostname,
+		Region:       region,
+		Prober:       prober,
+		Interval:     30 * time.Second,
+		TTL:          2 * time.Minute,
+	}
+}
+
+// Init creates the latency table if it doesn't exist.
+func (lm *LatencyMap) Init(ctx context.Context) error {
+	return WithHaltContext(ctx, lm.DatabasePath, func() error {
+		_, err := lm.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+LatencyTable+` (
+	writer TEXT NOT NULL,
+	reader TEXT NOT NULL,
+	reader_region TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	mean INTEGER NOT NULL,
+	p50 INTEGER NOT NULL,
+	p99 INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL,
+	PRIMARY KEY (writer, reader)
+)`)
+		return err
+	})
+}
+
+// Run publishes measurements every Interval until ctx is done.
+func (lm *LatencyMap) Run(ctx context.Context) error {
+	ticker := time.NewTicker(lm.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := lm.Publish(ctx); err != nil && lm.OnError != nil {
+				lm.OnError(err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Publish writes this node's current measurements.
+func (lm *LatencyMap) Publish(ctx context.Context) error {
+	from := lm.Prober.ReplicationFrom()
+	if len(from) == 0 {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	return WithHaltContext(ctx, lm.DatabasePath, func() error {
+		tx, err := lm.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		for _, writer := range sortedKeys(from) {
+			s := from[writer]
+			if _, err := tx.ExecContext(ctx, `INSERT INTO `+LatencyTable+` (writer, reader, reader_region, count, mean, p50, p99, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (writer, reader) DO UPDATE SET
+	reader_region = excluded.reader_region,
+	count = excluded.count,
+	mean = excluded.mean,
+	p50 = excluded.p50,
+	p99 = excluded.p99,
+	updated_at = excluded.updated_at`,
+				writer, lm.Hostname, lm.Region, int64(s.Count), int64(s.Mean()), int64(s.Quantile(0.5)), int64(s.Quantile(0.99)), now,
+			); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// Snapshot returns the measurements published within TTL by every node, read
+// from the local copy of the database.
+func (lm *LatencyMap) Snapshot(ctx context.Context) (*LatencySnapshot, error) {
+	rows, err := lm.DB.QueryContext(ctx, `SELECT writer, reader, reader_region, count, mean, p50, p99, updated_at FROM `+LatencyTable+`
+WHERE updated_at > ? ORDER BY writer, reader`,
+		time.Now().Add(-lm.TTL).UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	regions := map[string]string{lm.Hostname: lm.Region}
+	var entries []LatencyEntry
+	for rows.Next() {
+		var e LatencyEntry
+		var count, mean, p50, p99, updatedAt int64
+		if err := rows.Scan(&e.Writer, &e.Reader, &e.ReaderRegion, &count, &mean, &p50, &p99, &updatedAt); err != nil {
+			return nil, err
+		}
+		e.Count = uint64(count)
+		e.Mean, e.P50, e.P99 = time.Duration(mean), time.Duration(p50), time.Duration(p99)
+		e.UpdatedAt = time.Unix(0, updatedAt)
+
+		regions[e.Reader] = e.ReaderRegion
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if lm.Registry != nil {
+		nodes, err := lm.Registry.Nodes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range nodes {
+			if _, ok := regions[node.ID]; !ok {
+				regions[node.ID] = node.Region
+			}
+		}
+	}
+
+	for i := range entries {
+		entries[i].WriterRegion = regions[entries[i].Writer]
+	}
+	return &LatencySnapshot{Entries: entries}, nil
+}
+
+// LatencySnapshot is the cluster's replication latency at a point in time.
+type LatencySnapshot struct {
+	// Entries are the latencies of each pair of nodes, ordered by writer and
+	// then reader.
+	Entries []LatencyEntry `json:"entries"`
+}
+
+// LatencyEntry is how long writes on one node take to be applied on another.
+// P50 and P99 are the upper bounds of the histogram buckets containing them.
+type LatencyEntry struct {
+	Writer       string        `json:"writer"`
+	WriterRegion string        `json:"writerRegion,omitempty"`
+	Reader       string        `json:"reader"`
+	ReaderRegion string        `json:"readerRegion,omitempty"`
+	Count        uint64        `json:"count"`
+	Mean         time.Duration `json:"mean"`
+	P50          time.Duration `json:"p50"`
+	P99          time.Duration `json:"p99"`
+	UpdatedAt    time.Time     `json:"updatedAt"`
+}
+
+// Region returns the region of the node with hostname, or an empty string if
+// the node doesn't appear in the snapshot.
+func (s *LatencySnapshot) Region(hostname string) string {
+	for _, e := range s.Entries {
+		if e.Writer == hostname && e.WriterRegion != "" {
+			return e.WriterRegion
+		} else if e.Reader == hostname && e.ReaderRegion != "" {
+			return e.ReaderRegion
+		}
+	}
+	return ""
+}
+
+// RegionLatency is how long writes in one region take to be applied in
+// another, aggregated over the nodes in both.
+type RegionLatency struct {
+	From  string        `json:"from"`
+	To    string        `json:"to"`
+	Count uint64        `json:"count"`
+	Mean  time.Duration `json:"mean"`
+
+	// P99 is the largest P99 of the aggregated nodes.
+	P99 time.Duration `json:"p99"`
+}
+
+// Regions returns the latencies between each pair of regions, ordered by the
+// writing and then the reading region.
+func (s *LatencySnapshot) Regions() []RegionLatency {
+	type key struct{ from, to string }
+	byKey := make(map[key]*RegionLatency)
+	sums := make(map[key]time.Duration)
+	for _, e := range s.Entries {
+		k := key{e.WriterRegion, e.ReaderRegion}
+		r, ok := byKey[k]
+		if !ok {
+			r = &RegionLatency{From: k.from, To: k.to}
+			byKey[k] = r
+		}
+		r.Count += e.Count
+		sums[k] += e.Mean * time.Duration(e.Count)
+		if e.P99 > r.P99 {
+			r.P99 = e.P99
+		}
+	}
+
+	regions := make([]RegionLatency, 0, len(byKey))
+	for k, r := range byKey {
+		if r.Count > 0 {
+			r.Mean = sums[k] / time.Duration(r.Count)
+		}
+		regions = append(regions, *r)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		if regions[i].From != regions[j].From {
+			return regions[i].From < regions[j].From
+		}
+		return regions[i].To < regions[j].To
+	})
+	return regions
+}
@@ -0,0 +1,25 @@
+package litefs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLatencySnapshotRegions(t *testing.T) {
+	s := &LatencySnapshot{Entries: []LatencyEntry{
+		{Writer: "node-1", WriterRegion: "ord", Reader: "node-2", ReaderRegion: "ams", Count: 1, Mean: 100 * time.Millisecond, P99: 250 * time.Millisecond},
+		{Writer: "node-1", WriterRegion: "ord", Reader: "node-3", ReaderRegion: "ams", Count: 3, Mean: 80 * time.Millisecond, P99: 100 * time.Millisecond},
+		{Writer: "node-1", WriterRegion: "ord", Reader: "node-4", ReaderRegion: "ord", Count: 2, Mean: 5 * time.Millisecond, P99: 10 * time.Millisecond},
+		{Writer: "node-2", WriterRegion: "ams", Reader: "node-1", ReaderRegion: "ord", Count: 0},
+	}}
+
+	expected := []RegionLatency{
+		{From: "ams", To: "ord"},
+		{From: "ord", To: "ams", Count: 4, Mean: 85 * time.Millisecond, P99: 250 * time.Millisecond},
+		{From: "ord", To: "ord", Count: 2, Mean: 5 * time.Millisecond, P99: 10 * time.Millisecond},
+	}
+	if regions := s.Regions(); !reflect.DeepEqual(regions, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, regions)
+	}
+}
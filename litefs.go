@@ -1,8 +1,16 @@
 package litefs
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"syscall"
+	"time"
+)
+
+var (
+	ErrHaltContended = errors.New("HALT lock held by another node")
 )
 
 // Open file description lock constants.
@@ -54,6 +62,66 @@ func Unhalt(f *os.File) error {
 	}
 }
 
+// haltPollBackoff paces HaltContext's attempts to take the HALT lock while
+// another node holds it.
+var haltPollBackoff = Backoff{Min: time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 2, Jitter: 0.2}
+
+// HaltContext is like Halt, but gives up once ctx is done. Rather than block in
+// the kernel, which can't be interrupted, it polls for the lock until it is
+// free, so f isn't in use once HaltContext returns.
+func HaltContext(ctx context.Context, f *os.File) error {
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := tryHalt(f); !errors.Is(err, ErrHaltContended) {
+			return err
+		}
+		if err := sleepContext(ctx, haltPollBackoff.Delay(attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for d or until ctx is done, returning ctx's error in the
+// latter case. The wait ends early at ctx's deadline, so that a retry after it
+// can't run past the caller's budget.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		d = min(d, time.Until(deadline))
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return ctx.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tryHalt is like Halt, but returns ErrHaltContended rather than waiting if
+// the lock is held elsewhere.
+func tryHalt(f *os.File) error {
+	for {
+		err := syscall.FcntlFlock(f.Fd(), F_OFD_SETLK, &syscall.Flock_t{
+			Type:  syscall.F_WRLCK,
+			Start: HaltByte,
+			Len:   1,
+		})
+		switch err {
+		case syscall.EINTR:
+			continue
+		case syscall.EAGAIN, syscall.EACCES:
+			return ErrHaltContended
+		default:
+			return err
+		}
+	}
+}
+
 // WithHalt executes fn with a HALT lock. This allows any node to perform writes
 // on the database file. If this is a replica node, it will forward those writes
 // back to the primary node. If this is the primary node, it will simply execute
@@ -66,7 +134,7 @@ func Unhalt(f *os.File) error {
 // This function should only be used for periodic migrations or low-write
 // scenarios.
 func WithHalt(databasePath string, fn func() error) error {
-	f, err := os.OpenFile(databasePath+"-lock", os.O_RDWR, 0666)
+	f, err := os.OpenFile(LockPath(databasePath), os.O_RDWR, 0666)
 	if err != nil {
 		return err
 	}
@@ -82,3 +150,56 @@ func WithHalt(databasePath string, fn func() error) error {
 
 	return Unhalt(f)
 }
+
+// WithHaltContext is like WithHalt, but gives up waiting for the HALT lock
+// once ctx is done, so that a request's deadline bounds the whole write.
+func WithHaltContext(ctx context.Context, databasePath string, fn func() error) error {
+	f, err := os.OpenFile(LockPath(databasePath), os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	if err := HaltContext(ctx, f); err != nil {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	return Unhalt(f)
+}
+
+// WithHaltRetry is like WithHalt, but rather than waiting in line for the
+// HALT lock while another node holds it, it retries with the delays of b,
+// which suits bursty writes from many replicas. It gives up once ctx is done
+// or, if b.MaxRetries is set, with ErrHaltContended after that many retries.
+func WithHaltRetry(ctx context.Context, databasePath string, b Backoff, fn func() error) error {
+	f, err := os.OpenFile(LockPath(databasePath), os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	for attempt := 1; ; attempt++ {
+		err := tryHalt(f)
+		if err == nil {
+			break
+		} else if !errors.Is(err, ErrHaltContended) {
+			return err
+		} else if b.MaxRetries > 0 && attempt > b.MaxRetries {
+			return fmt.Errorf("%w after %d attempts", err, attempt)
+		}
+
+		if err := sleepContext(ctx, b.Delay(attempt)); err != nil {
+			return err
+		}
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	return Unhalt(f)
+}
@@ -0,0 +1,193 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithHaltContext(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		path := lockedDB(t, false)
+
+		var called bool
+		if err := WithHaltContext(context.Background(), path, func() error { called = true; return nil }); err != nil || !called {
+			t.Fatalf("unexpected result: %v, %v", called, err)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		path := lockedDB(t, true)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		err := WithHaltContext(ctx, path, func() error {
+			t.Fatal("ran without the lock")
+			return nil
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+		assertWithinDeadline(t, start, 20*time.Millisecond)
+	})
+
+	t.Run("released", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "db")
+		holder, err := os.Create(LockPath(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer holder.Close()
+		if err := Halt(holder); err != nil {
+			t.Fatal(err)
+		}
+		time.AfterFunc(10*time.Millisecond, func() { _ = Unhalt(holder) })
+
+		var called bool
+		if err := WithHaltContext(context.Background(), path, func() error { called = true; return nil }); err != nil || !called {
+			t.Fatalf("unexpected result: %v, %v", called, err)
+		}
+	})
+
+	t.Run("not acquired after deadline", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "db")
+		holder, err := os.Create(LockPath(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer holder.Close()
+		if err := Halt(holder); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := os.OpenFile(LockPath(path), os.O_RDWR, 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if err := HaltContext(ctx, f); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+
+		// nothing is left waiting on f to take the lock once it is released.
+		if err := Unhalt(holder); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		if err := tryHalt(holder); err != nil {
+			t.Fatalf("expected the lock to be free, got %v", err)
+		}
+	})
+
+	t.Run("strong read", func(t *testing.T) {
+		path := lockedDB(t, true)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if err := Strong().Read(ctx, path, nil, func() error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+		assertWithinDeadline(t, start, 20*time.Millisecond)
+	})
+
+	t.Run("admission", func(t *testing.T) {
+		path := lockedDB(t, true)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		ac := &AdmissionController{}
+		if err := ac.WithHalt(ctx, path, func() error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+		assertWithinDeadline(t, start, 20*time.Millisecond)
+	})
+}
+
+func TestWithHaltRetry(t *testing.T) {
+	b := Backoff{Min: time.Millisecond, Max: 2 * time.Millisecond, Multiplier: 2}
+
+	t.Run("contended", func(t *testing.T) {
+		path := lockedDB(t, true)
+
+		b := b
+		b.MaxRetries = 3
+		err := WithHaltRetry(context.Background(), path, b, func() error {
+			t.Fatal("ran without the lock")
+			return nil
+		})
+		if !errors.Is(err, ErrHaltContended) {
+			t.Fatalf("expected ErrHaltContended, got %v", err)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		path := lockedDB(t, true)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if err := WithHaltRetry(ctx, path, b, func() error { return nil }); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+		assertWithinDeadline(t, start, 20*time.Millisecond)
+	})
+
+	t.Run("released", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "db")
+		f, err := os.Create(LockPath(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := Halt(f); err != nil {
+			t.Fatal(err)
+		}
+		time.AfterFunc(10*time.Millisecond, func() { _ = Unhalt(f) })
+
+		var called bool
+		if err := WithHaltRetry(context.Background(), path, b, func() error { called = true; return nil }); err != nil || !called {
+			t.Fatalf("unexpected result: %v, %v", called, err)
+		}
+	})
+}
+
+// lockedDB returns the path of a database whose lock file exists and, if held
+// is true, whose HALT lock is held by another file description.
+func lockedDB(t *testing.T, held bool) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "db")
+	f, err := os.Create(LockPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	if held {
+		if err := Halt(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+func assertWithinDeadline(t *testing.T, start time.Time, timeout time.Duration) {
+	t.Helper()
+
+	if elapsed := time.Since(start); elapsed > timeout+50*time.Millisecond {
+		t.Fatalf("returned %s after a %s deadline", elapsed, timeout)
+	}
+}
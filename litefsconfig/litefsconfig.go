@@ -0,0 +1,251 @@
+// Package litefsconfig reads LiteFS configuration files, so that tools built
+// on litefs-go can find the mount directory and the API of the local node
+// from the same litefs.yml LiteFS runs with instead of hard-coding them.
+//
+// Only the settings of interest to clients are decoded: the mount and data
+// directories, the HTTP API, the proxy and the lease. Environment variables
+// are expanded as LiteFS does, unless the file sets skip-env-expansion.
+package litefsconfig
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/superfly/litefs-go/internal/miniyaml"
+)
+
+// DefaultHTTPAddr is the address LiteFS serves its HTTP API on when the
+// configuration file doesn't set one.
+const DefaultHTTPAddr = ":20202"
+
+// Paths are searched in order for a configuration file when Load is given no
+// path, matching LiteFS itself.
+var Paths = []string{"litefs.yml", "/etc/litefs.yml"}
+
+// ErrNotFound is returned by Load when no path is given and none of Paths
+// exists.
+var ErrNotFound = errors.New("no litefs config found")
+
+// Config is a LiteFS configuration file.
+type Config struct {
+	Fuse  FuseConfig
+	Data  DataConfig
+	HTTP  HTTPConfig
+	Proxy ProxyConfig
+	Lease LeaseConfig
+}
+
+// FuseConfig is the "fuse" section, which configures the mount.
+type FuseConfig struct {
+	// Dir is the mount directory, in which applications open databases.
+	Dir string
+
+	// AllowOther allows users other than the one running LiteFS to access
+	// the mount.
+	AllowOther bool
+}
+
+// DataConfig is the "data" section, which configures LiteFS's own storage.
+type DataConfig struct {
+	// Dir is where LiteFS stores databases and transaction files.
+	Dir string
+}
+
+// HTTPConfig is the "http" section, which configures the LiteFS API.
+type HTTPConfig struct {
+	// Addr is the address the API listens on. It defaults to
+	// DefaultHTTPAddr.
+	Addr string
+}
+
+// ProxyConfig is the "proxy" section, which configures the LiteFS proxy. Addr
+// is empty if the proxy isn't configured.
+type ProxyConfig struct {
+	// Addr is the address the LiteFS proxy listens on, e.g. ":8080".
+	Addr string
+
+	// Target is the address of the application the proxy forwards to,
+	// e.g. "localhost:8081".
+	Target string
+
+	// DB is the database whose position the proxy tracks.
+	DB string
+
+	// Passthrough are path patterns that are never forwarded or held.
+	Passthrough []string
+
+	// AlwaysForward are path patterns always forwarded to the primary.
+	AlwaysForward []string
+
+	// PrimaryRedirectTimeout is how long the proxy waits for a primary.
+	PrimaryRedirectTimeout time.Duration
+}
+
+// LeaseConfig is the "lease" section, which configures how the primary is
+// elected.
+type LeaseConfig struct {
+	// Type is "consul" or "static".
+	Type string
+
+	// Hostname is the name the node advertises to other nodes.
+	Hostname string
+
+	// AdvertiseURL is the URL other nodes replicate from this node at.
+	AdvertiseURL string
+
+	// Candidate is whether the node can become primary.
+	Candidate bool
+
+	// Promote is whether the node promotes itself to primary on startup.
+	Promote bool
+}
+
+// Load reads the configuration file at path, or the first of Paths that
+// exists if path is empty.
+func Load(path string) (*Config, error) {
+	data, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func read(path string) ([]byte, error) {
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	for _, path := range Paths {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		return data, err
+	}
+	return nil, ErrNotFound
+}
+
+// Parse decodes the contents of a configuration file.
+func Parse(data []byte) (*Config, error) {
+	doc, err := miniyaml.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse litefs config: %w", err)
+	}
+	if skip, err := parseBool(doc, "skip-env-expansion"); err != nil {
+		return nil, err
+	} else if !skip {
+		if doc, err = miniyaml.Parse([]byte(ExpandEnv(string(data)))); err != nil {
+			return nil, fmt.Errorf("parse litefs config: %w", err)
+		}
+	}
+
+	fuse, lease, proxy := doc.Map("fuse"), doc.Map("lease"), doc.Map("proxy")
+	c := &Config{
+		Fuse: FuseConfig{Dir: fuse.String("dir")},
+		Data: DataConfig{Dir: doc.Map("data").String("dir")},
+		HTTP: HTTPConfig{Addr: doc.Map("http").String("addr")},
+		Proxy: ProxyConfig{
+			Addr:          proxy.String("addr"),
+			Target:        proxy.String("target"),
+			DB:            proxy.String("db"),
+			Passthrough:   proxy.Strings("passthrough"),
+			AlwaysForward: proxy.Strings("always-forward"),
+		},
+		Lease: LeaseConfig{
+			Type:         lease.String("type"),
+			Hostname:     lease.String("hostname"),
+			AdvertiseURL: lease.String("advertise-url"),
+		},
+	}
+	if c.HTTP.Addr == "" {
+		c.HTTP.Addr = DefaultHTTPAddr
+	}
+	if c.Fuse.AllowOther, err = parseBool(fuse, "allow-other"); err != nil {
+		return nil, fmt.Errorf("fuse.%w", err)
+	}
+	if c.Lease.Candidate, err = parseBool(lease, "candidate"); err != nil {
+		return nil, fmt.Errorf("lease.%w", err)
+	}
+	if c.Lease.Promote, err = parseBool(lease, "promote"); err != nil {
+		return nil, fmt.Errorf("lease.%w", err)
+	}
+	if s := proxy.String("primary-redirect-timeout"); s != "" {
+		if c.Proxy.PrimaryRedirectTimeout, err = time.ParseDuration(s); err != nil {
+			return nil, fmt.Errorf("parse proxy.primary-redirect-timeout: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// Expressions LiteFS accepts in place of a variable name, comparing a variable
+// with a quoted string or another variable.
+var (
+	expandExprSingleQuote = regexp.MustCompile(`^(\w+)\s*(==|!=)\s*'(.*)'$`)
+	expandExprDoubleQuote = regexp.MustCompile(`^(\w+)\s*(==|!=)\s*"(.*)"$`)
+	expandExprVar         = regexp.MustCompile(`^(\w+)\s*(==|!=)\s*(\w+)$`)
+)
+
+// ExpandEnv replaces ${var} or $var in s with the value of the environment
+// variable, as LiteFS does. ${var == value} and ${var != value} expand to
+// "true" or "false", where value is a quoted string or the name of another
+// variable, so that e.g. "candidate: ${FLY_REGION == PRIMARY_REGION}" makes
+// the nodes of one region candidates.
+func ExpandEnv(s string) string {
+	return os.Expand(s, func(v string) string {
+		v = strings.TrimSpace(v)
+
+		var lhs, op, rhs string
+		if a := expandExprSingleQuote.FindStringSubmatch(v); a != nil {
+			lhs, op, rhs = os.Getenv(a[1]), a[2], a[3]
+		} else if a := expandExprDoubleQuote.FindStringSubmatch(v); a != nil {
+			lhs, op, rhs = os.Getenv(a[1]), a[2], a[3]
+		} else if a := expandExprVar.FindStringSubmatch(v); a != nil {
+			lhs, op, rhs = os.Getenv(a[1]), a[2], os.Getenv(a[3])
+		} else {
+			return os.Getenv(v)
+		}
+		return strconv.FormatBool((lhs == rhs) == (op == "=="))
+	})
+}
+
+// parseBool returns the boolean at key in m, or false if it is missing.
+func parseBool(m miniyaml.Map, key string) (bool, error) {
+	s := m.String(key)
+	if s == "" {
+		return false, nil
+	}
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid boolean %q", key, s)
+	}
+	return v, nil
+}
+
+// APIURL returns the URL of path on the LiteFS API of the local node. A
+// listening address without a host, such as ":20202", is reached on
+// localhost.
+func (c *Config) APIURL(path string) (string, error) {
+	host, port, err := net.SplitHostPort(c.HTTP.Addr)
+	if err != nil {
+		return "", fmt.Errorf("parse http.addr: %w", err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port) + path, nil
+}
+
+// EventsURL returns the URL of the local node's event stream.
+func (c *Config) EventsURL() (string, error) {
+	return c.APIURL("/events")
+}
+
+// MountDir returns the directory databases are mounted in.
+func (c *Config) MountDir() string {
+	return c.Fuse.Dir
+}
@@ -0,0 +1,140 @@
+package litefsconfig_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs-go/litefsconfig"
+)
+
+func TestLoad(t *testing.T) {
+	t.Setenv("FLY_ALLOC_ID", "abc123")
+
+	path := filepath.Join(t.TempDir(), "litefs.yml")
+	if err := os.WriteFile(path, []byte(`
+fuse:
+  dir: "/litefs"
+  allow-other: true
+
+data:
+  dir: "/var/lib/litefs"
+
+http:
+  addr: "0.0.0.0:20203"
+
+proxy:
+  addr: ":8080"
+  target: "localhost:8081"
+  db: "db"
+  passthrough: ["*.ico", "*.png"]
+  primary-redirect-timeout: 5s
+
+lease:
+  type: "consul"
+  hostname: "${FLY_ALLOC_ID}.vm.app.internal"
+  advertise-url: "http://${FLY_ALLOC_ID}.vm.app.internal:20202"
+  candidate: true
+`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := litefsconfig.Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := &litefsconfig.Config{
+		Fuse: litefsconfig.FuseConfig{Dir: "/litefs", AllowOther: true},
+		Data: litefsconfig.DataConfig{Dir: "/var/lib/litefs"},
+		HTTP: litefsconfig.HTTPConfig{Addr: "0.0.0.0:20203"},
+		Proxy: litefsconfig.ProxyConfig{
+			Addr:                   ":8080",
+			Target:                 "localhost:8081",
+			DB:                     "db",
+			Passthrough:            []string{"*.ico", "*.png"},
+			PrimaryRedirectTimeout: 5 * time.Second,
+		},
+		Lease: litefsconfig.LeaseConfig{
+			Type:         "consul",
+			Hostname:     "abc123.vm.app.internal",
+			AdvertiseURL: "http://abc123.vm.app.internal:20202",
+			Candidate:    true,
+		},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("wrong config: %#v", c)
+	}
+
+	if u, err := c.EventsURL(); err != nil || u != "http://localhost:20203/events" {
+		t.Fatalf("wrong events URL: %s (%v)", u, err)
+	}
+	if dir := c.MountDir(); dir != "/litefs" {
+		t.Fatalf("wrong mount dir: %s", dir)
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Setenv("DIR", "/expanded")
+
+	c, err := litefsconfig.Parse([]byte("skip-env-expansion: true\nfuse:\n  dir: ${DIR}\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if c.Fuse.Dir != "${DIR}" {
+		t.Fatalf("expected variables not to be expanded, got %s", c.Fuse.Dir)
+	}
+	if u, err := c.EventsURL(); err != nil || u != "http://localhost:20202/events" {
+		t.Fatalf("wrong default events URL: %s (%v)", u, err)
+	}
+
+	if _, err := litefsconfig.Parse([]byte("lease:\n  candidate: maybe\n")); err == nil {
+		t.Fatal("expected error for invalid boolean")
+	}
+}
+
+func TestParseExpressions(t *testing.T) {
+	t.Setenv("FLY_REGION", "ord")
+	t.Setenv("PRIMARY_REGION", "ord")
+
+	// the lease section of fly.io's LiteFS template.
+	c, err := litefsconfig.Parse([]byte(`
+lease:
+  type: "consul"
+  candidate: ${FLY_REGION == PRIMARY_REGION}
+  promote: ${FLY_REGION != "ord"}
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !c.Lease.Candidate || c.Lease.Promote {
+		t.Fatalf("wrong lease: %#v", c.Lease)
+	}
+
+	t.Setenv("FLY_REGION", "ams")
+	for _, tt := range []struct {
+		s, expected string
+	}{
+		{"${FLY_REGION == PRIMARY_REGION}", "false"},
+		{"${ FLY_REGION != PRIMARY_REGION }", "true"},
+		{"${FLY_REGION == 'ams'}", "true"},
+		{`${FLY_REGION == "ord"}`, "false"},
+		{"$FLY_REGION-${PRIMARY_REGION}", "ams-ord"},
+	} {
+		if actual := litefsconfig.ExpandEnv(tt.s); actual != tt.expected {
+			t.Fatalf("ExpandEnv(%q): expected %q, got %q", tt.s, tt.expected, actual)
+		}
+	}
+}
+
+func TestLoadNotFound(t *testing.T) {
+	paths := litefsconfig.Paths
+	litefsconfig.Paths = []string{filepath.Join(t.TempDir(), "litefs.yml")}
+	t.Cleanup(func() { litefsconfig.Paths = paths })
+
+	if _, err := litefsconfig.Load(""); !errors.Is(err, litefsconfig.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package litefstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superfly/litefs-go"
+)
+
+// ChaosConfig controls the failures injected by a ChaosServer. Probabilities
+// are between 0 and 1 and are rolled per connection or per event.
+type ChaosConfig struct {
+	// Seed seeds the server's random source so that runs are reproducible.
+	Seed int64
+
+	// StatusErrorRate is the probability that a connection is answered with
+	// 500 Internal Server Error.
+	StatusErrorRate float64
+
+	// HangupRate is the probability that the connection is dropped before
+	// each event.
+	HangupRate float64
+
+	// GarbageRate is the probability that a line of invalid JSON is sent
+	// before each event.
+	GarbageRate float64
+
+	// MaxDelay is the longest pause before each event.
+	MaxDelay time.Duration
+}
+
+// ChaosServer is a LiteFS event stream that misbehaves: it fails requests,
+// hangs up mid-stream, sends garbage and stalls, according to its config.
+// Every stream starts with an init event followed by tx and primaryChange
+// events.
+type ChaosServer struct {
+	*httptest.Server
+
+	config ChaosConfig
+	m      sync.Mutex
+	rand   *rand.Rand
+
+	connections atomic.Int64
+	events      atomic.Int64
+}
+
+// NewChaosServer starts a new *ChaosServer. It must be closed by the caller.
+func NewChaosServer(config ChaosConfig) *ChaosServer {
+	s := &ChaosServer{
+		config: config,
+		rand:   rand.New(rand.NewSource(config.Seed)),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveEvents))
+	return s
+}
+
+// EventsURL returns the URL of the server's event stream, for use as
+// litefs.EventSubscriptionURL.
+func (s *ChaosServer) EventsURL() string {
+	return s.URL + "/events"
+}
+
+// Connections returns the number of connections served.
+func (s *ChaosServer) Connections() int64 {
+	return s.connections.Load()
+}
+
+// Events returns the number of events sent.
+func (s *ChaosServer) Events() int64 {
+	return s.events.Load()
+}
+
+// roll reports whether an event with probability p happens.
+func (s *ChaosServer) roll(p float64) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return p > 0 && s.rand.Float64() < p
+}
+
+func (s *ChaosServer) delay() time.Duration {
+	if s.config.MaxDelay <= 0 {
+		return 0
+	}
+
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return time.Duration(s.rand.Int63n(int64(s.config.MaxDelay)))
+}
+
+func (s *ChaosServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	s.connections.Add(1)
+
+	if s.roll(s.config.StatusErrorRate) {
+		http.Error(w, "chaos", http.StatusInternalServerError)
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	send := func(e *litefs.Event) bool {
+		if err := enc.Encode(e); err != nil {
+			return false
+		}
+		w.(http.Flusher).Flush()
+		s.events.Add(1)
+		return true
+	}
+
+	if !send(&litefs.Event{Type: litefs.EventTypeInit, Data: &litefs.InitEventData{IsPrimary: true, Hostname: "chaos"}}) {
+		return
+	}
+
+	for txid := litefs.TXID(1); ; txid++ {
+		timer := time.NewTimer(s.delay())
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return
+		}
+
+		if s.roll(s.config.HangupRate) {
+			if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		if s.roll(s.config.GarbageRate) {
+			fmt.Fprintln(w, "{chaos")
+			w.(http.Flusher).Flush()
+		}
+
+		e := &litefs.Event{Type: litefs.EventTypeTx, DB: "db", Data: &litefs.TxEventData{
+			TXID:              txid.String(),
+			PostApplyChecksum: litefs.Checksum(txid).String(),
+		}}
+		if txid%10 == 0 {
+			e = &litefs.Event{Type: litefs.EventTypePrimaryChange, Data: &litefs.PrimaryChangeEventData{
+				IsPrimary: txid%20 == 0,
+				Hostname:  "chaos",
+			}}
+		}
+		if !send(e) {
+			return
+		}
+	}
+}
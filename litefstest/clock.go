@@ -0,0 +1,34 @@
+package litefstest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock that only moves when advanced.
+type Clock struct {
+	m   sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a new *Clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the clock's current time.
+func (c *Clock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d and returns the new time.
+func (c *Clock) Advance(d time.Duration) time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.now = c.now.Add(d)
+	return c.now
+}
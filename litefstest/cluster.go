@@ -0,0 +1,326 @@
+// Package litefstest provides helpers for testing code built on litefs-go
+// without running LiteFS.
+package litefstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs-go"
+)
+
+// DefaultLeaseTTL is the lease TTL of a new Cluster, matching LiteFS's
+// default.
+const DefaultLeaseTTL = 10 * time.Second
+
+// streamBuffer is the number of events buffered for each event stream client
+// before its connection is closed.
+const streamBuffer = 1024
+
+// Cluster simulates a LiteFS cluster whose nodes each serve an event stream.
+// Time is driven by a fake Clock: the primary's lease only expires, and a new
+// primary is only elected, when the clock is advanced past the lease's expiry
+// after the primary is killed. This lets tests exercise failover without
+// sleeping.
+type Cluster struct {
+	// Clock drives lease expiry. Advance the cluster, not the clock, so that
+	// expirations are processed.
+	Clock *Clock
+
+	// LeaseTTL is how long a lease lasts without being renewed.
+	LeaseTTL time.Duration
+
+	// Dir, if set, is treated as the nodes' shared mount directory: Tx
+	// writes each database's position to its "-pos" file there, as LiteFS
+	// does on every node, so that code reading positions can be tested.
+	Dir string
+
+	m              sync.Mutex
+	nodes          []*Node
+	primary        *Node
+	leaseExpiresAt time.Time
+	txids          map[string]litefs.TXID
+}
+
+// NewCluster starts a cluster of candidate nodes with the given hostnames. The
+// first node holds the lease. The nodes' servers are closed when the test
+// ends.
+func NewCluster(tb testing.TB, hostnames ...string) *Cluster {
+	tb.Helper()
+	if len(hostnames) == 0 {
+		tb.Fatal("litefstest: cluster requires at least one node")
+	}
+
+	c := &Cluster{
+		Clock:    NewClock(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)),
+		LeaseTTL: DefaultLeaseTTL,
+		txids:    make(map[string]litefs.TXID),
+	}
+	for _, hostname := range hostnames {
+		n := &Node{c: c, hostname: hostname, alive: true, streams: make(map[chan *litefs.Event]struct{})}
+		n.server = httptest.NewServer(http.HandlerFunc(n.serveEvents))
+		tb.Cleanup(n.server.Close)
+		tb.Cleanup(n.closeStreams)
+		c.nodes = append(c.nodes, n)
+	}
+
+	c.primary = c.nodes[0]
+	c.leaseExpiresAt = c.Clock.Now().Add(c.LeaseTTL)
+	return c
+}
+
+// Nodes returns the cluster's nodes in the order they were created.
+func (c *Cluster) Nodes() []*Node {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return append([]*Node(nil), c.nodes...)
+}
+
+// Node returns the node with hostname, or nil if there is none.
+func (c *Cluster) Node(hostname string) *Node {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, n := range c.nodes {
+		if n.hostname == hostname {
+			return n
+		}
+	}
+	return nil
+}
+
+// Primary returns the node holding the lease, or nil while there is none.
+func (c *Cluster) Primary() *Node {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.primary
+}
+
+// LeaseExpiresAt returns when the current lease expires unless it is renewed.
+func (c *Cluster) LeaseExpiresAt() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.leaseExpiresAt
+}
+
+// Advance moves the clock forward by d. A live primary renews its lease as
+// time passes. If the primary is dead and its lease expires, every node is
+// told the cluster has no primary and the first live node acquires the lease,
+// which is announced with a primaryChange event. All events are queued before
+// Advance returns.
+func (c *Cluster) Advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	now := c.Clock.Advance(d)
+
+	if c.primary != nil && c.primary.alive {
+		c.leaseExpiresAt = now.Add(c.LeaseTTL)
+		return
+	}
+	if c.primary != nil && now.Before(c.leaseExpiresAt) {
+		return
+	}
+
+	if c.primary != nil {
+		c.primary = nil
+		c.broadcast(func(*Node) *litefs.Event {
+			return &litefs.Event{Type: litefs.EventTypePrimaryChange, Data: &litefs.PrimaryChangeEventData{}}
+		})
+	}
+
+	for _, n := range c.nodes {
+		if n.alive {
+			c.primary = n
+			c.leaseExpiresAt = now.Add(c.LeaseTTL)
+			c.broadcastPrimary()
+			return
+		}
+	}
+}
+
+// Tx commits a transaction to db on the primary and sends a tx event to every
+// live node. If Dir is set, db's position file is updated before the event is
+// sent. It fails if there is no primary.
+func (c *Cluster) Tx(db string) (litefs.TXID, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if c.primary == nil {
+		return 0, fmt.Errorf("litefstest: no primary")
+	}
+
+	txid := c.txids[db] + 1
+	data := &litefs.TxEventData{
+		TXID:              txid.String(),
+		PostApplyChecksum: litefs.Checksum(txid).String(),
+		PageSize:          4096,
+		Commit:            1,
+		Timestamp:         c.Clock.Now(),
+	}
+	if c.Dir != "" {
+		pos := litefs.Pos{TXID: txid, PostApplyChecksum: litefs.Checksum(txid)}
+		if err := os.WriteFile(litefs.PosPath(filepath.Join(c.Dir, db)), []byte(pos.String()+"\n"), 0666); err != nil {
+			return 0, err
+		}
+	}
+	c.txids[db] = txid
+	c.broadcast(func(*Node) *litefs.Event {
+		return &litefs.Event{Type: litefs.EventTypeTx, DB: db, Data: data}
+	})
+	return txid, nil
+}
+
+// broadcastPrimary sends a primaryChange event for the current primary to
+// every live node. c.m must be held.
+func (c *Cluster) broadcastPrimary() {
+	c.broadcast(func(n *Node) *litefs.Event {
+		return &litefs.Event{Type: litefs.EventTypePrimaryChange, Data: c.primaryData(n)}
+	})
+}
+
+// broadcast sends the event returned by fn to every live node. c.m must be
+// held.
+func (c *Cluster) broadcast(fn func(*Node) *litefs.Event) {
+	for _, n := range c.nodes {
+		if n.alive {
+			n.publish(fn(n))
+		}
+	}
+}
+
+func (c *Cluster) primaryData(n *Node) *litefs.PrimaryChangeEventData {
+	var data litefs.PrimaryChangeEventData
+	if c.primary != nil {
+		data.IsPrimary = c.primary == n
+		data.Hostname = c.primary.hostname
+	}
+	return &data
+}
+
+// Node is a simulated LiteFS node.
+type Node struct {
+	c        *Cluster
+	hostname string
+	server   *httptest.Server
+	alive    bool
+
+	m       sync.Mutex
+	streams map[chan *litefs.Event]struct{}
+}
+
+// Hostname returns the node's hostname.
+func (n *Node) Hostname() string {
+	return n.hostname
+}
+
+// EventsURL returns the URL of the node's event stream, for use as
+// litefs.EventSubscriptionURL.
+func (n *Node) EventsURL() string {
+	return n.server.URL + "/events"
+}
+
+// Kill stops the node as if it crashed: its event streams are closed, new
+// connections are refused with 503 Service Unavailable and, if it is the
+// primary, its lease is no longer renewed.
+func (n *Node) Kill() {
+	n.c.m.Lock()
+	defer n.c.m.Unlock()
+
+	n.alive = false
+	n.closeStreams()
+}
+
+// Revive restarts a killed node as a replica.
+func (n *Node) Revive() {
+	n.c.m.Lock()
+	defer n.c.m.Unlock()
+
+	n.alive = true
+}
+
+func (n *Node) serveEvents(w http.ResponseWriter, r *http.Request) {
+	n.c.m.Lock()
+	if !n.alive {
+		n.c.m.Unlock()
+		http.Error(w, "node is down", http.StatusServiceUnavailable)
+		return
+	}
+	data := n.c.primaryData(n)
+	init := &litefs.Event{Type: litefs.EventTypeInit, Data: &litefs.InitEventData{IsPrimary: data.IsPrimary, Hostname: data.Hostname}}
+
+	stream := make(chan *litefs.Event, streamBuffer)
+	n.m.Lock()
+	n.streams[stream] = struct{}{}
+	n.m.Unlock()
+	n.c.m.Unlock()
+
+	defer n.removeStream(stream)
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(init); err != nil {
+		return
+	}
+	w.(http.Flusher).Flush()
+
+	for {
+		select {
+		case e, ok := <-stream:
+			if !ok {
+				return
+			}
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// publish queues e for every stream. Streams that have fallen too far behind
+// are closed so that their clients reconnect and resynchronize.
+func (n *Node) publish(e *litefs.Event) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	for stream := range n.streams {
+		select {
+		case stream <- e:
+		default:
+			delete(n.streams, stream)
+			close(stream)
+		}
+	}
+}
+
+func (n *Node) removeStream(stream chan *litefs.Event) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if _, ok := n.streams[stream]; ok {
+		delete(n.streams, stream)
+		close(stream)
+	}
+}
+
+func (n *Node) closeStreams() {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	for stream := range n.streams {
+		delete(n.streams, stream)
+		close(stream)
+	}
+}
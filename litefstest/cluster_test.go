@@ -0,0 +1,107 @@
+package litefstest_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs-go"
+	"github.com/superfly/litefs-go/litefstest"
+)
+
+func TestClusterFailover(t *testing.T) {
+	c := litefstest.NewCluster(t, "node-1", "node-2")
+	node1, node2 := c.Node("node-1"), c.Node("node-2")
+
+	litefs.EventSubscriptionURL = node2.EventsURL()
+	pm := litefs.NewPrimaryMonitor()
+	t.Cleanup(pm.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := pm.WaitReady(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertPrimary(t, pm, false, "node-1")
+
+	// a live primary renews its lease.
+	c.Advance(time.Hour)
+	if c.Primary() != node1 {
+		t.Fatal("expected node-1 to remain primary")
+	}
+
+	node1.Kill()
+	expiresAt := c.LeaseExpiresAt()
+
+	c.Advance(c.LeaseTTL - time.Second)
+	if c.Primary() != node1 {
+		t.Fatal("expected lease to be held until it expires")
+	}
+
+	c.Advance(time.Second)
+	if c.Primary() != node2 {
+		t.Fatal("expected node-2 to acquire the lease")
+	}
+	if !c.Clock.Now().Equal(expiresAt) {
+		t.Fatalf("expected failover at lease expiry, got %s", c.Clock.Now())
+	}
+	assertPrimary(t, pm, true, "node-2")
+}
+
+func TestClusterTx(t *testing.T) {
+	c := litefstest.NewCluster(t, "node-1")
+
+	litefs.EventSubscriptionURL = c.Node("node-1").EventsURL()
+	es := litefs.SubscribeEvents()
+	t.Cleanup(es.Close)
+
+	if e := <-es.C(); e.Type != litefs.EventTypeInit {
+		t.Fatalf("expected init event, got %s", e)
+	}
+
+	if _, err := c.Tx("db"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	e := <-es.C()
+	data, ok := e.Data.(*litefs.TxEventData)
+	if !ok || e.DB != "db" || data.TXID != litefs.TXID(1).String() || !data.Timestamp.Equal(c.Clock.Now()) {
+		t.Fatalf("wrong tx event: %s", e)
+	}
+}
+
+func TestClusterTxDir(t *testing.T) {
+	c := litefstest.NewCluster(t, "node-1")
+	c.Dir = t.TempDir()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Tx("db"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	pos, err := litefs.ReadPos(filepath.Join(c.Dir, "db"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pos.TXID != 2 || pos.PostApplyChecksum != litefs.Checksum(2) {
+		t.Fatalf("wrong position: %s", pos)
+	}
+}
+
+func assertPrimary(t *testing.T, pm *litefs.PrimaryMonitor, isPrimary bool, hostname string) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		actualIsPrimary, err := pm.IsPrimary()
+		actualHostname, _ := pm.Hostname()
+		if err == nil && actualIsPrimary == isPrimary && actualHostname == hostname {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected isPrimary=%v hostname=%q, got isPrimary=%v hostname=%q err=%v", isPrimary, hostname, actualIsPrimary, actualHostname, err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
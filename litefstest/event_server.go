@@ -0,0 +1,202 @@
+package litefstest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superfly/litefs-go"
+)
+
+// EventServer is a LiteFS event stream driven by the test: every connection
+// starts with an init event, after which the test emits events, hangs up on
+// clients or fails new connections. Events are only received by clients
+// connected when they are emitted, as with LiteFS, so use WaitClients before
+// emitting.
+type EventServer struct {
+	*httptest.Server
+
+	m       sync.Mutex
+	init    litefs.InitEventData
+	status  int
+	streams map[chan *litefs.Event]struct{}
+
+	connections atomic.Int64
+}
+
+// NewEventServer starts a new *EventServer whose clients are told they are on
+// the primary, node-1. It must be closed by the caller.
+func NewEventServer() *EventServer {
+	s := &EventServer{
+		init:    litefs.InitEventData{IsPrimary: true, Hostname: "node-1"},
+		streams: make(map[chan *litefs.Event]struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveEvents))
+	return s
+}
+
+// EventsURL returns the URL of the server's event stream, for use as
+// litefs.EventSubscriptionURL.
+func (s *EventServer) EventsURL() string {
+	return s.URL + "/events"
+}
+
+// Close hangs up on every client and shuts down the server.
+func (s *EventServer) Close() {
+	s.Hangup()
+	s.Server.Close()
+}
+
+// Connections returns the number of connections served, including those
+// answered with an error.
+func (s *EventServer) Connections() int64 {
+	return s.connections.Load()
+}
+
+// Clients returns the number of clients currently connected to the stream.
+func (s *EventServer) Clients() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return len(s.streams)
+}
+
+// WaitClients blocks until at least n clients are connected or ctx is done.
+func (s *EventServer) WaitClients(ctx context.Context, n int) error {
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	for s.Clients() < n {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// SetInit sets the init event sent to clients when they connect.
+func (s *EventServer) SetInit(isPrimary bool, hostname string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.init = litefs.InitEventData{IsPrimary: isPrimary, Hostname: hostname}
+}
+
+// Init sends an init event to connected clients. LiteFS only sends init
+// events when clients connect; use it to test handling of repeated ones.
+func (s *EventServer) Init(isPrimary bool, hostname string) {
+	s.Emit(&litefs.Event{Type: litefs.EventTypeInit, Data: &litefs.InitEventData{IsPrimary: isPrimary, Hostname: hostname}})
+}
+
+// Tx sends a tx event for db at txid to connected clients.
+func (s *EventServer) Tx(db string, txid litefs.TXID) {
+	s.Emit(&litefs.Event{Type: litefs.EventTypeTx, DB: db, Data: &litefs.TxEventData{
+		TXID:              txid.String(),
+		PostApplyChecksum: litefs.Checksum(txid).String(),
+		PageSize:          4096,
+		Commit:            1,
+	}})
+}
+
+// PrimaryChange sends a primaryChange event to connected clients and updates
+// the init event sent to clients that connect later to match. An empty
+// hostname announces that the cluster has no primary.
+func (s *EventServer) PrimaryChange(isPrimary bool, hostname string) {
+	s.SetInit(isPrimary, hostname)
+	s.Emit(&litefs.Event{Type: litefs.EventTypePrimaryChange, Data: &litefs.PrimaryChangeEventData{IsPrimary: isPrimary, Hostname: hostname}})
+}
+
+// Emit sends e to connected clients. Clients that have fallen too far behind
+// are hung up on.
+func (s *EventServer) Emit(e *litefs.Event) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for stream := range s.streams {
+		select {
+		case stream <- e:
+		default:
+			delete(s.streams, stream)
+			close(stream)
+		}
+	}
+}
+
+// Hangup drops the connection of every client, as if the node crashed.
+// Clients may reconnect.
+func (s *EventServer) Hangup() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	for stream := range s.streams {
+		delete(s.streams, stream)
+		close(stream)
+	}
+}
+
+// SetStatus answers new connections with code, e.g. 500 Internal Server
+// Error, until it is set back to 200 OK. Connected clients are unaffected.
+func (s *EventServer) SetStatus(code int) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.status = code
+}
+
+func (s *EventServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	s.connections.Add(1)
+
+	s.m.Lock()
+	if s.status != 0 && s.status != http.StatusOK {
+		status := s.status
+		s.m.Unlock()
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	init := &litefs.Event{Type: litefs.EventTypeInit, Data: &litefs.InitEventData{IsPrimary: s.init.IsPrimary, Hostname: s.init.Hostname}}
+	stream := make(chan *litefs.Event, streamBuffer)
+	s.streams[stream] = struct{}{}
+	s.m.Unlock()
+
+	defer s.removeStream(stream)
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(init); err != nil {
+		return
+	}
+	w.(http.Flusher).Flush()
+
+	for {
+		select {
+		case e, ok := <-stream:
+			if !ok {
+				if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+					_ = conn.Close()
+				}
+				return
+			}
+			if err := enc.Encode(e); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (s *EventServer) removeStream(stream chan *litefs.Event) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	if _, ok := s.streams[stream]; ok {
+		delete(s.streams, stream)
+		close(stream)
+	}
+}
@@ -0,0 +1,84 @@
+package litefstest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs-go"
+	"github.com/superfly/litefs-go/litefstest"
+)
+
+func TestEventServer(t *testing.T) {
+	s := litefstest.NewEventServer()
+	t.Cleanup(s.Close)
+
+	es := litefs.SubscribeEvents(litefs.WithURL(s.EventsURL()), litefs.WithReconnect(litefs.Backoff{Min: time.Millisecond}))
+	t.Cleanup(es.Close)
+
+	assertInit(t, es, true, "node-1")
+	waitClients(t, s, 1)
+
+	s.Tx("db", 3)
+	if e := <-es.C(); e.Type != litefs.EventTypeTx || e.DB != "db" || e.Data.(*litefs.TxEventData).TXID != litefs.TXID(3).String() {
+		t.Fatalf("wrong tx event: %s", e)
+	}
+
+	s.PrimaryChange(false, "node-2")
+	if e := <-es.C(); e.Type != litefs.EventTypePrimaryChange || e.Data.(*litefs.PrimaryChangeEventData).Hostname != "node-2" {
+		t.Fatalf("wrong primaryChange event: %s", e)
+	}
+
+	// clients reconnect after a hangup and are told of the new primary.
+	s.Hangup()
+	assertInit(t, es, false, "node-2")
+	waitClients(t, s, 1)
+
+	// new connections fail while the status is set.
+	s.SetStatus(http.StatusInternalServerError)
+	s.Hangup()
+	select {
+	case err := <-es.ErrC():
+		for errors.Is(err, litefs.ErrDisconnected) {
+			err = <-es.ErrC()
+		}
+		var statusErr *litefs.ErrUnexpectedStatus
+		if !errors.As(err, &statusErr) || statusErr.Code != http.StatusInternalServerError {
+			t.Fatalf("expected unexpected status error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for error")
+	}
+
+	s.SetStatus(http.StatusOK)
+	assertInit(t, es, false, "node-2")
+	if s.Connections() < 3 {
+		t.Fatalf("expected at least 3 connections, got %d", s.Connections())
+	}
+}
+
+func assertInit(t *testing.T, es *litefs.EventSubscription, isPrimary bool, hostname string) {
+	t.Helper()
+
+	select {
+	case e := <-es.C():
+		data, ok := e.Data.(*litefs.InitEventData)
+		if !ok || data.IsPrimary != isPrimary || data.Hostname != hostname {
+			t.Fatalf("expected init event for isPrimary=%v hostname=%q, got %s", isPrimary, hostname, e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for init event")
+	}
+}
+
+func waitClients(t *testing.T, s *litefstest.EventServer, n int) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.WaitClients(ctx, n); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
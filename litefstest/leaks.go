@@ -0,0 +1,89 @@
+package litefstest
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs-go"
+)
+
+// LeakTimeout is how long AssertNoLeaks waits for goroutines and connections
+// to shut down.
+var LeakTimeout = 5 * time.Second
+
+// Resources counts process resources that leak when subscriptions aren't
+// shut down properly.
+type Resources struct {
+	Goroutines int
+
+	// FDs is the number of open file descriptors, or -1 if they can't be
+	// counted on this platform.
+	FDs int
+}
+
+// CurrentResources returns the process's current resource counts.
+func CurrentResources() Resources {
+	fds := -1
+	if entries, err := os.ReadDir("/proc/self/fd"); err == nil {
+		fds = len(entries)
+	}
+	return Resources{Goroutines: runtime.NumGoroutine(), FDs: fds}
+}
+
+func (r Resources) String() string {
+	return fmt.Sprintf("goroutines=%d fds=%d", r.Goroutines, r.FDs)
+}
+
+// exceeds reports whether r has more of any resource than base.
+func (r Resources) exceeds(base Resources) bool {
+	return r.Goroutines > base.Goroutines || (r.FDs >= 0 && base.FDs >= 0 && r.FDs > base.FDs)
+}
+
+// CheckLeaks waits up to timeout for the process's resources to return to
+// base, since goroutines and connections take a moment to wind down after
+// being closed. An error describing the leak, including a dump of every
+// goroutine, is returned if they don't.
+func CheckLeaks(base Resources, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		cur := CurrentResources()
+		if !cur.exceeds(base) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			return fmt.Errorf("litefstest: leaked resources: %s, expected at most %s\n%s", cur, base, buf)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// AssertNoLeaks fails tb if, when it ends, litefs has more background
+// goroutines or event stream connections than when AssertNoLeaks was called.
+// Call it at the start of a test so that its check runs after every other
+// cleanup.
+func AssertNoLeaks(tb testing.TB) {
+	tb.Helper()
+
+	goroutines, conns := litefs.ActiveGoroutines(), litefs.OpenConnections()
+	tb.Cleanup(func() {
+		deadline := time.Now().Add(LeakTimeout)
+		for {
+			curGoroutines, curConns := litefs.ActiveGoroutines(), litefs.OpenConnections()
+			if curGoroutines <= goroutines && curConns <= conns {
+				return
+			}
+			if time.Now().After(deadline) {
+				buf := make([]byte, 1<<20)
+				buf = buf[:runtime.Stack(buf, true)]
+				tb.Errorf("litefstest: leaked %d goroutines and %d connections\n%s", curGoroutines-goroutines, curConns-conns, buf)
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package litefstest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs-go"
+	"github.com/superfly/litefs-go/litefstest"
+)
+
+func TestAssertNoLeaks(t *testing.T) {
+	t.Run("closed", func(t *testing.T) {
+		litefstest.AssertNoLeaks(t)
+
+		c := litefstest.NewCluster(t, "node-1")
+		litefs.EventSubscriptionURL = c.Node("node-1").EventsURL()
+
+		b := litefs.NewEventBroker()
+		t.Cleanup(b.Close)
+		sub := b.Subscribe()
+		<-sub.C()
+
+		if litefs.ActiveGoroutines() == 0 || litefs.OpenConnections() != 1 {
+			t.Fatalf("expected accounting, got %d goroutines and %d connections", litefs.ActiveGoroutines(), litefs.OpenConnections())
+		}
+	})
+
+	t.Run("leaked", func(t *testing.T) {
+		c := litefstest.NewCluster(t, "node-1")
+		litefs.EventSubscriptionURL = c.Node("node-1").EventsURL()
+
+		prev := litefstest.LeakTimeout
+		litefstest.LeakTimeout = 10 * time.Millisecond
+		defer func() { litefstest.LeakTimeout = prev }()
+
+		rec := &recorder{TB: t}
+		litefstest.AssertNoLeaks(rec)
+		pm := litefs.NewPrimaryMonitor()
+		rec.cleanup()
+		pm.Close()
+
+		if !rec.failed {
+			t.Fatal("expected leak to be reported")
+		}
+	})
+}
+
+// recorder captures failures and cleanups instead of applying them to the
+// test.
+type recorder struct {
+	testing.TB
+	failed   bool
+	cleanups []func()
+}
+
+func (r *recorder) Helper()                        {}
+func (r *recorder) Errorf(format string, a ...any) { r.failed = true }
+func (r *recorder) Cleanup(fn func())              { r.cleanups = append(r.cleanups, fn) }
+
+func (r *recorder) cleanup() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+}
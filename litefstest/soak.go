@@ -0,0 +1,163 @@
+package litefstest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/superfly/litefs-go"
+)
+
+// SoakConfig configures Soak.
+type SoakConfig struct {
+	// Duration is how long to run for.
+	Duration time.Duration
+
+	// Subscriptions is the number of each kind of subscriber kept open.
+	Subscriptions int
+
+	// Cycle is how often every subscriber is closed, resources are checked
+	// for leaks and subscribers are reopened.
+	Cycle time.Duration
+
+	// Chaos configures the failures injected by the event server.
+	Chaos ChaosConfig
+
+	// Logf, if set, receives progress reports after every cycle.
+	Logf func(format string, args ...any)
+}
+
+// SoakReport summarizes a soak run.
+type SoakReport struct {
+	Cycles      int
+	Events      int64
+	Errors      int64
+	Connections int64
+
+	// Peak is the highest resource usage seen while subscribers were open.
+	Peak Resources
+}
+
+// Soak runs event subscriptions, primary monitors and brokers against a
+// ChaosServer until the configured duration elapses or ctx is done. After
+// every cycle, all subscribers are closed and an error is returned if
+// goroutines or file descriptors haven't returned to their baseline.
+//
+// Soak points litefs.EventSubscriptionURL at its server for the duration of
+// the run, so it must not run concurrently with other users of the package.
+func Soak(ctx context.Context, config SoakConfig) (*SoakReport, error) {
+	if config.Subscriptions <= 0 {
+		config.Subscriptions = 1
+	}
+	if config.Cycle <= 0 {
+		config.Cycle = time.Minute
+	}
+
+	s := NewChaosServer(config.Chaos)
+	defer s.Close()
+
+	prevURL := litefs.EventSubscriptionURL
+	litefs.EventSubscriptionURL = s.EventsURL()
+	defer func() { litefs.EventSubscriptionURL = prevURL }()
+
+	ctx, cancel := context.WithTimeout(ctx, config.Duration)
+	defer cancel()
+
+	base := settle(s)
+	report := &SoakReport{}
+	var events, errs atomic.Int64
+
+	for ctx.Err() == nil {
+		closeAll := soakCycle(config.Subscriptions, &events, &errs)
+
+		timer := time.NewTimer(config.Cycle)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+
+		if cur := CurrentResources(); cur.Goroutines > report.Peak.Goroutines || cur.FDs > report.Peak.FDs {
+			report.Peak = cur
+		}
+		closeAll()
+		settle(s)
+
+		report.Cycles++
+		report.Events, report.Errors, report.Connections = events.Load(), errs.Load(), s.Connections()
+		if config.Logf != nil {
+			config.Logf("cycle %d: events=%d errors=%d connections=%d peak=%s", report.Cycles, report.Events, report.Errors, report.Connections, report.Peak)
+		}
+
+		if err := CheckLeaks(base, 5*time.Second); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// settle closes idle connections on both ends of the event stream so that
+// they aren't counted as leaks, and returns the resulting resource counts.
+func settle(s *ChaosServer) Resources {
+	if c, ok := litefs.EventSubscriptionClient.Transport.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	} else if litefs.EventSubscriptionClient.Transport == nil {
+		http.DefaultTransport.(*http.Transport).CloseIdleConnections()
+	}
+	s.CloseClientConnections()
+	return CurrentResources()
+}
+
+// soakCycle opens n of each kind of subscriber, drains them in the
+// background and returns a function that closes them all and waits for the
+// drainers to exit.
+func soakCycle(n int, events, errs *atomic.Int64) (closeAll func()) {
+	var wg sync.WaitGroup
+	var closers []func()
+
+	drain := func(c <-chan *litefs.Event, errc <-chan error, done <-chan struct{}) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case _, ok := <-c:
+					if !ok {
+						return
+					}
+					events.Add(1)
+				case _, ok := <-errc:
+					if !ok {
+						return
+					}
+					errs.Add(1)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		es := litefs.SubscribeEvents()
+		drain(es.C(), es.ErrC(), nil)
+		closers = append(closers, es.Close)
+
+		pm := litefs.NewPrimaryMonitor()
+		closers = append(closers, pm.Close)
+
+		b := litefs.NewEventBroker()
+		sub := b.Subscribe()
+		drain(sub.C(), sub.ErrC(), sub.Done())
+		closers = append(closers, b.Close)
+	}
+
+	return func() {
+		for _, close := range closers {
+			close()
+		}
+		wg.Wait()
+	}
+}
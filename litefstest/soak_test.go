@@ -0,0 +1,31 @@
+package litefstest_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/superfly/litefs-go/litefstest"
+)
+
+func TestSoak(t *testing.T) {
+	report, err := litefstest.Soak(context.Background(), litefstest.SoakConfig{
+		Duration:      300 * time.Millisecond,
+		Subscriptions: 2,
+		Cycle:         100 * time.Millisecond,
+		Chaos: litefstest.ChaosConfig{
+			Seed:            1,
+			StatusErrorRate: 0.2,
+			HangupRate:      0.05,
+			GarbageRate:     0.05,
+			MaxDelay:        time.Millisecond,
+		},
+		Logf: t.Logf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Cycles < 2 || report.Events == 0 || report.Errors == 0 {
+		t.Fatalf("unexpected report: %#v", report)
+	}
+}
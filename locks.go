@@ -0,0 +1,164 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LocksTable is the table Locks stores its locks in.
+const LocksTable = "_litefs_locks"
+
+var (
+	ErrLockHeld    = errors.New("lock held by another owner")
+	ErrLockNotHeld = errors.New("lock not held")
+)
+
+// Locks provides named, TTL-based mutual exclusion across the cluster. Locks
+// are stored in a LiteFS database and written while holding the HALT lock, so
+// they can be acquired from any node and survive failover.
+type Locks struct {
+	DB *sql.DB
+
+	// DatabasePath is the path of DB's file in the LiteFS mount. It is used
+	// to acquire the HALT lock and to match tx events while waiting.
+	DatabasePath string
+
+	// Owner identifies this process as a lock holder. It defaults to the
+	// hostname.
+	Owner string
+}
+
+// Init creates the locks table if it doesn't exist.
+func (l *Locks) Init(ctx context.Context) error {
+	return WithHaltContext(ctx, l.DatabasePath, func() error {
+		_, err := l.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+LocksTable+` (
+	name TEXT PRIMARY KEY,
+	owner TEXT NOT NULL,
+	expires_at INTEGER NOT NULL
+)`)
+		return err
+	})
+}
+
+// Acquire takes the lock name for ttl. ErrLockHeld is returned if another
+// owner holds an unexpired lock. Acquiring a lock that is already held by this
+// owner extends it.
+func (l *Locks) Acquire(ctx context.Context, name string, ttl time.Duration) error {
+	now := time.Now()
+	return l.update(ctx, ErrLockHeld, `INSERT INTO `+LocksTable+` (name, owner, expires_at) VALUES (?, ?, ?)
+ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at
+WHERE `+LocksTable+`.owner = excluded.owner OR `+LocksTable+`.expires_at <= ?`,
+		name, l.owner(), now.Add(ttl).UnixNano(), now.UnixNano(),
+	)
+}
+
+// Renew extends the lock name held by this owner to expire after ttl.
+// ErrLockNotHeld is returned if this owner doesn't hold the lock, including if
+// it expired.
+func (l *Locks) Renew(ctx context.Context, name string, ttl time.Duration) error {
+	now := time.Now()
+	return l.update(ctx, ErrLockNotHeld, `UPDATE `+LocksTable+` SET expires_at = ? WHERE name = ? AND owner = ? AND expires_at > ?`,
+		now.Add(ttl).UnixNano(), name, l.owner(), now.UnixNano(),
+	)
+}
+
+// Release gives up the lock name. ErrLockNotHeld is returned if this owner
+// doesn't hold the lock.
+func (l *Locks) Release(ctx context.Context, name string) error {
+	return l.update(ctx, ErrLockNotHeld, `DELETE FROM `+LocksTable+` WHERE name = ? AND owner = ? AND expires_at > ?`,
+		name, l.owner(), time.Now().UnixNano(),
+	)
+}
+
+// Holder returns the owner of the lock name and when it expires, reading from
+// the local copy of the database. An empty owner is returned if the lock isn't
+// held.
+func (l *Locks) Holder(ctx context.Context, name string) (owner string, expiresAt time.Time, err error) {
+	var expires int64
+	err = l.DB.QueryRowContext(ctx, `SELECT owner, expires_at FROM `+LocksTable+` WHERE name = ?`, name).Scan(&owner, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", time.Time{}, nil
+	} else if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt = time.Unix(0, expires)
+	if !expiresAt.After(time.Now()) {
+		return "", time.Time{}, nil
+	}
+	return owner, expiresAt, nil
+}
+
+// Wait blocks until the lock name is not held by another owner. Changes made
+// on other nodes are noticed through tx events, and the lock is rechecked when
+// it expires.
+func (l *Locks) Wait(ctx context.Context, name string) error {
+	es := NewEventSource()
+	defer es.Close()
+
+	db := filepath.Base(l.DatabasePath)
+	for {
+		owner, expiresAt, err := l.Holder(ctx, name)
+		if err != nil {
+			return err
+		}
+		if owner == "" || owner == l.owner() {
+			return nil
+		}
+
+		timer := time.NewTimer(time.Until(expiresAt))
+	wait:
+		for {
+			select {
+			case event, running := <-es.C():
+				if !running {
+					return ErrSubscriptionClosed
+				}
+				if event.Type == EventTypeTx && event.DB == db {
+					break wait
+				}
+			case err, running := <-es.ErrC():
+				if err := sourceError(err, running); err != nil {
+					return err
+				}
+			case <-timer.C:
+				break wait
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+		timer.Stop()
+	}
+}
+
+// update executes query under the HALT lock, returning errNone if it affects
+// no rows. Each query checks the holder and writes in one statement, so that
+// concurrent updates, which HALT doesn't serialize on the primary, can't both
+// see the lock as free.
+func (l *Locks) update(ctx context.Context, errNone error, query string, args ...any) error {
+	return WithHaltContext(ctx, l.DatabasePath, func() error {
+		result, err := l.DB.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return errNone
+		}
+		return nil
+	})
+}
+
+func (l *Locks) owner() string {
+	if l.Owner != "" {
+		return l.Owner
+	}
+	hostname, _ := os.Hostname()
+	return hostname
+}
@@ -0,0 +1,299 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLocks(t *testing.T) {
+	path := lockedDB(t, false)
+	db := openLocksDB(t)
+	a := &Locks{DB: db, DatabasePath: path, Owner: "a"}
+	b := &Locks{DB: db, DatabasePath: path, Owner: "b"}
+	ctx := context.Background()
+
+	if err := a.Init(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := a.Acquire(ctx, "job", time.Hour); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if owner, _, err := b.Holder(ctx, "job"); err != nil || owner != "a" {
+		t.Fatalf("unexpected holder: %q, %v", owner, err)
+	}
+
+	if err := b.Acquire(ctx, "job", time.Hour); !errors.Is(err, ErrLockHeld) {
+		t.Fatalf("expected ErrLockHeld, got %v", err)
+	}
+	if err := b.Release(ctx, "job"); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("expected ErrLockNotHeld, got %v", err)
+	}
+	if err := a.Renew(ctx, "job", time.Hour); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if err := a.Release(ctx, "job"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := b.Acquire(ctx, "job", time.Hour); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// expired locks can be taken by another owner, but not renewed.
+	if err := a.Acquire(ctx, "expiring", time.Millisecond); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := a.Renew(ctx, "expiring", time.Hour); !errors.Is(err, ErrLockNotHeld) {
+		t.Fatalf("expected ErrLockNotHeld, got %v", err)
+	}
+	if err := b.Acquire(ctx, "expiring", time.Hour); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestLocksConcurrentAcquire(t *testing.T) {
+	db := openLocksDB(t)
+	ctx := context.Background()
+
+	// only one of the owners racing for a free lock takes it. Each has its
+	// own lock file, as HALT doesn't exclude writers on the primary.
+	for round := 0; round < 20; round++ {
+		name := fmt.Sprintf("job-%d", round)
+		var wg sync.WaitGroup
+		var acquired atomic.Int32
+		start := make(chan struct{})
+		for i := 0; i < 8; i++ {
+			l := &Locks{DB: db, DatabasePath: lockedDB(t, false), Owner: fmt.Sprint(i)}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				if err := l.Acquire(ctx, name, time.Hour); err == nil {
+					acquired.Add(1)
+				} else if !errors.Is(err, ErrLockHeld) {
+					t.Errorf("unexpected error: %s", err)
+				}
+			}()
+		}
+		close(start)
+		wg.Wait()
+
+		if n := acquired.Load(); n != 1 {
+			t.Fatalf("expected 1 owner to acquire %s, got %d", name, n)
+		}
+	}
+}
+
+func TestLocksWait(t *testing.T) {
+	sources := make(chan *fakeSource, 1)
+	useEventSource(t, func(...SubscribeOption) EventSource {
+		src := newFakeSource()
+		sources <- src
+		return src
+	})
+
+	path := lockedDB(t, false)
+	db := openLocksDB(t)
+	a := &Locks{DB: db, DatabasePath: path, Owner: "a"}
+	b := &Locks{DB: db, DatabasePath: path, Owner: "b"}
+	ctx := context.Background()
+
+	wait := func() chan error {
+		errc := make(chan error, 1)
+		go func() { errc <- b.Wait(ctx, "job") }()
+		return errc
+	}
+
+	t.Run("tx event", func(t *testing.T) {
+		if err := a.Acquire(ctx, "job", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		errc := wait()
+		src := <-sources
+		t.Cleanup(src.Close)
+
+		// events for other databases don't wake it.
+		src.c <- &Event{Type: EventTypeTx, DB: "other"}
+		if err := a.Release(ctx, "job"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-errc:
+			t.Fatalf("returned before a tx event: %v", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		src.c <- &Event{Type: EventTypeTx, DB: "db"}
+		if err := <-errc; err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		if err := a.Acquire(ctx, "job", 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+		errc := wait()
+		src := <-sources
+		t.Cleanup(src.Close)
+
+		select {
+		case err := <-errc:
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for the lock to expire")
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		if err := a.Acquire(ctx, "job", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		errc := wait()
+		(<-sources).Close()
+
+		if err := <-errc; !errors.Is(err, ErrSubscriptionClosed) {
+			t.Fatalf("expected ErrSubscriptionClosed, got %v", err)
+		}
+	})
+}
+
+// openLocksDB returns a stub database holding a LocksTable.
+func openLocksDB(t *testing.T) *sql.DB {
+	type lock struct {
+		owner     string
+		expiresAt int64
+	}
+	locks := make(map[string]lock)
+
+	return openStubDB(t, func(query string, args []any) (stubResult, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT"):
+			result := stubResult{cols: []string{"owner", "expires_at"}}
+			if l, ok := locks[args[0].(string)]; ok {
+				result.rows = [][]driver.Value{{l.owner, l.expiresAt}}
+			}
+			return result, nil
+		case strings.HasPrefix(query, "INSERT"):
+			name, owner := args[0].(string), args[1].(string)
+			if l, ok := locks[name]; ok && l.owner != owner && l.expiresAt > args[3].(int64) {
+				return stubResult{}, nil
+			}
+			locks[name] = lock{owner: owner, expiresAt: args[2].(int64)}
+		case strings.HasPrefix(query, "UPDATE"):
+			name := args[1].(string)
+			l, ok := locks[name]
+			if !ok || l.owner != args[2].(string) || l.expiresAt <= args[3].(int64) {
+				return stubResult{}, nil
+			}
+			locks[name] = lock{owner: l.owner, expiresAt: args[0].(int64)}
+		case strings.HasPrefix(query, "DELETE"):
+			name := args[0].(string)
+			if l, ok := locks[name]; !ok || l.owner != args[1].(string) || l.expiresAt <= args[2].(int64) {
+				return stubResult{}, nil
+			}
+			delete(locks, name)
+		}
+		return stubResult{affected: 1}, nil
+	})
+}
+
+// stubResult is a stub database's answer to a statement: the rows of a query,
+// or the rows affected and last insert ID of anything else.
+type stubResult struct {
+	cols     []string
+	rows     [][]driver.Value
+	affected int64
+	lastID   int64
+}
+
+// openStubDB returns a database that answers every statement with fn. Calls
+// are serialized so that fn can keep its tables in plain maps. Transactions
+// are accepted but not isolated.
+func openStubDB(t *testing.T, fn func(query string, args []any) (stubResult, error)) *sql.DB {
+	db := sql.OpenDB(&stubConnector{fn: fn})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+type stubConnector struct {
+	m  sync.Mutex
+	fn func(query string, args []any) (stubResult, error)
+}
+
+func (c *stubConnector) Connect(context.Context) (driver.Conn, error) { return &stubConn{c}, nil }
+func (c *stubConnector) Driver() driver.Driver                        { return nil }
+
+func (c *stubConnector) do(query string, args []driver.NamedValue) (stubResult, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	values := make([]any, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	return c.fn(strings.TrimSpace(query), values)
+}
+
+type stubConn struct{ c *stubConnector }
+
+func (c *stubConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *stubConn) Close() error                        { return nil }
+func (c *stubConn) Begin() (driver.Tx, error)           { return stubTx{}, nil }
+
+func (c *stubConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.c.do(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return stubExecResult(result), nil
+}
+
+func (c *stubConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.c.do(query, args)
+	if err != nil {
+		return nil, err
+	}
+	// let concurrent callers run between a read and whatever follows it, as
+	// they could against a real database.
+	time.Sleep(100 * time.Microsecond)
+	return &stubRows{cols: result.cols, rows: result.rows}, nil
+}
+
+type stubTx struct{}
+
+func (stubTx) Commit() error   { return nil }
+func (stubTx) Rollback() error { return nil }
+
+type stubExecResult stubResult
+
+func (r stubExecResult) LastInsertId() (int64, error) { return r.lastID, nil }
+func (r stubExecResult) RowsAffected() (int64, error) { return r.affected, nil }
+
+type stubRows struct {
+	cols []string
+	rows [][]driver.Value
+}
+
+func (r *stubRows) Columns() []string { return r.cols }
+func (r *stubRows) Close() error      { return nil }
+func (r *stubRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,244 @@
+// Package metrics exports the metrics of LiteFS event subscriptions and the
+// replication state they report in the Prometheus text format, without
+// depending on the Prometheus client library.
+//
+// A Registry is a litefs.MetricsSink that counts events, reconnects and decode
+// errors when given to subscriptions with litefs.WithMetrics, and Register
+// adds the node's role and replication lag. Serve the registry on the path
+// Prometheus scrapes:
+//
+//	reg := metrics.NewRegistry()
+//	b := litefs.NewEventBroker(litefs.WithMetrics(reg))
+//	metrics.Register(b, reg, "/litefs")
+//	http.Handle("/metrics", reg)
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/superfly/litefs-go"
+)
+
+// Names of the metrics added by Register.
+const (
+	// MetricPrimary is 1 while the node is the primary and 0 otherwise.
+	MetricPrimary = "litefs_primary"
+
+	// MetricLastTXID is the TXID of the last tx event of each database,
+	// labeled by "db".
+	MetricLastTXID = "litefs_last_tx_txid"
+
+	// MetricReplicationLag is how many transactions the local position of
+	// each database is behind its last tx event, labeled by "db".
+	MetricReplicationLag = "litefs_replication_lag_txids"
+)
+
+// help describes the metrics this module knows of. Others are exported
+// without a description.
+var help = map[string]string{
+	litefs.MetricEventsReceived: "Events received from LiteFS by type.",
+	litefs.MetricReconnects:     "Event subscriptions reconnecting after an error.",
+	litefs.MetricDecodeErrors:   "Events from LiteFS that couldn't be decoded.",
+	litefs.MetricEventsDropped:  "Events dropped because a subscriber was too slow.",
+	MetricPrimary:               "Whether the node is the primary.",
+	MetricLastTXID:              "TXID of the last tx event of each database.",
+	MetricReplicationLag:        "Transactions the local position of each database is behind its last tx event.",
+}
+
+// Registry holds counters and gauges and serves them in the Prometheus text
+// format. It is safe for concurrent use.
+type Registry struct {
+	m        sync.Mutex
+	families map[string]*family
+	collect  []func()
+}
+
+var _ litefs.MetricsSink = (*Registry)(nil)
+
+type family struct {
+	typ    string
+	series map[string]float64 // by encoded labels
+}
+
+// NewRegistry returns a new, empty *Registry.
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Add adds delta to the counter name.
+func (r *Registry) Add(name string, delta float64, labels ...string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.family(name, "counter").series[encodeLabels(labels)] += delta
+}
+
+// Set sets the gauge name to value.
+func (r *Registry) Set(name string, value float64, labels ...string) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.family(name, "gauge").series[encodeLabels(labels)] = value
+}
+
+// OnCollect calls fn before each time the metrics are written, so that it can
+// set gauges that are only worth computing when scraped.
+func (r *Registry) OnCollect(fn func()) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.collect = append(r.collect, fn)
+}
+
+func (r *Registry) family(name, typ string) *family {
+	f := r.families[name]
+	if f == nil {
+		f = &family{typ: typ, series: make(map[string]float64)}
+		r.families[name] = f
+	}
+	return f
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.m.Lock()
+	collect := r.collect
+	r.m.Unlock()
+	for _, fn := range collect {
+		fn()
+	}
+
+	var b strings.Builder
+	r.m.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		if h := help[name]; h != "" {
+			fmt.Fprintf(&b, "# HELP %s %s\n", name, h)
+		}
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.typ)
+
+		series := make([]string, 0, len(f.series))
+		for labels := range f.series {
+			series = append(series, labels)
+		}
+		sort.Strings(series)
+		for _, labels := range series {
+			fmt.Fprintf(&b, "%s%s %s\n", name, labels, formatValue(f.series[labels]))
+		}
+	}
+	r.m.Unlock()
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = r.WriteTo(w)
+}
+
+// Subscriber is the source of the events Register reports on, such as a
+// *litefs.EventBroker.
+type Subscriber interface {
+	OnEvent(fn func(*litefs.Event), opts ...litefs.BrokerSubscribeOption) *litefs.BrokerSubscription
+}
+
+// Register reports whether the node is the primary and the replication state
+// of its databases, which are mounted in dir, from the events of sub to reg.
+// It returns the subscription, which stops reporting when closed.
+func Register(sub Subscriber, reg *Registry, dir string) *litefs.BrokerSubscription {
+	var m sync.Mutex
+	last := make(map[string]litefs.TXID)
+
+	reg.OnCollect(func() {
+		m.Lock()
+		defer m.Unlock()
+
+		for db, txid := range last {
+			pos, err := litefs.ReadPos(filepath.Join(dir, db))
+			if err != nil {
+				continue
+			}
+			lag := 0.0
+			if txid > pos.TXID {
+				lag = float64(txid - pos.TXID)
+			}
+			reg.Set(MetricReplicationLag, lag, "db", db)
+		}
+	})
+
+	return sub.OnEvent(func(e *litefs.Event) {
+		switch data := e.Data.(type) {
+		case *litefs.InitEventData:
+			reg.Set(MetricPrimary, boolValue(data.IsPrimary))
+		case *litefs.PrimaryChangeEventData:
+			reg.Set(MetricPrimary, boolValue(data.IsPrimary))
+		case *litefs.TxEventData:
+			txid, err := litefs.ParseTXID(data.TXID)
+			if err != nil {
+				return
+			}
+			m.Lock()
+			last[e.DB] = txid
+			m.Unlock()
+			reg.Set(MetricLastTXID, float64(txid), "db", e.DB)
+		}
+	}, litefs.WithLabel("metrics"))
+}
+
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
+
+// encodeLabels returns the alternating names and values of labels in the
+// Prometheus text format, e.g. `{db="app.db"}`.
+func encodeLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(labelReplacer.Replace(labels[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,62 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/superfly/litefs-go"
+	"github.com/superfly/litefs-go/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.db"+litefs.PosSuffix), []byte("0000000000000025/0000000000000000\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reg := metrics.NewRegistry()
+	reg.Add(litefs.MetricEventsReceived, 1, "type", "tx")
+	reg.Add(litefs.MetricEventsReceived, 2, "type", "tx")
+	reg.Add(litefs.MetricEventsDropped, 1, "subscriber", `say "hi"`)
+
+	metrics.Register(fakeSubscriber{
+		{Type: litefs.EventTypeInit, Data: &litefs.InitEventData{IsPrimary: true}},
+		{Type: litefs.EventTypeTx, DB: "app.db", Data: &litefs.TxEventData{TXID: "0000000000000027"}},
+		{Type: litefs.EventTypePrimaryChange, Data: &litefs.PrimaryChangeEventData{Hostname: "node-2"}},
+	}, reg, dir)
+
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	expected := `# HELP litefs_events_dropped_total Events dropped because a subscriber was too slow.
+# TYPE litefs_events_dropped_total counter
+litefs_events_dropped_total{subscriber="say \"hi\""} 1
+# HELP litefs_events_received_total Events received from LiteFS by type.
+# TYPE litefs_events_received_total counter
+litefs_events_received_total{type="tx"} 3
+# HELP litefs_last_tx_txid TXID of the last tx event of each database.
+# TYPE litefs_last_tx_txid gauge
+litefs_last_tx_txid{db="app.db"} 39
+# HELP litefs_primary Whether the node is the primary.
+# TYPE litefs_primary gauge
+litefs_primary 0
+# HELP litefs_replication_lag_txids Transactions the local position of each database is behind its last tx event.
+# TYPE litefs_replication_lag_txids gauge
+litefs_replication_lag_txids{db="app.db"} 2
+`
+	if body := w.Body.String(); body != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, body)
+	}
+}
+
+// fakeSubscriber passes its events to handlers as they are added.
+type fakeSubscriber []*litefs.Event
+
+func (s fakeSubscriber) OnEvent(fn func(*litefs.Event), opts ...litefs.BrokerSubscribeOption) *litefs.BrokerSubscription {
+	for _, e := range s {
+		fn(e)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"time"
+)
+
+// NodesTable is the table NodeRegistry stores its nodes in.
+const NodesTable = "_litefs_nodes"
+
+// NodeRecord describes an application instance registered in a NodeRegistry.
+type NodeRecord struct {
+	ID          string            `json:"id"`
+	Region      string            `json:"region,omitempty"`
+	Version     string            `json:"version,omitempty"`
+	Role        Role              `json:"role,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	HeartbeatAt time.Time         `json:"heartbeatAt"`
+}
+
+// NodeRegistry is a registry of application instances stored in a LiteFS
+// database. Each instance periodically writes a heartbeat row through the HALT
+// lock, and any node can list the instances whose heartbeats are current.
+type NodeRegistry struct {
+	DB *sql.DB
+
+	// DatabasePath is the path of DB's file in the LiteFS mount.
+	DatabasePath string
+
+	// Self describes this instance. Its HeartbeatAt is set on each heartbeat.
+	Self NodeRecord
+
+	// Monitor, if set, is used to fill in Self.Role on each heartbeat.
+	Monitor *PrimaryMonitor
+
+	// Interval is how often Run heartbeats.
+	Interval time.Duration
+
+	// TTL is how long after its last heartbeat a node is considered gone.
+	TTL time.Duration
+
+	// Logger, if set, receives the heartbeat failures Run retries.
+	Logger *slog.Logger
+}
+
+// NewNodeRegistry returns a new *NodeRegistry for the instance self that
+// heartbeats every 10 seconds and expires nodes after 30 seconds.
+func NewNodeRegistry(db *sql.DB, databasePath string, self NodeRecord) *NodeRegistry {
+	return &NodeRegistry{
+		DB:           db,
+		DatabasePath: databasePath,
+		Self:         self,
+		Interval:     10 * time.Second,
+		TTL:          30 * time.Second,
+	}
+}
+
+// Init creates the nodes table if it doesn't exist.
+func (nr *NodeRegistry) Init(ctx context.Context) error {
+	return WithHaltContext(ctx, nr.DatabasePath, func() error {
+		_, err := nr.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+NodesTable+` (
+	id TEXT PRIMARY KEY,
+	data TEXT NOT NULL,
+	heartbeat_at INTEGER NOT NULL
+)`)
+		return err
+	})
+}
+
+// Heartbeat writes this instance's record.
+func (nr *NodeRegistry) Heartbeat(ctx context.Context) error {
+	rec := nr.Self
+	rec.HeartbeatAt = time.Now()
+	if nr.Monitor != nil {
+		if isPrimary, err := nr.Monitor.IsPrimary(); err == nil {
+			rec.Role = RoleReplica
+			if isPrimary {
+				rec.Role = RolePrimary
+			}
+		}
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	return WithHaltContext(ctx, nr.DatabasePath, func() error {
+		_, err := nr.DB.ExecContext(ctx, `INSERT INTO `+NodesTable+` (id, data, heartbeat_at) VALUES (?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET data = excluded.data, heartbeat_at = excluded.heartbeat_at`,
+			rec.ID, string(data), rec.HeartbeatAt.UnixNano(),
+		)
+		return err
+	})
+}
+
+// Deregister removes this instance's record.
+func (nr *NodeRegistry) Deregister(ctx context.Context) error {
+	return WithHaltContext(ctx, nr.DatabasePath, func() error {
+		_, err := nr.DB.ExecContext(ctx, `DELETE FROM `+NodesTable+` WHERE id = ?`, nr.Self.ID)
+		return err
+	})
+}
+
+// Run heartbeats every Interval until ctx is done, then deregisters. Failed
+// heartbeats are logged and retried sooner, backing off up to Interval, so
+// that a transient error such as a failover doesn't stop the heartbeats.
+func (nr *NodeRegistry) Run(ctx context.Context) error {
+	backoff := Backoff{Min: nr.Interval / 10, Max: nr.Interval, Multiplier: 2, Jitter: 0.2}
+
+	for failures := 0; ; {
+		delay := nr.Interval
+		if err := nr.Heartbeat(ctx); err != nil && ctx.Err() == nil {
+			failures++
+			delay = backoff.Delay(failures)
+			if nr.Logger != nil {
+				nr.Logger.Warn("litefs: node heartbeat failed, retrying",
+					slog.String("id", nr.Self.ID),
+					slog.Duration("delay", delay),
+					slog.Any("error", err),
+				)
+			}
+		} else {
+			failures = 0
+		}
+
+		if err := sleepContext(ctx, delay); err != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), nr.Interval)
+			defer cancel()
+			return nr.Deregister(ctx)
+		}
+	}
+}
+
+// Nodes returns the records of nodes that have heartbeated within TTL, read
+// from the local copy of the database.
+func (nr *NodeRegistry) Nodes(ctx context.Context) ([]NodeRecord, error) {
+	rows, err := nr.DB.QueryContext(ctx, `SELECT data FROM `+NodesTable+` WHERE heartbeat_at > ? ORDER BY id`,
+		time.Now().Add(-nr.TTL).UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nodes []NodeRecord
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var rec NodeRecord
+		if err := json.Unmarshal([]byte(data), &rec); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, rec)
+	}
+	return nodes, rows.Err()
+}
@@ -0,0 +1,166 @@
+package litefs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNodeRegistry(t *testing.T) {
+	mockServer(t, initEventJSON, hold)
+	pm := NewPrimaryMonitor()
+	t.Cleanup(pm.Close)
+	assertReady(t, pm, time.Second)
+
+	path := lockedDB(t, false)
+	db := openNodesDB(t)
+	a := NewNodeRegistry(db, path, NodeRecord{ID: "a", Region: "ord", Metadata: map[string]string{"version": "1"}})
+	a.Monitor = pm
+	b := NewNodeRegistry(db, path, NodeRecord{ID: "b", Region: "ams"})
+	ctx := context.Background()
+
+	if err := a.Init(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, nr := range []*NodeRegistry{b, a} {
+		if err := nr.Heartbeat(ctx); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	nodes, err := b.Nodes(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if len(nodes) != 2 || nodes[0].ID != "a" || nodes[1].ID != "b" {
+		t.Fatalf("unexpected nodes: %+v", nodes)
+	}
+	if n := nodes[0]; n.Region != "ord" || n.Role != RolePrimary || n.Metadata["version"] != "1" || n.HeartbeatAt.IsZero() {
+		t.Fatalf("unexpected node: %+v", n)
+	}
+	if n := nodes[1]; n.Role != "" {
+		t.Fatalf("expected no role without a monitor, got %q", n.Role)
+	}
+
+	// nodes that stop heartbeating are left out once their TTL has passed.
+	b.TTL = 20 * time.Millisecond
+	time.Sleep(b.TTL)
+	if err := b.Heartbeat(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if nodes, err := b.Nodes(ctx); err != nil || len(nodes) != 1 || nodes[0].ID != "b" {
+		t.Fatalf("unexpected result: %+v, %v", nodes, err)
+	}
+
+	if err := b.Deregister(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if nodes, err := a.Nodes(ctx); err != nil || len(nodes) != 1 || nodes[0].ID != "a" {
+		t.Fatalf("unexpected result: %+v, %v", nodes, err)
+	}
+}
+
+func TestNodeRegistryRun(t *testing.T) {
+	nr := NewNodeRegistry(openNodesDB(t), lockedDB(t, false), NodeRecord{ID: "a"})
+	nr.Interval = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- nr.Run(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		nodes, err := nr.Nodes(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		} else if len(nodes) == 1 {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for a heartbeat")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the node deregisters when it stops.
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if nodes, err := nr.Nodes(context.Background()); err != nil || len(nodes) != 0 {
+		t.Fatalf("unexpected result: %+v, %v", nodes, err)
+	}
+}
+
+func TestNodeRegistryRunRetries(t *testing.T) {
+	var heartbeats int
+	recovered := make(chan struct{})
+	db := openStubDB(t, func(query string, args []any) (stubResult, error) {
+		if !strings.HasPrefix(query, "INSERT") {
+			return stubResult{}, nil
+		}
+		if heartbeats++; heartbeats <= 2 {
+			return stubResult{}, errors.New("database is locked")
+		} else if heartbeats == 3 {
+			close(recovered)
+		}
+		return stubResult{affected: 1}, nil
+	})
+
+	var buf bytes.Buffer
+	nr := NewNodeRegistry(db, lockedDB(t, false), NodeRecord{ID: "a"})
+	nr.Interval = 5 * time.Millisecond
+	nr.Logger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- nr.Run(ctx) }()
+
+	// failed heartbeats are retried rather than stopping Run.
+	select {
+	case <-recovered:
+	case err := <-errc:
+		t.Fatalf("unexpected return: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a heartbeat to succeed")
+	}
+
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := strings.Count(buf.String(), "heartbeat failed"); n != 2 {
+		t.Fatalf("expected 2 logged failures, got %d:\n%s", n, buf.String())
+	}
+}
+
+// openNodesDB returns a stub database holding a NodesTable.
+func openNodesDB(t *testing.T) *sql.DB {
+	type node struct {
+		data        string
+		heartbeatAt int64
+	}
+	nodes := make(map[string]node)
+
+	return openStubDB(t, func(query string, args []any) (stubResult, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT"):
+			result := stubResult{cols: []string{"data"}}
+			for _, id := range sortedKeys(nodes) {
+				if nodes[id].heartbeatAt > args[0].(int64) {
+					result.rows = append(result.rows, []driver.Value{nodes[id].data})
+				}
+			}
+			return result, nil
+		case strings.HasPrefix(query, "INSERT"):
+			nodes[args[0].(string)] = node{data: args[1].(string), heartbeatAt: args[2].(int64)}
+		case strings.HasPrefix(query, "DELETE"):
+			delete(nodes, args[0].(string))
+		}
+		return stubResult{affected: 1}, nil
+	})
+}
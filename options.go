@@ -0,0 +1,149 @@
+package litefs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Option configures settings shared by the package's components: where they
+// log, how they tell the time and where they report metrics. Options are
+// accepted by the constructors of components that subscribe to events, and
+// are also a SubscribeOption and a BrokerSubscribeOption, so the same options
+// can be passed to anything that subscribes.
+type Option func(*settings)
+
+// settings are the values configured by Options. The zero value discards logs
+// and metrics and uses the system clock.
+type settings struct {
+	logger   *slog.Logger
+	clock    Clock
+	metrics  MetricsSink
+	observer StreamObserver
+}
+
+func newSettings(opts []Option) settings {
+	var s settings
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+func (o Option) applySubscription(es *EventSubscription) { o(&es.settings) }
+func (o Option) applyBroker(sub *BrokerSubscription)     { o(&sub.settings) }
+
+// WithLogger logs to logger. Event subscriptions log connecting, retrying,
+// events that couldn't be decoded and primary changes, so that they are seen
+// even by callers that don't drain ErrC.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *settings) {
+		s.logger = logger
+	}
+}
+
+// WithClock tells the time with c rather than the system clock, e.g. in tests.
+// Timers and tickers still run on the system clock.
+func WithClock(c Clock) Option {
+	return func(s *settings) {
+		s.clock = c
+	}
+}
+
+// WithMetrics reports metrics to sink.
+func WithMetrics(sink MetricsSink) Option {
+	return func(s *settings) {
+		s.metrics = sink
+	}
+}
+
+// WithObserver notifies o of the connections and events of event
+// subscriptions.
+func WithObserver(o StreamObserver) Option {
+	return func(s *settings) {
+		s.observer = o
+	}
+}
+
+// StreamObserver is notified of the connections of event subscriptions and
+// the events they receive, e.g. to trace them. Each subscription calls its
+// observer from a single goroutine, but an observer shared by several
+// subscriptions is called concurrently.
+type StreamObserver interface {
+	// Connected is called when es has connected to the event stream at
+	// url.
+	Connected(es *EventSubscription, url string)
+
+	// Disconnected is called with the error that ended a connection of es,
+	// or that an attempt to connect failed with. The error is the
+	// subscription's context.Canceled once it is closed.
+	Disconnected(es *EventSubscription, err error)
+
+	// Received is called with each event es receives, before it is
+	// filtered.
+	Received(es *EventSubscription, e *Event)
+}
+
+// Clock tells the time.
+type Clock interface {
+	Now() time.Time
+}
+
+// MetricsSink receives metrics from the package's components, e.g. to export
+// them to Prometheus. Labels are given as alternating names and values.
+// Implementations must be safe for concurrent use.
+type MetricsSink interface {
+	// Add adds delta to the counter name.
+	Add(name string, delta float64, labels ...string)
+
+	// Set sets the gauge name to value.
+	Set(name string, value float64, labels ...string)
+}
+
+// Names of the metrics reported to a MetricsSink.
+const (
+	// MetricEventsReceived counts events received from LiteFS, labeled by
+	// "type".
+	MetricEventsReceived = "litefs_events_received_total"
+
+	// MetricReconnects counts subscriptions reconnecting after an error.
+	MetricReconnects = "litefs_reconnects_total"
+
+	// MetricDecodeErrors counts events that couldn't be decoded.
+	MetricDecodeErrors = "litefs_decode_errors_total"
+
+	// MetricEventsDropped counts events dropped because a subscriber was
+	// too slow.
+	MetricEventsDropped = "litefs_events_dropped_total"
+)
+
+// now returns the current time from the configured clock.
+func (s *settings) now() time.Time {
+	if s.clock == nil {
+		return time.Now()
+	}
+	return s.clock.Now()
+}
+
+// log logs msg if a logger is configured.
+func (s *settings) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	if s.logger != nil {
+		s.logger.LogAttrs(context.Background(), level, msg, attrs...)
+	}
+}
+
+// add adds delta to a counter if a metrics sink is configured.
+func (s *settings) add(name string, delta float64, labels ...string) {
+	if s.metrics != nil {
+		s.metrics.Add(name, delta, labels...)
+	}
+}
+
+// subscribeOptions returns opts followed by extra as subscription options.
+func subscribeOptions(opts []Option, extra ...SubscribeOption) []SubscribeOption {
+	subOpts := make([]SubscribeOption, 0, len(opts)+len(extra))
+	for _, opt := range opts {
+		subOpts = append(subOpts, opt)
+	}
+	return append(subOpts, extra...)
+}
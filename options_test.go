@@ -0,0 +1,192 @@
+package litefs
+
+import (
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOptions(t *testing.T) {
+	t.Run("subscription", func(t *testing.T) {
+		mockServer(t, initEventJSON, "{", hold, txEventJSON, txEventJSON, hold)
+		sink := &memoryMetrics{}
+
+		es := SubscribeEvents(WithMetrics(sink), WithReconnect(Backoff{Min: time.Millisecond}))
+		t.Cleanup(es.Close)
+
+		// the decode error is reported and the subscription reconnects.
+		assertReadEvent(t, es, initEvent)
+		if err := readError(t, es); err == nil {
+			t.Fatal("expected decode error")
+		}
+		assertReadEvent(t, es, txEvent)
+		assertReadEvent(t, es, txEvent)
+
+		for key, expected := range map[string]float64{
+			MetricEventsReceived + " type=init": 1,
+			MetricEventsReceived + " type=tx":   2,
+			MetricDecodeErrors:                  1,
+			MetricReconnects:                    1,
+		} {
+			if n := sink.get(key); n != expected {
+				t.Fatalf("expected %s to be %v, got %v", key, expected, n)
+			}
+		}
+	})
+
+	t.Run("broker", func(t *testing.T) {
+		clock := &fixedClock{t: time.Unix(0, 0)}
+		b := mockServerBroker(t, hold)
+		sub := b.Subscribe(WithClock(clock))
+		t.Cleanup(sub.Close)
+
+		b.Publish(txEvent)
+		time.Sleep(10 * time.Millisecond)
+		clock.add(time.Minute)
+		assertReadEvent(t, sub, txEvent)
+
+		// lag is recorded once delivery completes.
+		deadline := time.Now().Add(time.Second)
+		for sub.Stats().Lag != time.Minute {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected lag of a minute, got %s", sub.Stats().Lag)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	})
+
+	t.Run("observer", func(t *testing.T) {
+		mockServer(t, initEventJSON, txEventJSON)
+		o := &recordingObserver{}
+
+		es := SubscribeEvents(WithObserver(o), WithReconnect(Backoff{Min: time.Hour}))
+		t.Cleanup(es.Close)
+
+		assertReadEvent(t, es, initEvent)
+		assertReadEvent(t, es, txEvent)
+		if err := readError(t, es); err == nil {
+			t.Fatal("expected error")
+		}
+
+		expected := []string{"connected", "received init", "received tx", "disconnected"}
+		if calls := o.get(); strings.Join(calls, ",") != strings.Join(expected, ",") {
+			t.Fatalf("expected %q, got %q", expected, calls)
+		}
+	})
+
+	t.Run("logger", func(t *testing.T) {
+		mockServer(t, initEventJSON, pChangeNode2EventJSON, "{", hold)
+		var buf syncBuffer
+		logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+		es := SubscribeEvents(WithLogger(logger), WithReconnect(Backoff{Min: time.Hour}))
+		t.Cleanup(es.Close)
+
+		assertReadEvent(t, es, initEvent)
+		assertReadEvent(t, es, pChangeNode2Event)
+		if err := readError(t, es); err == nil {
+			t.Fatal("expected decode error")
+		}
+
+		for _, msg := range []string{
+			`msg="connected to event stream"`,
+			`msg="primary changed" event.type=primaryChange event.isPrimary=false event.hostname=node-2`,
+			`msg="couldn't decode event"`,
+			`msg="event stream disconnected, retrying"`,
+		} {
+			if !strings.Contains(buf.String(), msg) {
+				t.Fatalf("expected log to contain %s, got:\n%s", msg, buf.String())
+			}
+		}
+	})
+}
+
+// recordingObserver is a StreamObserver that records the calls made to it.
+type recordingObserver struct {
+	m     sync.Mutex
+	calls []string
+}
+
+func (o *recordingObserver) Connected(es *EventSubscription, url string) {
+	o.record("connected")
+}
+
+func (o *recordingObserver) Disconnected(es *EventSubscription, err error) {
+	o.record("disconnected")
+}
+
+func (o *recordingObserver) Received(es *EventSubscription, e *Event) {
+	o.record("received " + e.Type)
+}
+
+func (o *recordingObserver) record(call string) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	o.calls = append(o.calls, call)
+}
+
+func (o *recordingObserver) get() []string {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return append([]string(nil), o.calls...)
+}
+
+// memoryMetrics is a MetricsSink that keeps metrics in memory, keyed by name
+// and labels.
+type memoryMetrics struct {
+	m      sync.Mutex
+	values map[string]float64
+}
+
+func (s *memoryMetrics) Add(name string, delta float64, labels ...string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]float64)
+	}
+	s.values[metricKey(name, labels)] += delta
+}
+
+func (s *memoryMetrics) Set(name string, value float64, labels ...string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.values == nil {
+		s.values = make(map[string]float64)
+	}
+	s.values[metricKey(name, labels)] = value
+}
+
+func (s *memoryMetrics) get(key string) float64 {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return s.values[key]
+}
+
+func metricKey(name string, labels []string) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for i := 0; i+1 < len(labels); i += 2 {
+		b.WriteString(" " + labels[i] + "=" + labels[i+1])
+	}
+	return b.String()
+}
+
+// fixedClock is a Clock that only moves when told to.
+type fixedClock struct {
+	m sync.Mutex
+	t time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.t
+}
+
+func (c *fixedClock) add(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.t = c.t.Add(d)
+}
@@ -0,0 +1,68 @@
+package litefs
+
+import (
+	"path/filepath"
+	"strconv"
+)
+
+// DefaultAPIPort is the port LiteFS serves its HTTP API on by default.
+const DefaultAPIPort = 20202
+
+// EventsPath is the path of the event stream on the LiteFS API.
+const EventsPath = "/events"
+
+// Files LiteFS exposes in its mount directory alongside each database.
+const (
+	// PrimaryFile is the name of the file in the mount directory that holds
+	// the primary's hostname. It only exists on replicas.
+	PrimaryFile = ".primary"
+
+	// PosSuffix is appended to a database's path to name the file holding
+	// its replication position.
+	PosSuffix = "-pos"
+
+	// LockSuffix is appended to a database's path to name the file used for
+	// the HALT lock.
+	LockSuffix = "-lock"
+)
+
+// FlyReplayHeader is the response header the LiteFS proxy sets to have the
+// Fly.io proxy replay a request on another instance, e.g. a write on the
+// primary.
+const FlyReplayHeader = "Fly-Replay"
+
+// FlyReplaySrcHeader is the request header the Fly.io proxy sets on replayed
+// requests to describe where they were replayed from, including the state
+// given in the Fly-Replay header.
+const FlyReplaySrcHeader = "Fly-Replay-Src"
+
+// FlyRegionHeader is the request header the Fly.io proxy sets to the region
+// of the edge that received a request. It is kept when requests are replayed.
+const FlyRegionHeader = "Fly-Region"
+
+// ForwardedHeader is the request header ForwardWrites sets on the requests it
+// forwards, so that a request isn't forwarded again by a node that is no
+// longer the primary.
+const ForwardedHeader = "Litefs-Forwarded"
+
+// APIURL returns the URL of path on the LiteFS API listening on port of the
+// local host.
+func APIURL(port int, path string) string {
+	return "http://localhost:" + strconv.Itoa(port) + path
+}
+
+// PosPath returns the path of the position file of the database at
+// databasePath.
+func PosPath(databasePath string) string {
+	return databasePath + PosSuffix
+}
+
+// LockPath returns the path of the lock file of the database at databasePath.
+func LockPath(databasePath string) string {
+	return databasePath + LockSuffix
+}
+
+// PrimaryPath returns the path of the PrimaryFile in the mount directory dir.
+func PrimaryPath(dir string) string {
+	return filepath.Join(dir, PrimaryFile)
+}
@@ -0,0 +1,20 @@
+package litefs
+
+import (
+	"testing"
+)
+
+func TestPaths(t *testing.T) {
+	if s := APIURL(DefaultAPIPort, EventsPath); s != "http://localhost:20202/events" {
+		t.Fatalf("wrong URL: %s", s)
+	}
+	if s := PosPath("/litefs/db"); s != "/litefs/db-pos" {
+		t.Fatalf("wrong path: %s", s)
+	}
+	if s := LockPath("/litefs/db"); s != "/litefs/db-lock" {
+		t.Fatalf("wrong path: %s", s)
+	}
+	if s := PrimaryPath("/litefs"); s != "/litefs/.primary" {
+		t.Fatalf("wrong path: %s", s)
+	}
+}
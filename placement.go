@@ -0,0 +1,247 @@
+package litefs
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WriteOrigins counts write requests by the region they came from, as given by
+// the Fly-Region header.
+//
+// Wrap handlers with its middleware inside ReplayWrites or Router.Middleware on
+// every node, so that writes are counted once, by the primary, wherever they
+// were received. Writes that replicas make through the HALT lock aren't
+// counted.
+type WriteOrigins struct {
+	// Region is counted for requests without a Fly-Region header. It must be
+	// set before the middleware is used.
+	Region string
+
+	m      sync.Mutex
+	counts map[string]uint64
+}
+
+// NewWriteOrigins returns a new *WriteOrigins that counts requests without a
+// Fly-Region header as coming from region.
+func NewWriteOrigins(region string) *WriteOrigins {
+	return &WriteOrigins{Region: region, counts: make(map[string]uint64)}
+}
+
+// Middleware returns a handler that counts write requests before passing them
+// to next. Requests with safe methods aren't counted.
+func (wo *WriteOrigins) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			region := r.Header.Get(FlyRegionHeader)
+			if region == "" {
+				region = wo.Region
+			}
+			wo.m.Lock()
+			wo.counts[region]++
+			wo.m.Unlock()
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Counts returns the number of write requests from each region since the
+// counts were last reset.
+func (wo *WriteOrigins) Counts() map[string]uint64 {
+	wo.m.Lock()
+	defer wo.m.Unlock()
+
+	counts := make(map[string]uint64, len(wo.counts))
+	for region, n := range wo.counts {
+		counts[region] = n
+	}
+	return counts
+}
+
+// Reset sets every count to zero.
+func (wo *WriteOrigins) Reset() {
+	wo.m.Lock()
+	defer wo.m.Unlock()
+
+	wo.counts = make(map[string]uint64)
+}
+
+// Placement is a recommendation of the region the primary should run in.
+type Placement struct {
+	// Current is the region of the current primary, or an empty string if it
+	// isn't known. It is known on the primary, and on replicas if the
+	// advisor has a LatencyMap in which the primary appears.
+	Current string `json:"current"`
+
+	// Region is the region generating the most writes.
+	Region string `json:"region"`
+
+	// Writes are the number of writes from each region.
+	Writes map[string]uint64 `json:"writes"`
+
+	// Share is the fraction of writes from Region.
+	Share float64 `json:"share"`
+
+	// Latency is the mean replication latency from Current to Region, if it
+	// is known. It approximates how much each write from Region would save
+	// if the primary moved.
+	Latency time.Duration `json:"latency,omitempty"`
+
+	// Move is whether the primary should move to Region.
+	Move bool `json:"move"`
+}
+
+// PlacementAdvisor recommends moving the primary to the region generating most
+// writes, and optionally moves it.
+//
+// The exported fields configure the advisor and must be set before it is used.
+type PlacementAdvisor struct {
+	// Origins counts writes by region. Run advisors on every node; only the
+	// primary counts writes.
+	Origins *WriteOrigins
+
+	// Latency, if set, limits recommendations to regions with nodes, which
+	// are able to become primary, and supplies the latency between regions.
+	// Otherwise any region writes come from may be recommended.
+	Latency *LatencyMap
+
+	// Monitor reports the primary.
+	Monitor *PrimaryMonitor
+
+	// MinShare is the fraction of writes a region must generate for the
+	// primary to move there.
+	MinShare float64
+
+	// MinWrites is the number of writes that must be counted before the
+	// primary is moved, so that moves aren't based on a few requests.
+	MinWrites uint64
+
+	// Interval is how often Run evaluates placement. Counts are reset after
+	// each evaluation, so it is also the window writes are counted over.
+	Interval time.Duration
+
+	// Move, if set, is called by Run to move the primary when a placement
+	// recommends it, e.g. by promoting a node in the recommended region.
+	Move func(ctx context.Context, p *Placement) error
+
+	// OnError, if set, is called with errors evaluating or moving placement.
+	// Evaluation continues after an error.
+	OnError func(error)
+}
+
+// NewPlacementAdvisor returns a new *PlacementAdvisor that recommends moving
+// the primary to a region generating at least half of 1000 or more writes,
+// evaluated every 10 minutes.
+func NewPlacementAdvisor(origins *WriteOrigins, latency *LatencyMap, monitor *PrimaryMonitor) *PlacementAdvisor {
+	return &PlacementAdvisor{
+		Origins:   origins,
+		Latency:   latency,
+		Monitor:   monitor,
+		MinShare:  0.5,
+		MinWrites: 1000,
+		Interval:  10 * time.Minute,
+	}
+}
+
+// Recommend returns the placement of the primary recommended by the writes
+// counted so far.
+func (pa *PlacementAdvisor) Recommend(ctx context.Context) (*Placement, error) {
+	hostname, err := pa.Monitor.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	isPrimary, err := pa.Monitor.IsPrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot *LatencySnapshot
+	if pa.Latency != nil {
+		if snapshot, err = pa.Latency.Snapshot(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var current string
+	if isPrimary {
+		current = pa.Origins.Region
+	} else if snapshot != nil {
+		current = snapshot.Region(hostname)
+	}
+	return recommendPlacement(pa.Origins.Counts(), current, snapshot, pa.MinShare, pa.MinWrites), nil
+}
+
+// Run evaluates placement every Interval until ctx is done, calling Move when
+// the primary should move.
+func (pa *PlacementAdvisor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(pa.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := pa.evaluate(ctx); err != nil && pa.OnError != nil {
+				pa.OnError(err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (pa *PlacementAdvisor) evaluate(ctx context.Context) error {
+	p, err := pa.Recommend(ctx)
+	if err != nil {
+		return err
+	}
+	pa.Origins.Reset()
+
+	if !p.Move || pa.Move == nil {
+		return nil
+	}
+	return pa.Move(ctx, p)
+}
+
+// recommendPlacement recommends the region generating the most writes for a
+// primary in the region current. If snapshot is non-nil, only regions of nodes
+// in it are recommended.
+func recommendPlacement(writes map[string]uint64, current string, snapshot *LatencySnapshot, minShare float64, minWrites uint64) *Placement {
+	p := &Placement{Current: current, Writes: writes}
+
+	var candidates map[string]bool
+	if snapshot != nil {
+		candidates = make(map[string]bool)
+		for _, e := range snapshot.Entries {
+			candidates[e.WriterRegion] = true
+			candidates[e.ReaderRegion] = true
+		}
+	}
+
+	var total, most uint64
+	for _, region := range sortedKeys(writes) {
+		n := writes[region]
+		total += n
+		if n > most && (candidates == nil || candidates[region]) {
+			p.Region, most = region, n
+		}
+	}
+	if total == 0 {
+		return p
+	}
+	p.Share = float64(most) / float64(total)
+
+	if snapshot != nil {
+		for _, r := range snapshot.Regions() {
+			if r.From == p.Current && r.To == p.Region {
+				p.Latency = r.Mean
+			}
+		}
+	}
+
+	p.Move = p.Region != "" && p.Current != "" && p.Region != p.Current &&
+		p.Share >= minShare && total >= minWrites
+	return p
+}
@@ -0,0 +1,68 @@
+package litefs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWriteOrigins(t *testing.T) {
+	wo := NewWriteOrigins("ord")
+	h := wo.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, req := range []struct{ method, region string }{
+		{http.MethodPost, "ams"},
+		{http.MethodPut, "ams"},
+		{http.MethodDelete, ""},
+		{http.MethodGet, "syd"},
+	} {
+		r := httptest.NewRequest(req.method, "/", nil)
+		if req.region != "" {
+			r.Header.Set(FlyRegionHeader, req.region)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if expected := map[string]uint64{"ams": 2, "ord": 1}; !reflect.DeepEqual(wo.Counts(), expected) {
+		t.Fatalf("expected %v, got %v", expected, wo.Counts())
+	}
+	wo.Reset()
+	if len(wo.Counts()) != 0 {
+		t.Fatalf("expected no counts after reset, got %v", wo.Counts())
+	}
+}
+
+func TestRecommendPlacement(t *testing.T) {
+	snapshot := &LatencySnapshot{Entries: []LatencyEntry{
+		{Writer: "node-1", WriterRegion: "ord", Reader: "node-2", ReaderRegion: "ams", Count: 1, Mean: 90 * time.Millisecond},
+	}}
+	writes := map[string]uint64{"ams": 60, "ord": 30, "syd": 100}
+
+	// syd has no nodes, so ams is recommended.
+	p := recommendPlacement(writes, "ord", snapshot, 0.3, 100)
+	if p.Region != "ams" || !p.Move || p.Latency != 90*time.Millisecond || p.Share != 60.0/190 {
+		t.Fatalf("unexpected placement %+v", p)
+	}
+
+	// too few writes.
+	if p := recommendPlacement(writes, "ord", snapshot, 0.3, 1000); p.Move {
+		t.Fatalf("expected no move, got %+v", p)
+	}
+
+	// too small a share.
+	if p := recommendPlacement(writes, "ord", snapshot, 0.5, 100); p.Move {
+		t.Fatalf("expected no move, got %+v", p)
+	}
+
+	// without a latency map, any region may be recommended.
+	if p := recommendPlacement(writes, "ord", nil, 0.5, 100); p.Region != "syd" || !p.Move {
+		t.Fatalf("unexpected placement %+v", p)
+	}
+
+	// already in the busiest region.
+	if p := recommendPlacement(writes, "ams", snapshot, 0.3, 100); p.Move {
+		t.Fatalf("expected no move, got %+v", p)
+	}
+}
@@ -0,0 +1,171 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+var (
+	errInvalidTXID     = errors.New("invalid TXID")
+	errInvalidChecksum = errors.New("invalid checksum")
+	errInvalidPos      = errors.New("invalid position")
+)
+
+////
+// TXID, Checksum & Pos mirror the types of the same names in the ltx repo.
+
+// TXID represents a LiteFS transaction ID.
+type TXID uint64
+
+// ParseTXID parses a 16-character hex string into a TXID.
+func ParseTXID(s string) (TXID, error) {
+	if len(s) != 16 {
+		return 0, fmt.Errorf("%w: %q", errInvalidTXID, s)
+	}
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", errInvalidTXID, s)
+	}
+	return TXID(v), nil
+}
+
+// String returns id as a 16-character hex string.
+func (id TXID) String() string {
+	return fmt.Sprintf("%016x", uint64(id))
+}
+
+func (id TXID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *TXID) UnmarshalText(data []byte) (err error) {
+	*id, err = ParseTXID(string(data))
+	return err
+}
+
+// Checksum represents an LTX checksum.
+type Checksum uint64
+
+// ParseChecksum parses a 16-character hex string into a Checksum.
+func ParseChecksum(s string) (Checksum, error) {
+	if len(s) != 16 {
+		return 0, fmt.Errorf("%w: %q", errInvalidChecksum, s)
+	}
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", errInvalidChecksum, s)
+	}
+	return Checksum(v), nil
+}
+
+// String returns c as a 16-character hex string.
+func (c Checksum) String() string {
+	return fmt.Sprintf("%016x", uint64(c))
+}
+
+func (c Checksum) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Checksum) UnmarshalText(data []byte) (err error) {
+	*c, err = ParseChecksum(string(data))
+	return err
+}
+
+// Pos represents the replication position of a database.
+type Pos struct {
+	TXID              TXID     `json:"txid"`
+	PostApplyChecksum Checksum `json:"postApplyChecksum"`
+}
+
+// ParsePos parses a position in the "TXID/CHECKSUM" format used by LiteFS.
+func ParsePos(s string) (Pos, error) {
+	txid, chksum, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Pos{}, fmt.Errorf("%w: %q", errInvalidPos, s)
+	}
+
+	var pos Pos
+	var err error
+	if pos.TXID, err = ParseTXID(txid); err != nil {
+		return Pos{}, err
+	}
+	if pos.PostApplyChecksum, err = ParseChecksum(chksum); err != nil {
+		return Pos{}, err
+	}
+	return pos, nil
+}
+
+// String returns pos in the "TXID/CHECKSUM" format used by LiteFS.
+func (pos Pos) String() string {
+	return pos.TXID.String() + "/" + pos.PostApplyChecksum.String()
+}
+
+// IsZero reports whether pos is the zero position.
+func (pos Pos) IsZero() bool {
+	return pos == Pos{}
+}
+
+// Pos returns the position of the database after the transaction was applied.
+func (e *TxEventData) Pos() (Pos, error) {
+	txid, err := ParseTXID(e.TXID)
+	if err != nil {
+		return Pos{}, err
+	}
+	chksum, err := ParseChecksum(e.PostApplyChecksum)
+	if err != nil {
+		return Pos{}, err
+	}
+	return Pos{TXID: txid, PostApplyChecksum: chksum}, nil
+}
+
+// PosStore persists named positions so that consumers of the event stream can
+// resume where they left off after a restart.
+type PosStore interface {
+	// LoadPos returns the position saved under name, or the zero Pos if none
+	// has been saved.
+	LoadPos(ctx context.Context, name string) (Pos, error)
+
+	// SavePos saves pos under name.
+	SavePos(ctx context.Context, name string, pos Pos) error
+}
+
+// FilePosStore is a PosStore that keeps each position in a file in Dir. Dir
+// should not be inside the LiteFS mount.
+type FilePosStore struct {
+	Dir string
+}
+
+var _ PosStore = (*FilePosStore)(nil)
+
+func (s *FilePosStore) LoadPos(ctx context.Context, name string) (Pos, error) {
+	data, err := os.ReadFile(s.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return Pos{}, nil
+	} else if err != nil {
+		return Pos{}, err
+	}
+	return ParsePos(string(data))
+}
+
+func (s *FilePosStore) SavePos(ctx context.Context, name string, pos Pos) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+
+	// write to a temp file and rename so readers never see a partial write.
+	tmp := s.path(name) + ".tmp"
+	if err := os.WriteFile(tmp, []byte(pos.String()+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(name))
+}
+
+func (s *FilePosStore) path(name string) string {
+	return filepath.Join(s.Dir, name+".pos")
+}
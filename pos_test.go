@@ -0,0 +1,63 @@
+package litefs
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParsePos(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		pos, err := ParsePos("0000000000000027/83b05248774ce767\n")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if pos.TXID != 0x27 || pos.PostApplyChecksum != 0x83b05248774ce767 {
+			t.Fatalf("wrong pos: %#v", pos)
+		}
+		if s := pos.String(); s != "0000000000000027/83b05248774ce767" {
+			t.Fatalf("wrong string: %s", s)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, s := range []string{"", "27/83b05248774ce767", "0000000000000027", "000000000000002g/83b05248774ce767"} {
+			if _, err := ParsePos(s); err == nil {
+				t.Fatalf("expected error for %q", s)
+			}
+		}
+	})
+
+	t.Run("tx event", func(t *testing.T) {
+		pos, err := txEvent.Data.(*TxEventData).Pos()
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if pos.String() != "0000000000000027/83b05248774ce767" {
+			t.Fatalf("wrong pos: %s", pos)
+		}
+	})
+}
+
+func TestFilePosStore(t *testing.T) {
+	ctx := context.Background()
+	s := &FilePosStore{Dir: t.TempDir()}
+
+	pos, err := s.LoadPos(ctx, "db")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !pos.IsZero() {
+		t.Fatalf("expected zero pos, got %s", pos)
+	}
+
+	expected := Pos{TXID: 3, PostApplyChecksum: 4}
+	if err := s.SavePos(ctx, "db", expected); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pos, err = s.LoadPos(ctx, "db"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if pos != expected {
+		t.Fatalf("expected %s, got %s", expected, pos)
+	}
+}
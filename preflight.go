@@ -0,0 +1,209 @@
+package litefs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Preflight check names.
+const (
+	CheckMount       = "mount"
+	CheckEventAPI    = "event-api"
+	CheckRole        = "role"
+	CheckDatabase    = "database"
+	CheckJournalMode = "journal-mode"
+	CheckProxy       = "proxy"
+)
+
+// PreflightConfig describes the environment Preflight expects.
+type PreflightConfig struct {
+	// Dir is the LiteFS mount directory.
+	Dir string
+
+	// Databases are the names of databases that must exist in Dir.
+	Databases []string
+
+	// JournalMode, if set, is the journal mode the databases must use. "wal"
+	// requires WAL mode and any other value requires a rollback journal.
+	JournalMode string
+
+	// ProxyAddr, if set, is the address the LiteFS proxy must be listening on.
+	ProxyAddr string
+}
+
+// PreflightFailure is a failed preflight check.
+type PreflightFailure struct {
+	// Check is the name of the failed check, e.g. CheckMount.
+	Check string `json:"check"`
+
+	// Target is what was checked, e.g. a database name, if applicable.
+	Target string `json:"target,omitempty"`
+
+	Err error `json:"-"`
+}
+
+func (f PreflightFailure) Error() string {
+	if f.Target != "" {
+		return fmt.Sprintf("%s %s: %s", f.Check, f.Target, f.Err)
+	}
+	return fmt.Sprintf("%s: %s", f.Check, f.Err)
+}
+
+func (f PreflightFailure) Unwrap() error {
+	return f.Err
+}
+
+// PreflightError is returned by Preflight when any checks fail.
+type PreflightError struct {
+	Failures []PreflightFailure
+}
+
+func (e *PreflightError) Error() string {
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = f.Error()
+	}
+	return "preflight failed: " + strings.Join(msgs, "; ")
+}
+
+var (
+	errNotDirectory  = errors.New("not a directory")
+	errNoInitEvent   = errors.New("first event was not an init event")
+	errJournalMode   = errors.New("unexpected journal mode")
+	errNotSQLiteFile = errors.New("not a SQLite database")
+)
+
+// Preflight validates the environment before an application starts serving:
+// that the mount is reachable, the event API responds, the node's role can be
+// determined, the databases exist with the expected journal mode and the proxy
+// is listening. Every check is run and a *PreflightError listing the failures
+// is returned if any fail.
+func Preflight(ctx context.Context, config PreflightConfig) error {
+	var failures []PreflightFailure
+	fail := func(check, target string, err error) {
+		failures = append(failures, PreflightFailure{Check: check, Target: target, Err: err})
+	}
+
+	if config.Dir != "" {
+		if fi, err := os.Stat(config.Dir); err != nil {
+			fail(CheckMount, config.Dir, err)
+		} else if !fi.IsDir() {
+			fail(CheckMount, config.Dir, errNotDirectory)
+		}
+	}
+
+	if err := preflightEvents(ctx); err != nil {
+		check := CheckEventAPI
+		if errors.Is(err, errNoInitEvent) {
+			check = CheckRole
+		}
+		u, _ := eventsURL()
+		fail(check, u, err)
+	}
+
+	for _, name := range config.Databases {
+		path := filepath.Join(config.Dir, name)
+		if _, err := os.Stat(path); err != nil {
+			fail(CheckDatabase, name, err)
+			continue
+		}
+		if config.JournalMode != "" {
+			if err := checkJournalMode(path, config.JournalMode); err != nil {
+				fail(CheckJournalMode, name, err)
+			}
+		}
+	}
+
+	if config.ProxyAddr != "" {
+		var d net.Dialer
+		if conn, err := d.DialContext(ctx, "tcp", config.ProxyAddr); err != nil {
+			fail(CheckProxy, config.ProxyAddr, err)
+		} else {
+			_ = conn.Close()
+		}
+	}
+
+	if len(failures) != 0 {
+		return &PreflightError{Failures: failures}
+	}
+	return nil
+}
+
+// preflightEvents reads the first event from the event stream, which must be
+// an init event reporting the node's role.
+func preflightEvents(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	u, err := eventsURL()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", DefaultUserAgent)
+
+	resp, err := EventSubscriptionClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &ErrUnexpectedStatus{Code: resp.StatusCode}
+	}
+
+	var e Event
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		return err
+	}
+	if _, ok := e.Data.(*InitEventData); !ok {
+		return fmt.Errorf("%w: %s", errNoInitEvent, e.Type)
+	}
+	return nil
+}
+
+// sqliteHeader is the magic string at the start of a SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// checkJournalMode compares the file format version in the database header,
+// which is 2 in WAL mode and 1 otherwise, against mode. Empty databases have
+// no header yet and pass.
+func checkJournalMode(path, mode string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hdr := make([]byte, 20)
+	if _, err := io.ReadFull(f, hdr); err == io.EOF {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(hdr, sqliteHeader) {
+		return errNotSQLiteFile
+	}
+
+	wal := hdr[18] == 2
+	if wantWAL := strings.EqualFold(mode, "wal"); wal != wantWAL {
+		actual := "rollback"
+		if wal {
+			actual = "wal"
+		}
+		return fmt.Errorf("%w: %s", errJournalMode, actual)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreflight(t *testing.T) {
+	dir := t.TempDir()
+	writeDBHeader(t, filepath.Join(dir, "wal.db"), 2)
+	writeDBHeader(t, filepath.Join(dir, "rollback.db"), 1)
+
+	t.Run("ok", func(t *testing.T) {
+		mockServer(t, initEventJSON)
+
+		if err := Preflight(context.Background(), PreflightConfig{
+			Dir:         dir,
+			Databases:   []string{"wal.db"},
+			JournalMode: "wal",
+		}); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("failures", func(t *testing.T) {
+		mockServer(t, txEventJSON)
+
+		err := Preflight(context.Background(), PreflightConfig{
+			Dir:         dir,
+			Databases:   []string{"wal.db", "rollback.db", "missing.db"},
+			JournalMode: "wal",
+		})
+
+		var perr *PreflightError
+		if !errors.As(err, &perr) {
+			t.Fatalf("expected *PreflightError, got %v", err)
+		}
+		expected := []PreflightFailure{
+			{Check: CheckRole},
+			{Check: CheckJournalMode, Target: "rollback.db"},
+			{Check: CheckDatabase, Target: "missing.db"},
+		}
+		if len(perr.Failures) != len(expected) {
+			t.Fatalf("wrong failures: %s", perr)
+		}
+		for i, f := range perr.Failures {
+			if f.Check != expected[i].Check || (expected[i].Target != "" && f.Target != expected[i].Target) {
+				t.Fatalf("wrong failure %d: %s", i, f)
+			}
+		}
+	})
+
+	t.Run("event api", func(t *testing.T) {
+		statusServer(t, http.StatusNotFound)
+
+		err := Preflight(context.Background(), PreflightConfig{})
+
+		var perr *PreflightError
+		if !errors.As(err, &perr) || len(perr.Failures) != 1 || perr.Failures[0].Check != CheckEventAPI {
+			t.Fatalf("wrong error: %v", err)
+		}
+		if !errors.As(perr.Failures[0], new(*ErrUnexpectedStatus)) {
+			t.Fatalf("wrong failure: %s", perr.Failures[0])
+		}
+	})
+}
+
+// writeDBHeader writes a SQLite header with the given file format version.
+func writeDBHeader(t *testing.T, path string, version byte) {
+	t.Helper()
+
+	hdr := make([]byte, 100)
+	copy(hdr, sqliteHeader)
+	hdr[18], hdr[19] = version, version
+	if err := os.WriteFile(path, hdr, 0666); err != nil {
+		t.Fatal(err)
+	}
+}
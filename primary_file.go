@@ -0,0 +1,112 @@
+package litefs
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// PrimaryFilePollInterval is how often a PrimaryFileWatcher rereads the
+// PrimaryFile.
+var PrimaryFilePollInterval = 100 * time.Millisecond
+
+// PrimaryFileWatcher is an EventSource that follows the primary by polling
+// the PrimaryFile in the LiteFS mount rather than through the event stream,
+// for environments where the events endpoint is disabled or unreachable. It
+// emits an init event once the role is first read and a primaryChange event
+// whenever the primary changes.
+//
+// The file doesn't name the primary on the primary itself, so events
+// announcing that the local node is the primary have an empty hostname.
+type PrimaryFileWatcher struct {
+	dir  string
+	c    chan *Event
+	errc chan error
+	done chan struct{}
+	once sync.Once
+}
+
+// WatchPrimaryFile returns a new *PrimaryFileWatcher for the LiteFS mount
+// directory dir. Use it in place of an event subscription by returning it
+// from NewEventSource, or directly.
+func WatchPrimaryFile(dir string) *PrimaryFileWatcher {
+	w := &PrimaryFileWatcher{
+		dir:  dir,
+		c:    make(chan *Event),
+		errc: make(chan error),
+		done: make(chan struct{}),
+	}
+
+	spawn(w.run)
+
+	return w
+}
+
+// C returns a chan of primary events.
+func (w *PrimaryFileWatcher) C() <-chan *Event {
+	return w.c
+}
+
+// ErrC returns a chan of errors encountered reading the mount directory.
+func (w *PrimaryFileWatcher) ErrC() <-chan error {
+	return w.errc
+}
+
+// Close stops watching. Both channels are closed once polling stops.
+func (w *PrimaryFileWatcher) Close() {
+	w.once.Do(func() { close(w.done) })
+}
+
+func (w *PrimaryFileWatcher) run() {
+	defer close(w.c)
+	defer close(w.errc)
+
+	ticker := time.NewTicker(PrimaryFilePollInterval)
+	defer ticker.Stop()
+
+	var last string
+	known := false
+	for {
+		if hostname, err := w.read(); err != nil {
+			select {
+			case w.errc <- err:
+			case <-w.done:
+				return
+			}
+		} else if !known || hostname != last {
+			typ := EventTypePrimaryChange
+			if !known {
+				typ = EventTypeInit
+			}
+			last, known = hostname, true
+
+			select {
+			case w.c <- primaryEvent(typ, hostname == "", hostname):
+			case <-w.done:
+				return
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// read returns the primary's hostname, checking that the mount directory
+// exists since a missing PrimaryFile otherwise means the node is primary.
+func (w *PrimaryFileWatcher) read() (string, error) {
+	if _, err := os.Stat(w.dir); err != nil {
+		return "", err
+	}
+	return ReadPrimary(w.dir)
+}
+
+func primaryEvent(typ string, isPrimary bool, hostname string) *Event {
+	if typ == EventTypeInit {
+		return &Event{Type: typ, Data: &InitEventData{IsPrimary: isPrimary, Hostname: hostname}}
+	}
+	return &Event{Type: typ, Data: &PrimaryChangeEventData{IsPrimary: isPrimary, Hostname: hostname}}
+}
@@ -0,0 +1,44 @@
+package litefs
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatchPrimaryFile(t *testing.T) {
+	prev := PrimaryFilePollInterval
+	PrimaryFilePollInterval = 5 * time.Millisecond
+	t.Cleanup(func() { PrimaryFilePollInterval = prev })
+
+	dir := t.TempDir()
+	w := WatchPrimaryFile(dir)
+	t.Cleanup(w.Close)
+
+	assertReadEvent(t, w, &Event{Type: EventTypeInit, Data: &InitEventData{IsPrimary: true}})
+
+	if err := os.WriteFile(PrimaryPath(dir), []byte("node-2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertReadEvent(t, w, &Event{Type: EventTypePrimaryChange, Data: &PrimaryChangeEventData{Hostname: "node-2"}})
+
+	// a missing mount isn't mistaken for being the primary.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-w.ErrC():
+		if !os.IsNotExist(err) {
+			t.Fatalf("expected not exist error, got %v", err)
+		}
+	case e := <-w.C():
+		t.Fatalf("unexpected event: %v", e)
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	w.Close()
+	if e, ok := <-w.C(); ok {
+		t.Fatalf("expected C to be closed, got %v", e)
+	}
+}
@@ -0,0 +1,138 @@
+package litefs
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// ListenWhenPrimary returns a net.Listener for servers that must only run on
+// the primary, such as admin APIs and webhook receivers. It listens on addr
+// while the local node is the primary and stops listening when it is demoted,
+// leaving accepted connections open so that they finish gracefully. Accept
+// blocks while the node is a replica.
+//
+// The listener is closed when ctx is done or Close is called. If listening
+// fails, Accept returns the error and the listener is closed.
+func ListenWhenPrimary(ctx context.Context, network, addr string) net.Listener {
+	ctx, cancel := context.WithCancel(ctx)
+	l := &primaryListener{
+		ctx:     ctx,
+		cancel:  cancel,
+		network: network,
+		addr:    addr,
+		conns:   make(chan net.Conn),
+		errc:    make(chan error, 1),
+		watcher: NewRoleWatcher(),
+	}
+
+	spawn(l.run)
+
+	return l
+}
+
+type primaryListener struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	network string
+	addr    string
+	conns   chan net.Conn
+	errc    chan error
+	watcher *RoleWatcher
+	m       sync.Mutex
+
+	inner net.Listener // set while listening
+}
+
+func (l *primaryListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errc:
+		return nil, err
+	case <-l.ctx.Done():
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *primaryListener) Close() error {
+	l.cancel()
+	return nil
+}
+
+// Addr returns the address listened on while the node is the primary, or the
+// requested address otherwise.
+func (l *primaryListener) Addr() net.Addr {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.inner != nil {
+		return l.inner.Addr()
+	}
+	return listenAddr{network: l.network, addr: l.addr}
+}
+
+func (l *primaryListener) run() {
+	defer l.watcher.Close()
+	defer l.cancel()
+
+	for {
+		if err := l.watcher.Wait(l.ctx, RolePrimary); err != nil {
+			return
+		}
+
+		inner, err := net.Listen(l.network, l.addr)
+		if err != nil {
+			l.errc <- err
+			return
+		}
+		l.setInner(inner)
+
+		demoted := make(chan struct{})
+		spawn(func() { l.accept(inner, demoted) })
+
+		err = l.watcher.Wait(l.ctx, RoleReplica)
+		close(demoted)
+		l.setInner(nil)
+		_ = inner.Close()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// accept passes connections from inner to Accept until inner is closed.
+func (l *primaryListener) accept(inner net.Listener, demoted <-chan struct{}) {
+	for {
+		conn, err := inner.Accept()
+		if err != nil {
+			return
+		}
+
+		select {
+		case l.conns <- conn:
+		case <-demoted:
+			_ = conn.Close()
+			return
+		case <-l.ctx.Done():
+			_ = conn.Close()
+			return
+		}
+	}
+}
+
+func (l *primaryListener) setInner(inner net.Listener) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.inner = inner
+}
+
+// listenAddr is a net.Addr for an address that isn't being listened on.
+type listenAddr struct {
+	network string
+	addr    string
+}
+
+func (a listenAddr) Network() string { return a.network }
+func (a listenAddr) String() string  { return a.addr }
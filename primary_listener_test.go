@@ -0,0 +1,99 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenWhenPrimary(t *testing.T) {
+	src := newFakeSource()
+	useEventSource(t, func(...SubscribeOption) EventSource { return src })
+
+	l := ListenWhenPrimary(context.Background(), "tcp", "127.0.0.1:0")
+	t.Cleanup(func() { l.Close() })
+
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	// replicas don't listen.
+	src.c <- pChangeNode2Event
+	if _, err := net.DialTimeout("tcp", l.Addr().String(), 10*time.Millisecond); err == nil {
+		t.Fatal("expected replica not to listen")
+	}
+
+	src.c <- pChangeNode1Event
+	addr := waitListening(t, l)
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var server net.Conn
+	select {
+	case server = <-accepted:
+		defer server.Close()
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	// demotion stops listening but leaves connections open.
+	src.c <- pChangeNode2Event
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, 10*time.Millisecond)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("expected listener to close on demotion")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, err := client.Write([]byte("x")); err != nil {
+		t.Fatalf("expected connection to stay open: %s", err)
+	}
+	buf := make([]byte, 1)
+	if _, err := server.Read(buf); err != nil {
+		t.Fatalf("expected connection to stay open: %s", err)
+	}
+
+	l.Close()
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("expected Accept to return after Close")
+	}
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected net.ErrClosed, got %v", err)
+	}
+}
+
+// waitListening waits for l to listen and returns its address.
+func waitListening(t *testing.T, l net.Listener) string {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := l.Addr().(*net.TCPAddr); ok {
+			return l.Addr().String()
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -3,33 +3,90 @@ package litefs
 import (
 	"context"
 	"errors"
+	"os"
 	"sync"
+	"time"
 )
 
 var (
-	ErrNotReady = errors.New("awaiting first event")
-	ErrClosed   = errors.New("PrimaryMonitor closed")
+	ErrNotReady  = errors.New("awaiting first event")
+	ErrClosed    = errors.New("PrimaryMonitor closed")
+	ErrNoPrimary = errors.New("no primary")
 )
 
+// waitForPrimaryBackoff paces WaitForPrimary's reconnects while the local
+// LiteFS node isn't serving its event stream, e.g. while it starts up.
+var waitForPrimaryBackoff = Backoff{Min: 100 * time.Millisecond, Max: 2 * time.Second, Multiplier: 2, Jitter: 0.2}
+
+// WaitForPrimary blocks until the cluster has a primary, or ctx is done, and
+// returns its hostname. While a cluster bootstraps, the local node may not be
+// serving its event stream yet and no node may hold the lease; WaitForPrimary
+// reconnects until it is told of a primary, by the init event or a later
+// primaryChange event. If the local node is the primary and doesn't report
+// its own hostname, the hostname of this machine is returned.
+func WaitForPrimary(ctx context.Context) (string, error) {
+	es := NewEventSource(WithEventFilter(EventTypeInit, EventTypePrimaryChange), WithReconnect(waitForPrimaryBackoff))
+	defer es.Close()
+
+	for {
+		select {
+		case event, running := <-es.C():
+			if !running {
+				return "", ErrSubscriptionClosed
+			}
+			var isPrimary bool
+			var hostname string
+			switch data := event.Data.(type) {
+			case *InitEventData:
+				isPrimary, hostname = data.IsPrimary, data.Hostname
+			case *PrimaryChangeEventData:
+				isPrimary, hostname = data.IsPrimary, data.Hostname
+			}
+			if hostname != "" {
+				return hostname, nil
+			}
+			if isPrimary {
+				return os.Hostname()
+			}
+		case err, running := <-es.ErrC():
+			if err := sourceError(err, running); err != nil {
+				return "", err
+			}
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
 // PrimaryMonitor monitors the current primary status of the LiteFS cluster.
 type PrimaryMonitor struct {
-	es    *EventSubscription
-	ready chan struct{}
-	m     sync.RWMutex
+	es      EventSource
+	ready   chan struct{}
+	changed chan bool // nil unless the monitor backs a PrimaryTracker
+	m       sync.RWMutex
 
 	isPrimary bool
 	hostname  string
+	known     bool // whether isPrimary and hostname have been received
 	err       error
 }
 
 // NewPrimaryMonitor returns a new *PrimaryMonitor.
-func NewPrimaryMonitor() *PrimaryMonitor {
+func NewPrimaryMonitor(opts ...Option) *PrimaryMonitor {
+	return newPrimaryMonitor(subscribeOptions(opts), nil)
+}
+
+// newPrimaryMonitor returns a new *PrimaryMonitor subscribed with opts. If
+// changed is set, it is sent the role once it is first known and whenever it
+// changes, and closed when the monitor stops.
+func newPrimaryMonitor(opts []SubscribeOption, changed chan bool) *PrimaryMonitor {
 	pm := &PrimaryMonitor{
-		es:    SubscribeEvents(),
-		ready: make(chan struct{}),
+		es:      NewEventSource(opts...),
+		ready:   make(chan struct{}),
+		changed: changed,
 	}
 
-	go pm.run()
+	spawn(pm.run)
 
 	return pm
 }
@@ -91,6 +148,10 @@ func (pm *PrimaryMonitor) Close() {
 }
 
 func (pm *PrimaryMonitor) run() {
+	if pm.changed != nil {
+		defer close(pm.changed)
+	}
+
 	first := true
 
 	for {
@@ -121,11 +182,23 @@ func (pm *PrimaryMonitor) run() {
 
 func (pm *PrimaryMonitor) setData(isPrimary bool, hostname string) {
 	pm.m.Lock()
-	defer pm.m.Unlock()
-
+	changed := !pm.known || isPrimary != pm.isPrimary
 	pm.isPrimary = isPrimary
 	pm.hostname = hostname
+	pm.known = true
 	pm.err = nil
+	pm.m.Unlock()
+
+	if !changed || pm.changed == nil {
+		return
+	}
+
+	// replace an unreceived role with the latest one.
+	select {
+	case <-pm.changed:
+	default:
+	}
+	pm.changed <- isPrimary
 }
 
 func (pm *PrimaryMonitor) setError(err error) {
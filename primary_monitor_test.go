@@ -41,16 +41,16 @@ func TestPrimaryMonitor(t *testing.T) {
 		time.Sleep(5 * time.Millisecond)
 
 		hn, err := pm.Hostname()
-		if !errors.Is(err, errUnexpectedStatus) {
-			t.Fatalf("expected errUnexpectedStatus, got %v", err)
+		if !errors.As(err, new(*ErrUnexpectedStatus)) {
+			t.Fatalf("expected ErrUnexpectedStatus, got %v", err)
 		}
 		if hn != "node-1" {
 			t.Fatalf("expected node-1, got %s", hn)
 		}
 
 		ip, err := pm.IsPrimary()
-		if !errors.Is(err, errUnexpectedStatus) {
-			t.Fatalf("expected errUnexpectedStatus, got %v", err)
+		if !errors.As(err, new(*ErrUnexpectedStatus)) {
+			t.Fatalf("expected ErrUnexpectedStatus, got %v", err)
 		}
 		if !ip {
 			t.Fatal("expected isPrimary")
@@ -84,8 +84,8 @@ func TestPrimaryMonitor(t *testing.T) {
 		c <- status500
 
 		err := pm.WaitReady(context.Background())
-		if !errors.Is(err, errUnexpectedStatus) {
-			t.Fatalf("expected errUnexpectedStatus, got %v", err)
+		if !errors.As(err, new(*ErrUnexpectedStatus)) {
+			t.Fatalf("expected ErrUnexpectedStatus, got %v", err)
 		}
 
 		c <- initEventJSON
@@ -94,6 +94,41 @@ func TestPrimaryMonitor(t *testing.T) {
 	})
 }
 
+func TestWaitForPrimary(t *testing.T) {
+	backoff := waitForPrimaryBackoff
+	waitForPrimaryBackoff = Backoff{Min: time.Millisecond}
+	t.Cleanup(func() { waitForPrimaryBackoff = backoff })
+
+	const noPrimaryEventJSON = `{"type":"init","data":{"isPrimary":false}}`
+
+	t.Run("bootstrap", func(t *testing.T) {
+		// the node isn't serving events yet, then no node holds the lease.
+		mockServer(t, status500, noPrimaryEventJSON, flush, pChangeNode2EventJSON, hold)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		hostname, err := WaitForPrimary(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if hostname != "node-2" {
+			t.Fatalf("expected node-2, got %s", hostname)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		mockServer(t, noPrimaryEventJSON, hold)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		if _, err := WaitForPrimary(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected DeadlineExceeded, got %v", err)
+		}
+	})
+}
+
 func assertReady(t *testing.T, pm *PrimaryMonitor, to time.Duration) {
 	t.Helper()
 
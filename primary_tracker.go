@@ -0,0 +1,45 @@
+package litefs
+
+// PrimaryTracker tracks the primary status of the local node from the event
+// stream. Unlike PrimaryMonitor, it doesn't report errors: it holds the last
+// known status, which is that of a replica with no known primary until the
+// first event is received. It is backed by a PrimaryMonitor.
+type PrimaryTracker struct {
+	pm      *PrimaryMonitor
+	changed chan bool
+}
+
+// NewPrimaryTracker returns a new *PrimaryTracker.
+func NewPrimaryTracker(opts ...Option) *PrimaryTracker {
+	changed := make(chan bool, 1)
+	return &PrimaryTracker{
+		pm:      newPrimaryMonitor(subscribeOptions(opts, WithEventFilter(EventTypeInit, EventTypePrimaryChange)), changed),
+		changed: changed,
+	}
+}
+
+// IsPrimary reports whether the local node is the primary.
+func (pt *PrimaryTracker) IsPrimary() bool {
+	isPrimary, _ := pt.pm.IsPrimary()
+	return isPrimary
+}
+
+// PrimaryHostname returns the hostname of the primary, or an empty string if
+// it isn't known.
+func (pt *PrimaryTracker) PrimaryHostname() string {
+	hostname, _ := pt.pm.Hostname()
+	return hostname
+}
+
+// Changed returns a channel that receives whether the local node is the
+// primary once the status is first known and whenever it changes. Only the
+// latest status is kept if the receiver falls behind. The channel is closed
+// by Close.
+func (pt *PrimaryTracker) Changed() <-chan bool {
+	return pt.changed
+}
+
+// Close unsubscribes from the local LiteFS node's event stream.
+func (pt *PrimaryTracker) Close() {
+	pt.pm.Close()
+}
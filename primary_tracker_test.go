@@ -0,0 +1,93 @@
+package litefs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPrimaryTracker(t *testing.T) {
+	pt, c := mockServerTracker(t)
+
+	if pt.IsPrimary() || pt.PrimaryHostname() != "" {
+		t.Fatal("expected unknown status before first event")
+	}
+
+	c <- initEventJSON
+	c <- flush
+	assertChanged(t, pt, true)
+	if pt.PrimaryHostname() != "node-1" {
+		t.Fatalf("expected node-1, got %s", pt.PrimaryHostname())
+	}
+
+	c <- pChangeNode2EventJSON
+	c <- flush
+	assertChanged(t, pt, false)
+	if pt.IsPrimary() || pt.PrimaryHostname() != "node-2" {
+		t.Fatalf("expected replica of node-2, got %v, %s", pt.IsPrimary(), pt.PrimaryHostname())
+	}
+
+	// unchanged roles aren't notified.
+	c <- pChangeNode2EventJSON
+	c <- flush
+	select {
+	case isPrimary := <-pt.Changed():
+		t.Fatalf("unexpected notification: %v", isPrimary)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// only the latest status is kept.
+	c <- pChangeNode1EventJSON
+	c <- pChangeNode2EventJSON
+	c <- flush
+	time.Sleep(10 * time.Millisecond)
+	assertChanged(t, pt, false)
+
+	pt.Close()
+	select {
+	case _, ok := <-pt.Changed():
+		if ok {
+			t.Fatal("expected channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func assertChanged(t *testing.T, pt *PrimaryTracker, isPrimary bool) {
+	t.Helper()
+
+	select {
+	case actual := <-pt.Changed():
+		if actual != isPrimary || pt.IsPrimary() != isPrimary {
+			t.Fatalf("expected isPrimary=%v, got %v", isPrimary, actual)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func mockServerTracker(t *testing.T) (*PrimaryTracker, chan string) {
+	c := make(chan string)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for resp := range c {
+			switch resp {
+			case flush:
+				w.(http.Flusher).Flush()
+			default:
+				fmt.Fprintln(w, resp)
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	t.Cleanup(func() { close(c) })
+	EventSubscriptionURL = s.URL
+
+	pt := NewPrimaryTracker()
+	t.Cleanup(pt.Close)
+
+	return pt, c
+}
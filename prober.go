@@ -0,0 +1,214 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ProbesTable is the table Prober writes its probes to.
+const ProbesTable = "_litefs_probes"
+
+// Prober is synthetic monitoring for the whole replication path. It
+// periodically writes a tiny probe row on the primary, timing how long the
+// write takes to commit, and on every node times how long probes written by
+// other nodes take to arrive. Run it on every node.
+//
+// Replication latency is measured against the writer's clock, so it is only as
+// accurate as the nodes' clocks are synchronized.
+type Prober struct {
+	DB *sql.DB
+
+	// DatabasePath is the path of DB's file in the LiteFS mount.
+	DatabasePath string
+
+	// Hostname identifies the probes this node writes.
+	Hostname string
+
+	// Monitor reports the node's role. Only the primary writes probes unless
+	// Forward is set.
+	Monitor *PrimaryMonitor
+
+	// Forward causes replicas to write probes too, through the HALT lock, so
+	// that the latency of forwarded writes is measured.
+	Forward bool
+
+	// Interval is how often probes are written.
+	Interval time.Duration
+
+	// Commit records how long probe writes take to commit.
+	Commit *LatencyHistogram
+
+	// Replication records how long after they were written probes from
+	// other nodes were applied locally.
+	Replication *LatencyHistogram
+
+	// OnError, if set, is called with errors writing or reading probes.
+	// Probing continues after an error.
+	OnError func(error)
+
+	// seen holds the latest probe observed from each writer.
+	seen map[string]int64
+
+	m      sync.Mutex
+	byHost map[string]*LatencyHistogram
+}
+
+// NewProber returns a new *Prober that probes every 5 seconds.
+func NewProber(db *sql.DB, databasePath, hostname string, monitor *PrimaryMonitor) *Prober {
+	return &Prober{
+		DB:           db,
+		DatabasePath: databasePath,
+		Hostname:     hostname,
+		Monitor:      monitor,
+		Interval:     5 * time.Second,
+		Commit:       NewLatencyHistogram(),
+		Replication:  NewLatencyHistogram(),
+	}
+}
+
+// Init creates the probes table if it doesn't exist.
+func (p *Prober) Init(ctx context.Context) error {
+	return WithHaltContext(ctx, p.DatabasePath, func() error {
+		_, err := p.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+ProbesTable+` (
+	hostname TEXT PRIMARY KEY,
+	written_at INTEGER NOT NULL
+)`)
+		return err
+	})
+}
+
+// Run probes every Interval and measures the probes of other nodes as their
+// transactions arrive, until ctx is done.
+func (p *Prober) Run(ctx context.Context) error {
+	es := NewEventSource()
+	defer es.Close()
+
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	db := filepath.Base(p.DatabasePath)
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Probe(ctx); err != nil {
+				p.error(err)
+			}
+		case e, running := <-es.C():
+			if !running {
+				return ErrSubscriptionClosed
+			}
+			if e.Type != EventTypeTx || e.DB != db {
+				continue
+			}
+			if err := p.observe(ctx, time.Now()); err != nil {
+				p.error(err)
+			}
+		case err, running := <-es.ErrC():
+			if err := sourceError(err, running); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Probe writes a single probe and records its commit latency. It is a no-op on
+// replicas unless Forward is set.
+func (p *Prober) Probe(ctx context.Context) error {
+	isPrimary, err := p.Monitor.IsPrimary()
+	if err != nil {
+		return err
+	} else if !isPrimary && !p.Forward {
+		return nil
+	}
+
+	start := time.Now()
+	write := func() error {
+		_, err := p.DB.ExecContext(ctx, `INSERT INTO `+ProbesTable+` (hostname, written_at) VALUES (?, ?)
+ON CONFLICT (hostname) DO UPDATE SET written_at = excluded.written_at`,
+			p.Hostname, start.UnixNano(),
+		)
+		return err
+	}
+	if isPrimary {
+		err = write()
+	} else {
+		err = WithHaltContext(ctx, p.DatabasePath, write)
+	}
+	if err != nil {
+		return err
+	}
+
+	p.Commit.Observe(time.Since(start))
+	return nil
+}
+
+// observe records the replication latency of probes from other nodes that
+// haven't been seen yet.
+func (p *Prober) observe(ctx context.Context, now time.Time) error {
+	rows, err := p.DB.QueryContext(ctx, `SELECT hostname, written_at FROM `+ProbesTable+` WHERE hostname != ?`, p.Hostname)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if p.seen == nil {
+		p.seen = make(map[string]int64)
+	}
+	for rows.Next() {
+		var hostname string
+		var writtenAt int64
+		if err := rows.Scan(&hostname, &writtenAt); err != nil {
+			return err
+		}
+
+		prev, ok := p.seen[hostname]
+		p.seen[hostname] = writtenAt
+		// the first probe seen from a node may have been written long before
+		// this node started, so it isn't measured.
+		if ok && writtenAt > prev {
+			latency := now.Sub(time.Unix(0, writtenAt))
+			p.Replication.Observe(latency)
+			p.writer(hostname).Observe(latency)
+		}
+	}
+	return rows.Err()
+}
+
+// ReplicationFrom returns the replication latency of probes from each writer,
+// by hostname.
+func (p *Prober) ReplicationFrom() map[string]HistogramSnapshot {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	m := make(map[string]HistogramSnapshot, len(p.byHost))
+	for hostname, h := range p.byHost {
+		m[hostname] = h.Snapshot()
+	}
+	return m
+}
+
+func (p *Prober) writer(hostname string) *LatencyHistogram {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if p.byHost == nil {
+		p.byHost = make(map[string]*LatencyHistogram)
+	}
+	h, ok := p.byHost[hostname]
+	if !ok {
+		h = NewLatencyHistogram(p.Replication.buckets...)
+		p.byHost[hostname] = h
+	}
+	return h
+}
+
+func (p *Prober) error(err error) {
+	if p.OnError != nil {
+		p.OnError(err)
+	}
+}
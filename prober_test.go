@@ -0,0 +1,99 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProber(t *testing.T) {
+	mockServer(t, initEventJSON, hold)
+	pm := NewPrimaryMonitor()
+	t.Cleanup(pm.Close)
+	assertReady(t, pm, time.Second)
+
+	// the monitor keeps its own subscription; Run is given the fake source.
+	src := newFakeSource()
+	useEventSource(t, func(...SubscribeOption) EventSource { return src })
+
+	path := lockedDB(t, false)
+	db := openProbesDB(t)
+	writer := NewProber(db, path, "node-1", pm)
+	reader := NewProber(db, path, "node-2", pm)
+	reader.Interval = time.Hour
+	ctx := context.Background()
+
+	if err := writer.Init(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- reader.Run(ctx) }()
+
+	// events are handled in order, so a tx event has been handled once the
+	// next event is received.
+	tx := func(db string) {
+		src.c <- &Event{Type: EventTypeTx, DB: db}
+		src.c <- &Event{Type: EventTypeInit}
+	}
+
+	// the first probe seen from a node isn't measured.
+	if err := writer.Probe(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tx("db")
+	if n := reader.Replication.Snapshot().Count; n != 0 {
+		t.Fatalf("expected no observations, got %d", n)
+	}
+
+	// probes are only read on tx events for the prober's database.
+	time.Sleep(time.Millisecond)
+	if err := writer.Probe(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tx("other")
+	if n := reader.Replication.Snapshot().Count; n != 0 {
+		t.Fatalf("expected no observations, got %d", n)
+	}
+
+	tx("db")
+	if n := reader.Replication.Snapshot().Count; n != 1 {
+		t.Fatalf("expected 1 observation, got %d", n)
+	}
+	if from := reader.ReplicationFrom(); len(from) != 1 || from["node-1"].Count != 1 {
+		t.Fatalf("unexpected latencies by writer: %+v", from)
+	}
+	if n := writer.Commit.Snapshot().Count; n != 2 {
+		t.Fatalf("expected 2 commits, got %d", n)
+	}
+
+	src.Close()
+	if err := <-errc; !errors.Is(err, ErrSubscriptionClosed) {
+		t.Fatalf("expected ErrSubscriptionClosed, got %v", err)
+	}
+}
+
+// openProbesDB returns a stub database holding a ProbesTable.
+func openProbesDB(t *testing.T) *sql.DB {
+	probes := make(map[string]int64)
+
+	return openStubDB(t, func(query string, args []any) (stubResult, error) {
+		switch {
+		case strings.HasPrefix(query, "SELECT"):
+			result := stubResult{cols: []string{"hostname", "written_at"}}
+			for _, hostname := range sortedKeys(probes) {
+				if hostname != args[0].(string) {
+					result.rows = append(result.rows, []driver.Value{hostname, probes[hostname]})
+				}
+			}
+			return result, nil
+		case strings.HasPrefix(query, "INSERT"):
+			probes[args[0].(string)] = args[1].(int64)
+		}
+		return stubResult{affected: 1}, nil
+	})
+}
@@ -0,0 +1,97 @@
+package litefs
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/superfly/litefs-go/litefsconfig"
+)
+
+// ProxyTXIDCookie is the cookie the LiteFS proxy sets after a write to the
+// TXID the client must read at. The proxy waits for that TXID before passing
+// later requests carrying the cookie to the application.
+const ProxyTXIDCookie = "__txid"
+
+// ProxyConfig is the "proxy" section of a LiteFS configuration file, as read
+// by the litefsconfig package, with methods describing how the proxy fronts
+// the application.
+type ProxyConfig litefsconfig.ProxyConfig
+
+// LoadProxyConfig reads the proxy configuration from the LiteFS configuration
+// file at path, or from the first of litefsconfig.Paths that exists if path is
+// empty, as litefsconfig.Load does. A nil *ProxyConfig is returned if the file
+// doesn't configure the proxy.
+func LoadProxyConfig(path string) (*ProxyConfig, error) {
+	c, err := litefsconfig.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if c.Proxy.Addr == "" {
+		return nil, nil
+	}
+	proxy := ProxyConfig(c.Proxy)
+	return &proxy, nil
+}
+
+// Enabled reports whether the LiteFS proxy is configured to run. It is safe
+// to call on a nil *ProxyConfig.
+func (c *ProxyConfig) Enabled() bool {
+	return c != nil && c.Addr != "" && c.Target != ""
+}
+
+// Fronts reports whether the LiteFS proxy forwards to an application listening
+// on addr, in which case the proxy already routes writes and applications
+// shouldn't forward them again. Only ports are compared since the proxy
+// target is usually a loopback address.
+func (c *ProxyConfig) Fronts(addr string) bool {
+	if !c.Enabled() {
+		return false
+	}
+	targetPort, err := c.TargetPort()
+	if err != nil {
+		return false
+	}
+	port, err := addrPort(addr)
+	return err == nil && port == targetPort
+}
+
+// Proxied reports whether r arrived through the LiteFS proxy, i.e. whether it
+// was received on a listener the proxy fronts. The proxy doesn't otherwise
+// mark the requests it passes on.
+func (c *ProxyConfig) Proxied(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && c.Fronts(addr.String())
+}
+
+// ProxyTXID returns the TXID in r's ProxyTXIDCookie.
+func ProxyTXID(r *http.Request) (TXID, bool) {
+	cookie, err := r.Cookie(ProxyTXIDCookie)
+	if err != nil {
+		return 0, false
+	}
+	txid, err := ParseTXID(cookie.Value)
+	return txid, err == nil
+}
+
+// TargetPort returns the port the proxy forwards to.
+func (c *ProxyConfig) TargetPort() (int, error) {
+	return addrPort(c.Target)
+}
+
+// BindAddr returns the address the application should listen on: the proxy
+// target if the proxy is enabled, or fallback otherwise.
+func (c *ProxyConfig) BindAddr(fallback string) string {
+	if !c.Enabled() {
+		return fallback
+	}
+	return c.Target
+}
+
+func addrPort(addr string) (int, error) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(port)
+}
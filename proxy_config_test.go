@@ -0,0 +1,84 @@
+package litefs
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadProxyConfig(t *testing.T) {
+	t.Setenv("APP_PORT", "8081")
+
+	path := filepath.Join(t.TempDir(), "litefs.yml")
+	if err := os.WriteFile(path, []byte(`
+fuse:
+  dir: /litefs
+proxy:
+  addr: ":8080"
+  target: "localhost:${APP_PORT}"
+  db: "db"
+  passthrough: ["*.ico"]
+  primary-redirect-timeout: 5s
+`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadProxyConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := &ProxyConfig{
+		Addr:                   ":8080",
+		Target:                 "localhost:8081",
+		DB:                     "db",
+		Passthrough:            []string{"*.ico"},
+		PrimaryRedirectTimeout: 5 * time.Second,
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("wrong config: %#v", c)
+	}
+
+	if !c.Enabled() {
+		t.Fatal("expected proxy to be enabled")
+	}
+	if !c.Fronts(":8081") || c.Fronts(":8080") {
+		t.Fatal("wrong Fronts result")
+	}
+	if addr := c.BindAddr(":3000"); addr != "localhost:8081" {
+		t.Fatalf("wrong bind addr: %s", addr)
+	}
+}
+
+func TestLoadProxyConfigSkipEnvExpansion(t *testing.T) {
+	t.Setenv("APP_PORT", "8081")
+
+	path := filepath.Join(t.TempDir(), "litefs.yml")
+	if err := os.WriteFile(path, []byte(`
+skip-env-expansion: true
+proxy:
+  addr: ":8080"
+  target: "localhost:${APP_PORT}"
+`), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadProxyConfig(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if c.Target != "localhost:${APP_PORT}" {
+		t.Fatalf("expected target to be unexpanded, got %q", c.Target)
+	}
+}
+
+func TestProxyConfigDisabled(t *testing.T) {
+	var c *ProxyConfig
+	if c.Enabled() || c.Fronts(":8081") {
+		t.Fatal("expected nil config to be disabled")
+	}
+	if addr := c.BindAddr(":3000"); addr != ":3000" {
+		t.Fatalf("wrong bind addr: %s", addr)
+	}
+}
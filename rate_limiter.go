@@ -0,0 +1,94 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+)
+
+// RateLimitTable is the table RateLimiter stores its buckets in.
+const RateLimitTable = "_litefs_rate_limits"
+
+// RateLimiter is a token bucket rate limiter whose buckets are stored in a
+// LiteFS database so that every node in the cluster shares the same limits.
+// Buckets are updated while holding the HALT lock so that the limiter can be
+// used from replicas as well as the primary.
+type RateLimiter struct {
+	DB *sql.DB
+
+	// DatabasePath is the path of DB's file in the LiteFS mount. It is used
+	// to acquire the HALT lock.
+	DatabasePath string
+
+	// Rate is the number of tokens added to each bucket per second.
+	Rate float64
+
+	// Burst is the maximum number of tokens a bucket holds.
+	Burst float64
+}
+
+// Init creates the rate limit table if it doesn't exist.
+func (rl *RateLimiter) Init(ctx context.Context) error {
+	return WithHaltContext(ctx, rl.DatabasePath, func() error {
+		_, err := rl.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+RateLimitTable+` (
+	key TEXT PRIMARY KEY,
+	tokens REAL NOT NULL,
+	updated_at REAL NOT NULL
+)`)
+		return err
+	})
+}
+
+// Allow is shorthand for AllowN(ctx, key, 1).
+func (rl *RateLimiter) Allow(ctx context.Context, key string) (bool, error) {
+	return rl.AllowN(ctx, key, 1)
+}
+
+// AllowN reports whether n tokens could be taken from the bucket for key. The
+// tokens are only taken if they are all available.
+func (rl *RateLimiter) AllowN(ctx context.Context, key string, n float64) (allowed bool, err error) {
+	err = WithHaltContext(ctx, rl.DatabasePath, func() error {
+		tx, err := rl.DB.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		now := time.Now()
+		tokens, updatedAt := rl.Burst, now
+		var unix float64
+		switch err := tx.QueryRowContext(ctx, `SELECT tokens, updated_at FROM `+RateLimitTable+` WHERE key = ?`, key).Scan(&tokens, &unix); {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return err
+		default:
+			updatedAt = time.Unix(0, int64(unix*float64(time.Second)))
+		}
+
+		tokens, allowed = takeTokens(tokens, updatedAt, now, rl.Rate, rl.Burst, n)
+
+		if _, err := tx.ExecContext(ctx, `INSERT INTO `+RateLimitTable+` (key, tokens, updated_at) VALUES (?, ?, ?)
+ON CONFLICT (key) DO UPDATE SET tokens = excluded.tokens, updated_at = excluded.updated_at`,
+			key, tokens, float64(now.UnixNano())/float64(time.Second),
+		); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+	return allowed, err
+}
+
+// takeTokens refills a bucket holding tokens as of updatedAt up to now and
+// takes n tokens from it if they are available. It returns the number of
+// tokens left in the bucket.
+func takeTokens(tokens float64, updatedAt, now time.Time, rate, burst, n float64) (float64, bool) {
+	if elapsed := now.Sub(updatedAt).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*rate)
+	}
+	if tokens < n {
+		return tokens, false
+	}
+	return tokens - n, true
+}
@@ -0,0 +1,35 @@
+package litefs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTakeTokens(t *testing.T) {
+	start := time.Unix(0, 0)
+
+	for _, tc := range []struct {
+		name     string
+		tokens   float64
+		elapsed  time.Duration
+		n        float64
+		left     float64
+		expected bool
+	}{
+		{"available", 5, 0, 1, 4, true},
+		{"exhausted", 0.5, 0, 1, 0.5, false},
+		{"refilled", 0, 500 * time.Millisecond, 1, 0, true},
+		{"capped at burst", 1, time.Hour, 1, 9, true},
+		{"clock went backwards", 1, -time.Second, 1, 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			left, ok := takeTokens(tc.tokens, start, start.Add(tc.elapsed), 2, 10, tc.n)
+			if ok != tc.expected {
+				t.Fatalf("expected %t, got %t", tc.expected, ok)
+			}
+			if left != tc.left {
+				t.Fatalf("expected %f tokens left, got %f", tc.left, left)
+			}
+		})
+	}
+}
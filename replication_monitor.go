@@ -0,0 +1,212 @@
+package litefs
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultMaxLag is the replication lag beyond which a ReplicationMonitor
+// reports the node unhealthy by default.
+const DefaultMaxLag = 10 * time.Second
+
+// ReplicationMonitor tracks replication of every database from the local LiteFS
+// node's tx events: the last TXID of each and how long after it was committed
+// on the primary it was received. A node is unhealthy while any database lags
+// by more than MaxLag or the event stream is failing, which makes the monitor
+// suitable for health checks that take lagging replicas out of rotation.
+//
+// The exported fields configure the monitor and must be set before it is
+// used.
+type ReplicationMonitor struct {
+	// MaxLag is the lag beyond which the node is unhealthy.
+	MaxLag time.Duration
+
+	// Config, if set, supplies MaxLag in place of the field above so that it
+	// can be tuned at runtime. The field is used while Config's is zero.
+	Config *LiveConfig
+
+	es       EventSource
+	settings settings
+	m        sync.Mutex
+
+	dbs map[string]*replicationState
+	err error
+}
+
+type replicationState struct {
+	txid TXID
+	lag  time.Duration
+}
+
+// NewReplicationMonitor returns a new *ReplicationMonitor that reports lag
+// beyond DefaultMaxLag as unhealthy. Lag is measured with the clock set by
+// WithClock.
+func NewReplicationMonitor(opts ...Option) *ReplicationMonitor {
+	rm := &ReplicationMonitor{
+		MaxLag:   DefaultMaxLag,
+		es:       NewEventSource(subscribeOptions(opts, WithEventFilter(EventTypeInit, EventTypeTx))...),
+		settings: newSettings(opts),
+		dbs:      make(map[string]*replicationState),
+	}
+
+	spawn(rm.run)
+
+	return rm
+}
+
+// LastTXID returns the TXID of the last tx event received for db. It reports
+// false if none has been received.
+func (rm *ReplicationMonitor) LastTXID(db string) (TXID, bool) {
+	rm.m.Lock()
+	defer rm.m.Unlock()
+
+	state, ok := rm.dbs[db]
+	if !ok {
+		return 0, false
+	}
+	return state.txid, true
+}
+
+// LagDuration returns how long after it was committed the last tx event for db
+// was received, or zero if none has been received.
+func (rm *ReplicationMonitor) LagDuration(db string) time.Duration {
+	rm.m.Lock()
+	defer rm.m.Unlock()
+
+	if state, ok := rm.dbs[db]; ok {
+		return state.lag
+	}
+	return 0
+}
+
+// Databases returns the names of the databases tx events have been received
+// for, sorted.
+func (rm *ReplicationMonitor) Databases() []string {
+	rm.m.Lock()
+	defer rm.m.Unlock()
+
+	return sortedKeys(rm.dbs)
+}
+
+// Err returns the error the event stream last failed with, or nil if it has
+// received events since.
+func (rm *ReplicationMonitor) Err() error {
+	rm.m.Lock()
+	defer rm.m.Unlock()
+
+	return rm.err
+}
+
+// Unhealthy reports whether any database lags by more than MaxLag or the event
+// stream is failing.
+func (rm *ReplicationMonitor) Unhealthy() bool {
+	rm.m.Lock()
+	defer rm.m.Unlock()
+
+	if rm.err != nil {
+		return true
+	}
+	maxLag := rm.maxLag()
+	for _, state := range rm.dbs {
+		if state.lag > maxLag {
+			return true
+		}
+	}
+	return false
+}
+
+// maxLag returns MaxLag, from Config if it is set there.
+func (rm *ReplicationMonitor) maxLag() time.Duration {
+	if rm.Config != nil {
+		if d := rm.Config.Load().MaxLag; d > 0 {
+			return d
+		}
+	}
+	return rm.MaxLag
+}
+
+// ReplicationStatus is the body of a ReplicationMonitor's health endpoint.
+type ReplicationStatus struct {
+	Healthy   bool                         `json:"healthy"`
+	Error     string                       `json:"error,omitempty"`
+	Databases map[string]DatabaseLagStatus `json:"databases"`
+}
+
+// DatabaseLagStatus is the replication state of a database.
+type DatabaseLagStatus struct {
+	TXID string        `json:"txid"`
+	Lag  time.Duration `json:"lag"`
+}
+
+// ServeHTTP serves the monitor as a health endpoint: the ReplicationStatus as
+// JSON, with 503 Service Unavailable while the node is unhealthy.
+func (rm *ReplicationMonitor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := ReplicationStatus{
+		Healthy:   !rm.Unhealthy(),
+		Databases: make(map[string]DatabaseLagStatus),
+	}
+
+	rm.m.Lock()
+	if rm.err != nil {
+		status.Error = rm.err.Error()
+	}
+	for db, state := range rm.dbs {
+		status.Databases[db] = DatabaseLagStatus{TXID: state.txid.String(), Lag: state.lag}
+	}
+	rm.m.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Healthy {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// Close unsubscribes from the local LiteFS node's event stream.
+func (rm *ReplicationMonitor) Close() {
+	rm.es.Close()
+}
+
+func (rm *ReplicationMonitor) run() {
+	for {
+		select {
+		case event, running := <-rm.es.C():
+			if !running {
+				return
+			}
+			rm.observe(event)
+		case err, running := <-rm.es.ErrC():
+			if !running {
+				return
+			}
+			rm.m.Lock()
+			rm.err = err
+			rm.m.Unlock()
+		}
+	}
+}
+
+func (rm *ReplicationMonitor) observe(event *Event) {
+	rm.m.Lock()
+	defer rm.m.Unlock()
+
+	rm.err = nil
+
+	data, ok := event.Data.(*TxEventData)
+	if !ok {
+		return
+	}
+	txid, err := ParseTXID(data.TXID)
+	if err != nil {
+		return
+	}
+
+	var lag time.Duration
+	if !data.Timestamp.IsZero() {
+		lag = max(rm.settings.now().Sub(data.Timestamp), 0)
+	}
+	rm.dbs[event.DB] = &replicationState{txid: txid, lag: lag}
+}
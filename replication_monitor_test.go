@@ -0,0 +1,55 @@
+package litefs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReplicationMonitor(t *testing.T) {
+	const laggingTxEventJSON = `{"type":"tx","db":"other","data":{"txID":"0000000000000005","postApplyChecksum":"83b05248774ce767","timestamp":"2000-01-01T00:00:00Z"}}`
+	mockServer(t, initEventJSON, txEventJSON, flush, laggingTxEventJSON, hold)
+
+	clock := &fixedClock{t: time.Date(2000, 1, 1, 0, 0, 30, 0, time.UTC)}
+	rm := NewReplicationMonitor(WithClock(clock))
+	t.Cleanup(rm.Close)
+
+	deadline := time.Now().Add(time.Second)
+	for len(rm.Databases()) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 2 databases, got %v", rm.Databases())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if txid, ok := rm.LastTXID("db"); !ok || txid != 0x27 {
+		t.Fatalf("expected TXID 27 for db, got %s (%v)", txid, ok)
+	}
+	if lag := rm.LagDuration("db"); lag != 0 {
+		t.Fatalf("expected no lag for db, got %s", lag)
+	}
+	if lag := rm.LagDuration("other"); lag != 30*time.Second {
+		t.Fatalf("expected 30s lag for other, got %s", lag)
+	}
+	if _, ok := rm.LastTXID("missing"); ok {
+		t.Fatal("expected no TXID for missing database")
+	}
+	if !rm.Unhealthy() {
+		t.Fatal("expected unhealthy")
+	}
+
+	rec := httptest.NewRecorder()
+	rm.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", rec.Code)
+	}
+	var status ReplicationStatus
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if status.Healthy || status.Databases["other"].TXID != "0000000000000005" {
+		t.Fatalf("wrong status: %+v", status)
+	}
+}
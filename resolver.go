@@ -0,0 +1,85 @@
+package litefs
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Default Resolver settings.
+const (
+	DefaultResolveTTL         = 5 * time.Second
+	DefaultResolveNegativeTTL = time.Second
+	DefaultResolveTimeout     = 5 * time.Second
+)
+
+// Resolver resolves the addresses of LiteFS nodes, such as the primary that
+// writes are forwarded to. Results are cached so that it can be consulted on
+// every request, failed lookups are cached briefly so that a missing host
+// doesn't hammer the resolver, and concurrent lookups of the same host share
+// a single query.
+//
+// The exported fields configure the resolver and must be set before it is
+// used.
+type Resolver struct {
+	// Lookup returns the addresses of host. If nil, the system resolver is
+	// used. It may be replaced to resolve hosts some other way, e.g. over
+	// HTTP.
+	Lookup func(ctx context.Context, host string) ([]string, error)
+
+	// TTL is how long addresses are cached.
+	TTL time.Duration
+
+	// NegativeTTL is how long failed lookups are cached.
+	NegativeTTL time.Duration
+
+	// Timeout bounds each lookup.
+	Timeout time.Duration
+
+	cache ttlCache[[]string]
+}
+
+// NewResolver returns a new *Resolver using the system resolver and the
+// default TTLs.
+func NewResolver() *Resolver {
+	return &Resolver{
+		TTL:         DefaultResolveTTL,
+		NegativeTTL: DefaultResolveNegativeTTL,
+		Timeout:     DefaultResolveTimeout,
+	}
+}
+
+// Resolve returns the addresses of host.
+func (r *Resolver) Resolve(ctx context.Context, host string) ([]string, error) {
+	return r.cache.get(ctx, host, r.TTL, r.NegativeTTL, func(ctx context.Context) ([]string, error) {
+		if r.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+			defer cancel()
+		}
+
+		lookup := r.Lookup
+		if lookup == nil {
+			lookup = net.DefaultResolver.LookupHost
+		}
+		return lookup(ctx, host)
+	})
+}
+
+// ResolvePrimary returns the addresses of the current primary reported by pm.
+// ErrNoPrimary is returned while the cluster has no primary.
+func (r *Resolver) ResolvePrimary(ctx context.Context, pm *PrimaryMonitor) ([]string, error) {
+	hostname, err := pm.Hostname()
+	if err != nil {
+		return nil, err
+	} else if hostname == "" {
+		return nil, ErrNoPrimary
+	}
+	return r.Resolve(ctx, hostname)
+}
+
+// Forget drops any cached result for host, e.g. after a connection to one of
+// its addresses fails.
+func (r *Resolver) Forget(host string) {
+	r.cache.forget(host)
+}
@@ -0,0 +1,153 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestResolver(t *testing.T) {
+	t.Run("caches addresses", func(t *testing.T) {
+		r, calls := countingResolver(func(host string) ([]string, error) {
+			return []string{"fdaa::" + host}, nil
+		})
+		r.TTL = 20 * time.Millisecond
+
+		for i := 0; i < 3; i++ {
+			assertResolve(t, r, "1", "fdaa::1")
+		}
+		assertResolve(t, r, "2", "fdaa::2")
+		if n := calls.Load(); n != 2 {
+			t.Fatalf("expected 2 lookups, got %d", n)
+		}
+
+		time.Sleep(30 * time.Millisecond)
+		assertResolve(t, r, "1", "fdaa::1")
+		if n := calls.Load(); n != 3 {
+			t.Fatalf("expected expired address to be looked up again, got %d lookups", n)
+		}
+
+		r.Forget("1")
+		assertResolve(t, r, "1", "fdaa::1")
+		if n := calls.Load(); n != 4 {
+			t.Fatalf("expected forgotten address to be looked up again, got %d lookups", n)
+		}
+	})
+
+	t.Run("caches failures", func(t *testing.T) {
+		errLookup := errors.New("no such host")
+		r, calls := countingResolver(func(host string) ([]string, error) {
+			return nil, errLookup
+		})
+		r.NegativeTTL = 20 * time.Millisecond
+
+		for i := 0; i < 3; i++ {
+			if _, err := r.Resolve(context.Background(), "gone"); !errors.Is(err, errLookup) {
+				t.Fatalf("expected lookup error, got %v", err)
+			}
+		}
+		if n := calls.Load(); n != 1 {
+			t.Fatalf("expected 1 lookup, got %d", n)
+		}
+
+		time.Sleep(30 * time.Millisecond)
+		_, _ = r.Resolve(context.Background(), "gone")
+		if n := calls.Load(); n != 2 {
+			t.Fatalf("expected expired failure to be looked up again, got %d lookups", n)
+		}
+	})
+
+	t.Run("deduplicates concurrent lookups", func(t *testing.T) {
+		release := make(chan struct{})
+		r, calls := countingResolver(func(host string) ([]string, error) {
+			<-release
+			return []string{"fdaa::1"}, nil
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assertResolve(t, r, "1", "fdaa::1")
+			}()
+		}
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if n := calls.Load(); n != 1 {
+			t.Fatalf("expected 1 lookup, got %d", n)
+		}
+	})
+
+	t.Run("abandoned lookup", func(t *testing.T) {
+		release := make(chan struct{})
+		r, calls := countingResolver(func(host string) ([]string, error) {
+			<-release
+			return []string{"fdaa::1"}, nil
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := r.Resolve(ctx, "1"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+
+		// the lookup carries on for other callers.
+		close(release)
+		assertResolve(t, r, "1", "fdaa::1")
+		if n := calls.Load(); n != 1 {
+			t.Fatalf("expected 1 lookup, got %d", n)
+		}
+	})
+
+	t.Run("primary", func(t *testing.T) {
+		r, _ := countingResolver(func(host string) ([]string, error) {
+			return []string{host + ".internal"}, nil
+		})
+		pm, c := mockServerMonitor(t)
+
+		c <- initEventJSON
+		c <- pChangeNode2EventJSON
+		c <- flush
+		assertReady(t, pm, 100*time.Millisecond)
+		assertPrimary(t, pm, false, "node-2")
+
+		addrs, err := r.ResolvePrimary(context.Background(), pm)
+		if err != nil || len(addrs) != 1 || addrs[0] != "node-2.internal" {
+			t.Fatalf("expected node-2.internal, got %v, %v", addrs, err)
+		}
+
+		c <- `{"type":"primaryChange","data":{"isPrimary":false}}`
+		c <- flush
+		assertPrimary(t, pm, false, "")
+		if _, err := r.ResolvePrimary(context.Background(), pm); !errors.Is(err, ErrNoPrimary) {
+			t.Fatalf("expected ErrNoPrimary, got %v", err)
+		}
+	})
+}
+
+func countingResolver(lookup func(host string) ([]string, error)) (*Resolver, *atomic.Int64) {
+	var calls atomic.Int64
+	r := NewResolver()
+	r.Lookup = func(ctx context.Context, host string) ([]string, error) {
+		calls.Add(1)
+		return lookup(host)
+	}
+	return r, &calls
+}
+
+func assertResolve(t *testing.T, r *Resolver, host, expected string) {
+	t.Helper()
+
+	addrs, err := r.Resolve(context.Background(), host)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err)
+	} else if len(addrs) != 1 || addrs[0] != expected {
+		t.Errorf("expected %s, got %v", expected, addrs)
+	}
+}
@@ -0,0 +1,131 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultRoleCacheTTL is how long a RoleCache reuses a lookup by default.
+const DefaultRoleCacheTTL = 100 * time.Millisecond
+
+// DefaultRoleLookupTimeout bounds how long a RoleCache waits for the init
+// event of the event stream by default.
+const DefaultRoleLookupTimeout = 5 * time.Second
+
+// ReadPrimary reads the hostname of the primary from the PrimaryFile in the
+// LiteFS mount directory dir. An empty hostname is returned if the file
+// doesn't exist, which means this node is the primary.
+func ReadPrimary(dir string) (string, error) {
+	data, err := os.ReadFile(PrimaryPath(dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// RoleCache answers role questions from lookups that are reused for a short
+// TTL, with concurrent lookups sharing a single read, so that request
+// handlers can consult it on every request without touching the mount each
+// time. Answers may be up to TTL out of date; use PrimaryMonitor to be
+// notified of changes as they happen.
+//
+// The exported fields configure the cache and must be set before it is used.
+type RoleCache struct {
+	// Dir is the LiteFS mount directory, whose PrimaryFile is read. If empty,
+	// the role is read from the init event of the local node's event
+	// stream instead, with a connection per lookup.
+	Dir string
+
+	// TTL is how long lookups, successful or not, are reused.
+	TTL time.Duration
+
+	// Timeout bounds how long a lookup waits for the event stream's init
+	// event. Zero uses DefaultRoleLookupTimeout. Lookups are shared, so they
+	// aren't bounded by the callers' contexts.
+	Timeout time.Duration
+
+	primary ttlCache[string]
+}
+
+// NewRoleCache returns a new *RoleCache for the LiteFS mount directory dir.
+func NewRoleCache(dir string) *RoleCache {
+	return &RoleCache{Dir: dir, TTL: DefaultRoleCacheTTL}
+}
+
+// DefaultRoleCache is the RoleCache used by IsPrimary. It reads the role from
+// the event stream; set its Dir to read the mount directory instead.
+var DefaultRoleCache = NewRoleCache("")
+
+// IsPrimary reports whether this node is the primary, using DefaultRoleCache.
+// It suits point-in-time decisions, such as routing a request, by apps that
+// don't keep a PrimaryMonitor running.
+func IsPrimary(ctx context.Context) (bool, error) {
+	return DefaultRoleCache.IsPrimary(ctx)
+}
+
+// PrimaryHostname returns the hostname of the primary, or an empty string if
+// this node is the primary. See ReadPrimary.
+func (rc *RoleCache) PrimaryHostname(ctx context.Context) (string, error) {
+	return rc.primary.get(ctx, "", rc.TTL, rc.TTL, func(ctx context.Context) (string, error) {
+		if rc.Dir == "" {
+			timeout := rc.Timeout
+			if timeout <= 0 {
+				timeout = DefaultRoleLookupTimeout
+			}
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return readPrimaryEvent(ctx)
+		}
+		return ReadPrimary(rc.Dir)
+	})
+}
+
+// IsPrimary reports whether this node is the primary.
+func (rc *RoleCache) IsPrimary(ctx context.Context) (bool, error) {
+	hostname, err := rc.PrimaryHostname(ctx)
+	return err == nil && hostname == "", err
+}
+
+// Invalidate drops cached lookups so that the next call reads the mount again,
+// e.g. after a primaryChange event.
+func (rc *RoleCache) Invalidate() {
+	rc.primary.forget("")
+}
+
+// readPrimaryEvent reads the hostname of the primary from the init event of
+// the local node's event stream, or an empty string if this node is the
+// primary. ErrNoPrimary is returned while the cluster has no primary.
+func readPrimaryEvent(ctx context.Context) (string, error) {
+	es := NewEventSource(WithEventFilter(EventTypeInit))
+	defer es.Close()
+
+	select {
+	case event, running := <-es.C():
+		if !running {
+			return "", ErrSubscriptionClosed
+		}
+		data, ok := event.Data.(*InitEventData)
+		switch {
+		case !ok:
+			return "", fmt.Errorf("unexpected init event data %T", event.Data)
+		case data.IsPrimary:
+			return "", nil
+		case data.Hostname == "":
+			return "", ErrNoPrimary
+		}
+		return data.Hostname, nil
+	case err, running := <-es.ErrC():
+		if !running {
+			return "", ErrSubscriptionClosed
+		}
+		return "", err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
@@ -0,0 +1,96 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRoleCache(t *testing.T) {
+	dir := t.TempDir()
+	rc := NewRoleCache(dir)
+	rc.TTL = 20 * time.Millisecond
+
+	assertRole(t, rc, true, "")
+
+	if err := os.WriteFile(filepath.Join(dir, PrimaryFile), []byte("node-2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assertRole(t, rc, true, "")
+
+	time.Sleep(30 * time.Millisecond)
+	assertRole(t, rc, false, "node-2")
+
+	if err := os.Remove(filepath.Join(dir, PrimaryFile)); err != nil {
+		t.Fatal(err)
+	}
+	rc.Invalidate()
+	assertRole(t, rc, true, "")
+}
+
+func TestIsPrimary(t *testing.T) {
+	rc := DefaultRoleCache
+	DefaultRoleCache = NewRoleCache("")
+	DefaultRoleCache.TTL = time.Hour
+	t.Cleanup(func() { DefaultRoleCache = rc })
+
+	// the stream is only served once, so the second lookup must be cached.
+	mockServer(t, pChangeNode2EventJSON, initEventJSON, hold)
+
+	for i := 0; i < 2; i++ {
+		isPrimary, err := IsPrimary(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !isPrimary {
+			t.Fatal("expected primary")
+		}
+	}
+}
+
+func TestRoleCacheEventLookup(t *testing.T) {
+	src := newFakeSource()
+	useEventSource(t, func(...SubscribeOption) EventSource { return src })
+	rc := NewRoleCache("")
+	rc.TTL = time.Hour
+
+	// a caller giving up doesn't fail the lookup it shares.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := rc.PrimaryHostname(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	go func() { src.c <- &Event{Type: EventTypeInit, Data: &InitEventData{Hostname: "node-2"}} }()
+	if hostname, err := rc.PrimaryHostname(context.Background()); err != nil || hostname != "node-2" {
+		t.Fatalf("unexpected result: %q, %v", hostname, err)
+	}
+
+	// lookups from a silent stream time out.
+	rc = NewRoleCache("")
+	rc.Timeout = 20 * time.Millisecond
+	src = newFakeSource()
+	start := time.Now()
+	if _, err := rc.PrimaryHostname(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	assertWithinDeadline(t, start, rc.Timeout)
+}
+
+func assertRole(t *testing.T, rc *RoleCache, isPrimary bool, hostname string) {
+	t.Helper()
+
+	actualHostname, err := rc.PrimaryHostname(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	actualIsPrimary, err := rc.IsPrimary(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if actualIsPrimary != isPrimary || actualHostname != hostname {
+		t.Fatalf("expected isPrimary=%t hostname=%q, got isPrimary=%t hostname=%q", isPrimary, hostname, actualIsPrimary, actualHostname)
+	}
+}
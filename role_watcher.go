@@ -0,0 +1,146 @@
+package litefs
+
+import (
+	"context"
+	"sync"
+)
+
+// Role is the role of a node in the cluster.
+type Role string
+
+// Node roles.
+const (
+	RolePrimary Role = "primary"
+	RoleReplica Role = "replica"
+)
+
+// RoleWatcher follows the role of the local node for code structured around
+// channels or blocking waits rather than callbacks.
+type RoleWatcher struct {
+	es   EventSource
+	done chan struct{}
+	m    sync.Mutex
+
+	role    Role
+	changed chan struct{} // closed when role changes
+	notify  []chan<- Role
+}
+
+// NewRoleWatcher returns a new *RoleWatcher.
+func NewRoleWatcher(opts ...Option) *RoleWatcher {
+	w := &RoleWatcher{
+		es:      NewEventSource(subscribeOptions(opts, WithEventFilter(EventTypeInit, EventTypePrimaryChange))...),
+		done:    make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+
+	spawn(w.run)
+
+	return w
+}
+
+// Role returns the role of the local node, or an empty string until it is
+// known.
+func (w *RoleWatcher) Role() Role {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.role
+}
+
+// Wait blocks until the local node has the given role. It returns
+// ErrSubscriptionClosed if the watcher is closed first.
+func (w *RoleWatcher) Wait(ctx context.Context, role Role) error {
+	for {
+		w.m.Lock()
+		current, changed := w.role, w.changed
+		w.m.Unlock()
+
+		if current == role {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-w.done:
+			return ErrSubscriptionClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Notify causes the local node's role to be sent to c whenever it changes.
+// As with signal.Notify, sends don't block, so c must have sufficient buffer
+// to keep up with changes.
+func (w *RoleWatcher) Notify(c chan<- Role) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	w.notify = append(w.notify, c)
+}
+
+// Stop causes c to no longer receive roles.
+func (w *RoleWatcher) Stop(c chan<- Role) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	for i, ch := range w.notify {
+		if ch == c {
+			w.notify = append(w.notify[:i], w.notify[i+1:]...)
+			return
+		}
+	}
+}
+
+// Close unsubscribes from the local LiteFS node's event stream.
+func (w *RoleWatcher) Close() {
+	w.es.Close()
+}
+
+func (w *RoleWatcher) run() {
+	defer close(w.done)
+
+	for {
+		select {
+		case event, running := <-w.es.C():
+			if !running {
+				return
+			}
+			switch data := event.Data.(type) {
+			case *InitEventData:
+				w.set(data.IsPrimary)
+			case *PrimaryChangeEventData:
+				w.set(data.IsPrimary)
+			}
+		case _, running := <-w.es.ErrC():
+			if !running {
+				return
+			}
+		}
+	}
+}
+
+func (w *RoleWatcher) set(isPrimary bool) {
+	role := RoleReplica
+	if isPrimary {
+		role = RolePrimary
+	}
+
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if role == w.role {
+		return
+	}
+	w.role = role
+	close(w.changed)
+	w.changed = make(chan struct{})
+
+	for _, c := range w.notify {
+		select {
+		case c <- role:
+		default:
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRoleWatcher(t *testing.T) {
+	w, c := mockServerWatcher(t)
+
+	roles := make(chan Role, 4)
+	w.Notify(roles)
+
+	waited := make(chan error, 1)
+	go func() { waited <- w.Wait(context.Background(), RoleReplica) }()
+
+	c <- initEventJSON
+	c <- flush
+	assertNotified(t, roles, RolePrimary)
+	if err := w.Wait(context.Background(), RolePrimary); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	c <- pChangeNode2EventJSON
+	c <- flush
+	assertNotified(t, roles, RoleReplica)
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	// stopped channels receive nothing more.
+	w.Stop(roles)
+	c <- pChangeNode1EventJSON
+	c <- flush
+	select {
+	case role := <-roles:
+		t.Fatalf("unexpected role: %s", role)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if role := w.Role(); role != RolePrimary {
+		t.Fatalf("expected primary, got %s", role)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := w.Wait(ctx, RoleReplica); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	w.Close()
+	if err := w.Wait(context.Background(), RoleReplica); !errors.Is(err, ErrSubscriptionClosed) {
+		t.Fatalf("expected ErrSubscriptionClosed, got %v", err)
+	}
+}
+
+func assertNotified(t *testing.T, c <-chan Role, role Role) {
+	t.Helper()
+
+	select {
+	case actual := <-c:
+		if actual != role {
+			t.Fatalf("expected %s, got %s", role, actual)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func mockServerWatcher(t *testing.T) (*RoleWatcher, chan string) {
+	c := make(chan string)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for resp := range c {
+			switch resp {
+			case flush:
+				w.(http.Flusher).Flush()
+			default:
+				fmt.Fprintln(w, resp)
+			}
+		}
+	}))
+	t.Cleanup(s.Close)
+	t.Cleanup(func() { close(c) })
+	EventSubscriptionURL = s.URL
+
+	w := NewRoleWatcher()
+	t.Cleanup(w.Close)
+
+	return w, c
+}
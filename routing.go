@@ -0,0 +1,155 @@
+package litefs
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"path/filepath"
+)
+
+var (
+	ErrPrimaryRequired = errors.New("write must run on the primary")
+)
+
+// RoutePolicy is how writes to a database are handled on replicas.
+type RoutePolicy int
+
+const (
+	// RouteForward requires writes to run on the primary. On replicas, the
+	// driver wrapper rejects them with ErrPrimaryRequired and the middleware
+	// hands write requests to the Router's Forward handler.
+	RouteForward RoutePolicy = iota
+
+	// RouteHalt lets replicas write by taking the HALT lock around each
+	// write statement.
+	RouteHalt
+
+	// RouteLocal lets replicas write without coordination, e.g. to a
+	// database that isn't replicated.
+	RouteLocal
+)
+
+func (p RoutePolicy) String() string {
+	switch p {
+	case RouteForward:
+		return "forward"
+	case RouteHalt:
+		return "halt"
+	case RouteLocal:
+		return "local"
+	default:
+		return "unknown"
+	}
+}
+
+// Router routes writes according to a policy per database, so that databases
+// with different write patterns can be served by one process. Until Monitor
+// is ready, the node is treated as a replica.
+//
+// The exported fields configure the router and must be set before it is used.
+type Router struct {
+	// Monitor reports the node's role.
+	Monitor *PrimaryMonitor
+
+	// Default is the policy of databases not in Databases.
+	Default RoutePolicy
+
+	// Databases maps database names to their policies.
+	Databases map[string]RoutePolicy
+
+	// Forward, if set, handles write requests that must run on the primary
+	// when received by a replica, e.g. by replaying them there or proxying
+	// them with ForwardWrites. Otherwise such requests receive a 421
+	// Misdirected Request response.
+	Forward http.Handler
+
+	// Config, if set, supplies DefaultRoute and Routes in place of Default
+	// and Databases so that policies can be changed at runtime.
+	Config *LiveConfig
+}
+
+// Policy returns the policy of the database named db.
+func (rt *Router) Policy(db string) RoutePolicy {
+	def, dbs := rt.Default, rt.Databases
+	if rt.Config != nil {
+		c := rt.Config.Load()
+		def, dbs = c.DefaultRoute, c.Routes
+	}
+
+	if p, ok := dbs[db]; ok {
+		return p
+	}
+	return def
+}
+
+// Wrap returns a connector for the database at databasePath whose write
+// statements follow the database's policy. Statements in explicit
+// transactions aren't routed individually; run such transactions in WithHalt.
+// Writes returning rows, e.g. INSERT ... RETURNING, hold the HALT lock until
+// their rows are closed. Use it with sql.OpenDB.
+func (rt *Router) Wrap(c driver.Connector, databasePath string) driver.Connector {
+	db := filepath.Base(databasePath)
+	return &hookConnector{Connector: c, hooks: &DriverHooks{
+		Exec: func(ctx context.Context, query string, fn func() error) error {
+			switch rt.statementPolicy(db, query) {
+			case RouteHalt:
+				return WithHaltContext(ctx, databasePath, fn)
+			case RouteLocal:
+				return fn()
+			default:
+				return ErrPrimaryRequired
+			}
+		},
+		Query: func(ctx context.Context, query string, fn func() (driver.Rows, error)) (driver.Rows, error) {
+			switch rt.statementPolicy(db, query) {
+			case RouteHalt:
+				return queryWithHalt(ctx, databasePath, fn)
+			case RouteLocal:
+				return fn()
+			default:
+				return nil, ErrPrimaryRequired
+			}
+		},
+	}}
+}
+
+// statementPolicy returns the policy query follows on the database named db.
+// Reads, and all statements on the primary, run locally.
+func (rt *Router) statementPolicy(db, query string) RoutePolicy {
+	if !IsWriteStatement(query) || rt.isPrimary() {
+		return RouteLocal
+	}
+	return rt.Policy(db)
+}
+
+// Middleware returns a function that wraps handlers serving the database
+// named db. On replicas, write requests to databases whose policy is
+// RouteForward are handed to Forward rather than next. Requests with safe
+// methods are always passed to next.
+func (rt *Router) Middleware(db string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if rt.Policy(db) != RouteForward || rt.isPrimary() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if rt.Forward != nil {
+				rt.Forward.ServeHTTP(w, r)
+				return
+			}
+			http.Error(w, ErrPrimaryRequired.Error(), http.StatusMisdirectedRequest)
+		})
+	}
+}
+
+func (rt *Router) isPrimary() bool {
+	isPrimary, err := rt.Monitor.IsPrimary()
+	return err == nil && isPrimary
+}
@@ -0,0 +1,126 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRouter(t *testing.T) {
+	pm, c := mockServerMonitor(t)
+	c <- pChangeNode2EventJSON
+	c <- flush
+	assertReady(t, pm, 5*time.Millisecond)
+
+	rt := &Router{
+		Monitor:   pm,
+		Default:   RouteForward,
+		Databases: map[string]RoutePolicy{"analytics.db": RouteHalt, "cache.db": RouteLocal},
+	}
+
+	t.Run("driver", func(t *testing.T) {
+		dir := t.TempDir()
+		open := func(name string) *sql.DB {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path+"-lock", nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+			db := sql.OpenDB(rt.Wrap(&fakeConnector{}, path))
+			t.Cleanup(func() { db.Close() })
+			return db
+		}
+
+		ctx := context.Background()
+		for name, expected := range map[string]error{
+			"app.db":       ErrPrimaryRequired,
+			"analytics.db": nil,
+			"cache.db":     nil,
+		} {
+			db := open(name)
+			if _, err := db.ExecContext(ctx, "SELECT 1"); err != nil {
+				t.Fatalf("%s: unexpected error reading: %s", name, err)
+			}
+			if _, err := db.ExecContext(ctx, "INSERT INTO t VALUES (1)"); !errors.Is(err, expected) {
+				t.Fatalf("%s: expected %v, got %v", name, expected, err)
+			}
+			rows, err := db.QueryContext(ctx, "WITH x AS (SELECT 1) INSERT INTO t SELECT * FROM x RETURNING id")
+			if !errors.Is(err, expected) {
+				t.Fatalf("%s: expected %v from query, got %v", name, expected, err)
+			} else if err == nil {
+				rows.Close()
+			}
+		}
+	})
+
+	t.Run("halt rows", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "analytics.db")
+		f, err := os.Create(LockPath(path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		db := sql.OpenDB(rt.Wrap(&fakeConnector{}, path))
+		t.Cleanup(func() { db.Close() })
+
+		// the HALT lock is held while the rows of a write are read.
+		rows, err := db.QueryContext(context.Background(), "INSERT INTO t VALUES (1) RETURNING id")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := tryHalt(f); !errors.Is(err, ErrHaltContended) {
+			t.Fatalf("expected ErrHaltContended while rows are open, got %v", err)
+		}
+		rows.Close()
+		if err := tryHalt(f); err != nil {
+			t.Fatalf("expected the lock to be released, got %v", err)
+		}
+		_ = Unhalt(f)
+	})
+
+	t.Run("middleware", func(t *testing.T) {
+		ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+		for _, tc := range []struct {
+			db     string
+			method string
+			status int
+		}{
+			{"app.db", http.MethodGet, http.StatusOK},
+			{"app.db", http.MethodPost, http.StatusMisdirectedRequest},
+			{"analytics.db", http.MethodPost, http.StatusOK},
+		} {
+			w := httptest.NewRecorder()
+			rt.Middleware(tc.db)(ok).ServeHTTP(w, httptest.NewRequest(tc.method, "/", nil))
+			if w.Code != tc.status {
+				t.Fatalf("%s %s: expected %d, got %d", tc.method, tc.db, tc.status, w.Code)
+			}
+		}
+
+		forward := *rt
+		forward.Forward = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+		w := httptest.NewRecorder()
+		forward.Middleware("app.db")(ok).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		if w.Code != http.StatusTeapot {
+			t.Fatalf("expected request to be forwarded, got %d", w.Code)
+		}
+	})
+
+	t.Run("primary", func(t *testing.T) {
+		c <- pChangeNode1EventJSON
+		c <- flush
+		assertPrimary(t, pm, true, "node-1")
+
+		db := sql.OpenDB(rt.Wrap(&fakeConnector{}, filepath.Join(t.TempDir(), "app.db")))
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.ExecContext(context.Background(), "INSERT INTO t VALUES (1)"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+}
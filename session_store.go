@@ -0,0 +1,172 @@
+package litefs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// sessionKeyPrefix namespaces session IDs within the KV.
+const sessionKeyPrefix = "session:"
+
+// Session is an HTTP session. Its API mirrors gorilla/sessions so that
+// applications can switch stores with few changes.
+type Session struct {
+	ID     string
+	Name   string
+	Values map[any]any
+	IsNew  bool
+
+	// MaxAge is the lifetime of the session in seconds. A negative value
+	// deletes the session when it is saved.
+	MaxAge int
+
+	store *SessionStore
+}
+
+// Save is shorthand for s.store.Save(r, w, s).
+func (s *Session) Save(r *http.Request, w http.ResponseWriter) error {
+	return s.store.Save(r, w, s)
+}
+
+type sessionRecord struct {
+	Values    map[any]any
+	ExpiresAt time.Time
+}
+
+// SessionStore is a gorilla-style session store backed by a KV. Session data is
+// written through the HALT lock and read from the local copy of the database.
+// A second cookie carries the position of the last write so that reads on a
+// replica wait for the session to replicate before loading it.
+type SessionStore struct {
+	KV *KV
+
+	// Path, Domain, MaxAge, Secure, HttpOnly and SameSite configure the
+	// cookies set by the store.
+	Path     string
+	Domain   string
+	MaxAge   int
+	Secure   bool
+	HttpOnly bool
+	SameSite http.SameSite
+
+	// MaxWait bounds how long a read waits for a session write to replicate.
+	MaxWait time.Duration
+}
+
+// NewSessionStore returns a new *SessionStore with sessions lasting 30 days.
+func NewSessionStore(kv *KV) *SessionStore {
+	return &SessionStore{
+		KV:       kv,
+		Path:     "/",
+		MaxAge:   86400 * 30,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		MaxWait:  5 * time.Second,
+	}
+}
+
+// Get returns the session name for r, or a new session if r has none. Unlike
+// gorilla/sessions, sessions are not cached per request.
+func (s *SessionStore) Get(r *http.Request, name string) (*Session, error) {
+	return s.New(r, name)
+}
+
+// New loads the session name for r. A new session is returned if r has no
+// session cookie or the session has expired. The read observes the session's
+// last write and honors any Consistency in r's context.
+func (s *SessionStore) New(r *http.Request, name string) (*Session, error) {
+	sess := &Session{Name: name, Values: make(map[any]any), IsNew: true, MaxAge: s.MaxAge, store: s}
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return sess, nil
+	}
+
+	var consistency Consistency
+	if c, err := r.Cookie(name + ".pos"); err == nil {
+		if token, err := ParseConsistencyToken(c.Value); err == nil {
+			consistency = ReadYourWrites(token)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.MaxWait)
+	defer cancel()
+
+	data, err := s.KV.Get(ctx, sessionKeyPrefix+c.Value, consistency)
+	if errors.Is(err, ErrNotFound) {
+		return sess, nil
+	} else if err != nil {
+		return sess, err
+	}
+
+	var rec sessionRecord
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&rec); err != nil {
+		return sess, err
+	}
+	if !rec.ExpiresAt.IsZero() && rec.ExpiresAt.Before(time.Now()) {
+		return sess, nil
+	}
+
+	sess.ID, sess.Values, sess.IsNew = c.Value, rec.Values, false
+	return sess, nil
+}
+
+// Save writes sess to the store and sets its cookies on w.
+func (s *SessionStore) Save(r *http.Request, w http.ResponseWriter, sess *Session) error {
+	if sess.MaxAge < 0 {
+		if sess.ID != "" {
+			if _, err := s.KV.Delete(r.Context(), sessionKeyPrefix+sess.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, s.cookie(sess.Name, "", -1))
+		http.SetCookie(w, s.cookie(sess.Name+".pos", "", -1))
+		return nil
+	}
+
+	if sess.ID == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		sess.ID = base64.RawURLEncoding.EncodeToString(b)
+	}
+
+	rec := sessionRecord{Values: sess.Values}
+	if sess.MaxAge > 0 {
+		rec.ExpiresAt = time.Now().Add(time.Duration(sess.MaxAge) * time.Second)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+		return err
+	}
+
+	token, err := s.KV.Put(r.Context(), sessionKeyPrefix+sess.ID, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, s.cookie(sess.Name, sess.ID, sess.MaxAge))
+	http.SetCookie(w, s.cookie(sess.Name+".pos", token.String(), sess.MaxAge))
+	return nil
+}
+
+func (s *SessionStore) cookie(name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     s.Path,
+		Domain:   s.Domain,
+		MaxAge:   maxAge,
+		Secure:   s.Secure,
+		HttpOnly: s.HttpOnly,
+		SameSite: s.SameSite,
+	}
+}
@@ -0,0 +1,75 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSessionStore(t *testing.T) {
+	useEventSource(t, func(...SubscribeOption) EventSource { return newFakeSource() })
+
+	path := lockedDB(t, false)
+	writePosFile(t, path, "0000000000000002/0000000000000000")
+	s := NewSessionStore(&KV{DB: openKVDB(t), DatabasePath: path})
+	s.MaxWait = 20 * time.Millisecond
+
+	// request returns a request carrying the cookies set by w.
+	request := func(w *httptest.ResponseRecorder) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range w.Result().Cookies() {
+			r.AddCookie(c)
+		}
+		return r
+	}
+
+	sess, err := s.Get(httptest.NewRequest(http.MethodGet, "/", nil), "sess")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if !sess.IsNew {
+		t.Fatal("expected a new session")
+	}
+
+	sess.Values["user"] = "alice"
+	w := httptest.NewRecorder()
+	if err := sess.Save(httptest.NewRequest(http.MethodPost, "/", nil), w); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 2 || cookies[0].Name != "sess" || cookies[1].Name != "sess.pos" || cookies[1].Value != "db=0000000000000002/0000000000000000" {
+		t.Fatalf("unexpected cookies: %v", cookies)
+	}
+
+	loaded, err := s.Get(request(w), "sess")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	} else if loaded.IsNew || loaded.ID != sess.ID || loaded.Values["user"] != "alice" {
+		t.Fatalf("unexpected session: %+v", loaded)
+	}
+
+	// a replica that hasn't caught up with the write times out.
+	writePosFile(t, path, "0000000000000001/0000000000000000")
+	if _, err := s.Get(request(w), "sess"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+	writePosFile(t, path, "0000000000000002/0000000000000000")
+
+	loaded.MaxAge = -1
+	w2 := httptest.NewRecorder()
+	if err := loaded.Save(httptest.NewRequest(http.MethodPost, "/", nil), w2); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, c := range w2.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			t.Fatalf("expected cookie %s to be cleared", c.Name)
+		}
+	}
+
+	// the deleted session isn't found from the old cookies.
+	if sess, err := s.Get(request(w), "sess"); err != nil || !sess.IsNew {
+		t.Fatalf("unexpected result: %+v, %v", sess, err)
+	}
+}
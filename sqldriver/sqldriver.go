@@ -0,0 +1,240 @@
+// Package sqldriver wraps a SQLite database/sql driver so that write
+// statements on a LiteFS replica fail fast with litefs.ErrPrimaryRequired
+// instead of failing inside LiteFS, optionally taking the HALT lock for
+// BEGIN IMMEDIATE transactions so that replicas can run them.
+//
+// Register a wrapped driver under its own name and open databases in the
+// LiteFS mount with it:
+//
+//	sql.Register("litefs-sqlite3", &sqldriver.Driver{
+//		Driver:    &sqlite3.SQLiteDriver{},
+//		IsPrimary: tracker.IsPrimary,
+//		HaltTx:    true,
+//	})
+//	db, err := sql.Open("litefs-sqlite3", "file:/litefs/app.db?_txlock=immediate")
+package sqldriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/superfly/litefs-go"
+)
+
+// Driver wraps a SQLite driver for databases in a LiteFS mount.
+//
+// The exported fields configure the driver and must be set before it is
+// registered.
+type Driver struct {
+	// Driver is the wrapped SQLite driver.
+	Driver driver.Driver
+
+	// IsPrimary reports whether the local node is the primary, e.g. the
+	// IsPrimary method of a *litefs.PrimaryTracker.
+	IsPrimary func() bool
+
+	// HaltTx causes transactions begun with BEGIN IMMEDIATE or BEGIN
+	// EXCLUSIVE on a replica to take the HALT lock until they end, rather
+	// than having their writes rejected. Transactions begun through
+	// database/sql are immediate if the name passed to Open sets _txlock to
+	// immediate or exclusive, as SQLite drivers accept.
+	HaltTx bool
+}
+
+// Open opens a connection to the database named by name, a path or "file:"
+// URI in the LiteFS mount.
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	c, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	s := &session{d: d, path: databasePath(name), immediate: immediateTxLock(name)}
+	return litefs.HookConn(c, &litefs.DriverHooks{
+		Exec:  s.exec,
+		Query: s.query,
+		Begin: s.begin,
+		Close: s.close,
+	}), nil
+}
+
+// databasePath returns the path of the database a data source name refers to.
+func databasePath(name string) string {
+	name = strings.TrimPrefix(name, "file:")
+	if i := strings.IndexByte(name, '?'); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// immediateTxLock reports whether a data source name makes database/sql
+// transactions begin immediately.
+func immediateTxLock(name string) bool {
+	_, query, _ := strings.Cut(name, "?")
+	for _, param := range strings.Split(query, "&") {
+		switch strings.ToLower(param) {
+		case "_txlock=immediate", "_txlock=exclusive":
+			return true
+		}
+	}
+	return false
+}
+
+// session is the state of a connection, whose statements pass through its
+// hooks.
+type session struct {
+	d         *Driver
+	path      string
+	immediate bool
+
+	// lock is the lock file held with the HALT lock during a transaction.
+	lock *os.File
+}
+
+// before checks a statement about to be executed, taking the HALT lock if it
+// begins a transaction that should hold it.
+func (s *session) before(ctx context.Context, query string) error {
+	if s.lock != nil || s.d.IsPrimary() {
+		return nil
+	}
+
+	if s.d.HaltTx && beginsImmediate(query) {
+		return s.halt(ctx)
+	}
+	if litefs.IsWriteStatement(query) {
+		return litefs.ErrPrimaryRequired
+	}
+	return nil
+}
+
+// after releases the HALT lock once a statement ending the transaction
+// holding it has succeeded.
+func (s *session) after(query string, err error) {
+	if err == nil && s.lock != nil && endsTx(query) {
+		s.unhalt()
+	}
+}
+
+func (s *session) halt(ctx context.Context) error {
+	f, err := os.OpenFile(litefs.LockPath(s.path), os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+	if err := litefs.HaltContext(ctx, f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.lock = f
+	return nil
+}
+
+func (s *session) unhalt() {
+	// closing the lock file releases the lock even if unlocking fails.
+	_ = litefs.Unhalt(s.lock)
+	_ = s.lock.Close()
+	s.lock = nil
+}
+
+func (s *session) exec(ctx context.Context, query string, fn func() error) error {
+	if err := s.before(ctx, query); err != nil {
+		return err
+	}
+	err := fn()
+	s.after(query, err)
+	return err
+}
+
+func (s *session) query(ctx context.Context, query string, fn func() (driver.Rows, error)) (driver.Rows, error) {
+	if err := s.before(ctx, query); err != nil {
+		return nil, err
+	}
+	rows, err := fn()
+	s.after(query, err)
+	return rows, err
+}
+
+func (s *session) begin(ctx context.Context, opts driver.TxOptions, fn func() (driver.Tx, error)) (driver.Tx, error) {
+	halt := s.d.HaltTx && s.immediate && !opts.ReadOnly && s.lock == nil && !s.d.IsPrimary()
+	if halt {
+		if err := s.halt(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := fn()
+	if err != nil {
+		if halt {
+			s.unhalt()
+		}
+		return nil, err
+	}
+	if !halt {
+		return tx, nil
+	}
+	return &haltTx{Tx: tx, s: s}, nil
+}
+
+func (s *session) close(fn func() error) error {
+	if s.lock != nil {
+		s.unhalt()
+	}
+	return fn()
+}
+
+// haltTx releases the HALT lock taken for it once it ends.
+type haltTx struct {
+	driver.Tx
+	s *session
+}
+
+func (tx *haltTx) Commit() error {
+	defer tx.s.unhalt()
+	return tx.Tx.Commit()
+}
+
+func (tx *haltTx) Rollback() error {
+	defer tx.s.unhalt()
+	return tx.Tx.Rollback()
+}
+
+// beginsImmediate reports whether query begins a transaction that takes the
+// write lock immediately.
+func beginsImmediate(query string) bool {
+	words := keywords(query, 2)
+	return len(words) == 2 && words[0] == "BEGIN" && (words[1] == "IMMEDIATE" || words[1] == "EXCLUSIVE")
+}
+
+// endsTx reports whether query commits or rolls back a transaction, as
+// opposed to rolling back to a savepoint.
+func endsTx(query string) bool {
+	words := keywords(query, 3)
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "COMMIT", "END":
+		return true
+	case "ROLLBACK":
+		for _, w := range words[1:] {
+			if w == "TO" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// keywords returns up to n leading words of query in upper case.
+func keywords(query string, n int) []string {
+	words := strings.FieldsFunc(query, func(r rune) bool { return !unicode.IsLetter(r) })
+	if len(words) > n {
+		words = words[:n]
+	}
+	for i, w := range words {
+		words[i] = strings.ToUpper(w)
+	}
+	return words
+}
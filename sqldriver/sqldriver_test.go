@@ -0,0 +1,139 @@
+package sqldriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/superfly/litefs-go"
+)
+
+var isPrimary atomic.Bool
+
+func init() {
+	sql.Register("litefs-fake", &Driver{
+		Driver:    fakeDriver{},
+		IsPrimary: isPrimary.Load,
+		HaltTx:    true,
+	})
+}
+
+func TestDriver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db")
+	if err := os.WriteFile(litefs.LockPath(path), nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	t.Run("primary", func(t *testing.T) {
+		isPrimary.Store(true)
+		defer isPrimary.Store(false)
+
+		db := openDB(t, path)
+		if _, err := db.ExecContext(ctx, "INSERT INTO t VALUES (1)"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	})
+
+	t.Run("replica write", func(t *testing.T) {
+		db := openDB(t, path)
+		if _, err := db.ExecContext(ctx, "SELECT 1"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := db.ExecContext(ctx, "INSERT INTO t VALUES (1)"); !errors.Is(err, litefs.ErrPrimaryRequired) {
+			t.Fatalf("expected ErrPrimaryRequired, got %v", err)
+		}
+	})
+
+	t.Run("begin immediate", func(t *testing.T) {
+		db := openDB(t, path)
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		for _, q := range []string{"BEGIN IMMEDIATE", "INSERT INTO t VALUES (1)", "ROLLBACK TO sp"} {
+			if _, err := conn.ExecContext(ctx, q); err != nil {
+				t.Fatalf("%s: unexpected error: %s", q, err)
+			}
+		}
+		assertHalted(t, path, true)
+
+		if _, err := conn.ExecContext(ctx, "COMMIT"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		assertHalted(t, path, false)
+	})
+
+	t.Run("immediate transaction", func(t *testing.T) {
+		db := openDB(t, "file:"+path+"?_txlock=immediate")
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO t VALUES (1)"); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		assertHalted(t, path, true)
+
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		assertHalted(t, path, false)
+	})
+}
+
+func openDB(t *testing.T, name string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("litefs-fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// assertHalted checks whether the HALT lock of the database at path is held
+// by trying to take it from another file description.
+func assertHalted(t *testing.T, path string, halted bool) {
+	t.Helper()
+
+	f, err := os.OpenFile(litefs.LockPath(path), os.O_RDWR, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	err = syscall.FcntlFlock(f.Fd(), litefs.F_OFD_SETLK, &syscall.Flock_t{
+		Type:  syscall.F_WRLCK,
+		Start: litefs.HaltByte,
+		Len:   1,
+	})
+	if held := err == syscall.EAGAIN || err == syscall.EACCES; held != halted {
+		t.Fatalf("expected halted=%v, got %v", halted, err)
+	}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{}, nil }
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeConn{}, nil }
+func (fakeConn) Commit() error                             { return nil }
+func (fakeConn) Rollback() error                           { return nil }
+
+func (fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(0), nil
+}
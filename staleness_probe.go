@@ -0,0 +1,144 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// StalenessProbe measures, on a replica, how stale queries against the local
+// copy of a database are. It reads the probe rows written by a Prober on the
+// primary through the same database handle the application uses, so it
+// reflects what queries actually observe rather than when events arrived.
+//
+// Staleness is estimated without comparing clocks across nodes. The offset
+// between the writer's clock and the local one is taken to be the smallest
+// apparent age at which a new probe has been observed, and a read is stale
+// once the primary is due to have written a newer probe that hasn't arrived.
+// Estimates are therefore low by at most the fastest replication latency.
+//
+// The exported fields configure the probe and must be set before it is used.
+type StalenessProbe struct {
+	DB *sql.DB
+
+	// Interval is how often the Prober on the primary writes probes.
+	Interval time.Duration
+
+	// PollInterval is how often Run measures staleness in addition to
+	// measuring on every tx event.
+	PollInterval time.Duration
+
+	// Staleness records each measurement.
+	Staleness *LatencyHistogram
+
+	// OnError, if set, is called with errors reading probes. Measuring
+	// continues after an error.
+	OnError func(error)
+
+	m    sync.Mutex
+	est  stalenessEstimator
+	last time.Duration
+}
+
+// NewStalenessProbe returns a new *StalenessProbe for probes written every
+// interval that polls once a second.
+func NewStalenessProbe(db *sql.DB, interval time.Duration) *StalenessProbe {
+	return &StalenessProbe{
+		DB:           db,
+		Interval:     interval,
+		PollInterval: time.Second,
+		Staleness:    NewLatencyHistogram(),
+	}
+}
+
+// Run measures staleness every PollInterval and whenever a transaction is
+// applied, until ctx is done.
+func (sp *StalenessProbe) Run(ctx context.Context) error {
+	es := NewEventSource()
+	defer es.Close()
+
+	ticker := time.NewTicker(sp.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e, running := <-es.C():
+			if !running {
+				return ErrSubscriptionClosed
+			}
+			if e.Type != EventTypeTx {
+				continue
+			}
+		case err, running := <-es.ErrC():
+			if err := sourceError(err, running); err != nil {
+				return err
+			}
+			continue
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if _, err := sp.Measure(ctx); err != nil && sp.OnError != nil {
+			sp.OnError(err)
+		}
+	}
+}
+
+// Measure reads the newest probe and returns the estimated staleness of the
+// local copy of the database, which is also recorded in Staleness.
+func (sp *StalenessProbe) Measure(ctx context.Context) (time.Duration, error) {
+	var writtenAt sql.NullInt64
+	if err := sp.DB.QueryRowContext(ctx, `SELECT MAX(written_at) FROM `+ProbesTable).Scan(&writtenAt); err != nil {
+		return 0, err
+	} else if !writtenAt.Valid {
+		return 0, nil
+	}
+
+	sp.m.Lock()
+	sp.est.interval = sp.Interval
+	staleness := sp.est.observe(writtenAt.Int64, time.Now())
+	sp.last = staleness
+	sp.m.Unlock()
+
+	sp.Staleness.Observe(staleness)
+	return staleness, nil
+}
+
+// Last returns the most recent measurement.
+func (sp *StalenessProbe) Last() time.Duration {
+	sp.m.Lock()
+	defer sp.m.Unlock()
+
+	return sp.last
+}
+
+// stalenessEstimator estimates staleness from probe timestamps taken by
+// another clock.
+type stalenessEstimator struct {
+	interval time.Duration
+
+	// offset is the smallest apparent age at which a new probe was observed,
+	// i.e. the clock offset plus the fastest replication latency.
+	offset    time.Duration
+	hasOffset bool
+	writtenAt int64
+}
+
+// observe returns the staleness of a read at now whose newest probe was
+// written at writtenAt, by the writer's clock.
+func (e *stalenessEstimator) observe(writtenAt int64, now time.Time) time.Duration {
+	age := now.Sub(time.Unix(0, writtenAt))
+	if writtenAt != e.writtenAt {
+		e.writtenAt = writtenAt
+		if !e.hasOffset || age < e.offset {
+			e.offset, e.hasOffset = age, true
+		}
+	}
+
+	if staleness := age - e.offset - e.interval; staleness > 0 {
+		return staleness
+	}
+	return 0
+}
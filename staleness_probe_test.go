@@ -0,0 +1,35 @@
+package litefs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStalenessEstimator(t *testing.T) {
+	// the writer's clock is an hour ahead, and probes take 10ms to replicate.
+	skew := time.Hour
+	t0 := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	written := func(d time.Duration) int64 { return t0.Add(skew + d).UnixNano() }
+	local := func(d time.Duration) time.Time { return t0.Add(d) }
+
+	e := stalenessEstimator{interval: time.Second}
+	for _, tt := range []struct {
+		writtenAt time.Duration
+		now       time.Duration
+		expected  time.Duration
+	}{
+		{0, 10 * time.Millisecond, 0},
+		// reads between probes aren't stale.
+		{0, 500 * time.Millisecond, 0},
+		{time.Second, time.Second + 10*time.Millisecond, 0},
+		// the probe written at 2s hasn't arrived.
+		{time.Second, 2500 * time.Millisecond, 490 * time.Millisecond},
+		// a late probe doesn't move the offset.
+		{2 * time.Second, 2600 * time.Millisecond, 0},
+		{2 * time.Second, 4 * time.Second, 990 * time.Millisecond},
+	} {
+		if actual := e.observe(written(tt.writtenAt), local(tt.now)); actual != tt.expected {
+			t.Fatalf("written at %s, read at %s: expected %s, got %s", tt.writtenAt, tt.now, tt.expected, actual)
+		}
+	}
+}
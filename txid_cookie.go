@@ -0,0 +1,110 @@
+package litefs
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// TXIDCookie is the cookie WriteTXIDCookie sets to the TXID a client's later
+// reads must observe.
+const TXIDCookie = "__litefs_txid"
+
+// WriteTXIDCookie returns a function that wraps handlers so that responses to
+// write requests set TXIDCookie to the TXID of the database at databasePath
+// when the response header is written, which is after the request's writes
+// have committed in handlers that respond once they are done, or after the
+// handler returns if it wrote nothing. Error responses don't set the cookie.
+// Use it with WaitTXIDCookie for read-your-writes consistency across requests.
+func WriteTXIDCookie(databasePath string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+			cw := &txidCookieWriter{ResponseWriter: w, databasePath: databasePath}
+			next.ServeHTTP(cw, r)
+
+			// net/http would send an implicit 200 OK without the cookie.
+			if !cw.wroteHeader {
+				cw.WriteHeader(http.StatusOK)
+			}
+		})
+	}
+}
+
+// WaitTXIDCookie returns a function that wraps handlers so that requests
+// carrying TXIDCookie wait up to maxWait for the database at databasePath to
+// reach its TXID before being passed to next. Requests that time out receive a
+// 503 response with a Retry-After header.
+func WaitTXIDCookie(databasePath string, maxWait time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := r.Cookie(TXIDCookie)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			txid, err := ParseTXID(cookie.Value)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), maxWait)
+			defer cancel()
+
+			if err := WaitForPos(ctx, databasePath, txid); err != nil {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// txidCookieWriter sets TXIDCookie before the header of a successful response
+// is written.
+type txidCookieWriter struct {
+	http.ResponseWriter
+	databasePath string
+	wroteHeader  bool
+}
+
+func (w *txidCookieWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if pos, err := ReadPos(w.databasePath); err == nil && code < http.StatusBadRequest {
+			http.SetCookie(w.ResponseWriter, &http.Cookie{
+				Name:     TXIDCookie,
+				Value:    pos.TXID.String(),
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *txidCookieWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *txidCookieWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *txidCookieWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,69 @@
+package litefs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTXIDCookie(t *testing.T) {
+	mockServer(t, hold)
+	dbPath := filepath.Join(t.TempDir(), "db")
+	writePosFile(t, dbPath, "0000000000000002/0000000000000000")
+
+	h := WriteTXIDCookie(dbPath)(WaitTXIDCookie(dbPath, 20*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			writePosFile(t, dbPath, "0000000000000003/0000000000000000")
+		}
+		_, _ = w.Write([]byte("ok"))
+	})))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != TXIDCookie || cookies[0].Value != "0000000000000003" {
+		t.Fatalf("unexpected cookies: %v", cookies)
+	}
+
+	// reads aren't given cookies and wait for the cookie's TXID.
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("unexpected response: %d, %v", w.Code, w.Result().Cookies())
+	}
+
+	// a replica that hasn't caught up times out.
+	writePosFile(t, dbPath, "0000000000000002/0000000000000000")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 503 with Retry-After, got %d", w.Code)
+	}
+}
+
+func TestTXIDCookieImplicitStatus(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "db")
+	writePosFile(t, dbPath, "0000000000000003/0000000000000000")
+
+	// handlers that write nothing still set the cookie.
+	h := WriteTXIDCookie(dbPath)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if cookies := w.Result().Cookies(); w.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Value != "0000000000000003" {
+		t.Fatalf("unexpected response: %d, %v", w.Code, cookies)
+	}
+
+	// failed writes don't.
+	h = WriteTXIDCookie(dbPath)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusInternalServerError || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("unexpected response: %d, %v", w.Code, w.Result().Cookies())
+	}
+}
@@ -0,0 +1,163 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// View is an in-memory read model of a LiteFS database: the result of a query
+// that is re-run whenever tx events report the database changed. Reads of the
+// cached result are cheap and never block on the database, which suits
+// replicas serving frequent reads of small, slowly changing data.
+//
+// The exported fields configure the view and must be set before it is used.
+type View[T any] struct {
+	DB *sql.DB
+
+	// Database is the name of the database the query reads. Tx events for
+	// other databases are ignored.
+	Database string
+
+	// Query is run with Args to load the view, and Scan is called with each
+	// row it returns.
+	Query string
+	Args  []any
+	Scan  func(*sql.Rows) (T, error)
+
+	// Tables optionally lists the tables Query reads. Tx events reporting
+	// that none of them changed are skipped.
+	Tables []string
+
+	// Debounce is how long after a tx event the query is re-run, so that a
+	// burst of transactions causes a single refresh.
+	Debounce time.Duration
+
+	// Config, if set, supplies Debounce in place of the field above so that it
+	// can be tuned at runtime. The field is used while Config's is zero.
+	Config *LiveConfig
+
+	// OnError is called with errors refreshing the view, which keeps its
+	// previous result. If nil, Run returns the first such error.
+	OnError func(error)
+
+	rows   atomic.Pointer[[]T]
+	loaded chan struct{}
+}
+
+// NewView returns a new *View of query against the database named database,
+// with rows scanned by scan, that refreshes 50ms after tx events.
+func NewView[T any](db *sql.DB, database, query string, scan func(*sql.Rows) (T, error), args ...any) *View[T] {
+	return &View[T]{
+		DB:       db,
+		Database: database,
+		Query:    query,
+		Args:     args,
+		Scan:     scan,
+		Debounce: 50 * time.Millisecond,
+		loaded:   make(chan struct{}),
+	}
+}
+
+// Rows returns the result of the most recent refresh, or nil if the view
+// hasn't been loaded. The slice is shared and must not be modified.
+func (v *View[T]) Rows() []T {
+	if rows := v.rows.Load(); rows != nil {
+		return *rows
+	}
+	return nil
+}
+
+// WaitLoaded blocks until the view has been loaded or ctx is done.
+func (v *View[T]) WaitLoaded(ctx context.Context) error {
+	select {
+	case <-v.loaded:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run loads the view and then refreshes it after tx events for Database until
+// ctx is done.
+func (v *View[T]) Run(ctx context.Context) error {
+	es := NewEventSource()
+	defer es.Close()
+
+	if err := v.handle(v.Refresh(ctx)); err != nil {
+		return err
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case event, running := <-es.C():
+			if !running {
+				return ErrSubscriptionClosed
+			}
+			data, ok := event.Data.(*TxEventData)
+			if !ok || event.DB != v.Database || !data.MayTouch(v.Tables...) {
+				continue
+			}
+			if debounce == nil {
+				debounce = time.After(v.debounce())
+			}
+		case <-debounce:
+			debounce = nil
+			if err := v.handle(v.Refresh(ctx)); err != nil {
+				return err
+			}
+		case err, running := <-es.ErrC():
+			if err := sourceError(err, running); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// debounce returns Debounce, from Config if it is set there.
+func (v *View[T]) debounce() time.Duration {
+	if v.Config != nil {
+		if d := v.Config.Load().Debounce; d > 0 {
+			return d
+		}
+	}
+	return v.Debounce
+}
+
+// Refresh re-runs the query and replaces the view's result.
+func (v *View[T]) Refresh(ctx context.Context) error {
+	rows, err := v.DB.QueryContext(ctx, v.Query, v.Args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	result := []T{}
+	for rows.Next() {
+		row, err := v.Scan(rows)
+		if err != nil {
+			return err
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if v.rows.Swap(&result) == nil {
+		close(v.loaded)
+	}
+	return nil
+}
+
+func (v *View[T]) handle(err error) error {
+	if err == nil || v.OnError == nil {
+		return err
+	}
+	v.OnError(err)
+	return nil
+}
@@ -0,0 +1,68 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestView(t *testing.T) {
+	src := newFakeSource()
+	useEventSource(t, func(...SubscribeOption) EventSource { return src })
+
+	fakeRows = [][]driver.Value{{"a", int64(1)}}
+	v := NewView(openFakeDB(t, []string{"id", "version"}, 1, 100), "db", "SELECT id, version FROM docs WHERE version > ?",
+		func(rows *sql.Rows) (string, error) {
+			var id string
+			var version int64
+			err := rows.Scan(&id, &version)
+			return id, err
+		}, int64(0))
+	if rows := v.Rows(); rows != nil {
+		t.Fatalf("expected no rows before loading, got %v", rows)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- v.Run(ctx) }()
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, time.Second)
+	defer waitCancel()
+	if err := v.WaitLoaded(waitCtx); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	assertViewRows(t, v, "a")
+
+	// events for other databases are ignored.
+	fakeRows = append(fakeRows, []driver.Value{"b", int64(2)})
+	src.c <- &Event{Type: EventTypeTx, DB: "other", Data: &TxEventData{}}
+	time.Sleep(2 * v.Debounce)
+	assertViewRows(t, v, "a")
+
+	src.c <- txEvent
+	src.c <- txEvent
+	deadline := time.Now().Add(time.Second)
+	for len(v.Rows()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertViewRows(t, v, "a", "b")
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func assertViewRows(t *testing.T, v *View[string], ids ...string) {
+	t.Helper()
+
+	if rows := v.Rows(); !reflect.DeepEqual(rows, ids) {
+		t.Fatalf("expected %v, got %v", ids, rows)
+	}
+}
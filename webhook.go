@@ -0,0 +1,118 @@
+package litefs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// WebhookSignatureHeader is the header carrying the HMAC-SHA256 signature of a
+// webhook body, formatted as "sha256=<hex>".
+const WebhookSignatureHeader = "Litefs-Signature"
+
+// DefaultWebhookMaxBodySize is the largest webhook body accepted by default.
+const DefaultWebhookMaxBodySize = 1 << 20
+
+var (
+	errInvalidSignature = errors.New("invalid webhook signature")
+	errNoWebhookSecret  = errors.New("webhook secret not set")
+)
+
+// WebhookHandler is an http.Handler that receives LiteFS events delivered by an
+// external system, such as a cloud control plane, and publishes them to an
+// EventBroker so that consumers see a single event model regardless of source.
+// The body may hold a single event or newline-delimited events.
+//
+// Init and primaryChange events are delivered to subscribers but don't change
+// the role the broker remembers for new subscribers, which is always the one
+// reported by the local node.
+type WebhookHandler struct {
+	Broker *EventBroker
+
+	// Secret is the key used to verify the WebhookSignatureHeader. It is
+	// required: every request is rejected while it is unset.
+	Secret []byte
+
+	// MaxBodySize limits the size of webhook bodies. It defaults to
+	// DefaultWebhookMaxBodySize.
+	MaxBodySize int64
+}
+
+func (h *WebhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if len(h.Secret) == 0 {
+		http.Error(w, errNoWebhookSecret.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	maxBodySize := h.MaxBodySize
+	if maxBodySize == 0 {
+		maxBodySize = DefaultWebhookMaxBodySize
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !h.validSignature(r.Header.Get(WebhookSignatureHeader), body) {
+		http.Error(w, errInvalidSignature.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	events, err := decodeWebhookEvents(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, e := range events {
+		h.Broker.publish(e, false)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) validSignature(header string, body []byte) bool {
+	sig, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, h.Secret)
+	mac.Write(body)
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+// decodeWebhookEvents decodes every event in body, failing if any is invalid
+// so that a partially-valid delivery isn't half published.
+func decodeWebhookEvents(body []byte) ([]*Event, error) {
+	var events []*Event
+	d := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var e Event
+		if err := d.Decode(&e); err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if e.Type == "" {
+			return nil, errMissingEventType
+		}
+		events = append(events, &e)
+	}
+}
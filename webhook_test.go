@@ -0,0 +1,86 @@
+package litefs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	b := mockServerBroker(t)
+	sub := b.Subscribe()
+	h := &WebhookHandler{Broker: b, Secret: []byte("secret")}
+
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, h.Secret)
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	post := func(body, sig string) int {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(WebhookSignatureHeader, sig)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		body := initEventJSON + "\n" + pChangeNode2EventJSON + "\n"
+		done := make(chan int)
+		go func() { done <- post(body, sign(body)) }()
+
+		assertReadEvent(t, sub, initEvent)
+		assertReadEvent(t, sub, pChangeNode2Event)
+		if code := <-done; code != http.StatusNoContent {
+			t.Fatalf("expected 204, got %d", code)
+		}
+	})
+
+	t.Run("role unchanged", func(t *testing.T) {
+		// the broker's role is still the local node's, which hasn't reported
+		// one, rather than the webhook's.
+		b.m.Lock()
+		defer b.m.Unlock()
+		if b.init != nil {
+			t.Fatalf("expected no role, got %+v", b.init)
+		}
+	})
+
+	t.Run("bad signature", func(t *testing.T) {
+		if code := post(initEventJSON, sign("other")); code != http.StatusUnauthorized {
+			t.Fatalf("expected 401, got %d", code)
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		h := &WebhookHandler{Broker: b, Secret: h.Secret, MaxBodySize: 8}
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(initEventJSON))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected 413, got %d", w.Code)
+		}
+	})
+
+	t.Run("no secret", func(t *testing.T) {
+		h := &WebhookHandler{Broker: b}
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(initEventJSON))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("expected 500, got %d", w.Code)
+		}
+	})
+
+	t.Run("invalid event", func(t *testing.T) {
+		for _, body := range []string{`{"data":{}}`, initEventJSON + "beep"} {
+			if code := post(body, sign(body)); code != http.StatusBadRequest {
+				t.Fatalf("expected 400 for %q, got %d", body, code)
+			}
+		}
+	})
+}
@@ -0,0 +1,222 @@
+package litefs
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// writeKeywords are the leading keywords of statements that modify a
+// database.
+var writeKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "REPLACE": true,
+	"CREATE": true, "DROP": true, "ALTER": true, "REINDEX": true, "VACUUM": true,
+}
+
+// writePragmas are the pragmas that modify a database when they are given a
+// value. Pragmas that only configure the connection, e.g. busy_timeout or
+// foreign_keys, aren't writes.
+var writePragmas = map[string]bool{
+	"APPLICATION_ID": true, "AUTO_VACUUM": true, "JOURNAL_MODE": true,
+	"SCHEMA_VERSION": true, "USER_VERSION": true,
+}
+
+// actionPragmas are the pragmas that modify a database whether or not they are
+// given a value.
+var actionPragmas = map[string]bool{
+	"INCREMENTAL_VACUUM": true, "OPTIMIZE": true, "WAL_CHECKPOINT": true,
+}
+
+// IsWriteStatement reports whether query modifies the database: it begins
+// with a keyword that does, is a common table expression followed by one, or
+// sets or runs a pragma that does. Leading whitespace and SQL comments are
+// skipped.
+func IsWriteStatement(query string) bool {
+	s := sqlScanner{query: query}
+	switch keyword := strings.ToUpper(s.next()); keyword {
+	case "WITH":
+		return isWriteWith(&s)
+	case "PRAGMA":
+		return isWritePragma(&s)
+	default:
+		return writeKeywords[keyword]
+	}
+}
+
+// isWriteWith reports whether the statement following the common table
+// expressions of a WITH clause modifies the database.
+func isWriteWith(s *sqlScanner) bool {
+	var depth int
+	for tok := s.next(); tok != ""; tok = s.next() {
+		switch keyword := strings.ToUpper(tok); {
+		case tok == "(":
+			depth++
+		case tok == ")":
+			depth--
+		case depth > 0:
+		case keyword == "SELECT" || keyword == "VALUES":
+			return false
+		case writeKeywords[keyword]:
+			return true
+		}
+	}
+	return false
+}
+
+// isWritePragma reports whether a pragma, following the PRAGMA keyword,
+// modifies the database.
+func isWritePragma(s *sqlScanner) bool {
+	// the name may be qualified by a schema name.
+	name, tok := s.next(), s.next()
+	if tok == "." {
+		name, tok = s.next(), s.next()
+	}
+	name = strings.ToUpper(name)
+	return actionPragmas[name] || (writePragmas[name] && (tok == "=" || tok == "("))
+}
+
+// sqlScanner splits SQL into tokens: words, quoted identifiers and literals,
+// and single punctuation characters. Whitespace and comments are skipped.
+type sqlScanner struct {
+	query string
+}
+
+// next returns the next token, or "" at the end of the query.
+func (s *sqlScanner) next() string {
+	for {
+		s.query = strings.TrimLeftFunc(s.query, unicode.IsSpace)
+		switch {
+		case strings.HasPrefix(s.query, "--"):
+			if i := strings.IndexByte(s.query, '\n'); i >= 0 {
+				s.query = s.query[i+1:]
+				continue
+			}
+			s.query = ""
+		case strings.HasPrefix(s.query, "/*"):
+			if i := strings.Index(s.query, "*/"); i >= 0 {
+				s.query = s.query[i+2:]
+				continue
+			}
+			s.query = ""
+		}
+		break
+	}
+	if s.query == "" {
+		return ""
+	}
+
+	var end int
+	switch c := s.query[0]; c {
+	case '\'', '"', '`', '[':
+		if c == '[' {
+			c = ']'
+		}
+		// quotes are escaped by doubling them, which scans as two tokens.
+		if i := strings.IndexByte(s.query[1:], c); i >= 0 {
+			end = i + 2
+		} else {
+			end = len(s.query)
+		}
+	default:
+		end = strings.IndexFunc(s.query, func(r rune) bool { return !isWordRune(r) })
+		if end < 0 {
+			end = len(s.query)
+		} else if end == 0 {
+			end = 1
+		}
+	}
+
+	tok := s.query[:end]
+	s.query = s.query[end:]
+	return tok
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+type replicaWriteKey struct{}
+
+// AllowReplicaWrites returns a copy of ctx marking writes made with it as
+// intentional, e.g. because the HALT lock is held, so that a WriteGuard
+// doesn't report them.
+func AllowReplicaWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaWriteKey{}, true)
+}
+
+// WriteGuard wraps a database driver and reports successful writes made while
+// the node believes it is a replica. Such writes mean the application bypassed
+// write routing, which is a correctness bug.
+type WriteGuard struct {
+	// Monitor reports the node's role. Writes are not checked until it is
+	// ready.
+	Monitor *PrimaryMonitor
+
+	// Logger, if set, receives a warning for each violation.
+	Logger *slog.Logger
+
+	// OnViolation, if set, is called with the offending statement, e.g. to
+	// increment a metric.
+	OnViolation func(query string)
+
+	// Panic causes violations to panic after being reported.
+	Panic bool
+
+	violations atomic.Int64
+}
+
+// Violations returns the number of violations observed.
+func (g *WriteGuard) Violations() int64 {
+	return g.violations.Load()
+}
+
+// Wrap returns a connector whose connections are checked by g. Use it with
+// sql.OpenDB.
+func (g *WriteGuard) Wrap(c driver.Connector) driver.Connector {
+	// queries are checked too, as statements with a RETURNING clause are
+	// writes that return rows.
+	return &hookConnector{Connector: c, hooks: &DriverHooks{
+		Exec: func(ctx context.Context, query string, fn func() error) error {
+			if err := fn(); err != nil {
+				return err
+			}
+			g.check(ctx, query)
+			return nil
+		},
+		Query: func(ctx context.Context, query string, fn func() (driver.Rows, error)) (driver.Rows, error) {
+			rows, err := fn()
+			if err != nil {
+				return nil, err
+			}
+			g.check(ctx, query)
+			return rows, nil
+		},
+	}}
+}
+
+func (g *WriteGuard) check(ctx context.Context, query string) {
+	if !IsWriteStatement(query) {
+		return
+	}
+	if allowed, _ := ctx.Value(replicaWriteKey{}).(bool); allowed {
+		return
+	}
+	if isPrimary, err := g.Monitor.IsPrimary(); err != nil || isPrimary {
+		return
+	}
+
+	g.violations.Add(1)
+	if g.Logger != nil {
+		g.Logger.Warn("litefs: write succeeded on replica", slog.String("query", query))
+	}
+	if g.OnViolation != nil {
+		g.OnViolation(query)
+	}
+	if g.Panic {
+		panic(fmt.Sprintf("litefs: write succeeded on replica: %s", query))
+	}
+}
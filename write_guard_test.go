@@ -0,0 +1,77 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestIsWriteStatement(t *testing.T) {
+	for _, tc := range []struct {
+		query    string
+		expected bool
+	}{
+		{"INSERT INTO t VALUES (1)", true},
+		{"  update t SET x = 1", true},
+		{"-- comment\n/* block */ DELETE FROM t", true},
+		{"INSERT INTO t VALUES (1) RETURNING id", true},
+		{"SELECT * FROM t", false},
+		{"BEGIN IMMEDIATE", false},
+		{"-- only a comment", false},
+		{"", false},
+
+		{"WITH x AS (SELECT 1) INSERT INTO t SELECT * FROM x", true},
+		{"with recursive x(n) as (select 1 union all select n+1 from x) update t set n = 1", true},
+		{"WITH x AS (SELECT 'DELETE' FROM t) DELETE FROM t WHERE id IN x", true},
+		{"WITH x AS (DELETE FROM t) SELECT 1", false},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", false},
+		{"WITH \"insert\" AS (SELECT 1) SELECT * FROM \"insert\"", false},
+		{"WITH x AS (SELECT ')' FROM t) SELECT * FROM x", false},
+
+		{"PRAGMA user_version = 3", true},
+		{"pragma main.user_version=3", true},
+		{"PRAGMA journal_mode(wal)", true},
+		{"PRAGMA wal_checkpoint(TRUNCATE)", true},
+		{"PRAGMA optimize", true},
+		{"PRAGMA user_version", false},
+		{"PRAGMA foreign_keys = ON", false},
+		{"PRAGMA busy_timeout = 5000", false},
+		{"PRAGMA table_info(t)", false},
+	} {
+		if actual := IsWriteStatement(tc.query); actual != tc.expected {
+			t.Fatalf("IsWriteStatement(%q): expected %t, got %t", tc.query, tc.expected, actual)
+		}
+	}
+}
+
+func TestWriteGuard(t *testing.T) {
+	pm, c := mockServerMonitor(t)
+	c <- pChangeNode2EventJSON
+	c <- flush
+	assertReady(t, pm, 5*time.Millisecond)
+
+	var violations []string
+	g := &WriteGuard{Monitor: pm, OnViolation: func(query string) { violations = append(violations, query) }}
+	db := sql.OpenDB(g.Wrap(&fakeConnector{}))
+	t.Cleanup(func() { db.Close() })
+
+	ctx := context.Background()
+	for _, q := range []string{"SELECT 1", "INSERT INTO t VALUES (1)"} {
+		if _, err := db.ExecContext(ctx, q); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	rows, err := db.QueryContext(ctx, "DELETE FROM t RETURNING id")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rows.Close()
+	if _, err := db.ExecContext(AllowReplicaWrites(ctx), "DELETE FROM t"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if g.Violations() != 2 || len(violations) != 2 || violations[0] != "INSERT INTO t VALUES (1)" || violations[1] != "DELETE FROM t RETURNING id" {
+		t.Fatalf("wrong violations: %d %v", g.Violations(), violations)
+	}
+}
@@ -0,0 +1,298 @@
+package litefs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// SpoolTable is the table WriteSpool stores deferred writes in.
+const SpoolTable = "_litefs_spool"
+
+// SpooledWrite is a write deferred by a WriteSpool.
+type SpooledWrite struct {
+	ID        int64
+	DB        string
+	Query     string
+	Args      []any
+	CreatedAt time.Time
+
+	// Attempts is the number of failed replays.
+	Attempts int
+
+	// Conflict is the error of the last replay if it was rejected for a
+	// reason other than an outage. Conflicting writes are skipped by Replay
+	// until they are discarded.
+	Conflict string
+}
+
+// SpoolReport describes the outcome of WriteSpool.Replay.
+type SpoolReport struct {
+	// Replayed is the number of writes delivered.
+	Replayed int
+
+	// Conflicts are the writes rejected during the replay.
+	Conflicts []SpooledWrite
+
+	// Remaining is the number of writes left in the spool, including
+	// conflicts.
+	Remaining int
+}
+
+// WriteSpool records writes that can't be delivered during a primary outage in
+// a local database, for applications that prefer delayed writes over errors.
+// Spooled writes are delivered in order by Replay, which an operator or a
+// recovery hook triggers once the cluster has a primary again.
+//
+// DB must not be in the LiteFS mount, since spooled writes are local to the
+// node that made them.
+type WriteSpool struct {
+	DB *sql.DB
+
+	// Deliver makes a write to the database named db, e.g. through
+	// WithHaltContext or by forwarding it to the primary.
+	Deliver func(ctx context.Context, db, query string, args ...any) error
+
+	// Deferrable reports whether a delivery error means the write should be
+	// spooled and retried later rather than returned. It defaults to
+	// IsOutage. Only writes that are safe to deliver twice, e.g. because
+	// they are idempotent, may be deferred on errors after which they might
+	// have been made, such as context.DeadlineExceeded.
+	Deferrable func(err error) bool
+}
+
+// NewWriteSpool returns a new *WriteSpool that stores writes in db and
+// delivers them with deliver.
+func NewWriteSpool(db *sql.DB, deliver func(ctx context.Context, db, query string, args ...any) error) *WriteSpool {
+	return &WriteSpool{DB: db, Deliver: deliver}
+}
+
+// IsOutage reports whether err means that writes can't currently reach the
+// primary, as opposed to being rejected by it. Timeouts aren't outages: a
+// forwarded write that timed out may have been made by the primary, so
+// spooling it could make it twice.
+func IsOutage(err error) bool {
+	return errors.Is(err, ErrNoPrimary) ||
+		errors.Is(err, ErrPrimaryRequired) ||
+		errors.Is(err, ErrHaltContended)
+}
+
+// Init creates the spool table if it doesn't exist.
+func (s *WriteSpool) Init(ctx context.Context) error {
+	_, err := s.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+SpoolTable+` (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	db TEXT NOT NULL,
+	query TEXT NOT NULL,
+	args TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	conflict TEXT NOT NULL DEFAULT ''
+)`)
+	return err
+}
+
+// Write delivers a write, spooling it if delivery fails because of an outage.
+// spooled reports whether the write was deferred. Writes are also spooled
+// while earlier writes to the same database are, so that they are delivered
+// in order. Args must be nil, booleans, integers, floats, strings, byte
+// slices or time.Time values.
+func (s *WriteSpool) Write(ctx context.Context, db, query string, args ...any) (spooled bool, err error) {
+	pending, err := s.pending(ctx, db)
+	if err != nil {
+		return false, err
+	}
+	if !pending {
+		err := s.Deliver(ctx, db, query, args...)
+		if err == nil || !s.deferrable(err) {
+			return false, err
+		}
+	}
+
+	data, err := encodeSpoolArgs(args)
+	if err != nil {
+		return false, err
+	}
+	if _, err := s.DB.ExecContext(ctx, `INSERT INTO `+SpoolTable+` (db, query, args, created_at) VALUES (?, ?, ?, ?)`,
+		db, query, data, time.Now().UnixNano(),
+	); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Writes returns the spooled writes in order.
+func (s *WriteSpool) Writes(ctx context.Context) ([]SpooledWrite, error) {
+	rows, err := s.DB.QueryContext(ctx, `SELECT id, db, query, args, created_at, attempts, conflict FROM `+SpoolTable+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var writes []SpooledWrite
+	for rows.Next() {
+		var w SpooledWrite
+		var args string
+		var createdAt int64
+		if err := rows.Scan(&w.ID, &w.DB, &w.Query, &args, &createdAt, &w.Attempts, &w.Conflict); err != nil {
+			return nil, err
+		}
+		if w.Args, err = decodeSpoolArgs(args); err != nil {
+			return nil, fmt.Errorf("spooled write %d: %w", w.ID, err)
+		}
+		w.CreatedAt = time.Unix(0, createdAt)
+		writes = append(writes, w)
+	}
+	return writes, rows.Err()
+}
+
+// Replay delivers spooled writes in order, removing those that succeed. It
+// stops at the first outage, leaving the rest spooled. Writes that are
+// rejected are recorded as conflicts and reported; they are skipped, as are
+// later writes to the same database, until they are discarded.
+func (s *WriteSpool) Replay(ctx context.Context) (*SpoolReport, error) {
+	writes, err := s.Writes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &SpoolReport{Remaining: len(writes)}
+	blocked := make(map[string]bool)
+	for _, w := range writes {
+		if w.Conflict != "" {
+			blocked[w.DB] = true
+		}
+		if blocked[w.DB] {
+			continue
+		}
+
+		if err := s.Deliver(ctx, w.DB, w.Query, w.Args...); err != nil {
+			if s.deferrable(err) {
+				break
+			}
+
+			w.Attempts++
+			w.Conflict = err.Error()
+			if _, err := s.DB.ExecContext(ctx, `UPDATE `+SpoolTable+` SET attempts = ?, conflict = ? WHERE id = ?`, w.Attempts, w.Conflict, w.ID); err != nil {
+				return report, err
+			}
+			report.Conflicts = append(report.Conflicts, w)
+			blocked[w.DB] = true
+			continue
+		}
+
+		if err := s.Discard(ctx, w.ID); err != nil {
+			return report, err
+		}
+		report.Replayed++
+		report.Remaining--
+	}
+	return report, nil
+}
+
+// Discard removes a spooled write, e.g. a conflict that an operator has
+// resolved by hand.
+func (s *WriteSpool) Discard(ctx context.Context, id int64) error {
+	_, err := s.DB.ExecContext(ctx, `DELETE FROM `+SpoolTable+` WHERE id = ?`, id)
+	return err
+}
+
+// pending reports whether writes to db are spooled.
+func (s *WriteSpool) pending(ctx context.Context, db string) (bool, error) {
+	var n int
+	err := s.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+SpoolTable+` WHERE db = ?`, db).Scan(&n)
+	return n > 0, err
+}
+
+func (s *WriteSpool) deferrable(err error) bool {
+	if s.Deferrable != nil {
+		return s.Deferrable(err)
+	}
+	return IsOutage(err)
+}
+
+// spoolArg is a typed argument of a spooled write, so that arguments keep
+// their types through JSON.
+type spoolArg struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+func encodeSpoolArgs(args []any) (string, error) {
+	encoded := make([]spoolArg, len(args))
+	for i, arg := range args {
+		var typ string
+		switch v := arg.(type) {
+		case nil:
+			encoded[i] = spoolArg{Type: "null"}
+			continue
+		case bool:
+			typ = "bool"
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+			typ = "int"
+		case float32, float64:
+			typ = "float"
+		case string:
+			typ = "string"
+		case []byte:
+			typ = "bytes"
+		case time.Time:
+			typ, arg = "time", v.Format(time.RFC3339Nano)
+		default:
+			return "", fmt.Errorf("cannot spool argument of type %T", arg)
+		}
+
+		value, err := json.Marshal(arg)
+		if err != nil {
+			return "", err
+		}
+		encoded[i] = spoolArg{Type: typ, Value: value}
+	}
+
+	data, err := json.Marshal(encoded)
+	return string(data), err
+}
+
+func decodeSpoolArgs(data string) ([]any, error) {
+	var encoded []spoolArg
+	if err := json.Unmarshal([]byte(data), &encoded); err != nil {
+		return nil, err
+	}
+
+	args := make([]any, len(encoded))
+	for i, arg := range encoded {
+		var err error
+		switch arg.Type {
+		case "null":
+		case "bool":
+			args[i], err = decodeSpoolArg[bool](arg.Value)
+		case "int":
+			args[i], err = decodeSpoolArg[int64](arg.Value)
+		case "float":
+			args[i], err = decodeSpoolArg[float64](arg.Value)
+		case "string":
+			args[i], err = decodeSpoolArg[string](arg.Value)
+		case "bytes":
+			args[i], err = decodeSpoolArg[[]byte](arg.Value)
+		case "time":
+			var v any
+			if v, err = decodeSpoolArg[string](arg.Value); err == nil {
+				args[i], err = time.Parse(time.RFC3339Nano, v.(string))
+			}
+		default:
+			err = fmt.Errorf("unknown argument type %q", arg.Type)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return args, nil
+}
+
+func decodeSpoolArg[T any](data json.RawMessage) (any, error) {
+	var v T
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
@@ -0,0 +1,47 @@
+package litefs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSpoolArgs(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)
+	args := []any{nil, true, 42, int64(-7), 1.5, "text", []byte{0, 1}, at}
+
+	data, err := encodeSpoolArgs(args)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	decoded, err := decodeSpoolArgs(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expected := []any{nil, true, int64(42), int64(-7), 1.5, "text", []byte{0, 1}, at}
+	if !reflect.DeepEqual(decoded, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, decoded)
+	}
+
+	if _, err := encodeSpoolArgs([]any{struct{}{}}); err == nil {
+		t.Fatal("expected error for unsupported type")
+	}
+}
+
+func TestIsOutage(t *testing.T) {
+	for _, err := range []error{ErrNoPrimary, ErrPrimaryRequired, fmt.Errorf("write: %w", ErrHaltContended)} {
+		if !IsOutage(err) {
+			t.Fatalf("expected outage: %s", err)
+		}
+	}
+	if IsOutage(fmt.Errorf("write: %w", context.DeadlineExceeded)) {
+		t.Fatal("expected timeouts not to be outages")
+	}
+	if IsOutage(errors.New("UNIQUE constraint failed")) {
+		t.Fatal("expected constraint error not to be an outage")
+	}
+}